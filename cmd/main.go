@@ -12,7 +12,9 @@ import (
 	"pdf_generator/internal/core/services"
 	"pdf_generator/internal/server"
 	"pdf_generator/pkg/database"
+	"pdf_generator/pkg/generator"
 	"pdf_generator/pkg/logger"
+	"pdf_generator/pkg/metrics"
 	"pdf_generator/pkg/queue"
 	"pdf_generator/pkg/version"
 )
@@ -52,6 +54,12 @@ func main() {
 	sessionRepo := repository.NewSessionRepository(db)
 	apiKeyRepo := repository.NewAPIKeyRepository(db)
 	gateRepo := repository.NewGateRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	queueControlRepo := repository.NewQueueControlRepository(db)
+	workerRepo := repository.NewWorkerRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	batchJobRepo := repository.NewBatchJobRepository(db)
+	alertRepo := repository.NewAlertRepository(db)
 
 	// Dependency injection
 	sessionExpiry := 12 * time.Hour
@@ -63,18 +71,25 @@ func main() {
 		}
 	}
 
+	// Metrics read from the database on every scrape
+	metrics.CollectTasks(taskRepo)
+	metrics.CollectSessions(sessionRepo)
+	metrics.CollectOutputDir(generator.DefaultOutputDir)
+
 	// Initialize services
 	authService := services.NewAuthService(sessionRepo, settingsRepo, sessionExpiry)
 	apiKeyService := services.NewAPIKeyService(apiKeyRepo)
 	settingsService := services.NewSettingsService(settingsRepo)
 	gateService := services.NewGateService(gateRepo)
 	processService := services.NewProcessService(settingsService)
+	alertService := services.NewAlertService(alertRepo, taskRepo, settingsService, processService, generator.DefaultOutputDir)
 
 	// Initialize Queue
-	taskQueue, err := queue.NewQueue(db, taskRepo, settingsRepo, gateRepo)
+	taskQueue, err := queue.NewQueue(db, taskRepo, settingsRepo, gateRepo, queueControlRepo)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize queue")
 	}
+	taskQueue.SetWebhookRepository(webhookRepo)
 
 	// Initialize HTTP server
 	srv := server.NewServer(
@@ -83,8 +98,13 @@ func main() {
 		settingsService,
 		gateService,
 		processService,
+		alertService,
 		taskRepo,
 		scheduleRepo,
+		idempotencyRepo,
+		workerRepo,
+		webhookRepo,
+		batchJobRepo,
 		taskQueue,
 	)
 	srv.SetupRoutes()
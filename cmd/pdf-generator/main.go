@@ -4,8 +4,10 @@ import (
 	"context"
 	"flag"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/kardianos/service"
 	"github.com/rs/zerolog"
@@ -13,16 +15,38 @@ import (
 	"gorm.io/gorm"
 
 	"pdf_generator/internal/adapters/repository"
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
 	"pdf_generator/pkg/database"
+	"pdf_generator/pkg/generator"
+	"pdf_generator/pkg/metrics"
+	"pdf_generator/pkg/progress"
 	"pdf_generator/pkg/queue"
+	"pdf_generator/pkg/remote"
+	"pdf_generator/pkg/utils"
 	"pdf_generator/pkg/version"
 )
 
+// queueWatchInterval is how often the worker checks for concurrency and pause/resume changes
+const queueWatchInterval = 3 * time.Second
+
+// reconcileInterval is how often task rows are checked against queue jobs
+const reconcileInterval = 5 * time.Minute
+
+// heartbeatInterval is how often the worker refreshes its registry entry
+const heartbeatInterval = 10 * time.Second
+
+// workerRetention is how long registry entries of workers that stopped reporting are kept
+const workerRetention = 7 * 24 * time.Hour
+
 type program struct {
-	exit    chan struct{}
-	service service.Service
-	db      *gorm.DB
-	queue   *queue.Queue
+	mode       domain.WorkerMode
+	exit       chan struct{}
+	service    service.Service
+	db         *gorm.DB
+	queue      *queue.Queue
+	workerRepo ports.WorkerRepository
+	worker     *domain.Worker
 }
 
 func (p *program) Start(s service.Service) error {
@@ -53,6 +77,14 @@ func (p *program) run() {
 	zerolog.TimeFieldFormat = "02-01-2006 15:04:05"
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: "02-01-2006 15:04:05"})
 
+	if p.mode == "" {
+		p.mode = domain.WorkerMode(os.Getenv("WORKER_MODE"))
+	}
+	if p.mode == domain.WorkerModeRemote {
+		p.runRemote()
+		return
+	}
+
 	// Initialize Database (uses default path: data/app.db)
 	// Ensure directories exist first
 	for _, dir := range []string{"data", "output", "logs"} {
@@ -69,39 +101,168 @@ func (p *program) run() {
 	settingsRepo := repository.NewSettingsRepository(p.db)
 	taskRepo := repository.NewTaskRepository(p.db)
 	gateRepo := repository.NewGateRepository(p.db)
+	queueControlRepo := repository.NewQueueControlRepository(p.db)
+	p.workerRepo = repository.NewWorkerRepository(p.db)
 
 	// Initialize Queue
-	q, err := queue.NewQueue(p.db, taskRepo, settingsRepo, gateRepo)
+	q, err := queue.NewQueue(p.db, taskRepo, settingsRepo, gateRepo, queueControlRepo)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize queue")
 		return
 	}
 	p.queue = q
 
+	// Register this process in the worker registry
+	p.worker = newWorker()
+	q.SetWorkerID(p.worker.ID)
+
+	// Push live progress to the API for SSE streaming
+	reporter := progress.NewReporter(progress.EndpointFromEnv(), utils.WorkerSecret())
+	q.SetProgressPublisher(reporter)
+
+	// Notify webhooks of final task states
+	q.SetWebhookRepository(repository.NewWebhookRepository(p.db))
+
 	// Register Consumer (This is the key difference for the worker service)
 	q.RegisterConsumers()
 
 	// Start Queue
-	q.Start(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go reporter.Run(ctx)
+
+	metrics.CollectTasks(taskRepo)
+	metrics.CollectOutputDir(generator.DefaultOutputDir)
+	serveMetrics(ctx)
+
+	// Recover tasks and jobs left behind by a previous crash before workers start
+	reconcile(ctx, q, true)
+
+	q.Start(ctx)
 	log.Info().Msg("Queue consumers started")
 
-	// Helper ticker to keep the service loop alive and log status if needed
-	ticker := time.NewTicker(10 * time.Second)
+	// Apply concurrency and pause/resume changes without a restart
+	go q.Watch(ctx, queueWatchInterval)
+
+	p.heartbeat(ctx)
+	log.Info().Str("worker_id", p.worker.ID).Msg("Worker registered")
+
+	// Heartbeat ticker keeps the worker registry entry fresh
+	ticker := time.NewTicker(heartbeatInterval)
 	defer ticker.Stop()
 
+	reconcileTicker := time.NewTicker(reconcileInterval)
+	defer reconcileTicker.Stop()
+
 	for {
 		select {
 		case <-p.exit:
+			if err := p.workerRepo.SetState(context.Background(), p.worker.ID, domain.WorkerStateStopped); err != nil {
+				log.Warn().Err(err).Msg("Failed to unregister worker")
+			}
 			return
 		case <-ticker.C:
-			// Just a heartbeat or check specific things
-			// Could be used to update a "last seen" timestamp in DB if desired
+			p.heartbeat(ctx)
+		case <-reconcileTicker.C:
+			reconcile(ctx, q, false)
+			if err := p.workerRepo.DeleteInactive(ctx, time.Now().Add(-workerRetention)); err != nil {
+				log.Warn().Err(err).Msg("Failed to prune worker registry")
+			}
 		}
 	}
 }
 
+// runRemote leases jobs from the API over HTTP instead of opening the database
+func (p *program) runRemote() {
+	apiKey := os.Getenv("WORKER_API_KEY")
+	if apiKey == "" {
+		log.Fatal().Msg("WORKER_API_KEY is required in remote mode")
+		return
+	}
+	for _, dir := range []string{"output", "logs"} {
+		os.MkdirAll(dir, 0755)
+	}
+
+	concurrency, _ := strconv.Atoi(os.Getenv("WORKER_CONCURRENCY"))
+	baseURL := progress.BaseURLFromEnv()
+	runner := remote.NewRunner(remote.NewClient(baseURL, apiKey), newWorker(), remote.Config{
+		Concurrency:        concurrency,
+		PollInterval:       queueWatchInterval,
+		RootFolder:         os.Getenv("WORKER_ROOT_FOLDER"),
+		DataSourcePassword: os.Getenv("WORKER_DATASOURCE_PASSWORD"),
+	})
+	log.Info().Str("api", baseURL).Msg("Starting remote worker")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	metrics.CollectOutputDir(generator.DefaultOutputDir)
+	serveMetrics(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+
+	<-p.exit
+	cancel()
+	<-done
+}
+
+// serveMetrics serves /metrics on WORKER_METRICS_ADDR (metrics.DefaultWorkerAddr when unset).
+// Setting it to an empty value disables the endpoint.
+func serveMetrics(ctx context.Context) {
+	addr, ok := os.LookupEnv("WORKER_METRICS_ADDR")
+	if !ok {
+		addr = metrics.DefaultWorkerAddr
+	}
+	if addr != "" {
+		go metrics.Serve(ctx, addr)
+	}
+}
+
+// newWorker describes this process for the worker registry
+func newWorker() *domain.Worker {
+	host, _ := os.Hostname()
+	return &domain.Worker{
+		ID:        uuid.New().String(),
+		Host:      host,
+		PID:       os.Getpid(),
+		Version:   version.Version,
+		Build:     version.Build,
+		Mode:      domain.WorkerModeLocal,
+		StartedAt: time.Now(),
+	}
+}
+
+// heartbeat publishes the current worker state and running tasks
+func (p *program) heartbeat(ctx context.Context) {
+	state, workers, taskIDs := p.queue.Status()
+
+	p.worker.State = domain.WorkerState(state)
+	p.worker.Concurrency = workers
+	p.worker.CurrentTasks = taskIDs
+	p.worker.LastHeartbeat = time.Now()
+	if err := p.workerRepo.Save(ctx, p.worker); err != nil {
+		log.Warn().Err(err).Msg("Failed to send worker heartbeat")
+	}
+}
+
+// reconcile aligns task rows with queue jobs and logs what was corrected
+func reconcile(ctx context.Context, q *queue.Queue, startup bool) {
+	report, err := q.Reconcile(ctx, startup)
+	if err != nil {
+		log.Error().Err(err).Msg("Queue reconciliation failed")
+		return
+	}
+	if report.Changed() {
+		log.Info().Interface("report", report).Bool("startup", startup).Msg("Queue reconciled")
+	}
+}
+
 func main() {
 	svcFlag := flag.String("service", "", "Control the system service.")
+	modeFlag := flag.String("mode", "", "Worker mode: local (shared database) or remote (lease jobs from the API). Defaults to WORKER_MODE.")
 	flag.Parse()
 
 	options := make(service.KeyValue)
@@ -118,7 +279,7 @@ func main() {
 		Option: options,
 	}
 
-	prg := &program{}
+	prg := &program{mode: domain.WorkerMode(*modeFlag)}
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create service interface")
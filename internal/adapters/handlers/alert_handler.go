@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/api"
+)
+
+// AlertHandler handles alert endpoints
+type AlertHandler struct {
+	alertRepo ports.AlertRepository
+}
+
+// NewAlertHandler creates a new alert handler
+func NewAlertHandler(alertRepo ports.AlertRepository) *AlertHandler {
+	return &AlertHandler{
+		alertRepo: alertRepo,
+	}
+}
+
+// List handles GET /alerts (Admin)
+// Newest alerts first, filtered by status (open or resolved) and rule
+func (h *AlertHandler) List(c fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	alerts, total, err := h.alertRepo.List(c.Context(), ports.AlertFilter{
+		Status: c.Query("status"),
+		Rule:   c.Query("rule"),
+		Page:   page,
+		Limit:  limit,
+	})
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to list alerts")
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	return api.Success(c, api.PaginatedResponse{
+		Items: alerts,
+		Pagination: api.Pagination{
+			Total:      total,
+			Page:       page,
+			Limit:      limit,
+			TotalPages: totalPages,
+		},
+	})
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v3"
 
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
 	"pdf_generator/internal/core/services"
 	"pdf_generator/pkg/api"
 )
@@ -10,16 +14,19 @@ import (
 // APIKeyHandler handles API key endpoints
 type APIKeyHandler struct {
 	apiKeyService *services.APIKeyService
+	taskRepo      ports.TaskRepository
 }
 
 // NewAPIKeyHandler creates a new API key handler
-func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
-	return &APIKeyHandler{apiKeyService: apiKeyService}
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService, taskRepo ports.TaskRepository) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService, taskRepo: taskRepo}
 }
 
 // CreateAPIKeyRequest represents API key creation
 type CreateAPIKeyRequest struct {
-	Name string `json:"name"`
+	Name   string `json:"name"`
+	Worker bool   `json:"worker"` // Key of a remote worker node
+	domain.APIKeyLimits
 }
 
 // List handles GET /api-keys
@@ -28,13 +35,25 @@ func (h *APIKeyHandler) List(c fiber.Ctx) error {
 	if err != nil {
 		return api.Error(c, api.CodeInternalError, "Failed to list API keys")
 	}
+
+	now := time.Now()
+	usage, err := h.taskRepo.UsageByAPIKey(c.Context(), time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to get API key usage")
+	}
+
 	// Don't expose key hash or encrypted key
 	items := make([]fiber.Map, len(keys))
 	for i, k := range keys {
+		keyUsage := usage[k.ID]
+		keyUsage.RequestsThisMinute = h.apiKeyService.RequestsThisMinute(k.ID)
 		items[i] = fiber.Map{
 			"id":         k.ID,
 			"name":       k.Name,
 			"active":     k.Active,
+			"worker":     k.Worker,
+			"limits":     k.APIKeyLimits,
+			"usage":      keyUsage,
 			"created_at": k.CreatedAt,
 		}
 	}
@@ -51,8 +70,11 @@ func (h *APIKeyHandler) Create(c fiber.Ctx) error {
 	if req.Name == "" {
 		return api.Error(c, api.CodeValidationError, "Name is required")
 	}
+	if err := req.APIKeyLimits.Validate(); err != nil {
+		return api.Error(c, api.CodeValidationError, err.Error())
+	}
 
-	key, rawKey, err := h.apiKeyService.Create(c.Context(), req.Name)
+	key, rawKey, err := h.apiKeyService.Create(c.Context(), req.Name, req.Worker, req.APIKeyLimits)
 	if err != nil {
 		return api.Error(c, api.CodeInternalError, "Failed to create API key")
 	}
@@ -62,6 +84,8 @@ func (h *APIKeyHandler) Create(c fiber.Ctx) error {
 		"name":    key.Name,
 		"api_key": rawKey,
 		"active":  key.Active,
+		"worker":  key.Worker,
+		"limits":  key.APIKeyLimits,
 	})
 }
 
@@ -85,6 +109,23 @@ func (h *APIKeyHandler) Toggle(c fiber.Ctx) error {
 	return api.Success(c, fiber.Map{"id": key.ID, "active": key.Active})
 }
 
+// UpdateLimits handles PUT /api-keys/:id/limits
+func (h *APIKeyHandler) UpdateLimits(c fiber.Ctx) error {
+	var limits domain.APIKeyLimits
+	if err := c.Bind().JSON(&limits); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	if err := limits.Validate(); err != nil {
+		return api.Error(c, api.CodeValidationError, err.Error())
+	}
+
+	key, err := h.apiKeyService.SetLimits(c.Context(), c.Params("id"), limits)
+	if err != nil {
+		return api.Error(c, api.CodeNotFound, "API key not found")
+	}
+	return api.Success(c, fiber.Map{"id": key.ID, "limits": key.APIKeyLimits})
+}
+
 // Delete handles DELETE /api-keys/:id
 func (h *APIKeyHandler) Delete(c fiber.Ctx) error {
 	id := c.Params("id")
@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/api"
+)
+
+// BatchJobHandler handles batch jobs that fan out into many tasks
+type BatchJobHandler struct {
+	jobRepo  ports.BatchJobRepository
+	taskRepo ports.TaskRepository
+	queue    ports.QueueService
+}
+
+// NewBatchJobHandler creates a new batch job handler
+func NewBatchJobHandler(jobRepo ports.BatchJobRepository, taskRepo ports.TaskRepository, queue ports.QueueService) *BatchJobHandler {
+	return &BatchJobHandler{
+		jobRepo:  jobRepo,
+		taskRepo: taskRepo,
+		queue:    queue,
+	}
+}
+
+// CreateBatchJobRequest represents a batch job request
+type CreateBatchJobRequest struct {
+	Name     string              `json:"name"`
+	Priority domain.TaskPriority `json:"priority"` // Applies to all tasks, normal by default
+	domain.BatchJobMatrix
+}
+
+// BatchJobResponse is a batch job with the aggregate state of its tasks
+type BatchJobResponse struct {
+	*domain.BatchJob
+	Status   domain.BatchJobStatus `json:"status"`
+	Progress int                   `json:"progress"` // Finished tasks in percent
+	Counts   domain.BatchJobCounts `json:"counts"`
+}
+
+// BatchJobOutput lists the files of a completed task of a batch job
+type BatchJobOutput struct {
+	TaskID       string       `json:"task_id"`
+	GateID       int          `json:"gate_id"`
+	StationID    int          `json:"station_id"`
+	Date         string       `json:"date"`
+	Files        []OutputFile `json:"files"`
+	DownloadPath string       `json:"download_path"`
+}
+
+// OutputFile is a generated file and its size in bytes
+type OutputFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Create handles POST /jobs
+func (h *BatchJobHandler) Create(c fiber.Ctx) error {
+	var req CreateBatchJobRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	req.Priority = req.Priority.OrDefault()
+	if !req.Priority.Valid() {
+		return api.Error(c, api.CodeValidationError, "Priority must be one of urgent, normal or bulk")
+	}
+	if err := req.BatchJobMatrix.Validate(); err != nil {
+		return api.Error(c, api.CodeValidationError, err.Error())
+	}
+
+	matrix := req.BatchJobMatrix
+	matrix.RootFolder = normalizeRootFolder(matrix.RootFolder)
+	children, err := matrix.Tasks(req.Priority)
+	if err != nil {
+		return api.Error(c, api.CodeValidationError, err.Error())
+	}
+	release, err := checkQuota(c, h.taskRepo, len(children), len(children))
+	if err != nil {
+		return quotaError(c, err)
+	}
+	defer release()
+
+	apiKeyID := callerAPIKeyID(c)
+	creator, creatorID := taskCreator(c)
+	tasks := make([]domain.Task, len(children))
+	for i, metadata := range children {
+		filter := metadata.Filter
+		tasks[i] = domain.Task{
+			Status:      domain.TaskStatusQueued,
+			Priority:    req.Priority,
+			Fingerprint: metadata.Fingerprint(),
+			RootFolder:  metadata.RootFolder,
+			BranchID:    metadata.BranchID,
+			GateID:      metadata.GateID,
+			StationID:   metadata.StationID,
+			Filters:     &filter,
+			Settings:    metadata.Settings,
+			APIKeyID:    apiKeyID,
+			CreatorType: creator,
+			CreatorID:   creatorID,
+			ReportDays:  filter.Days(),
+		}
+	}
+
+	job := &domain.BatchJob{
+		Name:     req.Name,
+		APIKeyID: apiKeyID,
+		Priority: req.Priority,
+		Matrix:   &matrix,
+	}
+	if err := h.jobRepo.Create(c.Context(), job, tasks); err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to create job")
+	}
+
+	if h.queue != nil {
+		for i := range tasks {
+			h.enqueue(c, &tasks[i])
+		}
+	}
+
+	return h.respond(c, job)
+}
+
+// List handles GET /jobs
+func (h *BatchJobHandler) List(c fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	jobs, total, err := h.jobRepo.List(c.Context(), ports.BatchJobFilter{
+		APIKeyID: callerAPIKeyID(c),
+		Page:     page,
+		Limit:    limit,
+	})
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to list jobs")
+	}
+
+	ids := make([]string, len(jobs))
+	for i := range jobs {
+		ids[i] = jobs[i].ID
+	}
+	counts, err := h.taskRepo.CountByParent(c.Context(), ids)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to count job tasks")
+	}
+
+	items := make([]BatchJobResponse, len(jobs))
+	for i := range jobs {
+		items[i] = newBatchJobResponse(&jobs[i], counts[jobs[i].ID])
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+	return api.Success(c, api.PaginatedResponse{
+		Items: items,
+		Pagination: api.Pagination{
+			Total:      total,
+			Page:       page,
+			Limit:      limit,
+			TotalPages: totalPages,
+		},
+	})
+}
+
+// Get handles GET /jobs/:id
+func (h *BatchJobHandler) Get(c fiber.Ctx) error {
+	job, ok := h.find(c)
+	if !ok {
+		return api.Error(c, api.CodeNotFound, "Job not found")
+	}
+	return h.respond(c, job)
+}
+
+// Cancel handles POST /jobs/:id/cancel
+// Queued tasks are cancelled, running tasks finish
+func (h *BatchJobHandler) Cancel(c fiber.Ctx) error {
+	job, ok := h.find(c)
+	if !ok {
+		return api.Error(c, api.CodeNotFound, "Job not found")
+	}
+
+	tasks, err := h.taskRepo.ListByParent(c.Context(), job.ID, domain.TaskStatusQueued, domain.TaskStatusPending)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to list job tasks")
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		task.Status = domain.TaskStatusCancelled
+		if err := h.taskRepo.Update(c.Context(), task); err != nil {
+			log.Warn().Err(err).Str("task_id", task.ID).Msg("Failed to cancel job task")
+			continue
+		}
+		if h.queue != nil {
+			h.queue.NotifyTask(c.Context(), task)
+		}
+	}
+
+	return h.respond(c, job)
+}
+
+// Retry handles POST /jobs/:id/retry
+// Failed and cancelled tasks are queued again
+func (h *BatchJobHandler) Retry(c fiber.Ctx) error {
+	job, ok := h.find(c)
+	if !ok {
+		return api.Error(c, api.CodeNotFound, "Job not found")
+	}
+	if h.queue == nil {
+		return api.Error(c, api.CodeInternalError, "Queue is not available")
+	}
+
+	tasks, err := h.taskRepo.ListByParent(c.Context(), job.ID, domain.TaskStatusFailed, domain.TaskStatusCancelled)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to list job tasks")
+	}
+	days := 0
+	for _, task := range tasks {
+		days += task.ReportDays
+	}
+	release, err := checkQuota(c, h.taskRepo, len(tasks), days)
+	if err != nil {
+		return quotaError(c, err)
+	}
+	defer release()
+
+	for i := range tasks {
+		task := &tasks[i]
+		task.ResetForRetry()
+		if err := h.taskRepo.Update(c.Context(), task); err != nil {
+			log.Warn().Err(err).Str("task_id", task.ID).Msg("Failed to retry job task")
+			continue
+		}
+		h.enqueue(c, task)
+	}
+
+	return h.respond(c, job)
+}
+
+// Outputs handles GET /jobs/:id/outputs
+// Lists the files of all completed tasks of the job
+func (h *BatchJobHandler) Outputs(c fiber.Ctx) error {
+	job, ok := h.find(c)
+	if !ok {
+		return api.Error(c, api.CodeNotFound, "Job not found")
+	}
+
+	tasks, err := h.taskRepo.ListByParent(c.Context(), job.ID, domain.TaskStatusCompleted)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to list job tasks")
+	}
+
+	items := make([]BatchJobOutput, 0, len(tasks))
+	var totalSize int64
+	for _, task := range tasks {
+		output := BatchJobOutput{
+			TaskID:       task.ID,
+			GateID:       task.GateID,
+			StationID:    task.StationID,
+			Files:        outputFiles(task.OutputFilePath),
+			DownloadPath: "/api/tasks/" + task.ID + "/download",
+		}
+		if task.Filters != nil {
+			output.Date = task.Filters.Date
+		}
+		for _, file := range output.Files {
+			totalSize += file.Size
+		}
+		items = append(items, output)
+	}
+
+	return api.Success(c, fiber.Map{
+		"job_id":     job.ID,
+		"items":      items,
+		"total_size": totalSize,
+		"missing":    job.TotalTasks - len(items),
+	})
+}
+
+// find loads the job of the :id parameter. API keys only see their own jobs.
+func (h *BatchJobHandler) find(c fiber.Ctx) (*domain.BatchJob, bool) {
+	job, err := h.jobRepo.GetByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return nil, false
+	}
+	if caller := callerAPIKeyID(c); caller != "" && job.APIKeyID != caller {
+		return nil, false
+	}
+	return job, true
+}
+
+// enqueue adds a task of the job to the queue and fails it when that is not possible
+func (h *BatchJobHandler) enqueue(c fiber.Ctx, task *domain.Task) {
+	if _, err := h.queue.Enqueue(c.Context(), task.ID, task.Metadata()); err != nil {
+		log.Error().Err(err).Str("task_id", task.ID).Msg("Failed to enqueue job task")
+		h.taskRepo.UpdateError(c.Context(), task.ID, domain.TaskErrorInternal, "Failed to enqueue task: "+err.Error())
+	}
+}
+
+// respond returns the job with the current counts of its tasks
+func (h *BatchJobHandler) respond(c fiber.Ctx, job *domain.BatchJob) error {
+	counts, err := h.taskRepo.CountByParent(c.Context(), []string{job.ID})
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to count job tasks")
+	}
+	return api.Success(c, newBatchJobResponse(job, counts[job.ID]))
+}
+
+func newBatchJobResponse(job *domain.BatchJob, counts domain.BatchJobCounts) BatchJobResponse {
+	return BatchJobResponse{
+		BatchJob: job,
+		Status:   counts.Status(),
+		Progress: counts.Progress(),
+		Counts:   counts,
+	}
+}
+
+// outputFiles lists the files of a task's comma separated output paths that still exist
+func outputFiles(paths string) []OutputFile {
+	files := []OutputFile{}
+	for _, path := range outputPaths(paths) {
+		if info, err := os.Stat(path); err == nil {
+			files = append(files, OutputFile{Name: filepath.Base(path), Size: info.Size()})
+		}
+	}
+	return files
+}
+
+// outputPaths splits a task's comma separated output paths, resolving relative ones against the output directory
+func outputPaths(paths string) []string {
+	var resolved []string
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join("output", path)
+		}
+		resolved = append(resolved, path)
+	}
+	return resolved
+}
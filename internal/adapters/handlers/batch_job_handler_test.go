@@ -0,0 +1,186 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"pdf_generator/internal/adapters/handlers"
+	"pdf_generator/internal/adapters/repository"
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+)
+
+type batchJobResult struct {
+	Data struct {
+		ID         string                `json:"id"`
+		TotalTasks int                   `json:"total_tasks"`
+		Status     domain.BatchJobStatus `json:"status"`
+		Progress   int                   `json:"progress"`
+		Counts     domain.BatchJobCounts `json:"counts"`
+	} `json:"data"`
+}
+
+func TestBatchJobHandler(t *testing.T) {
+	db := newTestDB(t, "batch_jobs")
+
+	ctx := context.Background()
+	taskRepo := repository.NewTaskRepository(db)
+	queue := new(MockQueue)
+	queue.On("Enqueue", mock.Anything, mock.Anything, mock.Anything).Return([]string{"job"}, nil)
+	queue.On("NotifyTask", mock.Anything, mock.Anything).Return()
+
+	h := handlers.NewBatchJobHandler(repository.NewBatchJobRepository(db), taskRepo, queue)
+	app := fiber.New()
+	app.Post("/jobs", h.Create)
+	app.Get("/jobs/:id", h.Get)
+	app.Post("/jobs/:id/cancel", h.Cancel)
+	app.Post("/jobs/:id/retry", h.Retry)
+
+	call := func(method, path, body string) batchJobResult {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		var result batchJobResult
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+
+	// 2 gates x 2 stations x 3 days
+	created := call("POST", "/jobs", `{"name":"audit","branch_id":1,"gate_ids":[1,2],"station_ids":[3,4],
+		"date_from":"2025-12-01","date_to":"2025-12-03","filter":{"transaction_status":"periodic"},"priority":"bulk"}`)
+	job := created.Data
+	assert.Equal(t, 12, job.TotalTasks)
+	assert.Equal(t, domain.BatchJobStatusRunning, job.Status)
+	assert.Equal(t, int64(12), job.Counts.Queued)
+	queue.AssertNumberOfCalls(t, "Enqueue", 12)
+
+	tasks, err := taskRepo.ListByParent(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 12)
+	assert.Equal(t, "2025-12-01", tasks[0].Filters.Date)
+	assert.Equal(t, "periodic", tasks[0].Filters.TransactionStatus)
+	assert.Equal(t, domain.TaskPriorityBulk, tasks[0].Priority)
+	assert.Equal(t, tasks[0].GateID, *tasks[0].Filters.GateID)
+
+	// Children finish in different ways
+	tasks[0].Status = domain.TaskStatusCompleted
+	tasks[1].Status = domain.TaskStatusFailed
+	tasks[2].Status = domain.TaskStatusRunning
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, taskRepo.Update(ctx, &tasks[i]))
+	}
+
+	// Cancelling leaves running tasks alone
+	cancelled := call("POST", "/jobs/"+job.ID+"/cancel", "").Data
+	assert.Equal(t, domain.BatchJobCounts{Total: 12, Running: 1, Completed: 1, Failed: 1, Cancelled: 9}, cancelled.Counts)
+	assert.Equal(t, domain.BatchJobStatusRunning, cancelled.Status)
+	queue.AssertNumberOfCalls(t, "NotifyTask", 9)
+
+	tasks[2].Status = domain.TaskStatusCompleted
+	assert.NoError(t, taskRepo.Update(ctx, &tasks[2]))
+	finished := call("GET", "/jobs/"+job.ID, "").Data
+	assert.Equal(t, domain.BatchJobStatusPartial, finished.Status)
+	assert.Equal(t, 100, finished.Progress)
+
+	// Failed and cancelled tasks are queued again
+	retried := call("POST", "/jobs/"+job.ID+"/retry", "").Data
+	assert.Equal(t, domain.BatchJobCounts{Total: 12, Queued: 10, Completed: 2}, retried.Counts)
+	queue.AssertNumberOfCalls(t, "Enqueue", 22)
+
+	failed, err := taskRepo.GetByID(ctx, tasks[1].ID)
+	assert.NoError(t, err)
+	assert.Empty(t, failed.JobID)
+	assert.Empty(t, failed.ErrorMessage)
+
+	// Children are listed through the task list
+	children, total, err := taskRepo.List(ctx, ports.TaskFilter{ParentID: job.ID, Limit: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), total)
+	assert.Len(t, children, 12)
+}
+
+func TestBatchJobHandler_Quota(t *testing.T) {
+	db := newTestDB(t, "batch_job_quota")
+
+	ctx := context.Background()
+	taskRepo := repository.NewTaskRepository(db)
+	key := &domain.APIKey{ID: "key-1", APIKeyLimits: domain.APIKeyLimits{MaxQueuedTasks: 5, DailyReportDays: 4}}
+
+	// An active task and a cancelled one that does not count towards the report days
+	assert.NoError(t, taskRepo.Create(ctx, &domain.Task{Status: domain.TaskStatusQueued, APIKeyID: key.ID, ReportDays: 1}))
+	assert.NoError(t, taskRepo.Create(ctx, &domain.Task{Status: domain.TaskStatusCancelled, APIKeyID: key.ID, ReportDays: 10}))
+
+	h := handlers.NewBatchJobHandler(repository.NewBatchJobRepository(db), taskRepo, nil)
+	app := fiber.New()
+	app.Post("/jobs", func(c fiber.Ctx) error {
+		c.Locals("auth_type", "api_key")
+		c.Locals("api_key_id", key.ID)
+		c.Locals("api_key", key)
+		return c.Next()
+	}, h.Create)
+
+	post := func(dateTo string) int {
+		req := httptest.NewRequest("POST", "/jobs", strings.NewReader(`{"station_ids":[1],"date_from":"2025-12-01","date_to":"`+dateTo+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// 1 + 4 days exceeds the daily cap of 4
+	assert.Equal(t, 429, post("2025-12-04"))
+	assert.Equal(t, 200, post("2025-12-03"))
+
+	usage, err := taskRepo.UsageByAPIKey(ctx, time.Now().Add(-time.Hour), key.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.APIKeyUsage{ActiveTasks: 4, ReportDaysToday: 4}, usage[key.ID])
+
+	// Without the daily cap the limit of 5 queued tasks still applies
+	key.DailyReportDays = 0
+	assert.Equal(t, 200, post("2025-12-01"))
+	assert.Equal(t, 429, post("2025-12-01"))
+
+	// Concurrent requests cannot all pass the check before any of them created its tasks
+	key.MaxQueuedTasks = 7
+	statuses := make(chan int, 5)
+	for range 5 {
+		go func() { statuses <- post("2025-12-01") }()
+	}
+	accepted := 0
+	for range 5 {
+		if <-statuses == 200 {
+			accepted++
+		}
+	}
+	assert.Equal(t, 2, accepted)
+}
+
+func TestBatchJobHandler_Validation(t *testing.T) {
+	h := handlers.NewBatchJobHandler(nil, new(MockTaskRepo), nil)
+	app := fiber.New()
+	app.Post("/jobs", h.Create)
+
+	for name, body := range map[string]string{
+		"no gates or stations": `{"date_from":"2025-12-01","date_to":"2025-12-01"}`,
+		"reversed range":       `{"station_ids":[1],"date_from":"2025-12-02","date_to":"2025-12-01"}`,
+		"invalid gate":         `{"gate_ids":[101],"date_from":"2025-12-01","date_to":"2025-12-01"}`,
+		"too many tasks":       `{"gate_ids":[1,2,3,4,5,6,7,8,9,10],"station_ids":[1,2,3,4],"date_from":"2025-01-01","date_to":"2025-12-31"}`,
+	} {
+		req := httptest.NewRequest("POST", "/jobs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode, name)
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v3"
+
+	"pdf_generator/pkg/metrics"
+)
+
+// MetricsHandler serves metrics in the Prometheus text format
+type MetricsHandler struct {
+	registry *metrics.Registry
+	token    string
+}
+
+// NewMetricsHandler creates a new metrics handler. When token is set, scrapes must send it as a bearer token.
+func NewMetricsHandler(registry *metrics.Registry, token string) *MetricsHandler {
+	return &MetricsHandler{
+		registry: registry,
+		token:    token,
+	}
+}
+
+// Get handles GET /metrics
+func (h *MetricsHandler) Get(c fiber.Ctx) error {
+	if !metrics.Authorized(c.Get(fiber.HeaderAuthorization), h.token) {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	c.Set(fiber.HeaderContentType, metrics.ContentType)
+	return h.registry.Write(c.Context(), c.Response().BodyWriter())
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/api"
+	"pdf_generator/pkg/progress"
+)
+
+// ProgressHandler receives live task progress pushed by worker processes
+type ProgressHandler struct {
+	publisher ports.ProgressPublisher
+	secret    string
+}
+
+// NewProgressHandler creates a new progress handler verifying requests with the worker secret.
+// Every request is refused when the secret is empty
+func NewProgressHandler(publisher ports.ProgressPublisher, secret string) *ProgressHandler {
+	return &ProgressHandler{
+		publisher: publisher,
+		secret:    secret,
+	}
+}
+
+// Publish handles POST /internal/progress (Worker)
+func (h *ProgressHandler) Publish(c fiber.Ctx) error {
+	if h.secret == "" {
+		return api.Error(c, api.CodeHMACMismatch, "Worker secret not configured")
+	}
+	body := c.Body()
+	if !progress.Verify(body, c.Get(progress.TimestampHeader), c.Get("X-Signature"), h.secret, time.Now()) {
+		return api.Error(c, api.CodeHMACMismatch, "Invalid or expired signature")
+	}
+
+	var event ports.ProgressEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.TaskID == "" {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid progress event")
+	}
+
+	h.publisher.Publish(event)
+	return api.Success(c, nil)
+}
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/internal/core/services"
+	"pdf_generator/pkg/api"
+)
+
+// RemoteWorkerHandler implements the protocol used by worker nodes that lease
+// jobs over HTTP instead of opening the database
+type RemoteWorkerHandler struct {
+	queue        ports.QueueService
+	taskRepo     ports.TaskRepository
+	workerRepo   ports.WorkerRepository
+	settingsRepo ports.SettingsRepository
+	gateService  *services.GateService
+	publisher    ports.ProgressPublisher
+	outputDir    string
+}
+
+// NewRemoteWorkerHandler creates a new remote worker handler storing uploads in outputDir
+func NewRemoteWorkerHandler(
+	queue ports.QueueService,
+	taskRepo ports.TaskRepository,
+	workerRepo ports.WorkerRepository,
+	settingsRepo ports.SettingsRepository,
+	gateService *services.GateService,
+	publisher ports.ProgressPublisher,
+	outputDir string,
+) *RemoteWorkerHandler {
+	return &RemoteWorkerHandler{
+		queue:        queue,
+		taskRepo:     taskRepo,
+		workerRepo:   workerRepo,
+		settingsRepo: settingsRepo,
+		gateService:  gateService,
+		publisher:    publisher,
+		outputDir:    outputDir,
+	}
+}
+
+// HeartbeatRequest registers the worker and lists the tasks it is processing
+type HeartbeatRequest struct {
+	ID           string             `json:"id"`
+	Host         string             `json:"host"`
+	PID          int                `json:"pid"`
+	Version      string             `json:"version"`
+	Build        string             `json:"build"`
+	Concurrency  int                `json:"concurrency"`
+	State        domain.WorkerState `json:"state"`
+	CurrentTasks []string           `json:"current_tasks"`
+	StartedAt    time.Time          `json:"started_at"`
+}
+
+// LeaseRequest asks for the next job
+type LeaseRequest struct {
+	WorkerID string `json:"worker_id"`
+}
+
+// LeaseProgressRequest reports the progress of a leased task
+type LeaseProgressRequest struct {
+	WorkerID string `json:"worker_id"`
+	Stage    string `json:"stage"`
+	Current  int    `json:"current"`
+	Total    int    `json:"total"`
+}
+
+// LeaseFailRequest reports a failed attempt of a leased task
+type LeaseFailRequest struct {
+	WorkerID  string               `json:"worker_id"`
+	Error     string               `json:"error"`
+	ErrorCode domain.TaskErrorCode `json:"error_code"` // Workers without error codes report internal errors
+}
+
+// Heartbeat handles POST /worker/heartbeat (Remote Worker)
+// Registers the worker and renews the leases of its current tasks. Tasks whose lease
+// was lost are returned so the worker can abandon them.
+func (h *RemoteWorkerHandler) Heartbeat(c fiber.Ctx) error {
+	var req HeartbeatRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	if req.ID == "" {
+		return api.Error(c, api.CodeValidationError, "id is required")
+	}
+
+	ctx := c.Context()
+	now := time.Now()
+	if req.State == "" {
+		req.State = domain.WorkerStateRunning
+	}
+	if req.StartedAt.IsZero() {
+		req.StartedAt = now
+	}
+	worker := &domain.Worker{
+		ID:            req.ID,
+		Host:          req.Host,
+		PID:           req.PID,
+		Version:       req.Version,
+		Build:         req.Build,
+		Concurrency:   req.Concurrency,
+		State:         req.State,
+		Mode:          domain.WorkerModeRemote,
+		CurrentTasks:  req.CurrentTasks,
+		StartedAt:     req.StartedAt,
+		LastHeartbeat: now,
+	}
+	if err := h.workerRepo.Save(ctx, worker); err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to register worker")
+	}
+
+	lost := []string{}
+	for _, taskID := range req.CurrentTasks {
+		if _, err := h.queue.RenewLease(ctx, taskID, req.ID, callerAPIKeyID(c), domain.WorkerLeaseTTL); err != nil {
+			log.Warn().Err(err).Str("task_id", taskID).Str("worker_id", req.ID).Msg("Failed to renew task lease")
+			lost = append(lost, taskID)
+		}
+	}
+
+	return api.Success(c, fiber.Map{
+		"lease_ttl": domain.WorkerLeaseTTL.Seconds(),
+		"lost":      lost,
+	})
+}
+
+// Lease handles POST /worker/lease (Remote Worker)
+// Returns the next job together with the settings and gates needed to render it,
+// or a null lease when nothing is ready
+func (h *RemoteWorkerHandler) Lease(c fiber.Ctx) error {
+	var req LeaseRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	if req.WorkerID == "" {
+		return api.Error(c, api.CodeValidationError, "worker_id is required")
+	}
+
+	ctx := c.Context()
+	if setting, err := h.settingsRepo.Get(ctx, domain.SettingWorkerMode); err != nil || domain.WorkerMode(setting.Value) != domain.WorkerModeRemote {
+		return api.Error(c, api.CodeValidationError, "Remote workers are disabled, set worker_mode to remote")
+	}
+
+	lease, err := h.queue.Lease(ctx, req.WorkerID, callerAPIKeyID(c), domain.WorkerLeaseTTL)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to lease task")
+	}
+	if lease == nil {
+		return api.Success(c, fiber.Map{"lease": nil})
+	}
+
+	all, err := h.settingsRepo.GetAll(ctx)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to load settings")
+	}
+	settings := make(map[string]string, len(all))
+	for _, s := range all {
+		if !s.Secret() {
+			settings[s.Key] = s.Value
+		}
+	}
+
+	gates, _, err := h.gateService.List(ctx, ports.GateFilter{})
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to load gates")
+	}
+
+	h.publish(ports.ProgressEvent{TaskID: lease.TaskID, Status: domain.TaskStatusRunning, Stage: "Leased by remote worker"})
+
+	return api.Success(c, fiber.Map{
+		"lease":    lease,
+		"settings": settings,
+		"gates":    gates,
+	})
+}
+
+// Progress handles POST /worker/tasks/:id/progress (Remote Worker)
+// Stores the progress, renews the lease and forwards it to SSE subscribers
+func (h *RemoteWorkerHandler) Progress(c fiber.Ctx) error {
+	id := c.Params("id")
+	var req LeaseProgressRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+
+	ctx := c.Context()
+	expiresAt, err := h.queue.RenewLease(ctx, id, req.WorkerID, callerAPIKeyID(c), domain.WorkerLeaseTTL)
+	if err != nil {
+		return leaseError(c, err)
+	}
+	if err := h.taskRepo.UpdateProgress(ctx, id, req.Stage, req.Current, req.Total); err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to update progress")
+	}
+
+	h.publish(ports.ProgressEvent{
+		TaskID:  id,
+		Status:  domain.TaskStatusRunning,
+		Stage:   req.Stage,
+		Current: req.Current,
+		Total:   req.Total,
+	})
+	return api.Success(c, fiber.Map{"lease_expires_at": expiresAt})
+}
+
+// Complete handles POST /worker/tasks/:id/complete (Remote Worker)
+// Multipart form with worker_id and one or more PDF files in "files"
+func (h *RemoteWorkerHandler) Complete(c fiber.Ctx) error {
+	id := c.Params("id")
+	form, err := c.MultipartForm()
+	if err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid multipart form")
+	}
+
+	workerID := ""
+	if values := form.Value["worker_id"]; len(values) > 0 {
+		workerID = values[0]
+	}
+	files := form.File["files"]
+	if workerID == "" || len(files) == 0 {
+		return api.Error(c, api.CodeValidationError, "worker_id and at least one file are required")
+	}
+
+	// Check the lease before writing anything to the output directory
+	if _, err := h.queue.RenewLease(c.Context(), id, workerID, callerAPIKeyID(c), domain.WorkerLeaseTTL); err != nil {
+		return leaseError(c, err)
+	}
+
+	// Uploads are stored in a directory of the leased task, so a worker cannot replace
+	// the output of another task. Files left there by an earlier attempt are replaced.
+	outputDir, err := filepath.Abs(filepath.Join(h.outputDir, id))
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Invalid output directory")
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to create output directory")
+	}
+
+	var paths []string
+	var size int64
+	names := make(map[string]bool, len(files))
+	for _, file := range files {
+		name := uploadName(file.Filename)
+		if !strings.EqualFold(filepath.Ext(name), ".pdf") {
+			removeFiles(paths)
+			return api.Error(c, api.CodeValidationError, "Only PDF files can be uploaded")
+		}
+		if names[strings.ToLower(name)] {
+			removeFiles(paths)
+			return api.Error(c, api.CodeValidationError, "Uploaded file names must be unique")
+		}
+		names[strings.ToLower(name)] = true
+		dst := filepath.Join(outputDir, name)
+		if err := c.SaveFile(file, dst); err != nil {
+			removeFiles(paths)
+			return api.Error(c, api.CodeInternalError, "Failed to store output file")
+		}
+		paths = append(paths, dst)
+		size += file.Size
+	}
+
+	// Multi-date tasks store comma-separated paths, the same as local workers
+	if err := h.queue.CompleteLease(c.Context(), id, workerID, callerAPIKeyID(c), strings.Join(paths, ","), size); err != nil {
+		removeFiles(paths)
+		return leaseError(c, err)
+	}
+
+	h.publish(ports.ProgressEvent{
+		TaskID:     id,
+		Status:     domain.TaskStatusCompleted,
+		Stage:      "Completed",
+		OutputSize: size,
+	})
+	return api.Success(c, fiber.Map{"id": id, "status": domain.TaskStatusCompleted, "output_file_size": size})
+}
+
+// Fail handles POST /worker/tasks/:id/fail (Remote Worker)
+// The task is queued for a retry while attempts are left and the error is not permanent,
+// otherwise it is failed
+func (h *RemoteWorkerHandler) Fail(c fiber.Ctx) error {
+	id := c.Params("id")
+	var req LeaseFailRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	if req.Error == "" {
+		req.Error = "remote worker failed without an error message"
+	}
+	if !req.ErrorCode.IsValid() {
+		req.ErrorCode = domain.TaskErrorInternal
+	}
+
+	status, err := h.queue.FailLease(c.Context(), id, req.WorkerID, callerAPIKeyID(c), req.ErrorCode, req.Error)
+	if err != nil {
+		return leaseError(c, err)
+	}
+
+	h.publish(ports.ProgressEvent{TaskID: id, Status: status, ErrorMessage: req.Error, ErrorCode: req.ErrorCode})
+	return api.Success(c, fiber.Map{"id": id, "status": status})
+}
+
+func (h *RemoteWorkerHandler) publish(event ports.ProgressEvent) {
+	if h.publisher == nil {
+		return
+	}
+	event.Time = time.Now()
+	h.publisher.Publish(event)
+}
+
+// leaseError maps errors of lease operations to API errors
+func leaseError(c fiber.Ctx, err error) error {
+	if errors.Is(err, ports.ErrLeaseLost) {
+		return api.Error(c, api.CodeLeaseLost, err.Error())
+	}
+	return api.Error(c, api.CodeInternalError, "Failed to update leased task")
+}
+
+// uploadName returns the file name of an upload without any directory, whichever separator the worker uses
+func uploadName(filename string) string {
+	return path.Base(strings.ReplaceAll(filename, "\\", "/"))
+}
+
+// removeFiles deletes uploads that could not be attached to a task
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Failed to remove uploaded file")
+		}
+	}
+}
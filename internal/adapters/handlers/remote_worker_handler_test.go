@@ -0,0 +1,66 @@
+package handlers_test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"pdf_generator/internal/adapters/handlers"
+)
+
+// uploadForm builds the multipart upload of a remote worker from name and content pairs
+func uploadForm(t *testing.T, files ...[2]string) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	assert.NoError(t, w.WriteField("worker_id", "worker-1"))
+	for _, file := range files {
+		part, err := w.CreateFormFile("files", file[0])
+		assert.NoError(t, err)
+		part.Write([]byte(file[1]))
+	}
+	assert.NoError(t, w.Close())
+	return &body, w.FormDataContentType()
+}
+
+func TestRemoteWorkerHandler_Complete(t *testing.T) {
+	outputDir := t.TempDir()
+	other := filepath.Join(outputDir, "report.pdf")
+	assert.NoError(t, os.WriteFile(other, []byte("other task"), 0644))
+
+	mockQueue := new(MockQueue)
+	mockQueue.On("RenewLease", mock.Anything, mock.Anything, "worker-1", "", mock.Anything).Return(time.Now(), nil)
+	mockQueue.On("CompleteLease", mock.Anything, "task-1", "worker-1", "", mock.Anything, int64(9)).Return(nil)
+
+	h := handlers.NewRemoteWorkerHandler(mockQueue, nil, nil, nil, nil, nil, outputDir)
+	app := fiber.New()
+	app.Post("/worker/tasks/:id/complete", h.Complete)
+
+	complete := func(taskID string, files ...[2]string) int {
+		body, contentType := uploadForm(t, files...)
+		req := httptest.NewRequest("POST", "/worker/tasks/"+taskID+"/complete", body)
+		req.Header.Set("Content-Type", contentType)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// The name chosen by the worker cannot leave the directory of its task
+	assert.Equal(t, 200, complete("task-1", [2]string{`..\report.pdf`, "task 1..."}))
+	content, _ := os.ReadFile(filepath.Join(outputDir, "task-1", "report.pdf"))
+	assert.Equal(t, "task 1...", string(content))
+	content, _ = os.ReadFile(other)
+	assert.Equal(t, "other task", string(content))
+	mockQueue.AssertCalled(t, "CompleteLease", mock.Anything, "task-1", "worker-1", "", filepath.Join(outputDir, "task-1", "report.pdf"), int64(9))
+
+	assert.Equal(t, 400, complete("task-2", [2]string{"a.pdf", "1"}, [2]string{"A.PDF", "2"}))
+	assert.Equal(t, 400, complete("task-2", [2]string{"report.exe", "1"}))
+	assert.NoFileExists(t, filepath.Join(outputDir, "task-2", "a.pdf"))
+}
@@ -28,7 +28,7 @@ type CreateScheduleRequest struct {
 
 // List handles GET /schedules
 func (h *ScheduleHandler) List(c fiber.Ctx) error {
-	schedules, err := h.scheduleRepo.List(c.Context())
+	schedules, err := h.scheduleRepo.List(c.Context(), callerAPIKeyID(c))
 	if err != nil {
 		return api.Error(c, api.CodeInternalError, "Failed to list schedules")
 	}
@@ -45,6 +45,11 @@ func (h *ScheduleHandler) Create(c fiber.Ctx) error {
 	if req.Cron == "" {
 		return api.Error(c, api.CodeValidationError, "Cron expression required")
 	}
+	if req.TaskPayload.Email != nil {
+		if err := req.TaskPayload.Email.Validate(); err != nil {
+			return api.Error(c, api.CodeValidationError, err.Error())
+		}
+	}
 
 	payloadJSON, _ := json.Marshal(req.TaskPayload)
 
@@ -52,6 +57,7 @@ func (h *ScheduleHandler) Create(c fiber.Ctx) error {
 		Cron:        req.Cron,
 		TaskPayload: string(payloadJSON),
 		Active:      true,
+		APIKeyID:    callerAPIKeyID(c),
 	}
 
 	if err := h.scheduleRepo.Create(c.Context(), schedule); err != nil {
@@ -69,6 +75,11 @@ func (h *ScheduleHandler) Create(c fiber.Ctx) error {
 // Delete handles DELETE /schedules/:id
 func (h *ScheduleHandler) Delete(c fiber.Ctx) error {
 	id := c.Params("id")
+	if caller := callerAPIKeyID(c); caller != "" {
+		if schedule, err := h.scheduleRepo.GetByID(c.Context(), id); err != nil || schedule.APIKeyID != caller {
+			return api.Error(c, api.CodeNotFound, "Schedule not found")
+		}
+	}
 	if err := h.scheduleRepo.Delete(c.Context(), id); err != nil {
 		return api.Error(c, api.CodeNotFound, "Schedule not found")
 	}
@@ -1,12 +1,23 @@
 package handlers
 
 import (
+	"errors"
+	"path/filepath"
+
 	"github.com/gofiber/fiber/v3"
 
+	"pdf_generator/internal/core/domain"
 	"pdf_generator/internal/core/services"
 	"pdf_generator/pkg/api"
+	"pdf_generator/pkg/datasource"
+	"pdf_generator/pkg/generator"
+	"pdf_generator/pkg/mailer"
+	"pdf_generator/pkg/utils"
 )
 
+// secretMask replaces the value of secret settings in responses. Submitting it back keeps the stored secret.
+const secretMask = "********"
+
 // SettingsHandler handles settings endpoints
 type SettingsHandler struct {
 	settingsService *services.SettingsService
@@ -23,12 +34,27 @@ type UpdateSettingRequest struct {
 	Value string `json:"value"`
 }
 
+// TestEmailRequest represents an SMTP test
+type TestEmailRequest struct {
+	To string `json:"to"`
+}
+
+// TestDataSourceRequest represents an Access driver diagnosis
+type TestDataSourceRequest struct {
+	Path string `json:"path"`
+}
+
 // GetAll handles GET /settings
 func (h *SettingsHandler) GetAll(c fiber.Ctx) error {
 	settings, err := h.settingsService.GetAll(c.Context())
 	if err != nil {
 		return api.Error(c, api.CodeInternalError, "Failed to get settings")
 	}
+	for i := range settings {
+		if settings[i].Secret() && settings[i].Value != "" {
+			settings[i].Value = secretMask
+		}
+	}
 	return api.Success(c, fiber.Map{"settings": settings})
 }
 
@@ -42,10 +68,87 @@ func (h *SettingsHandler) Update(c fiber.Ctx) error {
 	if req.Key == "" {
 		return api.Error(c, api.CodeValidationError, "Key is required")
 	}
+	if req.Key == domain.SettingSMTPTLS && !domain.SMTPTLSMode(req.Value).Valid() {
+		return api.Error(c, api.CodeValidationError, "smtp_tls must be one of starttls, tls or none")
+	}
+	if req.Key == domain.SettingWebhookAllowedHosts {
+		if _, err := utils.ParseAddressPolicy(req.Value); err != nil {
+			return api.Error(c, api.CodeValidationError, "webhook_allowed_hosts: "+err.Error())
+		}
+	}
+	if req.Key == domain.SettingDataSourceDrivers {
+		if _, err := datasource.ParseDriverAttempts(req.Value); err != nil {
+			return api.Error(c, api.CodeValidationError, "datasource_drivers: "+err.Error())
+		}
+	}
 
-	if err := h.settingsService.Set(c.Context(), req.Key, req.Value); err != nil {
-		return api.Error(c, api.CodeInternalError, "Failed to update setting")
+	if req.Value != secretMask {
+		if err := h.settingsService.Set(c.Context(), req.Key, req.Value); err != nil {
+			return api.Error(c, api.CodeInternalError, "Failed to update setting")
+		}
 	}
 
+	if h.settingsService.IsSecret(req.Key) && req.Value != "" {
+		req.Value = secretMask
+	}
 	return api.Success(c, fiber.Map{"key": req.Key, "value": req.Value})
 }
+
+// TestEmail handles POST /settings/email/test
+// Sends a test email with the current SMTP settings
+func (h *SettingsHandler) TestEmail(c fiber.Ctx) error {
+	var req TestEmailRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	email := domain.EmailRequest{To: []string{req.To}}
+	if err := email.Validate(); err != nil {
+		return api.Error(c, api.CodeValidationError, err.Error())
+	}
+
+	cfg, err := mailer.LoadConfig(c.Context(), h.settingsService.GetRepo())
+	if err != nil {
+		if errors.Is(err, mailer.ErrNotConfigured) {
+			return api.Error(c, api.CodeValidationError, err.Error())
+		}
+		return api.Error(c, api.CodeInternalError, err.Error())
+	}
+
+	err = mailer.Send(c.Context(), cfg, mailer.Message{
+		To:      email.To,
+		Subject: "DataLane SMTP test",
+		Body:    "This is a test email from DataLane. Report emails will be sent with these settings.",
+	})
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to send test email: "+err.Error())
+	}
+	return api.Success(c, fiber.Map{"to": req.To, "host": cfg.Host, "port": cfg.Port})
+}
+
+// TestDataSource handles POST /settings/datasource/test
+// Tries every configured Access driver on a file and reports which one connects
+func (h *SettingsHandler) TestDataSource(c fiber.Ctx) error {
+	var req TestDataSourceRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	if req.Path == "" {
+		return api.Error(c, api.CodeValidationError, "Path is required")
+	}
+
+	snapshot, err := generator.LoadSnapshot(c.Context(), h.settingsService.GetRepo(), nil)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to load settings")
+	}
+
+	report, err := generator.DiagnoseDataSource(c.Context(), snapshot, filepath.FromSlash(req.Path))
+	switch {
+	case errors.Is(err, datasource.ErrDataSourceMissing):
+		return api.Error(c, api.CodeNotFound, "Data source file not found")
+	case errors.Is(err, generator.ErrInvalidInput):
+		return api.Error(c, api.CodeValidationError, err.Error())
+	case err != nil:
+		return api.Error(c, api.CodeInternalError, "Failed to test data source: "+err.Error())
+	}
+	return api.Success(c, report)
+}
@@ -10,20 +10,28 @@ import (
 	"github.com/gofiber/fiber/v3"
 	"github.com/valyala/fasthttp"
 
+	"pdf_generator/internal/core/domain"
 	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/api"
 )
 
 // SSEHandler handles Server-Sent Events
 type SSEHandler struct {
-	taskRepo ports.TaskRepository
-	queue    ports.QueueService
+	taskRepo   ports.TaskRepository
+	workerRepo ports.WorkerRepository
+	queue      ports.QueueService
+	progress   ports.ProgressSubscriber
+	alertRepo  ports.AlertRepository
 }
 
 // NewSSEHandler creates a new SSE handler
-func NewSSEHandler(taskRepo ports.TaskRepository, queue ports.QueueService) *SSEHandler {
+func NewSSEHandler(taskRepo ports.TaskRepository, workerRepo ports.WorkerRepository, queue ports.QueueService, progress ports.ProgressSubscriber, alertRepo ports.AlertRepository) *SSEHandler {
 	return &SSEHandler{
-		taskRepo: taskRepo,
-		queue:    queue,
+		taskRepo:   taskRepo,
+		workerRepo: workerRepo,
+		queue:      queue,
+		progress:   progress,
+		alertRepo:  alertRepo,
 	}
 }
 
@@ -38,6 +46,9 @@ func (h *SSEHandler) GlobalEvents(c fiber.Ctx) error {
 		ticker := time.NewTicker(2 * time.Second)
 		defer ticker.Stop()
 
+		// Open alerts are only sent when they changed
+		var lastAlertsJSON string
+
 		for {
 			// Check if client disconnected by writing a ping or just checking error on Flush?
 			// fasthttp loop ends when this function returns.
@@ -53,7 +64,15 @@ func (h *SSEHandler) GlobalEvents(c fiber.Ctx) error {
 				queueSize, _ := h.taskRepo.CountByStatus(ctx, "queued")
 				runningCount, _ := h.taskRepo.CountByStatus(ctx, "running")
 
-				data := fmt.Sprintf(`{"queue_size":%d,"running_tasks":%d}`, queueSize, runningCount)
+				// Pause/resume state as reported by the worker service
+				queueState, workers := domain.QueueStateRunning, 0
+				if h.queue != nil {
+					if control, err := h.queue.Control(ctx); err == nil {
+						queueState, workers = control.State, control.Workers
+					}
+				}
+
+				data := fmt.Sprintf(`{"queue_size":%d,"running_tasks":%d,"queue_state":%q,"workers":%d}`, queueSize, runningCount, queueState, workers)
 				
 				_, err := fmt.Fprintf(w, "event: global_stats\n")
 				if err != nil {
@@ -64,6 +83,29 @@ func (h *SSEHandler) GlobalEvents(c fiber.Ctx) error {
 					return
 				}
 				
+				// Registered workers, stale ones are flagged
+				if h.workerRepo != nil {
+					if workers, err := h.workerRepo.List(ctx); err == nil {
+						workersJSON, _ := json.Marshal(workers)
+						fmt.Fprintf(w, "event: workers\n")
+						fmt.Fprintf(w, "data: %s\n\n", workersJSON)
+					}
+				}
+
+				if h.alertRepo != nil {
+					if alerts, err := h.alertRepo.ListOpen(ctx); err == nil {
+						if alerts == nil {
+							alerts = []domain.Alert{}
+						}
+						alertsJSON, _ := json.Marshal(alerts)
+						if string(alertsJSON) != lastAlertsJSON {
+							lastAlertsJSON = string(alertsJSON)
+							fmt.Fprintf(w, "event: alerts\n")
+							fmt.Fprintf(w, "data: %s\n\n", alertsJSON)
+						}
+					}
+				}
+
 				if err := w.Flush(); err != nil {
 					return // Client disconnected
 				}
@@ -79,91 +121,92 @@ type TaskProgressEvent struct {
 	Status          string `json:"status"`
 	OutputSize      int64  `json:"output_size"`
 	ErrorMessage    string `json:"error_message,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
 	ProgressStage   string `json:"progress_stage,omitempty"`
 	ProgressCurrent int    `json:"progress_current"`
 	ProgressTotal   int    `json:"progress_total"`
 }
 
+// taskEventsFallbackInterval is how often TaskEvents re-reads the task, catching changes that are
+// not pushed by a worker (e.g. cancellation) and detecting disconnected clients
+const taskEventsFallbackInterval = 5 * time.Second
+
 // TaskEvents handles GET /sse/tasks/:id (Shared)
-// Pushes progress updates every 1 second
+// Streams progress pushed by the worker as it happens. The database is read on
+// connect and then only as a periodic fallback
 func (h *SSEHandler) TaskEvents(c fiber.Ctx) error {
 	taskID := c.Params("id")
 
+	// API keys only stream their own tasks
+	if caller := callerAPIKeyID(c); caller != "" {
+		if task, err := h.taskRepo.GetByID(c.Context(), taskID); err != nil || task.APIKeyID != caller {
+			return api.Error(c, api.CodeNotFound, "Task not found")
+		}
+	}
+
 	c.Set("Content-Type", "text/event-stream")
 	c.Set("Cache-Control", "no-cache")
 	c.Set("Connection", "keep-alive")
 	c.Set("Transfer-Encoding", "chunked")
 
 	c.SendStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
-		ticker := time.NewTicker(1 * time.Second) // Check every 1 second
-		defer ticker.Stop()
+		// Subscribe before reading the task so no update is missed in between
+		var events <-chan ports.ProgressEvent
+		if h.progress != nil {
+			ch, unsubscribe := h.progress.Subscribe(taskID)
+			defer unsubscribe()
+			events = ch
+		}
+
+		fallback := time.NewTicker(taskEventsFallbackInterval)
+		defer fallback.Stop()
 
 		var lastEventJSON string
-		
+		send := func(event TaskProgressEvent) bool {
+			eventJSON, _ := json.Marshal(event)
+			if string(eventJSON) == lastEventJSON {
+				return true
+			}
+			fmt.Fprintf(w, "event: progress\n")
+			fmt.Fprintf(w, "data: %s\n\n", eventJSON)
+			if err := w.Flush(); err != nil {
+				return false // Client disconnected
+			}
+			lastEventJSON = string(eventJSON)
+			return true
+		}
+
+		event, ok := h.loadTaskEvent(taskID)
+		if !ok {
+			fmt.Fprintf(w, "event: error\n")
+			fmt.Fprintf(w, "data: {\"error\":\"Task not found\"}\n\n")
+			w.Flush()
+			return
+		}
+		if !send(event) || domain.TaskStatus(event.Status).IsTerminal() {
+			return
+		}
+
 		for {
 			select {
-			case <-ticker.C:
-				ctx := context.Background()
-				task, err := h.taskRepo.GetByID(ctx, taskID)
-				if err != nil {
-					fmt.Fprintf(w, "event: error\n")
-					fmt.Fprintf(w, "data: {\"error\":\"Task not found\"}\n\n")
-					w.Flush()
+			case pushed := <-events:
+				if !send(newTaskProgressEvent(pushed)) {
 					return
 				}
-
-				// Get real-time progress from queue if available
-				var progressStage string
-				var progressCurrent, progressTotal int
-				
-				if h.queue != nil {
-					progress := h.queue.GetProgress(taskID)
-					if progress != nil {
-						progressStage = progress.Stage
-						progressCurrent = progress.Current
-						progressTotal = progress.Total
-					} else {
-						// Fall back to DB values
-						progressStage = task.ProgressStage
-						progressCurrent = task.ProgressCurrent
-						progressTotal = task.ProgressTotal
-					}
-				} else {
-					progressStage = task.ProgressStage
-					progressCurrent = task.ProgressCurrent
-					progressTotal = task.ProgressTotal
+				if pushed.Status.IsTerminal() {
+					return
 				}
 
-				// Build event data
-				eventData := TaskProgressEvent{
-					Status:          string(task.Status),
-					OutputSize:      task.OutputFileSize,
-					ErrorMessage:    task.ErrorMessage,
-					ProgressStage:   progressStage,
-					ProgressCurrent: progressCurrent,
-					ProgressTotal:   progressTotal,
+			case <-fallback.C:
+				event, ok := h.loadTaskEvent(taskID)
+				if !ok {
+					return
 				}
-
-				eventJSON, _ := json.Marshal(eventData)
-				currentEventJSON := string(eventJSON)
-
-				// Determine if we should send:
-				// 1. Always send if stage is "Appending transaction" (progress updates every second)
-				// 2. Otherwise, only send if state has changed
-				isAppendingStage := len(progressStage) >= 8 && progressStage[:8] == "Appending"
-				shouldSend := isAppendingStage || currentEventJSON != lastEventJSON
-
-				if shouldSend {
-					fmt.Fprintf(w, "event: progress\n")
-					fmt.Fprintf(w, "data: %s\n\n", currentEventJSON)
-					if err := w.Flush(); err != nil {
-						return
-					}
-					lastEventJSON = currentEventJSON
+				fmt.Fprintf(w, ": ping\n\n")
+				if err := w.Flush(); err != nil {
+					return
 				}
-
-				// Stop streaming if task is terminal
-				if task.Status == "completed" || task.Status == "failed" || task.Status == "cancelled" {
+				if !send(event) || domain.TaskStatus(event.Status).IsTerminal() {
 					return
 				}
 			}
@@ -172,3 +215,43 @@ func (h *SSEHandler) TaskEvents(c fiber.Ctx) error {
 
 	return nil
 }
+
+// loadTaskEvent reads the task from the database, overlaid with live progress of a running task
+func (h *SSEHandler) loadTaskEvent(taskID string) (TaskProgressEvent, bool) {
+	task, err := h.taskRepo.GetByID(context.Background(), taskID)
+	if err != nil {
+		return TaskProgressEvent{}, false
+	}
+
+	event := TaskProgressEvent{
+		Status:          string(task.Status),
+		OutputSize:      task.OutputFileSize,
+		ErrorMessage:    task.ErrorMessage,
+		ErrorCode:       string(task.ErrorCode),
+		ProgressStage:   task.ProgressStage,
+		ProgressCurrent: task.ProgressCurrent,
+		ProgressTotal:   task.ProgressTotal,
+	}
+
+	if task.Status == domain.TaskStatusRunning && h.progress != nil {
+		if live := h.progress.Latest(taskID); live != nil {
+			event.ProgressStage = live.Stage
+			event.ProgressCurrent = live.Current
+			event.ProgressTotal = live.Total
+		}
+	}
+	return event, true
+}
+
+// newTaskProgressEvent converts a pushed worker event to the SSE payload
+func newTaskProgressEvent(event ports.ProgressEvent) TaskProgressEvent {
+	return TaskProgressEvent{
+		Status:          string(event.Status),
+		OutputSize:      event.OutputSize,
+		ErrorMessage:    event.ErrorMessage,
+		ErrorCode:       string(event.ErrorCode),
+		ProgressStage:   event.Stage,
+		ProgressCurrent: event.Current,
+		ProgressTotal:   event.Total,
+	}
+}
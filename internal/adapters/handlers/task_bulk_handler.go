@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/api"
+	"pdf_generator/pkg/generator"
+)
+
+// MaxBulkTasks limits how many tasks a single bulk request may act on
+const MaxBulkTasks = 1000
+
+var errTooManyBulkTasks = errors.New("Filter matches more than 1000 tasks, narrow it down")
+
+// BulkTaskAction is the action applied to the tasks of a bulk request
+type BulkTaskAction string
+
+const (
+	BulkTaskActionCancel  BulkTaskAction = "cancel"  // Queued and pending tasks are cancelled
+	BulkTaskActionRetry   BulkTaskAction = "retry"   // Failed and cancelled tasks are queued again
+	BulkTaskActionDelete  BulkTaskAction = "delete"  // Finished tasks and their output files are removed (Admin)
+	BulkTaskActionArchive BulkTaskAction = "archive" // Finished tasks are hidden from the task list
+)
+
+// BulkTaskResultStatus is the outcome of a bulk action for a single task
+type BulkTaskResultStatus string
+
+const (
+	BulkTaskDone    BulkTaskResultStatus = "done"
+	BulkTaskSkipped BulkTaskResultStatus = "skipped" // The task is not in a state the action applies to
+	BulkTaskFailed  BulkTaskResultStatus = "failed"
+)
+
+// BulkTaskRequest selects tasks by ID or by filter and applies an action to them
+type BulkTaskRequest struct {
+	Action BulkTaskAction  `json:"action"`
+	IDs    []string        `json:"ids"`
+	Filter *BulkTaskFilter `json:"filter"` // Used when no IDs are given
+}
+
+// BulkTaskFilter selects tasks like the task list. At least one field is required.
+type BulkTaskFilter struct {
+	Status      string             `json:"status"`
+	Type        domain.TaskType    `json:"type"`
+	From        string             `json:"from"`
+	To          string             `json:"to"`
+	GateID      *int               `json:"gate_id"`
+	StationID   *int               `json:"station_id"`
+	ParentID    string             `json:"parent_id"`
+	APIKeyID    string             `json:"api_key_id"`   // Admin only
+	CreatorType domain.TaskCreator `json:"creator_type"` // Admin only
+	CreatorID   string             `json:"creator_id"`   // Admin only
+	Archived    *bool              `json:"archived"`     // Both archived and active tasks when omitted
+}
+
+// BulkTaskResult reports the outcome of the action for one task
+type BulkTaskResult struct {
+	TaskID  string               `json:"task_id"`
+	Result  BulkTaskResultStatus `json:"result"`
+	Status  domain.TaskStatus    `json:"status,omitempty"` // Task status after the action, empty when deleted
+	Message string               `json:"message,omitempty"`
+}
+
+// Bulk handles POST /tasks/bulk
+// API keys only act on their own tasks and may not delete
+func (h *TaskHandler) Bulk(c fiber.Ctx) error {
+	var req BulkTaskRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	switch req.Action {
+	case BulkTaskActionCancel, BulkTaskActionRetry, BulkTaskActionArchive:
+	case BulkTaskActionDelete:
+		if callerAPIKeyID(c) != "" {
+			return api.Error(c, api.CodeUnauthorized, "Admin access required")
+		}
+	default:
+		return api.Error(c, api.CodeValidationError, "Action must be one of cancel, retry, delete or archive")
+	}
+	if len(req.IDs) == 0 && req.Filter.empty() {
+		return api.Error(c, api.CodeValidationError, "Task IDs or a filter are required")
+	}
+	if len(req.IDs) > MaxBulkTasks {
+		return api.Error(c, api.CodeValidationError, "Too many task IDs")
+	}
+	if req.Action == BulkTaskActionRetry && h.queue == nil {
+		return api.Error(c, api.CodeInternalError, "Queue is not available")
+	}
+
+	tasks, results, err := h.bulkTasks(c, req)
+	if errors.Is(err, errTooManyBulkTasks) {
+		return api.Error(c, api.CodeValidationError, err.Error())
+	}
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to list tasks")
+	}
+
+	if req.Action == BulkTaskActionRetry {
+		count, days := 0, 0
+		for _, task := range tasks {
+			if task.Status == domain.TaskStatusFailed || task.Status == domain.TaskStatusCancelled {
+				count++
+				days += task.ReportDays
+			}
+		}
+		release, err := checkQuota(c, h.taskRepo, count, days)
+		if err != nil {
+			return quotaError(c, err)
+		}
+		defer release()
+	}
+
+	for i := range tasks {
+		results = append(results, h.applyBulkAction(c, req.Action, &tasks[i]))
+	}
+
+	summary := fiber.Map{
+		"action":  req.Action,
+		"matched": len(results),
+		"results": results,
+	}
+	for _, status := range []BulkTaskResultStatus{BulkTaskDone, BulkTaskSkipped, BulkTaskFailed} {
+		count := 0
+		for _, result := range results {
+			if result.Result == status {
+				count++
+			}
+		}
+		summary[string(status)] = count
+	}
+	return api.Success(c, summary)
+}
+
+// bulkTasks loads the tasks selected by the request. Unknown IDs and tasks of other
+// API keys are reported as failed results.
+func (h *TaskHandler) bulkTasks(c fiber.Ctx, req BulkTaskRequest) ([]domain.Task, []BulkTaskResult, error) {
+	results := []BulkTaskResult{}
+
+	if len(req.IDs) > 0 {
+		var tasks []domain.Task
+		seen := make(map[string]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			task, err := h.taskRepo.GetByID(c.Context(), id)
+			if err != nil || task == nil || !ownsTask(c, task) {
+				results = append(results, BulkTaskResult{TaskID: id, Result: BulkTaskFailed, Message: "Task not found"})
+				continue
+			}
+			tasks = append(tasks, *task)
+		}
+		return tasks, results, nil
+	}
+
+	f := req.Filter
+	filter := ports.TaskFilter{
+		Status:    f.Status,
+		Type:      f.Type,
+		FromDate:  f.From,
+		ToDate:    f.To,
+		GateID:    f.GateID,
+		StationID: f.StationID,
+		ParentID:  f.ParentID,
+		APIKeyID:  f.APIKeyID,
+		Creator:   f.CreatorType,
+		CreatorID: f.CreatorID,
+		Archived:  f.Archived,
+		Page:      1,
+		Limit:     MaxBulkTasks,
+	}
+	// API keys only act on their own tasks
+	if caller := callerAPIKeyID(c); caller != "" {
+		filter.APIKeyID = caller
+	}
+
+	tasks, total, err := h.taskRepo.List(c.Context(), filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if total > MaxBulkTasks {
+		return nil, nil, errTooManyBulkTasks
+	}
+	return tasks, results, nil
+}
+
+// empty reports whether the filter would select all tasks
+func (f *BulkTaskFilter) empty() bool {
+	return f == nil || (f.Status == "" && f.Type == "" && f.From == "" && f.To == "" && f.GateID == nil && f.StationID == nil &&
+		f.ParentID == "" && f.APIKeyID == "" && f.CreatorType == "" && f.CreatorID == "" && f.Archived == nil)
+}
+
+// applyBulkAction applies the action to one task and reports the outcome
+func (h *TaskHandler) applyBulkAction(c fiber.Ctx, action BulkTaskAction, task *domain.Task) BulkTaskResult {
+	result := BulkTaskResult{TaskID: task.ID, Status: task.Status}
+	skip := func(message string) BulkTaskResult {
+		result.Result = BulkTaskSkipped
+		result.Message = message
+		return result
+	}
+	fail := func(message string, err error) BulkTaskResult {
+		log.Warn().Err(err).Str("task_id", task.ID).Str("action", string(action)).Msg("Bulk task action failed")
+		result.Result = BulkTaskFailed
+		result.Message = message
+		return result
+	}
+
+	switch action {
+	case BulkTaskActionCancel:
+		if task.Status != domain.TaskStatusQueued && task.Status != domain.TaskStatusPending {
+			return skip("Cannot cancel task in current status")
+		}
+		task.Status = domain.TaskStatusCancelled
+		if err := h.taskRepo.Update(c.Context(), task); err != nil {
+			return fail("Failed to cancel task", err)
+		}
+		if h.queue != nil {
+			h.queue.NotifyTask(c.Context(), task)
+		}
+
+	case BulkTaskActionRetry:
+		if task.Status != domain.TaskStatusFailed && task.Status != domain.TaskStatusCancelled {
+			return skip("Only failed or cancelled tasks can be retried")
+		}
+		task.ResetForRetry()
+		if err := h.taskRepo.Update(c.Context(), task); err != nil {
+			return fail("Failed to retry task", err)
+		}
+		if _, err := h.queue.EnqueueTask(c.Context(), task); err != nil {
+			h.taskRepo.UpdateError(c.Context(), task.ID, domain.TaskErrorInternal, "Failed to enqueue task: "+err.Error())
+			result.Status = domain.TaskStatusFailed
+			return fail("Failed to enqueue task", err)
+		}
+
+	case BulkTaskActionDelete:
+		if !task.Status.IsTerminal() {
+			return skip("Cancel the task before deleting it")
+		}
+		if err := h.removeOutputs(c, task); err != nil {
+			return fail("Failed to remove output file", err)
+		}
+		if err := h.taskRepo.Delete(c.Context(), task.ID); err != nil {
+			return fail("Failed to delete task", err)
+		}
+		task.Status = ""
+
+	case BulkTaskActionArchive:
+		if !task.Status.IsTerminal() {
+			return skip("Only finished tasks can be archived")
+		}
+		if task.ArchivedAt != nil {
+			return skip("Task is already archived")
+		}
+		now := time.Now()
+		task.ArchivedAt = &now
+		if err := h.taskRepo.Update(c.Context(), task); err != nil {
+			return fail("Failed to archive task", err)
+		}
+	}
+
+	result.Result = BulkTaskDone
+	result.Status = task.Status
+	return result
+}
+
+// removeOutputs removes the output files of a task and its output directory. Files another task
+// also references are kept, tasks created before each task had an output directory may share them.
+func (h *TaskHandler) removeOutputs(c fiber.Ctx, task *domain.Task) error {
+	if task.OutputFilePath == "" {
+		return nil
+	}
+	all, err := h.taskRepo.ListOutputPaths(c.Context())
+	if err != nil {
+		return err
+	}
+	references := make(map[string]int)
+	for _, joined := range all {
+		for _, path := range splitOutputPath(joined) {
+			references[path]++
+		}
+	}
+
+	var owned []string
+	for _, path := range splitOutputPath(task.OutputFilePath) {
+		if references[path] > 1 {
+			log.Info().Str("task_id", task.ID).Str("path", path).Msg("Output file kept, another task references it")
+			continue
+		}
+		owned = append(owned, path)
+	}
+	return generator.RemoveOutputs(strings.Join(owned, ","))
+}
+
+// splitOutputPath splits the comma-separated output files of a task into cleaned paths
+func splitOutputPath(outputPath string) []string {
+	var paths []string
+	for _, path := range strings.Split(outputPath, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, filepath.Clean(path))
+		}
+	}
+	return paths
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/pkg/api"
+)
+
+// MaxSLADays limits the range of an SLA report
+const MaxSLADays = 92
+
+// Events handles GET /tasks/:id/events
+// Lists the status transitions and stage changes of the task, oldest first
+func (h *TaskHandler) Events(c fiber.Ctx) error {
+	task, ok := h.find(c)
+	if !ok {
+		return api.Error(c, api.CodeNotFound, "Task not found")
+	}
+
+	events, err := h.taskRepo.ListEvents(c.Context(), task.ID)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to list task events")
+	}
+	if events == nil {
+		events = []domain.TaskEvent{}
+	}
+
+	return api.Success(c, fiber.Map{
+		"task_id":      task.ID,
+		"status":       task.Status,
+		"queued_at":    task.QueuedAt,
+		"started_at":   task.StartedAt,
+		"finished_at":  task.FinishedAt,
+		"wait_seconds": task.WaitSeconds,
+		"run_seconds":  task.RunSeconds,
+		"events":       events,
+	})
+}
+
+// SLA handles GET /stats/sla
+// Aggregates the wait and run times of finished tasks per day they were queued.
+// The range defaults to the last 7 days, both dates are inclusive.
+func (h *TaskHandler) SLA(c fiber.Ctx) error {
+	today := time.Now().Format("2006-01-02")
+	from, err1 := time.ParseInLocation("2006-01-02", c.Query("from", time.Now().AddDate(0, 0, -6).Format("2006-01-02")), time.Local)
+	to, err2 := time.ParseInLocation("2006-01-02", c.Query("to", today), time.Local)
+	if err1 != nil || err2 != nil {
+		return api.Error(c, api.CodeValidationError, "from and to must be dates (YYYY-MM-DD)")
+	}
+	if to.Before(from) {
+		return api.Error(c, api.CodeValidationError, "to must not be before from")
+	}
+	if to.Sub(from) >= MaxSLADays*24*time.Hour {
+		return api.Error(c, api.CodeValidationError, "Range must not exceed 92 days")
+	}
+
+	tasks, err := h.taskRepo.ListTimings(c.Context(), from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to load task timings")
+	}
+
+	return api.Success(c, fiber.Map{
+		"from": from.Format("2006-01-02"),
+		"to":   to.Format("2006-01-02"),
+		"days": domain.SLAReport(tasks, time.Local),
+	})
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -21,25 +23,45 @@ type TaskHandler struct {
 	taskRepo     ports.TaskRepository
 	settingsRepo ports.SettingsRepository
 	queue        ports.QueueService
+	webhookRepo  ports.WebhookRepository
 }
 
 // NewTaskHandler creates a new task handler
-func NewTaskHandler(taskRepo ports.TaskRepository, settingsRepo ports.SettingsRepository, queue ports.QueueService) *TaskHandler {
+func NewTaskHandler(taskRepo ports.TaskRepository, settingsRepo ports.SettingsRepository, queue ports.QueueService, webhookRepo ports.WebhookRepository) *TaskHandler {
 	return &TaskHandler{
 		taskRepo:     taskRepo,
 		settingsRepo: settingsRepo,
 		queue:        queue,
+		webhookRepo:  webhookRepo,
 	}
 }
 
 // EnqueueRequest represents a task enqueue request
 type EnqueueRequest struct {
-	RootFolder string            `json:"root_folder"`
-	BranchID   int               `json:"branch_id"`
-	GateID     int               `json:"gate_id"`
-	StationID  int               `json:"station_id"`
-	Filter     domain.TaskFilter `json:"filter"`
-	Settings   map[string]any    `json:"settings"`
+	RootFolder string              `json:"root_folder"`
+	BranchID   int                 `json:"branch_id"`
+	GateID     int                 `json:"gate_id"`
+	StationID  int                 `json:"station_id"`
+	Filter     domain.TaskFilter   `json:"filter"`
+	Settings   map[string]any      `json:"settings"`
+	Priority   domain.TaskPriority `json:"priority"` // urgent, normal (default), bulk
+
+	// Optional email of the generated PDFs once the task completes
+	Email *domain.EmailRequest `json:"email"`
+
+	// Optional webhook notified when this task completes, fails or is cancelled
+	CallbackURL    string                `json:"callback_url"`
+	CallbackEvents []domain.WebhookEvent `json:"callback_events"`
+}
+
+// UpdatePriorityRequest represents a queued task priority change
+type UpdatePriorityRequest struct {
+	Priority domain.TaskPriority `json:"priority"`
+}
+
+// MoveTaskRequest represents moving a queued task to a new position
+type MoveTaskRequest struct {
+	Position int `json:"position"` // 1-based dispatch position
 }
 
 // List handles GET /tasks
@@ -66,13 +88,27 @@ func (h *TaskHandler) List(c fiber.Ctx) error {
 
 	filter := ports.TaskFilter{
 		Status:    c.Query("status"),
+		Type:      domain.TaskType(c.Query("type")),
 		FromDate:  c.Query("from"),
 		ToDate:    c.Query("to"),
 		GateID:    gateID,
 		StationID: stationID,
+		ParentID:  c.Query("parent_id"),
+		APIKeyID:  c.Query("api_key_id"),
+		Creator:   domain.TaskCreator(c.Query("creator_type")),
+		CreatorID: c.Query("creator_id"),
 		Page:      page,
 		Limit:     limit,
 	}
+	// API keys only see their own tasks
+	if caller := callerAPIKeyID(c); caller != "" {
+		filter.APIKeyID = caller
+	}
+	// Archived tasks are only listed on request
+	if c.Query("archived") != "all" {
+		archived := c.Query("archived") == "true"
+		filter.Archived = &archived
+	}
 
 	tasks, total, err := h.taskRepo.List(c.Context(), filter)
 	if err != nil {
@@ -97,9 +133,8 @@ func (h *TaskHandler) List(c fiber.Ctx) error {
 
 // Get handles GET /tasks/:id
 func (h *TaskHandler) Get(c fiber.Ctx) error {
-	id := c.Params("id")
-	task, err := h.taskRepo.GetByID(c.Context(), id)
-	if err != nil {
+	task, ok := h.find(c)
+	if !ok {
 		return api.Error(c, api.CodeNotFound, "Task not found")
 	}
 	return api.Success(c, task)
@@ -107,9 +142,8 @@ func (h *TaskHandler) Get(c fiber.Ctx) error {
 
 // Cancel handles DELETE /tasks/:id
 func (h *TaskHandler) Cancel(c fiber.Ctx) error {
-	id := c.Params("id")
-	task, err := h.taskRepo.GetByID(c.Context(), id)
-	if err != nil {
+	task, ok := h.find(c)
+	if !ok {
 		return api.Error(c, api.CodeNotFound, "Task not found")
 	}
 
@@ -121,15 +155,17 @@ func (h *TaskHandler) Cancel(c fiber.Ctx) error {
 	if err := h.taskRepo.Update(c.Context(), task); err != nil {
 		return api.Error(c, api.CodeInternalError, "Failed to cancel task")
 	}
+	if h.queue != nil {
+		h.queue.NotifyTask(c.Context(), task)
+	}
 
 	return api.Success(c, fiber.Map{"id": task.ID, "status": task.Status})
 }
 
 // Download handles GET /tasks/:id/download
 func (h *TaskHandler) Download(c fiber.Ctx) error {
-	id := c.Params("id")
-	task, err := h.taskRepo.GetByID(c.Context(), id)
-	if err != nil {
+	task, ok := h.find(c)
+	if !ok {
 		return api.Error(c, api.CodeNotFound, "Task not found")
 	}
 
@@ -171,15 +207,26 @@ func (h *TaskHandler) Enqueue(c fiber.Ctx) error {
 	if req.StationID < 0 || req.StationID > 100 {
 		return api.Error(c, api.CodeValidationError, "Station ID must be between 0 and 100")
 	}
-
-	// Normalize root folder path based on OS
-	normalizedRoot := req.RootFolder
-	if runtime.GOOS == "windows" {
-		normalizedRoot = filepath.FromSlash(req.RootFolder)
-	} else {
-		normalizedRoot = filepath.ToSlash(req.RootFolder)
+	req.Priority = req.Priority.OrDefault()
+	if !req.Priority.Valid() {
+		return api.Error(c, api.CodeValidationError, "Priority must be one of urgent, normal or bulk")
+	}
+	if req.Email != nil {
+		if err := req.Email.Validate(); err != nil {
+			return api.Error(c, api.CodeValidationError, err.Error())
+		}
+	}
+	if req.CallbackURL != "" {
+		if h.webhookRepo == nil {
+			return api.Error(c, api.CodeValidationError, "Webhooks are not available")
+		}
+		if err := validateWebhook(c.Context(), h.settingsRepo, req.CallbackURL, req.CallbackEvents); err != nil {
+			return api.Error(c, api.CodeValidationError, err.Error())
+		}
 	}
 
+	normalizedRoot := normalizeRootFolder(req.RootFolder)
+
 	// Check datasource from filepath while adding new task
 	var targetDate time.Time
 	if req.Filter.Date != "" {
@@ -190,18 +237,19 @@ func (h *TaskHandler) Enqueue(c fiber.Ctx) error {
 		targetDate = time.Now()
 	}
 
-	// Fetch datasource path format from settings
-	datasourceFormat := "{MM}{YY}/{StationID}/{DD}{MM}{YYYY}.mdb"
+	// Fetch datasource path formats from settings
+	datasourceFormats := []string{"{MM}{YY}/{StationID}/{DD}{MM}{YYYY}.mdb"}
 	if setting, err := h.settingsRepo.Get(c.Context(), domain.SettingDataSourcePathFormat); err == nil && setting != nil {
-		datasourceFormat = setting.Value
+		if formats := datasource.PathFormats(setting.Value); len(formats) > 0 {
+			datasourceFormats = formats
+		}
 	}
 
-	dbPath := datasource.GetDataSourcePath(datasourceFormat, normalizedRoot, targetDate, req.BranchID, req.GateID, req.StationID)
-	dbPath = filepath.FromSlash(dbPath)
-	if _, err := os.Stat(dbPath); err != nil {
-		log.Info().Str("path", dbPath).Msg("Datasource file not found while adding new task")
+	resolved, err := datasource.ResolveDataSource(datasourceFormats, normalizedRoot, targetDate, req.BranchID, req.GateID, req.StationID)
+	if err != nil {
+		log.Info().Err(err).Str("path", resolved.Path).Msg("Datasource file not found while adding new task")
 	} else {
-		log.Info().Str("path", dbPath).Msg("Datasource file found while adding new task")
+		log.Info().Str("path", resolved.Path).Str("format", resolved.Format).Msg("Datasource file found while adding new task")
 	}
 
 	// If GateID is not -1 (All), set it in the filter as well
@@ -217,22 +265,75 @@ func (h *TaskHandler) Enqueue(c fiber.Ctx) error {
 		StationID:  req.StationID,
 		Filter:     req.Filter,
 		Settings:   req.Settings,
+		Priority:   req.Priority,
+		Email:      req.Email,
+	}
+	fingerprint := metadata.Fingerprint()
+
+	// Return the existing task when the same report is already queued, running or recently completed
+	if existing := h.findDuplicate(c, fingerprint); existing != nil {
+		position, _ := h.taskRepo.GetQueuePosition(c.Context(), existing.ID)
+		queueSize, _ := h.taskRepo.CountByStatus(c.Context(), domain.TaskStatusQueued)
+
+		resp := fiber.Map{
+			"task_id":        existing.ID,
+			"status":         existing.Status,
+			"queue_position": position,
+			"queue_size":     queueSize,
+			"priority":       existing.Priority,
+			"created_at":     existing.CreatedAt,
+			"duplicate":      true,
+		}
+
+		// The callback is added to the existing task while it can still reach a final state
+		if req.CallbackURL != "" && !existing.Status.IsTerminal() {
+			secret, err := h.registerCallback(c, existing.ID, req)
+			if err != nil {
+				return api.Error(c, api.CodeInternalError, "Failed to register callback")
+			}
+			resp["callback_secret"] = secret
+		}
+		return api.Success(c, resp)
+	}
+
+	release, err := checkQuota(c, h.taskRepo, 1, req.Filter.Days())
+	if err != nil {
+		return quotaError(c, err)
 	}
+	defer release()
 
 	task := &domain.Task{
-		Status:     domain.TaskStatusQueued,
-		RootFolder: normalizedRoot,
-		BranchID:   req.BranchID,
-		GateID:     req.GateID,
-		StationID:  req.StationID,
-		Filters:    &req.Filter,
-		Settings:   req.Settings,
+		Status:      domain.TaskStatusQueued,
+		Priority:    req.Priority,
+		Fingerprint: fingerprint,
+		RootFolder:  normalizedRoot,
+		BranchID:    req.BranchID,
+		GateID:      req.GateID,
+		StationID:   req.StationID,
+		Filters:     &req.Filter,
+		Settings:    req.Settings,
+		Email:       req.Email,
+		APIKeyID:    callerAPIKeyID(c),
+		ReportDays:  req.Filter.Days(),
 	}
+	task.CreatorType, task.CreatorID = taskCreator(c)
 
 	if err := h.taskRepo.Create(c.Context(), task); err != nil {
 		return api.Error(c, api.CodeInternalError, "Failed to create task")
 	}
 
+	// Registered before enqueueing so that a fast task cannot finish unnoticed
+	var callbackSecret string
+	if req.CallbackURL != "" {
+		secret, err := h.registerCallback(c, task.ID, req)
+		if err != nil {
+			task.Status = domain.TaskStatusFailed
+			h.taskRepo.Update(c.Context(), task)
+			return api.Error(c, api.CodeInternalError, "Failed to register callback")
+		}
+		callbackSecret = secret
+	}
+
 	// Process queue asynchronously if queue is available
 	if h.queue != nil {
 		if _, err := h.queue.Enqueue(c.Context(), task.ID, metadata); err != nil {
@@ -249,11 +350,210 @@ func (h *TaskHandler) Enqueue(c fiber.Ctx) error {
 	position, _ := h.taskRepo.GetQueuePosition(c.Context(), task.ID)
 	queueSize, _ := h.taskRepo.CountByStatus(c.Context(), domain.TaskStatusQueued)
 
-	return api.Success(c, fiber.Map{
+	resp := fiber.Map{
 		"task_id":        task.ID,
 		"status":         task.Status,
 		"queue_position": position,
 		"queue_size":     queueSize,
+		"priority":       task.Priority,
 		"created_at":     task.CreatedAt,
+		"duplicate":      false,
+	}
+	if callbackSecret != "" {
+		resp["callback_secret"] = callbackSecret
+	}
+	return api.Success(c, resp)
+}
+
+// ownsTask checks if the caller may see the task. Admins see all tasks, API keys the tasks created with them.
+func ownsTask(c fiber.Ctx, task *domain.Task) bool {
+	caller := callerAPIKeyID(c)
+	return caller == "" || task.APIKeyID == caller
+}
+
+// taskCreator returns the creator recorded on tasks created by this request
+func taskCreator(c fiber.Ctx) (domain.TaskCreator, string) {
+	switch c.Locals("auth_type") {
+	case "admin":
+		userID, _ := c.Locals("user_id").(string)
+		return domain.TaskCreatorAdmin, userID
+	case "api_key":
+		return domain.TaskCreatorAPIKey, callerAPIKeyID(c)
+	}
+	return domain.TaskCreatorAnonymous, ""
+}
+
+// quotaLocks serializes the quota checks of each API key, by API key ID
+var quotaLocks sync.Map
+
+// checkQuota checks that the caller's API key may add tasks covering days report days.
+// Admins and anonymous callers are not limited. When the check passes, other checks of the key
+// wait until release is called, so the caller must call it once the tasks are created.
+func checkQuota(c fiber.Ctx, taskRepo ports.TaskRepository, tasks, days int) (release func(), err error) {
+	key := callerAPIKey(c)
+	if key == nil || (key.MaxQueuedTasks == 0 && key.DailyReportDays == 0) {
+		return func() {}, nil
+	}
+
+	lock, _ := quotaLocks.LoadOrStore(key.ID, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	usage, err := taskRepo.UsageByAPIKey(c.Context(), today, key.ID)
+	if err == nil {
+		err = key.CheckQuota(usage[key.ID], tasks, days)
+	}
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	return mu.Unlock, nil
+}
+
+// quotaError responds to a failed quota check
+func quotaError(c fiber.Ctx, err error) error {
+	if errors.Is(err, domain.ErrQuotaExceeded) {
+		return api.Error(c, api.CodeRateLimited, "API key "+err.Error())
+	}
+	return api.Error(c, api.CodeInternalError, "Failed to check quota")
+}
+
+// normalizeRootFolder converts the separators of a root folder path to the server's OS
+func normalizeRootFolder(path string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.FromSlash(path)
+	}
+	return filepath.ToSlash(path)
+}
+
+// registerCallback creates the webhook of the request's callback URL for a task and returns its secret
+func (h *TaskHandler) registerCallback(c fiber.Ctx, taskID string, req EnqueueRequest) (string, error) {
+	webhook, secret, err := newWebhook(req.CallbackURL, req.CallbackEvents)
+	if err != nil {
+		return "", err
+	}
+	webhook.TaskID = &taskID
+	if apiKeyID := callerAPIKeyID(c); apiKeyID != "" {
+		webhook.APIKeyID = &apiKeyID
+	}
+	if err := h.webhookRepo.Create(c.Context(), webhook); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// findDuplicate returns an active or recently completed task with the same fingerprint when duplicate detection is enabled
+func (h *TaskHandler) findDuplicate(c fiber.Ctx, fingerprint string) *domain.Task {
+	setting, err := h.settingsRepo.Get(c.Context(), domain.SettingTaskDedupEnabled)
+	if err != nil || setting == nil || setting.Value != "true" {
+		return nil
+	}
+
+	windowHours := 1
+	if setting, err := h.settingsRepo.Get(c.Context(), domain.SettingTaskDedupWindowHrs); err == nil && setting != nil {
+		if hrs, err := strconv.Atoi(setting.Value); err == nil && hrs >= 0 {
+			windowHours = hrs
+		}
+	}
+
+	since := time.Now().Add(-time.Duration(windowHours) * time.Hour)
+	existing, err := h.taskRepo.FindByFingerprint(c.Context(), fingerprint, since)
+	if err != nil || !ownsTask(c, existing) {
+		return nil
+	}
+	return existing
+}
+
+// find loads the task of the :id parameter. API keys only see their own tasks.
+func (h *TaskHandler) find(c fiber.Ctx) (*domain.Task, bool) {
+	task, err := h.taskRepo.GetByID(c.Context(), c.Params("id"))
+	if err != nil || task == nil || !ownsTask(c, task) {
+		return nil, false
+	}
+	return task, true
+}
+
+// UpdatePriority handles PUT /queue/:id/priority (Admin)
+func (h *TaskHandler) UpdatePriority(c fiber.Ctx) error {
+	var req UpdatePriorityRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	if !req.Priority.Valid() {
+		return api.Error(c, api.CodeValidationError, "Priority must be one of urgent, normal or bulk")
+	}
+
+	id := c.Params("id")
+	if _, err := h.taskRepo.GetByID(c.Context(), id); err != nil {
+		return api.Error(c, api.CodeNotFound, "Task not found")
+	}
+	if err := h.queue.SetPriority(c.Context(), id, req.Priority); err != nil {
+		return h.reorderError(c, err)
+	}
+
+	return h.queuePosition(c, id)
+}
+
+// Move handles PUT /queue/:id/position (Admin)
+func (h *TaskHandler) Move(c fiber.Ctx) error {
+	var req MoveTaskRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	if req.Position < 1 {
+		return api.Error(c, api.CodeValidationError, "Position must be 1 or greater")
+	}
+
+	id := c.Params("id")
+	if _, err := h.taskRepo.GetByID(c.Context(), id); err != nil {
+		return api.Error(c, api.CodeNotFound, "Task not found")
+	}
+	if err := h.queue.Move(c.Context(), id, req.Position); err != nil {
+		return h.reorderError(c, err)
+	}
+
+	return h.queuePosition(c, id)
+}
+
+// Pause handles POST /queue/pause (Admin)
+// Running tasks finish, but no new tasks are dispatched until resumed
+func (h *TaskHandler) Pause(c fiber.Ctx) error {
+	control, err := h.queue.Pause(c.Context())
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to pause queue")
+	}
+	return api.Success(c, control)
+}
+
+// Resume handles POST /queue/resume (Admin)
+func (h *TaskHandler) Resume(c fiber.Ctx) error {
+	control, err := h.queue.Resume(c.Context())
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to resume queue")
+	}
+	return api.Success(c, control)
+}
+
+// queuePosition responds with the current dispatch position of a task
+func (h *TaskHandler) queuePosition(c fiber.Ctx, id string) error {
+	task, err := h.taskRepo.GetByID(c.Context(), id)
+	if err != nil {
+		return api.Error(c, api.CodeNotFound, "Task not found")
+	}
+	position, _ := h.taskRepo.GetQueuePosition(c.Context(), id)
+
+	return api.Success(c, fiber.Map{
+		"task_id":        task.ID,
+		"priority":       task.Priority,
+		"queue_position": position,
 	})
 }
+
+func (h *TaskHandler) reorderError(c fiber.Ctx, err error) error {
+	if errors.Is(err, ports.ErrTaskNotQueued) {
+		return api.Error(c, api.CodeValidationError, "Task is no longer waiting in the queue")
+	}
+	return api.Error(c, api.CodeInternalError, "Failed to reorder task")
+}
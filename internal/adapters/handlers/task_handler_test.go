@@ -4,20 +4,35 @@ import (
 	"context"
 	"encoding/json"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/glebarez/sqlite"
 	"github.com/gofiber/fiber/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
 
 	"pdf_generator/internal/adapters/handlers"
+	"pdf_generator/internal/adapters/repository"
 	"pdf_generator/internal/core/domain"
 	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/database"
 )
 
+// newTestDB opens an in-memory database with every model migrated. Tests use distinct names
+// because databases with the same name are shared.
+func newTestDB(t *testing.T, name string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(database.Models()...))
+	return db
+}
+
 // Mocks
 type MockTaskRepo struct {
 	mock.Mock
@@ -46,14 +61,68 @@ func (m *MockTaskRepo) Update(ctx context.Context, task *domain.Task) error
 func (m *MockTaskRepo) UpdateProgress(ctx context.Context, id string, stage string, current, total int) error {
 	return nil
 }
-func (m *MockTaskRepo) UpdateError(ctx context.Context, id string, errMsg string) error { return nil }
-func (m *MockTaskRepo) Delete(ctx context.Context, id string) error                     { return nil }
+func (m *MockTaskRepo) UpdateError(ctx context.Context, id string, code domain.TaskErrorCode, errMsg string) error {
+	return nil
+}
+func (m *MockTaskRepo) AddChunk(ctx context.Context, id string, chunk domain.TaskChunk) error {
+	return nil
+}
+func (m *MockTaskRepo) AddSource(ctx context.Context, id string, source domain.TaskSource) error {
+	return nil
+}
+func (m *MockTaskRepo) Delete(ctx context.Context, id string) error { return nil }
 func (m *MockTaskRepo) List(ctx context.Context, filter ports.TaskFilter) ([]domain.Task, int64, error) {
 	return nil, 0, nil
 }
 func (m *MockTaskRepo) FindExpiredCompleted(ctx context.Context, days int) ([]domain.Task, error) {
 	return nil, nil
 }
+func (m *MockTaskRepo) ListQueued(ctx context.Context) ([]domain.Task, error) { return nil, nil }
+func (m *MockTaskRepo) UpdateDispatch(ctx context.Context, id string, jobID string, priority domain.TaskPriority, order int64) error {
+	return nil
+}
+
+func (m *MockTaskRepo) FindByFingerprint(ctx context.Context, fingerprint string, completedSince time.Time) (*domain.Task, error) {
+	args := m.Called(ctx, fingerprint, completedSince)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Task), args.Error(1)
+}
+
+func (m *MockTaskRepo) ListByStatus(ctx context.Context, statuses ...domain.TaskStatus) ([]domain.Task, error) {
+	return nil, nil
+}
+
+func (m *MockTaskRepo) ListByJobIDs(ctx context.Context, jobIDs []string) ([]domain.Task, error) {
+	return nil, nil
+}
+
+func (m *MockTaskRepo) ListOutputPaths(ctx context.Context) ([]string, error) { return nil, nil }
+
+func (m *MockTaskRepo) ListByParent(ctx context.Context, parentID string, statuses ...domain.TaskStatus) ([]domain.Task, error) {
+	return nil, nil
+}
+
+func (m *MockTaskRepo) CountByParent(ctx context.Context, parentIDs []string) (map[string]domain.BatchJobCounts, error) {
+	return nil, nil
+}
+
+func (m *MockTaskRepo) UsageByAPIKey(ctx context.Context, since time.Time, apiKeyIDs ...string) (map[string]domain.APIKeyUsage, error) {
+	return nil, nil
+}
+
+func (m *MockTaskRepo) ListEvents(ctx context.Context, taskID string) ([]domain.TaskEvent, error) {
+	return nil, nil
+}
+
+func (m *MockTaskRepo) ListTimings(ctx context.Context, from, to time.Time) ([]domain.Task, error) {
+	return nil, nil
+}
+
+func (m *MockTaskRepo) CountFinishedSince(ctx context.Context, since time.Time) (map[domain.TaskStatus]int64, error) {
+	return nil, nil
+}
 
 type MockSettingsRepo struct {
 	mock.Mock
@@ -84,6 +153,11 @@ func (m *MockQueue) Enqueue(ctx context.Context, taskID string, metadata domain.
 	return args.Get(0).([]string), args.Error(1)
 }
 
+func (m *MockQueue) EnqueueTask(ctx context.Context, task *domain.Task) ([]string, error) {
+	args := m.Called(ctx, task)
+	return args.Get(0).([]string), args.Error(1)
+}
+
 func (m *MockQueue) Start(ctx context.Context) {
 	m.Called(ctx)
 }
@@ -92,11 +166,69 @@ func (m *MockQueue) GetProgress(taskID string) *ports.TaskProgress {
 	return nil
 }
 
+func (m *MockQueue) SetPriority(ctx context.Context, taskID string, priority domain.TaskPriority) error {
+	args := m.Called(ctx, taskID, priority)
+	return args.Error(0)
+}
+
+func (m *MockQueue) Move(ctx context.Context, taskID string, position int) error {
+	args := m.Called(ctx, taskID, position)
+	return args.Error(0)
+}
+
+func (m *MockQueue) Pause(ctx context.Context) (*domain.QueueControl, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*domain.QueueControl), args.Error(1)
+}
+
+func (m *MockQueue) Resume(ctx context.Context) (*domain.QueueControl, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*domain.QueueControl), args.Error(1)
+}
+
+func (m *MockQueue) Control(ctx context.Context) (*domain.QueueControl, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*domain.QueueControl), args.Error(1)
+}
+
+func (m *MockQueue) Lease(ctx context.Context, workerID, apiKeyID string, ttl time.Duration) (*ports.Lease, error) {
+	args := m.Called(ctx, workerID, apiKeyID, ttl)
+	lease, _ := args.Get(0).(*ports.Lease)
+	return lease, args.Error(1)
+}
+
+func (m *MockQueue) RenewLease(ctx context.Context, taskID, workerID, apiKeyID string, ttl time.Duration) (time.Time, error) {
+	args := m.Called(ctx, taskID, workerID, apiKeyID, ttl)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockQueue) CompleteLease(ctx context.Context, taskID, workerID, apiKeyID, output string, size int64) error {
+	args := m.Called(ctx, taskID, workerID, apiKeyID, output, size)
+	return args.Error(0)
+}
+
+func (m *MockQueue) FailLease(ctx context.Context, taskID, workerID, apiKeyID string, code domain.TaskErrorCode, errMsg string) (domain.TaskStatus, error) {
+	args := m.Called(ctx, taskID, workerID, apiKeyID, code, errMsg)
+	return args.Get(0).(domain.TaskStatus), args.Error(1)
+}
+
+func (m *MockQueue) NotifyTask(ctx context.Context, task *domain.Task) {
+	m.Called(ctx, task)
+}
+
+func (m *MockQueue) ReplayDelivery(ctx context.Context, deliveryID string) (*domain.WebhookDelivery, error) {
+	args := m.Called(ctx, deliveryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.WebhookDelivery), args.Error(1)
+}
+
 func TestTaskHandler_Enqueue_PathNormalization(t *testing.T) {
 	taskRepo := new(MockTaskRepo)
 	settingsRepo := new(MockSettingsRepo)
 	queue := new(MockQueue)
-	handler := handlers.NewTaskHandler(taskRepo, settingsRepo, queue)
+	handler := handlers.NewTaskHandler(taskRepo, settingsRepo, queue, nil)
 
 	app := fiber.New()
 	app.Post("/queue", handler.Enqueue)
@@ -112,6 +244,7 @@ func TestTaskHandler_Enqueue_PathNormalization(t *testing.T) {
 
 	// Expectations
 	settingsRepo.On("Get", mock.Anything, domain.SettingDataSourcePathFormat).Return(&domain.Settings{Value: "{MM}{YY}/{StationID}/{DD}{MM}{YYYY}.mdb"}, nil)
+	settingsRepo.On("Get", mock.Anything, domain.SettingTaskDedupEnabled).Return(&domain.Settings{Value: "false"}, nil)
 	taskRepo.On("Create", mock.Anything, mock.MatchedBy(func(task *domain.Task) bool {
 		// Verify normalized path in task
 		if runtime.GOOS == "windows" {
@@ -147,13 +280,14 @@ func TestTaskHandler_Enqueue(t *testing.T) {
 	taskRepo := new(MockTaskRepo)
 	settingsRepo := new(MockSettingsRepo)
 	queue := new(MockQueue)
-	handler := handlers.NewTaskHandler(taskRepo, settingsRepo, queue)
+	handler := handlers.NewTaskHandler(taskRepo, settingsRepo, queue, nil)
 
 	app := fiber.New()
 	app.Post("/queue", handler.Enqueue)
 
 	// Expectations
 	settingsRepo.On("Get", mock.Anything, domain.SettingDataSourcePathFormat).Return(&domain.Settings{Value: "{MM}{YY}/{StationID}/{DD}{MM}{YYYY}.mdb"}, nil)
+	settingsRepo.On("Get", mock.Anything, domain.SettingTaskDedupEnabled).Return(&domain.Settings{Value: "false"}, nil)
 
 	// Payload
 	// Payload
@@ -189,3 +323,370 @@ func TestTaskHandler_Enqueue(t *testing.T) {
 	taskRepo.AssertExpectations(t)
 	queue.AssertExpectations(t)
 }
+
+func TestTaskHandler_Enqueue_Priority(t *testing.T) {
+	taskRepo := new(MockTaskRepo)
+	settingsRepo := new(MockSettingsRepo)
+	queue := new(MockQueue)
+	handler := handlers.NewTaskHandler(taskRepo, settingsRepo, queue, nil)
+
+	app := fiber.New()
+	app.Post("/queue", handler.Enqueue)
+
+	settingsRepo.On("Get", mock.Anything, domain.SettingDataSourcePathFormat).Return(&domain.Settings{Value: "{MM}{YY}/{StationID}/{DD}{MM}{YYYY}.mdb"}, nil)
+	settingsRepo.On("Get", mock.Anything, domain.SettingTaskDedupEnabled).Return(&domain.Settings{Value: "false"}, nil)
+
+	// Unknown priority is rejected before anything is stored
+	body, _ := json.Marshal(handlers.EnqueueRequest{BranchID: 1, StationID: 2, Priority: "asap"})
+	req := httptest.NewRequest("POST", "/queue", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	taskRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+
+	// Urgent priority is carried to both the task and the queue payload
+	taskRepo.On("Create", mock.Anything, mock.MatchedBy(func(task *domain.Task) bool {
+		return task.Priority == domain.TaskPriorityUrgent
+	})).Return(nil).Once()
+	queue.On("Enqueue", mock.Anything, "test-task-id", mock.MatchedBy(func(m domain.TaskMetadata) bool {
+		return m.Priority == domain.TaskPriorityUrgent
+	})).Return([]string{"job-id"}, nil).Once()
+	taskRepo.On("GetQueuePosition", mock.Anything, "test-task-id").Return(1, nil).Once()
+	taskRepo.On("CountByStatus", mock.Anything, domain.TaskStatusQueued).Return(int64(3), nil).Once()
+
+	body, _ = json.Marshal(handlers.EnqueueRequest{BranchID: 1, StationID: 2, Priority: domain.TaskPriorityUrgent})
+	req = httptest.NewRequest("POST", "/queue", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	taskRepo.AssertExpectations(t)
+	queue.AssertExpectations(t)
+}
+
+func TestTaskHandler_Enqueue_Duplicate(t *testing.T) {
+	taskRepo := new(MockTaskRepo)
+	settingsRepo := new(MockSettingsRepo)
+	queue := new(MockQueue)
+	handler := handlers.NewTaskHandler(taskRepo, settingsRepo, queue, nil)
+
+	app := fiber.New()
+	app.Post("/queue", handler.Enqueue)
+
+	settingsRepo.On("Get", mock.Anything, domain.SettingDataSourcePathFormat).Return(&domain.Settings{Value: "{MM}{YY}/{StationID}/{DD}{MM}{YYYY}.mdb"}, nil)
+	settingsRepo.On("Get", mock.Anything, domain.SettingTaskDedupEnabled).Return(&domain.Settings{Value: "true"}, nil)
+	settingsRepo.On("Get", mock.Anything, domain.SettingTaskDedupWindowHrs).Return(&domain.Settings{Value: "1"}, nil)
+
+	existing := &domain.Task{ID: "existing-task-id", Status: domain.TaskStatusRunning, Priority: domain.TaskPriorityNormal}
+	taskRepo.On("FindByFingerprint", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(existing, nil).Once()
+	taskRepo.On("GetQueuePosition", mock.Anything, "existing-task-id").Return(0, nil).Once()
+	taskRepo.On("CountByStatus", mock.Anything, domain.TaskStatusQueued).Return(int64(0), nil).Once()
+
+	body, _ := json.Marshal(handlers.EnqueueRequest{BranchID: 1, StationID: 2, Filter: domain.TaskFilter{Date: "2026-01-02"}})
+	req := httptest.NewRequest("POST", "/queue", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var result struct {
+		Data struct {
+			TaskID    string `json:"task_id"`
+			Duplicate bool   `json:"duplicate"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "existing-task-id", result.Data.TaskID)
+	assert.True(t, result.Data.Duplicate)
+
+	taskRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	queue.AssertNotCalled(t, "Enqueue", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestTaskHandler_CallerScoping(t *testing.T) {
+	db := newTestDB(t, "task_scoping")
+
+	ctx := context.Background()
+	taskRepo := repository.NewTaskRepository(db)
+	own := &domain.Task{Status: domain.TaskStatusQueued, APIKeyID: "key-a", CreatorType: domain.TaskCreatorAPIKey, CreatorID: "key-a"}
+	other := &domain.Task{Status: domain.TaskStatusQueued, APIKeyID: "key-b", CreatorType: domain.TaskCreatorAPIKey, CreatorID: "key-b"}
+	admin := &domain.Task{Status: domain.TaskStatusQueued, CreatorType: domain.TaskCreatorAdmin, CreatorID: "admin"}
+	for _, task := range []*domain.Task{own, other, admin} {
+		assert.NoError(t, taskRepo.Create(ctx, task))
+	}
+
+	queue := new(MockQueue)
+	queue.On("NotifyTask", mock.Anything, mock.Anything).Return()
+	handler := handlers.NewTaskHandler(taskRepo, new(MockSettingsRepo), queue, nil)
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		if key := c.Get("X-API-Key"); key != "" {
+			c.Locals("auth_type", "api_key")
+			c.Locals("api_key_id", key)
+		} else {
+			c.Locals("auth_type", "admin")
+			c.Locals("user_id", "admin")
+		}
+		return c.Next()
+	})
+	app.Get("/tasks", handler.List)
+	app.Get("/tasks/:id", handler.Get)
+	app.Delete("/tasks/:id", handler.Cancel)
+	app.Get("/tasks/:id/download", handler.Download)
+
+	request := func(method, path, apiKey string) (int, []string) {
+		req := httptest.NewRequest(method, path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+
+		var result struct {
+			Data struct {
+				Items []domain.Task `json:"items"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		var ids []string
+		for _, task := range result.Data.Items {
+			ids = append(ids, task.ID)
+		}
+		return resp.StatusCode, ids
+	}
+
+	// API keys only list and reach their own tasks
+	_, ids := request("GET", "/tasks?api_key_id=key-b", "key-a")
+	assert.Equal(t, []string{own.ID}, ids)
+	status, _ := request("GET", "/tasks/"+own.ID, "key-a")
+	assert.Equal(t, 200, status)
+	for _, method := range []string{"GET", "DELETE"} {
+		status, _ = request(method, "/tasks/"+other.ID, "key-a")
+		assert.Equal(t, 404, status, method)
+	}
+	status, _ = request("GET", "/tasks/"+other.ID+"/download", "key-a")
+	assert.Equal(t, 404, status)
+
+	cancelled, _ := taskRepo.GetByID(ctx, other.ID)
+	assert.Equal(t, domain.TaskStatusQueued, cancelled.Status)
+
+	// Admins see all tasks and can filter by creator
+	_, ids = request("GET", "/tasks", "")
+	assert.Len(t, ids, 3)
+	_, ids = request("GET", "/tasks?creator_type=admin", "")
+	assert.Equal(t, []string{admin.ID}, ids)
+	_, ids = request("GET", "/tasks?creator_type=api_key&creator_id=key-b", "")
+	assert.Equal(t, []string{other.ID}, ids)
+}
+
+func TestTaskHandler_Bulk(t *testing.T) {
+	db := newTestDB(t, "task_bulk")
+
+	ctx := context.Background()
+	taskRepo := repository.NewTaskRepository(db)
+	t.Chdir(t.TempDir())
+	taskDir := filepath.Join("output", "task-a")
+	assert.NoError(t, os.MkdirAll(taskDir, 0755))
+	output := filepath.Join(taskDir, "report.pdf")
+	assert.NoError(t, os.WriteFile(output, []byte("%PDF"), 0644))
+	// Written before tasks had directories of their own, also the output of another task
+	shared := filepath.Join("output", "shared.pdf")
+	assert.NoError(t, os.WriteFile(shared, []byte("%PDF"), 0644))
+
+	queued := &domain.Task{Status: domain.TaskStatusQueued, APIKeyID: "key-a"}
+	failed := &domain.Task{Status: domain.TaskStatusFailed, APIKeyID: "key-a", ErrorMessage: "boom", JobID: "old"}
+	completed := &domain.Task{Status: domain.TaskStatusCompleted, APIKeyID: "key-a", OutputFilePath: output + "," + shared}
+	other := &domain.Task{Status: domain.TaskStatusQueued, APIKeyID: "key-b", OutputFilePath: shared}
+	for _, task := range []*domain.Task{queued, failed, completed, other} {
+		assert.NoError(t, taskRepo.Create(ctx, task))
+	}
+
+	queue := new(MockQueue)
+	queue.On("NotifyTask", mock.Anything, mock.Anything).Return()
+	queue.On("EnqueueTask", mock.Anything, mock.MatchedBy(func(task *domain.Task) bool {
+		return task.ID == failed.ID
+	})).Return([]string{"job"}, nil)
+	handler := handlers.NewTaskHandler(taskRepo, new(MockSettingsRepo), queue, nil)
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		if key := c.Get("X-API-Key"); key != "" {
+			c.Locals("auth_type", "api_key")
+			c.Locals("api_key_id", key)
+		} else {
+			c.Locals("auth_type", "admin")
+		}
+		return c.Next()
+	})
+	app.Post("/tasks/bulk", handler.Bulk)
+	app.Get("/tasks", handler.List)
+
+	type bulkResult struct {
+		Data struct {
+			Matched int                       `json:"matched"`
+			Done    int                       `json:"done"`
+			Skipped int                       `json:"skipped"`
+			Failed  int                       `json:"failed"`
+			Results []handlers.BulkTaskResult `json:"results"`
+		} `json:"data"`
+	}
+	bulk := func(body, apiKey string) (int, bulkResult) {
+		req := httptest.NewRequest("POST", "/tasks/bulk", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+
+		var result bulkResult
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	// Filters by API key callers only match their own tasks
+	status, result := bulk(`{"action":"cancel","filter":{"status":"queued"}}`, "key-a")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, 1, result.Data.Matched)
+	assert.Equal(t, 1, result.Data.Done)
+	task, _ := taskRepo.GetByID(ctx, other.ID)
+	assert.Equal(t, domain.TaskStatusQueued, task.Status)
+
+	// Tasks of other keys are reported as not found
+	_, result = bulk(`{"action":"retry","ids":["`+failed.ID+`","`+other.ID+`","`+completed.ID+`"]}`, "key-a")
+	assert.Equal(t, 3, result.Data.Matched)
+	assert.Equal(t, 1, result.Data.Done)
+	assert.Equal(t, 1, result.Data.Skipped)
+	assert.Equal(t, 1, result.Data.Failed)
+	task, _ = taskRepo.GetByID(ctx, failed.ID)
+	assert.Equal(t, domain.TaskStatusQueued, task.Status)
+	assert.Empty(t, task.ErrorMessage)
+	assert.Empty(t, task.JobID)
+
+	// Archived tasks are hidden from the task list
+	_, result = bulk(`{"action":"archive","ids":["`+completed.ID+`"]}`, "key-a")
+	assert.Equal(t, 1, result.Data.Done)
+	resp, _ := app.Test(httptest.NewRequest("GET", "/tasks?limit=100", nil))
+	var list struct {
+		Data struct {
+			Pagination struct {
+				Total int64 `json:"total"`
+			} `json:"pagination"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	assert.Equal(t, int64(3), list.Data.Pagination.Total)
+
+	// Deleting is restricted to admins and removes the output files no other task references
+	status, _ = bulk(`{"action":"delete","ids":["`+completed.ID+`"]}`, "key-a")
+	assert.Equal(t, 401, status)
+	_, result = bulk(`{"action":"delete","filter":{"api_key_id":"key-a"}}`, "")
+	assert.Equal(t, 3, result.Data.Matched)
+	assert.Equal(t, 2, result.Data.Done)
+	assert.Equal(t, 1, result.Data.Skipped)
+	_, err := taskRepo.GetByID(ctx, completed.ID)
+	assert.Error(t, err)
+	_, err = os.Stat(output)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoDirExists(t, taskDir)
+	assert.FileExists(t, shared)
+
+	// Selecting all tasks requires an explicit filter
+	status, _ = bulk(`{"action":"cancel","filter":{}}`, "")
+	assert.Equal(t, 400, status)
+}
+
+func TestTaskHandler_EventsAndSLA(t *testing.T) {
+	db := newTestDB(t, "task_events")
+
+	ctx := context.Background()
+	taskRepo := repository.NewTaskRepository(db)
+	task := &domain.Task{Status: domain.TaskStatusQueued, APIKeyID: "key-a"}
+	assert.NoError(t, taskRepo.Create(ctx, task))
+	task.Status = domain.TaskStatusRunning
+	task.WorkerID = "worker-1"
+	assert.NoError(t, taskRepo.Update(ctx, task))
+	assert.NoError(t, taskRepo.UpdateProgress(ctx, task.ID, "Fetching transactions", 0, 10))
+	assert.NoError(t, taskRepo.UpdateProgress(ctx, task.ID, "Fetching transactions", 5, 10))
+	assert.NoError(t, taskRepo.UpdateError(ctx, task.ID, domain.TaskErrorInternal, "boom"))
+
+	handler := handlers.NewTaskHandler(taskRepo, new(MockSettingsRepo), nil, nil)
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		if key := c.Get("X-API-Key"); key != "" {
+			c.Locals("auth_type", "api_key")
+			c.Locals("api_key_id", key)
+		}
+		return c.Next()
+	})
+	app.Get("/tasks/:id/events", handler.Events)
+	app.Get("/stats/sla", handler.SLA)
+
+	req := httptest.NewRequest("GET", "/tasks/"+task.ID+"/events", nil)
+	req.Header.Set("X-API-Key", "key-a")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	var events struct {
+		Data struct {
+			FinishedAt *time.Time         `json:"finished_at"`
+			Events     []domain.TaskEvent `json:"events"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&events))
+	assert.NotNil(t, events.Data.FinishedAt)
+
+	// Repeated progress of the same stage is not an event
+	var history []string
+	for _, event := range events.Data.Events {
+		history = append(history, string(event.Type)+":"+string(event.Status)+":"+event.Stage)
+	}
+	assert.Equal(t, []string{
+		"status:queued:",
+		"status:running:",
+		"stage:running:Fetching transactions",
+		"status:failed:Fetching transactions",
+	}, history)
+	assert.Equal(t, "worker-1", events.Data.Events[1].WorkerID)
+	assert.Equal(t, "boom", events.Data.Events[3].Message)
+
+	// Other API keys cannot see the events
+	req = httptest.NewRequest("GET", "/tasks/"+task.ID+"/events", nil)
+	req.Header.Set("X-API-Key", "key-b")
+	resp, _ = app.Test(req)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	// Twenty tasks queued on one day, waiting 1 to 20 seconds and running twice as long
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	for i := 1; i <= 20; i++ {
+		queued := day.Add(time.Duration(i) * time.Minute)
+		started := queued.Add(time.Duration(i) * time.Second)
+		finished := started.Add(time.Duration(2*i) * time.Second)
+		assert.NoError(t, db.Create(&domain.Task{
+			Status: domain.TaskStatusCompleted, QueuedAt: &queued, StartedAt: &started, FinishedAt: &finished,
+		}).Error)
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/stats/sla?from=2026-03-01&to=2026-03-02", nil))
+	assert.Equal(t, 200, resp.StatusCode)
+	var sla struct {
+		Data struct {
+			Days []domain.SLADay `json:"days"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&sla))
+	assert.Len(t, sla.Data.Days, 1)
+	report := sla.Data.Days[0]
+	assert.Equal(t, "2026-03-02", report.Date)
+	assert.Equal(t, 20, report.Tasks)
+	assert.Equal(t, 20, report.Completed)
+	assert.Equal(t, float64(10), report.WaitP50)
+	assert.Equal(t, float64(19), report.WaitP95)
+	assert.Equal(t, float64(20), report.WaitMax)
+	assert.Equal(t, float64(38), report.RunP95)
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/stats/sla?from=2026-01-01&to=2026-06-01", nil))
+	assert.Equal(t, 400, resp.StatusCode)
+}
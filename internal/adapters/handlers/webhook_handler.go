@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/api"
+	"pdf_generator/pkg/utils"
+)
+
+// WebhookHandler handles webhook registration and the delivery log
+type WebhookHandler struct {
+	webhookRepo  ports.WebhookRepository
+	taskRepo     ports.TaskRepository
+	settingsRepo ports.SettingsRepository
+	queue        ports.QueueService
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(webhookRepo ports.WebhookRepository, taskRepo ports.TaskRepository, settingsRepo ports.SettingsRepository, queue ports.QueueService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookRepo:  webhookRepo,
+		taskRepo:     taskRepo,
+		settingsRepo: settingsRepo,
+		queue:        queue,
+	}
+}
+
+// CreateWebhookRequest represents a webhook registration
+type CreateWebhookRequest struct {
+	URL      string                `json:"url"`
+	Events   []domain.WebhookEvent `json:"events"`     // Empty subscribes to all events
+	TaskID   string                `json:"task_id"`    // Only notify about this task
+	APIKeyID string                `json:"api_key_id"` // Admin only, empty registers a global webhook
+}
+
+// Create handles POST /webhooks
+// API key clients register webhooks for their own tasks, admins for any key or all tasks
+func (h *WebhookHandler) Create(c fiber.Ctx) error {
+	var req CreateWebhookRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return api.Error(c, api.CodeInvalidRequest, "Invalid request body")
+	}
+	if err := validateWebhook(c.Context(), h.settingsRepo, req.URL, req.Events); err != nil {
+		return api.Error(c, api.CodeValidationError, err.Error())
+	}
+
+	apiKeyID := req.APIKeyID
+	if caller := callerAPIKeyID(c); caller != "" {
+		apiKeyID = caller
+	}
+
+	if req.TaskID != "" {
+		task, err := h.taskRepo.GetByID(c.Context(), req.TaskID)
+		if err != nil || (apiKeyID != "" && task.APIKeyID != apiKeyID) {
+			return api.Error(c, api.CodeNotFound, "Task not found")
+		}
+	}
+
+	webhook, secret, err := newWebhook(req.URL, req.Events)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to generate webhook secret")
+	}
+	if req.TaskID != "" {
+		webhook.TaskID = &req.TaskID
+	}
+	if apiKeyID != "" {
+		webhook.APIKeyID = &apiKeyID
+	}
+	if err := h.webhookRepo.Create(c.Context(), webhook); err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to create webhook")
+	}
+
+	// The secret is only shown once
+	return api.Success(c, fiber.Map{
+		"webhook": webhook,
+		"secret":  secret,
+	})
+}
+
+// List handles GET /webhooks
+func (h *WebhookHandler) List(c fiber.Ctx) error {
+	filter := ports.WebhookFilter{
+		APIKeyID: c.Query("api_key_id"),
+		TaskID:   c.Query("task_id"),
+	}
+	if caller := callerAPIKeyID(c); caller != "" {
+		filter.APIKeyID = caller
+	}
+
+	webhooks, err := h.webhookRepo.List(c.Context(), filter)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to list webhooks")
+	}
+	return api.Success(c, webhooks)
+}
+
+// Delete handles DELETE /webhooks/:id
+func (h *WebhookHandler) Delete(c fiber.Ctx) error {
+	webhook, err := h.webhookRepo.GetByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return api.Error(c, api.CodeNotFound, "Webhook not found")
+	}
+	if caller := callerAPIKeyID(c); caller != "" && (webhook.APIKeyID == nil || *webhook.APIKeyID != caller) {
+		return api.Error(c, api.CodeNotFound, "Webhook not found")
+	}
+
+	if err := h.webhookRepo.Delete(c.Context(), webhook.ID); err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to delete webhook")
+	}
+	return api.Success(c, nil)
+}
+
+// ListDeliveries handles GET /webhooks/deliveries (Admin)
+func (h *WebhookHandler) ListDeliveries(c fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := ports.WebhookFilter{
+		WebhookID: c.Query("webhook_id"),
+		TaskID:    c.Query("task_id"),
+		Status:    c.Query("status"),
+		Page:      page,
+		Limit:     limit,
+	}
+
+	deliveries, total, err := h.webhookRepo.ListDeliveries(c.Context(), filter)
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to list webhook deliveries")
+	}
+
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	return api.Success(c, api.PaginatedResponse{
+		Items: deliveries,
+		Pagination: api.Pagination{
+			Total:      total,
+			Page:       page,
+			Limit:      limit,
+			TotalPages: totalPages,
+		},
+	})
+}
+
+// GetDelivery handles GET /webhooks/deliveries/:id (Admin)
+func (h *WebhookHandler) GetDelivery(c fiber.Ctx) error {
+	delivery, err := h.webhookRepo.GetDelivery(c.Context(), c.Params("id"))
+	if err != nil {
+		return api.Error(c, api.CodeNotFound, "Delivery not found")
+	}
+	return api.Success(c, delivery)
+}
+
+// Replay handles POST /webhooks/deliveries/:id/replay (Admin)
+// The original payload is sent again as a new delivery
+func (h *WebhookHandler) Replay(c fiber.Ctx) error {
+	if _, err := h.webhookRepo.GetDelivery(c.Context(), c.Params("id")); err != nil {
+		return api.Error(c, api.CodeNotFound, "Delivery not found")
+	}
+
+	delivery, err := h.queue.ReplayDelivery(c.Context(), c.Params("id"))
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to replay delivery: "+err.Error())
+	}
+	return api.Success(c, delivery)
+}
+
+// callerAPIKeyID returns the API key of the request, empty for admins
+func callerAPIKeyID(c fiber.Ctx) string {
+	if c.Locals("auth_type") != "api_key" {
+		return ""
+	}
+	id, _ := c.Locals("api_key_id").(string)
+	return id
+}
+
+// callerAPIKey returns the API key of the request with its limits, nil for admins
+func callerAPIKey(c fiber.Ctx) *domain.APIKey {
+	if c.Locals("auth_type") != "api_key" {
+		return nil
+	}
+	key, _ := c.Locals("api_key").(*domain.APIKey)
+	return key
+}
+
+// validateWebhook checks the callback URL and event names. The URL must resolve to public
+// addresses unless its host is listed in the webhook_allowed_hosts setting.
+func validateWebhook(ctx context.Context, settingsRepo ports.SettingsRepository, rawURL string, events []domain.WebhookEvent) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Webhook URL must be an absolute http or https URL")
+	}
+	if err := webhookPolicy(ctx, settingsRepo).CheckURL(ctx, rawURL); err != nil {
+		if errors.Is(err, utils.ErrAddressNotAllowed) {
+			return fmt.Errorf("Webhook URL must reach a public address: %w", err)
+		}
+		return fmt.Errorf("Webhook URL cannot be resolved: %w", err)
+	}
+	for _, event := range events {
+		if !event.Valid() {
+			names := make([]string, len(domain.WebhookEvents))
+			for i, e := range domain.WebhookEvents {
+				names[i] = string(e)
+			}
+			return fmt.Errorf("Unknown webhook event %q, must be one of %s", event, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// webhookPolicy reads the hosts webhooks may reach although they are not public
+func webhookPolicy(ctx context.Context, settingsRepo ports.SettingsRepository) utils.AddressPolicy {
+	var policy utils.AddressPolicy
+	if settingsRepo == nil {
+		return policy
+	}
+	if setting, err := settingsRepo.Get(ctx, domain.SettingWebhookAllowedHosts); err == nil {
+		if policy, err = utils.ParseAddressPolicy(setting.Value); err != nil {
+			log.Warn().Err(err).Msg("Invalid webhook_allowed_hosts setting, only public addresses are allowed")
+		}
+	}
+	return policy
+}
+
+// newWebhook creates an active webhook with a new signing secret, returned in plain text
+func newWebhook(rawURL string, events []domain.WebhookEvent) (*domain.Webhook, string, error) {
+	key, err := utils.GenerateRandomKey(24)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := "whsec_" + strings.TrimPrefix(key, "pk_")
+
+	encrypted, err := utils.Encrypt(secret)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &domain.Webhook{
+		URL:             rawURL,
+		Events:          events,
+		EncryptedSecret: encrypted,
+		Active:          true,
+	}, secret, nil
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v3"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/api"
+)
+
+// WorkerHandler handles worker registry endpoints
+type WorkerHandler struct {
+	workerRepo ports.WorkerRepository
+}
+
+// NewWorkerHandler creates a new worker handler
+func NewWorkerHandler(workerRepo ports.WorkerRepository) *WorkerHandler {
+	return &WorkerHandler{
+		workerRepo: workerRepo,
+	}
+}
+
+// List handles GET /workers (Admin)
+// Workers that missed their heartbeats are flagged as stale
+func (h *WorkerHandler) List(c fiber.Ctx) error {
+	workers, err := h.workerRepo.List(c.Context())
+	if err != nil {
+		return api.Error(c, api.CodeInternalError, "Failed to list workers")
+	}
+
+	stale := 0
+	for _, w := range workers {
+		if w.Stale {
+			stale++
+		}
+	}
+
+	return api.Success(c, fiber.Map{
+		"workers":     workers,
+		"stale_count": stale,
+		"stale_after": domain.WorkerStaleAfter.Seconds(),
+	})
+}
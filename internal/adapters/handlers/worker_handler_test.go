@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/adapters/handlers"
+	"pdf_generator/internal/adapters/repository"
+	"pdf_generator/internal/core/domain"
+)
+
+func TestWorkerHandler_List(t *testing.T) {
+	db := newTestDB(t, "workers")
+
+	ctx := context.Background()
+	repo := repository.NewWorkerRepository(db)
+
+	live := &domain.Worker{ID: "live", Host: "gen-01", PID: 100, Concurrency: 2, State: domain.WorkerStateRunning,
+		CurrentTasks: []string{"task-1"}, StartedAt: time.Now(), LastHeartbeat: time.Now()}
+	stale := &domain.Worker{ID: "stale", Host: "gen-02", PID: 200, State: domain.WorkerStateRunning,
+		StartedAt: time.Now().Add(-time.Hour), LastHeartbeat: time.Now().Add(-time.Minute)}
+	stopped := &domain.Worker{ID: "stopped", Host: "gen-03", PID: 300, State: domain.WorkerStateRunning,
+		StartedAt: time.Now().Add(-time.Hour), LastHeartbeat: time.Now()}
+	for _, w := range []*domain.Worker{live, stale, stopped} {
+		assert.NoError(t, repo.Save(ctx, w))
+	}
+	assert.NoError(t, repo.SetState(ctx, "stopped", domain.WorkerStateStopped))
+
+	app := fiber.New()
+	app.Get("/workers", handlers.NewWorkerHandler(repo).List)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/workers", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var result struct {
+		Data struct {
+			Workers    []domain.Worker `json:"workers"`
+			StaleCount int             `json:"stale_count"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, 1, result.Data.StaleCount)
+
+	byID := map[string]domain.Worker{}
+	for _, w := range result.Data.Workers {
+		byID[w.ID] = w
+	}
+	assert.False(t, byID["live"].Stale)
+	assert.Equal(t, []string{"task-1"}, byID["live"].CurrentTasks)
+	assert.True(t, byID["stale"].Stale)
+	assert.False(t, byID["stopped"].Stale)
+	assert.Equal(t, domain.WorkerStateStopped, byID["stopped"].State)
+	assert.Empty(t, byID["stopped"].CurrentTasks)
+}
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 
@@ -58,7 +60,25 @@ func AuthMiddleware(authService *services.AuthService, apiKeyService *services.A
 				return api.Error(c, api.CodeInvalidAPIKey, "Invalid API key")
 			}
 			c.Locals("api_key_id", key.ID)
+			c.Locals("api_key", key)
 			c.Locals("auth_type", "api_key")
+
+			// Lease and progress polling of remote workers is not counted against the key's rate limit
+			if key.Worker && isWorkerRoute(c.Path()) {
+				return c.Next()
+			}
+
+			limit := apiKeyService.Allow(key)
+			if limit.Limit > 0 {
+				c.Set("X-RateLimit-Limit", strconv.Itoa(limit.Limit))
+				c.Set("X-RateLimit-Remaining", strconv.Itoa(limit.Remaining))
+				c.Set("X-RateLimit-Reset", strconv.FormatInt(limit.Reset.Unix(), 10))
+			}
+			if !limit.Allowed {
+				retryAfter := int(time.Until(limit.Reset).Seconds()) + 1
+				c.Set("Retry-After", strconv.Itoa(retryAfter))
+				return api.Error(c, api.CodeRateLimited, "Rate limit exceeded, retry in "+strconv.Itoa(retryAfter)+" seconds")
+			}
 			return c.Next()
 		}
 
@@ -66,6 +86,11 @@ func AuthMiddleware(authService *services.AuthService, apiKeyService *services.A
 	}
 }
 
+// isWorkerRoute checks if the path belongs to the remote worker protocol
+func isWorkerRoute(path string) bool {
+	return strings.Contains(path, "/worker/")
+}
+
 // AdminOnly restricts access to admin users only (when security is enabled)
 func AdminOnly(settingsService *services.SettingsService) fiber.Handler {
 	return func(c fiber.Ctx) error {
@@ -88,3 +113,23 @@ func AdminOnly(settingsService *services.SettingsService) fiber.Handler {
 		return c.Next()
 	}
 }
+
+// WorkerKeyOnly restricts access to API keys of remote worker nodes (when security is enabled)
+func WorkerKeyOnly(settingsService *services.SettingsService) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		// Check if security is enabled
+		securityEnabled, _ := settingsService.Get(c.Context(), domain.SettingSecurityEnabled)
+		if securityEnabled != "true" {
+			// Security disabled - allow all requests
+			return c.Next()
+		}
+
+		if c.Locals("auth_type") != "api_key" {
+			return api.Error(c, api.CodeUnauthorized, "API key required")
+		}
+		if key, ok := c.Locals("api_key").(*domain.APIKey); !ok || !key.Worker {
+			return api.Error(c, api.CodeUnauthorized, "Worker API key required")
+		}
+		return c.Next()
+	}
+}
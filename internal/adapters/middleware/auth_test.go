@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/internal/core/services"
+	"pdf_generator/pkg/utils"
+)
+
+type mockAPIKeyRepo struct {
+	keys []domain.APIKey
+}
+
+func (m *mockAPIKeyRepo) Create(ctx context.Context, key *domain.APIKey) error { return nil }
+func (m *mockAPIKeyRepo) GetByID(ctx context.Context, id string) (*domain.APIKey, error) {
+	return nil, nil
+}
+func (m *mockAPIKeyRepo) GetByKeyHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	return nil, nil
+}
+func (m *mockAPIKeyRepo) Update(ctx context.Context, key *domain.APIKey) error { return nil }
+func (m *mockAPIKeyRepo) Delete(ctx context.Context, id string) error          { return nil }
+func (m *mockAPIKeyRepo) List(ctx context.Context) ([]domain.APIKey, error)    { return m.keys, nil }
+
+var _ ports.APIKeyRepository = &mockAPIKeyRepo{}
+
+func TestWorkerKeyOnly(t *testing.T) {
+	mockRepo := &mockSettingsRepo{settings: map[string]string{domain.SettingSecurityEnabled: "true"}}
+	settingsService := services.NewSettingsService(mockRepo)
+
+	app := fiber.New()
+	app.Post("/worker/lease", func(c fiber.Ctx) error {
+		// Stands in for AuthMiddleware
+		switch c.Get("X-Test-Auth") {
+		case "worker":
+			c.Locals("auth_type", "api_key")
+			c.Locals("api_key", &domain.APIKey{ID: "worker", Worker: true})
+		case "integration":
+			c.Locals("auth_type", "api_key")
+			c.Locals("api_key", &domain.APIKey{ID: "integration"})
+		case "admin":
+			c.Locals("auth_type", "admin")
+		}
+		return c.Next()
+	}, WorkerKeyOnly(settingsService), func(c fiber.Ctx) error {
+		return c.SendString("leased")
+	})
+
+	status := func(auth string) int {
+		req := httptest.NewRequest("POST", "/worker/lease", nil)
+		req.Header.Set("X-Test-Auth", auth)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+	assert.Equal(t, 200, status("worker"))
+	assert.Equal(t, 401, status("integration"))
+	assert.Equal(t, 401, status("admin"))
+
+	// Without security every client is allowed
+	assert.NoError(t, settingsService.Set(t.Context(), domain.SettingSecurityEnabled, "false"))
+	assert.Equal(t, 200, status("integration"))
+}
+
+func TestAuthMiddleware_WorkerRoutesNotRateLimited(t *testing.T) {
+	settingsService := services.NewSettingsService(&mockSettingsRepo{settings: map[string]string{domain.SettingSecurityEnabled: "true"}})
+	keyHash := func(raw string) string {
+		hash, err := utils.HashPassword(raw)
+		assert.NoError(t, err)
+		return hash
+	}
+	limits := domain.APIKeyLimits{RequestsPerMinute: 1}
+	apiKeyService := services.NewAPIKeyService(&mockAPIKeyRepo{keys: []domain.APIKey{
+		{ID: "worker", KeyHash: keyHash("worker-key"), Active: true, Worker: true, APIKeyLimits: limits},
+		{ID: "integration", KeyHash: keyHash("integration-key"), Active: true, APIKeyLimits: limits},
+	}})
+
+	app := fiber.New()
+	app.Use(AuthMiddleware(nil, apiKeyService, settingsService))
+	app.Post("/api/queue", func(c fiber.Ctx) error { return c.SendString("queued") })
+	app.Post("/api/worker/lease", func(c fiber.Ctx) error { return c.SendString("leased") })
+
+	status := func(path, key string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("X-API-Key", key)
+		// Keys are checked against bcrypt hashes, which can exceed the default test timeout
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 30 * time.Second, FailOnTimeout: true})
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// Worker polling does not use up the budget of the worker key
+	for range 3 {
+		assert.Equal(t, 200, status("/api/worker/lease", "worker-key"))
+	}
+	assert.Equal(t, 200, status("/api/queue", "worker-key"))
+	assert.Equal(t, 429, status("/api/queue", "worker-key"))
+
+	// Other keys are counted on every route
+	assert.Equal(t, 200, status("/api/worker/lease", "integration-key"))
+	assert.Equal(t, 429, status("/api/worker/lease", "integration-key"))
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/internal/core/services"
+	"pdf_generator/pkg/api"
+	"pdf_generator/pkg/utils"
+)
+
+// IdempotencyKeyHeader is the request header carrying the client-chosen key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyPurgeInterval limits how often expired records are removed
+const idempotencyPurgeInterval = time.Hour
+
+// idempotencyPendingTTL releases the key of a request that never finished, e.g. after a crash
+const idempotencyPendingTTL = 5 * time.Minute
+
+// IdempotencyMiddleware replays the stored response of a previous request made with the same
+// Idempotency-Key header by the same caller. Keys are scoped per caller and expire after
+// the configured window. Must run after AuthMiddleware.
+func IdempotencyMiddleware(repo ports.IdempotencyRepository, settingsService *services.SettingsService) fiber.Handler {
+	var lastPurge atomic.Int64
+
+	return func(c fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > 255 {
+			return api.Error(c, api.CodeInvalidRequest, "Idempotency-Key must be at most 255 characters")
+		}
+
+		ctx := c.Context()
+		recordKey := utils.HashSHA256(idempotencyScope(c) + ":" + key)
+		requestHash := utils.HashSHA256(c.Method() + " " + c.Path() + "\n" + string(c.Body()))
+
+		if record, err := repo.Get(ctx, recordKey); err == nil {
+			if !record.IsExpired() {
+				return replay(c, record, requestHash)
+			}
+			if err := repo.Delete(ctx, recordKey); err != nil {
+				log.Warn().Err(err).Msg("Failed to remove expired idempotency record")
+			}
+		}
+
+		// Reserve the key, so a retry arriving while this request runs is not executed too
+		pending := &domain.IdempotencyRecord{
+			Key:         recordKey,
+			RequestHash: requestHash,
+			ExpiresAt:   time.Now().Add(idempotencyPendingTTL),
+		}
+		reserved, err := repo.Reserve(ctx, pending)
+		if err != nil {
+			return api.Error(c, api.CodeInternalError, "Failed to reserve Idempotency-Key")
+		}
+		if !reserved {
+			record, err := repo.Get(ctx, recordKey)
+			if err != nil {
+				return api.Error(c, api.CodeRequestInProgress, "A request with this Idempotency-Key is in progress")
+			}
+			return replay(c, record, requestHash)
+		}
+
+		// Only successful responses are stored so that failed requests can be retried
+		stored := false
+		defer func() {
+			if !stored {
+				if err := repo.Delete(ctx, recordKey); err != nil {
+					log.Warn().Err(err).Msg("Failed to release Idempotency-Key")
+				}
+			}
+		}()
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		status := c.Response().StatusCode()
+		if status < 200 || status >= 300 {
+			return nil
+		}
+
+		record := &domain.IdempotencyRecord{
+			Key:         recordKey,
+			RequestHash: requestHash,
+			StatusCode:  status,
+			Response:    string(c.Response().Body()),
+			ExpiresAt:   time.Now().Add(idempotencyWindow(c, settingsService)),
+		}
+		if err := repo.Save(ctx, record); err != nil {
+			log.Warn().Err(err).Msg("Failed to store idempotency record")
+		} else {
+			stored = true
+		}
+
+		now := time.Now().Unix()
+		if last := lastPurge.Load(); now-last >= int64(idempotencyPurgeInterval.Seconds()) && lastPurge.CompareAndSwap(last, now) {
+			if err := repo.DeleteExpired(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to purge expired idempotency records")
+			}
+		}
+
+		return nil
+	}
+}
+
+// replay answers a request with the record of an earlier request made with the same key
+func replay(c fiber.Ctx, record *domain.IdempotencyRecord, requestHash string) error {
+	if record.RequestHash != requestHash {
+		return api.Error(c, api.CodeValidationError, "Idempotency-Key was already used for a different request")
+	}
+	if record.IsPending() {
+		c.Set("Retry-After", "1")
+		return api.Error(c, api.CodeRequestInProgress, "A request with this Idempotency-Key is in progress")
+	}
+	c.Set("Idempotent-Replayed", "true")
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Status(record.StatusCode).SendString(record.Response)
+}
+
+// idempotencyScope identifies the caller so that keys from different clients never collide
+func idempotencyScope(c fiber.Ctx) string {
+	if id := c.Locals("api_key_id"); id != nil {
+		return fmt.Sprintf("api_key:%v", id)
+	}
+	if id := c.Locals("user_id"); id != nil {
+		return fmt.Sprintf("user:%v", id)
+	}
+	return "anonymous"
+}
+
+func idempotencyWindow(c fiber.Ctx, settingsService *services.SettingsService) time.Duration {
+	hours := 24
+	if val, err := settingsService.Get(c.Context(), domain.SettingIdempotencyWindowHrs); err == nil {
+		if h, err := strconv.Atoi(val); err == nil && h > 0 {
+			hours = h
+		}
+	}
+	return time.Duration(hours) * time.Hour
+}
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/internal/core/services"
+)
+
+type mockIdempotencyRepo struct {
+	mu      sync.Mutex
+	records map[string]*domain.IdempotencyRecord
+}
+
+func (m *mockIdempotencyRepo) Get(ctx context.Context, key string) (*domain.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.records[key]; ok {
+		return r, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+func (m *mockIdempotencyRepo) Save(ctx context.Context, record *domain.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[record.Key] = record
+	return nil
+}
+func (m *mockIdempotencyRepo) Reserve(ctx context.Context, record *domain.IdempotencyRecord) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.records[record.Key]; ok {
+		return false, nil
+	}
+	m.records[record.Key] = record
+	return true, nil
+}
+func (m *mockIdempotencyRepo) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+	return nil
+}
+func (m *mockIdempotencyRepo) DeleteExpired(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, r := range m.records {
+		if r.IsExpired() {
+			delete(m.records, k)
+		}
+	}
+	return nil
+}
+
+var _ ports.IdempotencyRepository = &mockIdempotencyRepo{}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	repo := &mockIdempotencyRepo{records: make(map[string]*domain.IdempotencyRecord)}
+	settingsService := services.NewSettingsService(&mockSettingsRepo{settings: map[string]string{
+		domain.SettingIdempotencyWindowHrs: "1",
+	}})
+
+	calls := 0
+	started := make(chan struct{})
+	release := make(chan struct{})
+	app := fiber.New()
+	app.Post("/queue", func(c fiber.Ctx) error {
+		c.Locals("api_key_id", c.Get("X-Caller"))
+		return c.Next()
+	}, IdempotencyMiddleware(repo, settingsService), func(c fiber.Ctx) error {
+		calls++
+		switch c.Get("X-Behavior") {
+		case "fail":
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"call": calls})
+		case "block":
+			started <- struct{}{}
+			<-release
+		}
+		return c.JSON(fiber.Map{"call": calls})
+	})
+
+	sendAs := func(behavior, key, caller, body string) (int, string, string) {
+		req := httptest.NewRequest("POST", "/queue", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Caller", caller)
+		req.Header.Set("X-Behavior", behavior)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data), resp.Header.Get("Idempotent-Replayed")
+	}
+	send := func(key, caller, body string) (int, string, string) {
+		return sendAs("", key, caller, body)
+	}
+
+	t.Run("First request executes", func(t *testing.T) {
+		status, body, replayed := send("key-1", "a", `{"x":1}`)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"call":1}`, body)
+		assert.Empty(t, replayed)
+	})
+
+	t.Run("Retry replays stored response", func(t *testing.T) {
+		status, body, replayed := send("key-1", "a", `{"x":1}`)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"call":1}`, body)
+		assert.Equal(t, "true", replayed)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Same key with different body is rejected", func(t *testing.T) {
+		status, _, _ := send("key-1", "a", `{"x":2}`)
+		assert.Equal(t, 400, status)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Keys are scoped per caller", func(t *testing.T) {
+		status, body, _ := send("key-1", "b", `{"x":1}`)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"call":2}`, body)
+	})
+
+	t.Run("Expired record is not replayed", func(t *testing.T) {
+		for _, r := range repo.records {
+			r.ExpiresAt = time.Now().Add(-time.Minute)
+		}
+		status, body, replayed := send("key-1", "a", `{"x":1}`)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"call":3}`, body)
+		assert.Empty(t, replayed)
+	})
+
+	t.Run("Requests without key are not stored", func(t *testing.T) {
+		before := len(repo.records)
+		send("", "a", `{"x":1}`)
+		send("", "a", `{"x":1}`)
+		assert.Equal(t, 5, calls)
+		assert.Equal(t, before, len(repo.records))
+	})
+
+	t.Run("Failed request releases the key", func(t *testing.T) {
+		status, _, _ := sendAs("fail", "key-2", "a", `{"x":1}`)
+		assert.Equal(t, 500, status)
+
+		status, body, replayed := send("key-2", "a", `{"x":1}`)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"call":7}`, body)
+		assert.Empty(t, replayed)
+	})
+
+	t.Run("Concurrent request with the same key is rejected", func(t *testing.T) {
+		done := make(chan int)
+		go func() {
+			status, _, _ := sendAs("block", "key-3", "a", `{"x":1}`)
+			done <- status
+		}()
+		<-started
+
+		status, _, _ := send("key-3", "a", `{"x":1}`)
+		assert.Equal(t, 409, status)
+
+		close(release)
+		assert.Equal(t, 200, <-done)
+		assert.Equal(t, 8, calls)
+
+		status, body, replayed := send("key-3", "a", `{"x":1}`)
+		assert.Equal(t, 200, status)
+		assert.JSONEq(t, `{"call":8}`, body)
+		assert.Equal(t, "true", replayed)
+	})
+}
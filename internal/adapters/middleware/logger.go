@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
 	"strings"
 	"time"
 
@@ -24,6 +26,11 @@ func LoggerMiddleware() fiber.Handler {
 		duration := time.Since(start)
 		path := c.Path()
 
+		// Worker progress is pushed several times per second, only failures are worth logging
+		if strings.HasPrefix(path, "/api/internal/") && c.Response().StatusCode() == fiber.StatusOK {
+			return err
+		}
+
         // Read response body
         resBody := c.Response().Body()
 		
@@ -41,13 +48,13 @@ func LoggerMiddleware() fiber.Handler {
 			Dur("duration", duration).
 			Str("ip", c.IP())
         
-        // Add bodies for API requests if not too large
+        // Add bodies for API requests if not too large, with secrets redacted
         if strings.HasPrefix(path, "/api") {
-            if len(reqBody) > 0 && len(reqBody) < 2048 {
-                 evt.Str("req_body", string(reqBody))
+            if body, ok := redactBody(reqBody); ok {
+                 evt.Str("req_body", body)
             }
-             if len(resBody) > 0 && len(resBody) < 2048 {
-                 evt.Str("res_body", string(resBody))
+            if body, ok := redactBody(resBody); ok {
+                 evt.Str("res_body", body)
             }
         }
 
@@ -56,3 +63,65 @@ func LoggerMiddleware() fiber.Handler {
 		return err
 	}
 }
+
+// maxLoggedBody is the size up to which API request and response bodies are logged
+const maxLoggedBody = 2048
+
+// redacted replaces the values of secret fields in logged bodies
+const redacted = "[REDACTED]"
+
+// redactBody returns a JSON body for the log with the values of secret fields redacted.
+// Bodies that are empty, too large or not JSON are not logged.
+func redactBody(body []byte) (string, bool) {
+	if len(body) == 0 || len(body) >= maxLoggedBody {
+		return "", false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+	out, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return "", false
+	}
+	return string(out), true
+}
+
+// redactValue redacts the secret fields of decoded JSON. A setting, an object with a key
+// and a value, has its value redacted when the key names a secret.
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		name, isSetting := v["key"].(string)
+		if _, ok := v["value"]; isSetting && ok {
+			if secretField(name) {
+				v["value"] = redacted
+			}
+		}
+		for field, fieldValue := range v {
+			if secretField(field) && !(isSetting && field == "key") {
+				v[field] = redacted
+				continue
+			}
+			v[field] = redactValue(fieldValue)
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return value
+}
+
+// secretField checks if a field name, e.g. callback_secret, password, token or api_key, holds a credential
+func secretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range []string{"secret", "password", "token"} {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return name == "key" || strings.HasSuffix(name, "_key") || strings.HasSuffix(name, "apikey")
+}
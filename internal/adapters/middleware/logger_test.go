@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "task with callback secret",
+			body: `{"success":true,"data":{"task_id":"t1","callback_secret":"cbs_1","api_key_id":"k1"}}`,
+			want: `{"data":{"api_key_id":"k1","callback_secret":"[REDACTED]","task_id":"t1"},"success":true}`,
+		},
+		{
+			name: "login",
+			body: `{"username":"admin","password":"hunter2"}`,
+			want: `{"password":"[REDACTED]","username":"admin"}`,
+		},
+		{
+			name: "created API key and token",
+			body: `{"data":{"id":"k1","api_key":"pk_1","token":"jwt"}}`,
+			want: `{"data":{"api_key":"[REDACTED]","id":"k1","token":"[REDACTED]"}}`,
+		},
+		{
+			name: "secret setting",
+			body: `{"key":"smtp_password","value":"hunter2"}`,
+			want: `{"key":"smtp_password","value":"[REDACTED]"}`,
+		},
+		{
+			name: "other setting",
+			body: `{"key":"page_size","value":"A4"}`,
+			want: `{"key":"page_size","value":"A4"}`,
+		},
+		{
+			name: "webhooks in a list",
+			body: `[{"url":"https://example.com","secret":"whsec_1","events":["task.completed"]}]`,
+			want: `[{"events":["task.completed"],"secret":"[REDACTED]","url":"https://example.com"}]`,
+		},
+		{
+			name: "numbers are kept as sent",
+			body: `{"size":12345678901234567890}`,
+			want: `{"size":12345678901234567890}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := redactBody([]byte(tt.body))
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// Bodies that are not JSON or too large are not logged
+	for _, body := range []string{"", "password=hunter2", `{"a":"` + strings.Repeat("x", maxLoggedBody) + `"}`} {
+		_, ok := redactBody([]byte(body))
+		assert.False(t, ok)
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"pdf_generator/pkg/metrics"
+)
+
+// MetricsMiddleware counts requests and their latency by method and route pattern.
+// Route patterns (e.g. /api/tasks/:id) keep the number of series bounded.
+func MetricsMiddleware() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		route := c.Route().Path
+		metrics.HTTPRequests.Inc(c.Method(), route, strconv.Itoa(status))
+		metrics.HTTPDuration.ObserveDuration(start, c.Method(), route)
+		return err
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/pkg/metrics"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(MetricsMiddleware())
+	app.Get("/metrics-test/:id", func(c fiber.Ctx) error {
+		if c.Params("id") == "missing" {
+			return fiber.ErrNotFound
+		}
+		return c.SendString("ok")
+	})
+
+	for _, path := range []string{"/metrics-test/1", "/metrics-test/2", "/metrics-test/missing"} {
+		_, err := app.Test(httptest.NewRequest("GET", path, nil))
+		assert.NoError(t, err)
+	}
+
+	var out strings.Builder
+	assert.NoError(t, metrics.Default.Write(context.Background(), &out))
+	// Requests are grouped by route pattern, not by path
+	assert.Contains(t, out.String(), `datalane_http_requests_total{method="GET",route="/metrics-test/:id",status="200"} 2`)
+	assert.Contains(t, out.String(), `datalane_http_requests_total{method="GET",route="/metrics-test/:id",status="404"} 1`)
+	assert.Contains(t, out.String(), `datalane_http_request_duration_seconds_count{method="GET",route="/metrics-test/:id"} 3`)
+}
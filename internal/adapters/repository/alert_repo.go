@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+)
+
+type alertRepository struct {
+	db *gorm.DB
+}
+
+// NewAlertRepository creates a new alert repository
+func NewAlertRepository(db *gorm.DB) ports.AlertRepository {
+	return &alertRepository{db: db}
+}
+
+func (r *alertRepository) Create(ctx context.Context, alert *domain.Alert) error {
+	return r.db.WithContext(ctx).Create(alert).Error
+}
+
+func (r *alertRepository) Update(ctx context.Context, alert *domain.Alert) error {
+	return r.db.WithContext(ctx).Save(alert).Error
+}
+
+func (r *alertRepository) ListOpen(ctx context.Context) ([]domain.Alert, error) {
+	var alerts []domain.Alert
+	err := r.db.WithContext(ctx).
+		Where("status = ?", domain.AlertStatusOpen).
+		Order("opened_at ASC").
+		Find(&alerts).Error
+	return alerts, err
+}
+
+func (r *alertRepository) List(ctx context.Context, filter ports.AlertFilter) ([]domain.Alert, int64, error) {
+	var alerts []domain.Alert
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&domain.Alert{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Rule != "" {
+		query = query.Where("rule = ?", filter.Rule)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit > 0 {
+		offset := (filter.Page - 1) * filter.Limit
+		if offset < 0 {
+			offset = 0
+		}
+		query = query.Offset(offset).Limit(filter.Limit)
+	}
+
+	err := query.Order("opened_at DESC").Find(&alerts).Error
+	return alerts, total, err
+}
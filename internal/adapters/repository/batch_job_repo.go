@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+)
+
+type batchJobRepository struct {
+	db *gorm.DB
+}
+
+// NewBatchJobRepository creates a new batch job repository
+func NewBatchJobRepository(db *gorm.DB) ports.BatchJobRepository {
+	return &batchJobRepository{db: db}
+}
+
+// Create stores the job together with its tasks, so a job never exists with only part of them
+func (r *batchJobRepository) Create(ctx context.Context, job *domain.BatchJob, tasks []domain.Task) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		job.TotalTasks = len(tasks)
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		for i := range tasks {
+			tasks[i].ParentID = &job.ID
+			if err := createTask(tx, &tasks[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *batchJobRepository) GetByID(ctx context.Context, id string) (*domain.BatchJob, error) {
+	var job domain.BatchJob
+	err := r.db.WithContext(ctx).First(&job, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *batchJobRepository) List(ctx context.Context, filter ports.BatchJobFilter) ([]domain.BatchJob, int64, error) {
+	var jobs []domain.BatchJob
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&domain.BatchJob{})
+	if filter.APIKeyID != "" {
+		query = query.Where("api_key_id = ?", filter.APIKeyID)
+	}
+	query.Count(&total)
+
+	if filter.Limit <= 0 {
+		filter.Limit = 10
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	offset := (filter.Page - 1) * filter.Limit
+
+	err := query.Order("created_at DESC").Offset(offset).Limit(filter.Limit).Find(&jobs).Error
+	return jobs, total, err
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"fmt"
 
 	"gorm.io/gorm"
 
@@ -80,3 +81,18 @@ func (r *gateRepository) BatchUpdate(ctx context.Context, gates []domain.Gate) e
 func (r *gateRepository) BatchDelete(ctx context.Context, ids []int) error {
 	return r.db.WithContext(ctx).Delete(&domain.Gate{}, "id IN ?", ids).Error
 }
+
+// Revision changes whenever a gate is created, updated or deleted
+func (r *gateRepository) Revision(ctx context.Context) (string, error) {
+	var rev struct {
+		Count     int64
+		UpdatedAt string
+	}
+	err := r.db.WithContext(ctx).Model(&domain.Gate{}).
+		Select("COUNT(*) AS count, COALESCE(MAX(updated_at), '') AS updated_at").
+		Scan(&rev).Error
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%s", rev.Count, rev.UpdatedAt), nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+)
+
+type idempotencyRepository struct {
+	db *gorm.DB
+}
+
+// NewIdempotencyRepository creates a new idempotency record repository
+func NewIdempotencyRepository(db *gorm.DB) ports.IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+func (r *idempotencyRepository) Get(ctx context.Context, key string) (*domain.IdempotencyRecord, error) {
+	var record domain.IdempotencyRecord
+	err := r.db.WithContext(ctx).Where("key = ?", key).First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *idempotencyRepository) Save(ctx context.Context, record *domain.IdempotencyRecord) error {
+	return r.db.WithContext(ctx).Save(record).Error
+}
+
+func (r *idempotencyRepository) Reserve(ctx context.Context, record *domain.IdempotencyRecord) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *idempotencyRepository) Delete(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Delete(&domain.IdempotencyRecord{}, "key = ?", key).Error
+}
+
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context) error {
+	return r.db.WithContext(ctx).Delete(&domain.IdempotencyRecord{}, "expires_at < ?", time.Now()).Error
+}
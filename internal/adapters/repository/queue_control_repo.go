@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+)
+
+type queueControlRepository struct {
+	db *gorm.DB
+}
+
+// NewQueueControlRepository creates a new queue control repository
+func NewQueueControlRepository(db *gorm.DB) ports.QueueControlRepository {
+	return &queueControlRepository{db: db}
+}
+
+func (r *queueControlRepository) Get(ctx context.Context) (*domain.QueueControl, error) {
+	control := domain.QueueControl{ID: domain.QueueControlID, State: domain.QueueStateRunning}
+	err := r.db.WithContext(ctx).FirstOrCreate(&control, domain.QueueControl{ID: domain.QueueControlID}).Error
+	if err != nil {
+		return nil, err
+	}
+	return &control, nil
+}
+
+func (r *queueControlRepository) SetPaused(ctx context.Context, paused bool) (*domain.QueueControl, error) {
+	control, err := r.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]any{"paused": paused}
+	// Reflect a pending pause immediately, the worker reports "paused" once running tasks finish
+	if paused && control.State == domain.QueueStateRunning {
+		updates["state"] = domain.QueueStatePausing
+	}
+
+	if err := r.db.WithContext(ctx).Model(control).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return r.Get(ctx)
+}
+
+func (r *queueControlRepository) Report(ctx context.Context, state domain.QueueState, workers, running int) error {
+	if _, err := r.Get(ctx); err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Model(&domain.QueueControl{ID: domain.QueueControlID}).Updates(map[string]any{
+		"state":       state,
+		"workers":     workers,
+		"running":     running,
+		"reported_at": time.Now(),
+	}).Error
+}
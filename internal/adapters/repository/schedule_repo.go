@@ -45,8 +45,13 @@ func (r *scheduleRepository) ListActive(ctx context.Context) ([]domain.Schedule,
 	return schedules, err
 }
 
-func (r *scheduleRepository) List(ctx context.Context) ([]domain.Schedule, error) {
+// List returns all schedules, or those of an API key when apiKeyID is set
+func (r *scheduleRepository) List(ctx context.Context, apiKeyID string) ([]domain.Schedule, error) {
 	var schedules []domain.Schedule
-	err := r.db.WithContext(ctx).Order("created_at DESC").Find(&schedules).Error
+	query := r.db.WithContext(ctx)
+	if apiKeyID != "" {
+		query = query.Where("api_key_id = ?", apiKeyID)
+	}
+	err := query.Order("created_at DESC").Find(&schedules).Error
 	return schedules, err
 }
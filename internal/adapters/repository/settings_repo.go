@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"fmt"
 
 	"gorm.io/gorm"
 
@@ -36,3 +37,18 @@ func (r *settingsRepository) GetAll(ctx context.Context) ([]domain.Settings, err
 	err := r.db.WithContext(ctx).Order("sort_order asc").Find(&settings).Error
 	return settings, err
 }
+
+// Revision changes whenever a setting is saved
+func (r *settingsRepository) Revision(ctx context.Context) (string, error) {
+	var rev struct {
+		Count     int64
+		UpdatedAt string
+	}
+	err := r.db.WithContext(ctx).Model(&domain.Settings{}).
+		Select("COUNT(*) AS count, COALESCE(MAX(updated_at), '') AS updated_at").
+		Scan(&rev).Error
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%s", rev.Count, rev.UpdatedAt), nil
+}
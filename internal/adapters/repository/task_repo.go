@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -20,7 +21,27 @@ func NewTaskRepository(db *gorm.DB) ports.TaskRepository {
 }
 
 func (r *taskRepository) Create(ctx context.Context, task *domain.Task) error {
-	return r.db.WithContext(ctx).Create(task).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createTask(tx, task)
+	})
+}
+
+// createTask stores a new task and records its first lifecycle event
+func createTask(tx *gorm.DB, task *domain.Task) error {
+	event := task.Transition("", "", time.Now())
+	if err := tx.Create(task).Error; err != nil {
+		return err
+	}
+	return recordEvent(tx, task, event)
+}
+
+// recordEvent stores the lifecycle event of a transition, if any
+func recordEvent(tx *gorm.DB, task *domain.Task, event *domain.TaskEvent) error {
+	if event == nil {
+		return nil
+	}
+	event.TaskID = task.ID
+	return tx.Create(event).Error
 }
 
 func (r *taskRepository) GetByID(ctx context.Context, id string) (*domain.Task, error) {
@@ -32,27 +53,143 @@ func (r *taskRepository) GetByID(ctx context.Context, id string) (*domain.Task,
 	return &task, nil
 }
 
+// Update saves the task and records an event when its status or progress stage changed
 func (r *taskRepository) Update(ctx context.Context, task *domain.Task) error {
-	return r.db.WithContext(ctx).Save(task).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		prev, err := storedState(tx, task.ID)
+		if err != nil {
+			return err
+		}
+		event := task.Transition(prev.Status, prev.ProgressStage, time.Now())
+		if err := tx.Save(task).Error; err != nil {
+			return err
+		}
+		return recordEvent(tx, task, event)
+	})
+}
+
+// storedState loads the stored status and progress stage of a task, empty when it does not exist yet
+func storedState(tx *gorm.DB, id string) (domain.Task, error) {
+	var prev domain.Task
+	err := tx.Model(&domain.Task{}).Select("status", "progress_stage", "worker_id").Where("id = ?", id).Limit(1).Scan(&prev).Error
+	return prev, err
 }
 
 func (r *taskRepository) UpdateProgress(ctx context.Context, id string, stage string, current, total int) error {
-	return r.db.WithContext(ctx).Model(&domain.Task{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"progress_stage":   stage,
-		"progress_current": current,
-		"progress_total":   total,
-	}).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		prev, err := storedState(tx, id)
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&domain.Task{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"progress_stage":   stage,
+			"progress_current": current,
+			"progress_total":   total,
+		}).Error
+		if err != nil || stage == prev.ProgressStage || stage == "" || prev.Status == "" {
+			return err
+		}
+		return tx.Create(&domain.TaskEvent{
+			TaskID:   id,
+			Type:     domain.TaskEventStage,
+			Status:   prev.Status,
+			Stage:    stage,
+			WorkerID: prev.WorkerID,
+		}).Error
+	})
+}
+
+// AddChunk records a rendered chunk on the task, replacing the chunks of an earlier render it restarts
+func (r *taskRepository) AddChunk(ctx context.Context, id string, chunk domain.TaskChunk) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var task domain.Task
+		if err := tx.Select("id", "chunks_json").First(&task, "id = ?", id).Error; err != nil {
+			return err
+		}
+		data, err := json.Marshal(domain.WithChunk(task.Chunks, chunk))
+		if err != nil {
+			return err
+		}
+		return tx.Model(&domain.Task{}).Where("id = ?", id).UpdateColumn("chunks_json", string(data)).Error
+	})
+}
+
+// AddSource records the data source file version a date was read from, replacing an earlier read of the date
+func (r *taskRepository) AddSource(ctx context.Context, id string, source domain.TaskSource) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var task domain.Task
+		if err := tx.Select("id", "sources_json").First(&task, "id = ?", id).Error; err != nil {
+			return err
+		}
+		data, err := json.Marshal(domain.WithSource(task.Sources, source))
+		if err != nil {
+			return err
+		}
+		return tx.Model(&domain.Task{}).Where("id = ?", id).UpdateColumn("sources_json", string(data)).Error
+	})
 }
 
-func (r *taskRepository) UpdateError(ctx context.Context, id string, errMsg string) error {
-	return r.db.WithContext(ctx).Model(&domain.Task{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"status":        domain.TaskStatusFailed,
-		"error_message": errMsg,
-	}).Error
+func (r *taskRepository) UpdateError(ctx context.Context, id string, code domain.TaskErrorCode, errMsg string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		prev, err := storedState(tx, id)
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"status":        domain.TaskStatusFailed,
+			"error_message": errMsg,
+			"error_code":    code,
+		}
+		// Only a change of status is an event, the task may also be gone already
+		if prev.Status == domain.TaskStatusFailed || prev.Status == "" {
+			return tx.Model(&domain.Task{}).Where("id = ?", id).Updates(updates).Error
+		}
+		now := time.Now()
+		updates["finished_at"] = now
+		if err := tx.Model(&domain.Task{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&domain.TaskEvent{
+			TaskID:    id,
+			Type:      domain.TaskEventStatus,
+			Status:    domain.TaskStatusFailed,
+			Stage:     prev.ProgressStage,
+			WorkerID:  prev.WorkerID,
+			Message:   errMsg,
+			CreatedAt: now,
+		}).Error
+	})
 }
 
+// Delete removes the task and its lifecycle events
 func (r *taskRepository) Delete(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Delete(&domain.Task{}, "id = ?", id).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&domain.TaskEvent{}, "task_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.Task{}, "id = ?", id).Error
+	})
+}
+
+// ListEvents returns the lifecycle events of a task, oldest first
+func (r *taskRepository) ListEvents(ctx context.Context, taskID string) ([]domain.TaskEvent, error) {
+	var events []domain.TaskEvent
+	err := r.db.WithContext(ctx).
+		Where("task_id = ?", taskID).
+		Order("created_at ASC, id ASC").
+		Find(&events).Error
+	return events, err
+}
+
+// ListTimings returns the finished tasks queued in [from, to), for SLA reports
+func (r *taskRepository) ListTimings(ctx context.Context, from, to time.Time) ([]domain.Task, error) {
+	var tasks []domain.Task
+	err := r.db.WithContext(ctx).
+		Select("id", "status", "queued_at", "started_at", "finished_at").
+		Where("queued_at >= ? AND queued_at < ? AND finished_at IS NOT NULL", from, to).
+		Order("queued_at ASC").
+		Find(&tasks).Error
+	return tasks, err
 }
 
 func (r *taskRepository) List(ctx context.Context, filter ports.TaskFilter) ([]domain.Task, int64, error) {
@@ -64,6 +201,9 @@ func (r *taskRepository) List(ctx context.Context, filter ports.TaskFilter) ([]d
 	if filter.Status != "" {
 		query = query.Where("status = ?", filter.Status)
 	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
 	if filter.FromDate != "" {
 		query = query.Where("created_at >= ?", filter.FromDate)
 	}
@@ -76,6 +216,25 @@ func (r *taskRepository) List(ctx context.Context, filter ports.TaskFilter) ([]d
 	if filter.StationID != nil {
 		query = query.Where("station_id = ?", *filter.StationID)
 	}
+	if filter.ParentID != "" {
+		query = query.Where("parent_id = ?", filter.ParentID)
+	}
+	if filter.APIKeyID != "" {
+		query = query.Where("api_key_id = ?", filter.APIKeyID)
+	}
+	if filter.Creator != "" {
+		query = query.Where("creator_type = ?", filter.Creator)
+	}
+	if filter.CreatorID != "" {
+		query = query.Where("creator_id = ?", filter.CreatorID)
+	}
+	if filter.Archived != nil {
+		if *filter.Archived {
+			query = query.Where("archived_at IS NOT NULL")
+		} else {
+			query = query.Where("archived_at IS NULL")
+		}
+	}
 
 	query.Count(&total)
 
@@ -103,9 +262,11 @@ func (r *taskRepository) GetQueuePosition(ctx context.Context, id string) (int,
 		return 0, err
 	}
 
+	// Position follows dispatch order; ties fall back to creation time
 	var position int64
 	err := r.db.WithContext(ctx).Model(&domain.Task{}).
-		Where("status = ? AND created_at < ?", domain.TaskStatusQueued, task.CreatedAt).
+		Where("status = ? AND id <> ?", domain.TaskStatusQueued, task.ID).
+		Where("queue_order < ? OR (queue_order = ? AND created_at < ?)", task.QueueOrder, task.QueueOrder, task.CreatedAt).
 		Count(&position).Error
 	if err != nil {
 		return 0, err
@@ -114,6 +275,41 @@ func (r *taskRepository) GetQueuePosition(ctx context.Context, id string) (int,
 	return int(position) + 1, nil
 }
 
+func (r *taskRepository) ListQueued(ctx context.Context) ([]domain.Task, error) {
+	var tasks []domain.Task
+	err := r.db.WithContext(ctx).
+		Where("status = ?", domain.TaskStatusQueued).
+		Order("queue_order ASC, created_at ASC").
+		Find(&tasks).Error
+	return tasks, err
+}
+
+func (r *taskRepository) UpdateDispatch(ctx context.Context, id string, jobID string, priority domain.TaskPriority, order int64) error {
+	updates := map[string]interface{}{
+		"priority":    priority.OrDefault(),
+		"queue_order": order,
+	}
+	if jobID != "" {
+		updates["job_id"] = jobID
+	}
+	return r.db.WithContext(ctx).Model(&domain.Task{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r *taskRepository) FindByFingerprint(ctx context.Context, fingerprint string, completedSince time.Time) (*domain.Task, error) {
+	var task domain.Task
+	err := r.db.WithContext(ctx).
+		Where("fingerprint = ?", fingerprint).
+		Where("status IN ? OR (status = ? AND updated_at >= ?)",
+			[]domain.TaskStatus{domain.TaskStatusQueued, domain.TaskStatusPending, domain.TaskStatusRunning},
+			domain.TaskStatusCompleted, completedSince).
+		Order("created_at DESC").
+		First(&task).Error
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
 func (r *taskRepository) FindExpiredCompleted(ctx context.Context, days int) ([]domain.Task, error) {
 	var tasks []domain.Task
 	cutoff := time.Now().AddDate(0, 0, -days)
@@ -122,3 +318,119 @@ func (r *taskRepository) FindExpiredCompleted(ctx context.Context, days int) ([]
 		Find(&tasks).Error
 	return tasks, err
 }
+
+func (r *taskRepository) ListByStatus(ctx context.Context, statuses ...domain.TaskStatus) ([]domain.Task, error) {
+	var tasks []domain.Task
+	err := r.db.WithContext(ctx).
+		Where("status IN ?", statuses).
+		Order("created_at ASC").
+		Find(&tasks).Error
+	return tasks, err
+}
+
+func (r *taskRepository) ListByJobIDs(ctx context.Context, jobIDs []string) ([]domain.Task, error) {
+	var tasks []domain.Task
+	if len(jobIDs) == 0 {
+		return tasks, nil
+	}
+	err := r.db.WithContext(ctx).
+		Where("job_id IN ?", jobIDs).
+		Find(&tasks).Error
+	return tasks, err
+}
+
+func (r *taskRepository) ListOutputPaths(ctx context.Context) ([]string, error) {
+	var paths []string
+	err := r.db.WithContext(ctx).Model(&domain.Task{}).
+		Where("output_file_path <> ''").
+		Pluck("output_file_path", &paths).Error
+	return paths, err
+}
+
+func (r *taskRepository) ListByParent(ctx context.Context, parentID string, statuses ...domain.TaskStatus) ([]domain.Task, error) {
+	var tasks []domain.Task
+	query := r.db.WithContext(ctx).Where("parent_id = ?", parentID)
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	err := query.Order("created_at ASC").Find(&tasks).Error
+	return tasks, err
+}
+
+func (r *taskRepository) CountByParent(ctx context.Context, parentIDs []string) (map[string]domain.BatchJobCounts, error) {
+	counts := make(map[string]domain.BatchJobCounts, len(parentIDs))
+	if len(parentIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ParentID string
+		Status   domain.TaskStatus
+		Count    int64
+	}
+	err := r.db.WithContext(ctx).Model(&domain.Task{}).
+		Select("parent_id, status, COUNT(*) AS count").
+		Where("parent_id IN ?", parentIDs).
+		Group("parent_id, status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		c := counts[row.ParentID]
+		c.Add(row.Status, row.Count)
+		counts[row.ParentID] = c
+	}
+	return counts, nil
+}
+
+// UsageByAPIKey counts the active tasks of each API key and the report days of its tasks created since
+// the given time. Failed and cancelled tasks do not count towards the report days.
+func (r *taskRepository) UsageByAPIKey(ctx context.Context, since time.Time, apiKeyIDs ...string) (map[string]domain.APIKeyUsage, error) {
+	var rows []struct {
+		APIKeyID        string
+		ActiveTasks     int64
+		ReportDaysToday int64
+	}
+	query := r.db.WithContext(ctx).Model(&domain.Task{}).
+		Select("api_key_id, "+
+			"SUM(CASE WHEN status IN ? THEN 1 ELSE 0 END) AS active_tasks, "+
+			"SUM(CASE WHEN created_at >= ? AND status NOT IN ? THEN report_days ELSE 0 END) AS report_days_today",
+			[]domain.TaskStatus{domain.TaskStatusQueued, domain.TaskStatusPending, domain.TaskStatusRunning},
+			since,
+			[]domain.TaskStatus{domain.TaskStatusFailed, domain.TaskStatusCancelled}).
+		Where("api_key_id <> ''")
+	if len(apiKeyIDs) > 0 {
+		query = query.Where("api_key_id IN ?", apiKeyIDs)
+	}
+	if err := query.Group("api_key_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]domain.APIKeyUsage, len(rows))
+	for _, row := range rows {
+		usage[row.APIKeyID] = domain.APIKeyUsage{ActiveTasks: row.ActiveTasks, ReportDaysToday: row.ReportDaysToday}
+	}
+	return usage, nil
+}
+
+// CountFinishedSince counts the tasks finished since the given time by status
+func (r *taskRepository) CountFinishedSince(ctx context.Context, since time.Time) (map[domain.TaskStatus]int64, error) {
+	var rows []struct {
+		Status domain.TaskStatus
+		Count  int64
+	}
+	err := r.db.WithContext(ctx).Model(&domain.Task{}).
+		Select("status, COUNT(*) AS count").
+		Where("finished_at >= ?", since).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[domain.TaskStatus]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
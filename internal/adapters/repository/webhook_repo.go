@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+)
+
+type webhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *gorm.DB) ports.WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	return r.db.WithContext(ctx).Create(webhook).Error
+}
+
+func (r *webhookRepository) GetByID(ctx context.Context, id string) (*domain.Webhook, error) {
+	var webhook domain.Webhook
+	err := r.db.WithContext(ctx).First(&webhook, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *webhookRepository) List(ctx context.Context, filter ports.WebhookFilter) ([]domain.Webhook, error) {
+	var webhooks []domain.Webhook
+	query := r.db.WithContext(ctx).Model(&domain.Webhook{})
+	if filter.APIKeyID != "" {
+		query = query.Where("api_key_id = ?", filter.APIKeyID)
+	}
+	if filter.TaskID != "" {
+		query = query.Where("task_id = ?", filter.TaskID)
+	}
+	err := query.Order("created_at DESC").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// ListForTask returns the active webhooks of the task, of the API key it was created with, and global webhooks.
+// Task webhooks also record the API key that registered them, which only scopes their ownership.
+func (r *webhookRepository) ListForTask(ctx context.Context, task *domain.Task) ([]domain.Webhook, error) {
+	var webhooks []domain.Webhook
+	query := r.db.WithContext(ctx).Where("active = ?", true)
+	if task.APIKeyID != "" {
+		query = query.Where("task_id = ? OR (task_id IS NULL AND (api_key_id = ? OR api_key_id IS NULL))", task.ID, task.APIKeyID)
+	} else {
+		query = query.Where("task_id = ? OR (task_id IS NULL AND api_key_id IS NULL)", task.ID)
+	}
+	err := query.Order("created_at").Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Delete(&domain.Webhook{}, "id = ?", id).Error
+}
+
+func (r *webhookRepository) CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	return r.db.WithContext(ctx).Create(delivery).Error
+}
+
+func (r *webhookRepository) GetDelivery(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	var delivery domain.WebhookDelivery
+	err := r.db.WithContext(ctx).First(&delivery, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	return r.db.WithContext(ctx).Save(delivery).Error
+}
+
+func (r *webhookRepository) ListDeliveries(ctx context.Context, filter ports.WebhookFilter) ([]domain.WebhookDelivery, int64, error) {
+	var deliveries []domain.WebhookDelivery
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&domain.WebhookDelivery{})
+	if filter.WebhookID != "" {
+		query = query.Where("webhook_id = ?", filter.WebhookID)
+	}
+	if filter.TaskID != "" {
+		query = query.Where("task_id = ?", filter.TaskID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit > 0 {
+		offset := (filter.Page - 1) * filter.Limit
+		if offset < 0 {
+			offset = 0
+		}
+		query = query.Offset(offset).Limit(filter.Limit)
+	}
+
+	// The list omits payloads, they are returned by GetDelivery
+	err := query.Omit("payload").Order("created_at DESC").Find(&deliveries).Error
+	return deliveries, total, err
+}
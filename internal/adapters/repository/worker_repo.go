@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+)
+
+type workerRepository struct {
+	db *gorm.DB
+}
+
+// NewWorkerRepository creates a new worker repository
+func NewWorkerRepository(db *gorm.DB) ports.WorkerRepository {
+	return &workerRepository{db: db}
+}
+
+func (r *workerRepository) Save(ctx context.Context, worker *domain.Worker) error {
+	return r.db.WithContext(ctx).Save(worker).Error
+}
+
+func (r *workerRepository) List(ctx context.Context) ([]domain.Worker, error) {
+	var workers []domain.Worker
+	err := r.db.WithContext(ctx).Order("last_heartbeat DESC").Find(&workers).Error
+	return workers, err
+}
+
+func (r *workerRepository) SetState(ctx context.Context, id string, state domain.WorkerState) error {
+	return r.db.WithContext(ctx).Model(&domain.Worker{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"state":              state,
+		"current_tasks_json": "[]",
+		"last_heartbeat":     time.Now(),
+	}).Error
+}
+
+func (r *workerRepository) DeleteInactive(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).Delete(&domain.Worker{}, "last_heartbeat < ?", before).Error
+}
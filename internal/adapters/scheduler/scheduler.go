@@ -3,7 +3,6 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
-	"os"
 	"strconv"
 	"time"
 
@@ -12,6 +11,7 @@ import (
 
 	"pdf_generator/internal/core/domain"
 	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/generator"
 )
 
 // Scheduler manages cron jobs
@@ -98,13 +98,18 @@ func (s *Scheduler) executeSchedule(ctx context.Context, schedule domain.Schedul
 
 	// Create new task with extracted fields
 	task := &domain.Task{
-		ScheduleID: &schedule.ID,
-		Status:     domain.TaskStatusQueued,
-		RootFolder: metadata.RootFolder,
-		GateID:     metadata.GateID,
-		StationID:  metadata.StationID,
-		Filters:    &metadata.Filter,
-		Settings:   metadata.Settings,
+		ScheduleID:  &schedule.ID,
+		APIKeyID:    schedule.APIKeyID,
+		CreatorType: domain.TaskCreatorSchedule,
+		CreatorID:   schedule.ID,
+		Status:      domain.TaskStatusQueued,
+		Priority:    metadata.Priority,
+		RootFolder:  metadata.RootFolder,
+		GateID:      metadata.GateID,
+		StationID:   metadata.StationID,
+		Filters:     &metadata.Filter,
+		Settings:    metadata.Settings,
+		Email:       metadata.Email,
 	}
 
 	if err := s.taskRepo.Create(ctx, task); err != nil {
@@ -155,7 +160,7 @@ func (s *Scheduler) cleanupExpiredFiles(ctx context.Context) {
 	for _, task := range tasks {
 		// Delete file
 		if task.OutputFilePath != "" {
-			if err := os.Remove(task.OutputFilePath); err != nil {
+			if err := generator.RemoveOutputs(task.OutputFilePath); err != nil {
 				log.Warn().Err(err).Str("task_id", task.ID).Msg("Failed to delete output file")
 			}
 		}
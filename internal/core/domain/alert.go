@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AlertRule identifies a condition that is watched for alerts
+type AlertRule string
+
+const (
+	AlertRuleTaskStuck   AlertRule = "task_stuck"   // A task has been running longer than allowed
+	AlertRuleQueueAge    AlertRule = "queue_age"    // The oldest queued task has been waiting too long
+	AlertRuleFailureRate AlertRule = "failure_rate" // Too many tasks failed in the last hour
+	AlertRuleWorkerDown  AlertRule = "worker_down"  // The local worker service is not running
+	AlertRuleDiskLow     AlertRule = "disk_low"     // Little free space left for the output directory
+)
+
+// AlertSeverity tells how urgent an alert is
+type AlertSeverity string
+
+const (
+	AlertSeverityWarning  AlertSeverity = "warning"
+	AlertSeverityCritical AlertSeverity = "critical"
+)
+
+// AlertStatus represents the state of an alert
+type AlertStatus string
+
+const (
+	AlertStatusOpen     AlertStatus = "open"
+	AlertStatusResolved AlertStatus = "resolved"
+)
+
+// Alert is a rule violation, opened when first found and resolved once the condition is gone
+type Alert struct {
+	ID        string        `gorm:"primaryKey;type:text" json:"id"`
+	Rule      AlertRule     `gorm:"type:text;index" json:"rule"`
+	Subject   string        `gorm:"type:text;index" json:"subject,omitempty"` // E.g. the ID of a stuck task, empty for system wide rules
+	Status    AlertStatus   `gorm:"type:text;index;not null;default:'open'" json:"status"`
+	Severity  AlertSeverity `gorm:"type:text" json:"severity"`
+	Message   string        `gorm:"type:text" json:"message"`
+	Value     float64       `gorm:"type:real" json:"value"`     // Last measured value
+	Threshold float64       `gorm:"type:real" json:"threshold"` // Limit the value crossed
+
+	OpenedAt   time.Time  `gorm:"index" json:"opened_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"` // Last evaluation that still found the condition
+	ResolvedAt *time.Time `gorm:"type:datetime" json:"resolved_at,omitempty"`
+}
+
+func (a *Alert) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// Key identifies the condition of the alert, at most one alert per key is open
+func (a *Alert) Key() string {
+	return string(a.Rule) + ":" + a.Subject
+}
+
+// AlertCondition is a rule violation found by an evaluation of the alert rules
+type AlertCondition struct {
+	Rule      AlertRule
+	Subject   string
+	Severity  AlertSeverity
+	Message   string
+	Value     float64
+	Threshold float64
+}
+
+// Key identifies the condition, matching Alert.Key
+func (c AlertCondition) Key() string {
+	return string(c.Rule) + ":" + c.Subject
+}
+
+// AlertEvent is the kind of alert change sent to the alert webhook
+type AlertEvent string
+
+const (
+	AlertEventOpened   AlertEvent = "alert.opened"
+	AlertEventResolved AlertEvent = "alert.resolved"
+)
@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,7 +16,10 @@ type APIKey struct {
 	KeyHash      string    `gorm:"type:text;uniqueIndex" json:"-"`         // Bcrypt hash for verification
 	EncryptedKey string    `gorm:"type:text" json:"-"`                     // AES encrypted for reveal
 	Active       bool      `gorm:"default:true" json:"active"`
+	Worker       bool      `gorm:"default:false" json:"worker"` // May use the remote worker protocol
 	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	APIKeyLimits `gorm:"embedded"`
 }
 
 func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
@@ -23,3 +28,39 @@ func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// ErrQuotaExceeded is returned when an API key would exceed one of its limits
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// APIKeyLimits restricts the usage of an API key. Zero means unlimited.
+type APIKeyLimits struct {
+	RequestsPerMinute int `gorm:"type:integer;default:0" json:"requests_per_minute"`
+	MaxQueuedTasks    int `gorm:"type:integer;default:0" json:"max_queued_tasks"`  // Tasks queued or running at the same time
+	DailyReportDays   int `gorm:"type:integer;default:0" json:"daily_report_days"` // Report days enqueued per calendar day
+}
+
+// Validate checks that no limit is negative
+func (l APIKeyLimits) Validate() error {
+	if l.RequestsPerMinute < 0 || l.MaxQueuedTasks < 0 || l.DailyReportDays < 0 {
+		return errors.New("Limits must be 0 (unlimited) or greater")
+	}
+	return nil
+}
+
+// APIKeyUsage is the current usage of an API key
+type APIKeyUsage struct {
+	RequestsThisMinute int   `json:"requests_this_minute"`
+	ActiveTasks        int64 `json:"active_tasks"`      // Tasks queued or running
+	ReportDaysToday    int64 `json:"report_days_today"` // Report days of tasks enqueued today
+}
+
+// CheckQuota checks whether tasks covering days report days can be added to the usage
+func (l APIKeyLimits) CheckQuota(usage APIKeyUsage, tasks, days int) error {
+	if l.MaxQueuedTasks > 0 && usage.ActiveTasks+int64(tasks) > int64(l.MaxQueuedTasks) {
+		return fmt.Errorf("%w: %d of %d tasks are queued or running", ErrQuotaExceeded, usage.ActiveTasks, l.MaxQueuedTasks)
+	}
+	if l.DailyReportDays > 0 && usage.ReportDaysToday+int64(days) > int64(l.DailyReportDays) {
+		return fmt.Errorf("%w: %d of %d report days used today", ErrQuotaExceeded, usage.ReportDaysToday, l.DailyReportDays)
+	}
+	return nil
+}
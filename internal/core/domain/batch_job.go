@@ -0,0 +1,239 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxBatchJobTasks limits how many child tasks a single batch job may create
+const MaxBatchJobTasks = 1000
+
+// BatchJobStatus is the aggregate state of the child tasks of a batch job
+type BatchJobStatus string
+
+const (
+	BatchJobStatusRunning   BatchJobStatus = "running"   // Some tasks are still queued or running
+	BatchJobStatusCompleted BatchJobStatus = "completed" // All tasks completed
+	BatchJobStatusPartial   BatchJobStatus = "partial"   // Finished, but some tasks failed or were cancelled
+	BatchJobStatusFailed    BatchJobStatus = "failed"    // Finished without any completed task
+	BatchJobStatusCancelled BatchJobStatus = "cancelled" // All tasks were cancelled
+)
+
+// BatchJob groups the tasks created from one matrix request. Its tasks reference it
+// through Task.ParentID. Not to be confused with backlite jobs (Task.JobID).
+type BatchJob struct {
+	ID       string       `gorm:"primaryKey;type:text" json:"id"`
+	Name     string       `gorm:"type:text" json:"name,omitempty"`
+	APIKeyID string       `gorm:"type:text;index" json:"api_key_id,omitempty"` // API key the job was created with
+	Priority TaskPriority `gorm:"type:text;not null;default:'normal'" json:"priority"`
+
+	// Matrix stored as object, serialized to JSON in database
+	Matrix    *BatchJobMatrix `gorm:"-" json:"matrix"`
+	MatrixRaw string          `gorm:"column:matrix_json;type:text" json:"-"`
+
+	TotalTasks int       `gorm:"type:integer;default:0" json:"total_tasks"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (j *BatchJob) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == "" {
+		j.ID = uuid.New().String()
+	}
+	j.Priority = j.Priority.OrDefault()
+	return nil
+}
+
+// BeforeSave serializes Matrix to JSON before saving
+func (j *BatchJob) BeforeSave(tx *gorm.DB) error {
+	if j.Matrix != nil {
+		data, err := json.Marshal(j.Matrix)
+		if err != nil {
+			return err
+		}
+		j.MatrixRaw = string(data)
+	}
+	return nil
+}
+
+// AfterFind deserializes Matrix after loading
+func (j *BatchJob) AfterFind(tx *gorm.DB) error {
+	if j.MatrixRaw != "" {
+		var matrix BatchJobMatrix
+		if err := json.Unmarshal([]byte(j.MatrixRaw), &matrix); err == nil {
+			j.Matrix = &matrix
+		}
+	}
+	return nil
+}
+
+// BatchJobMatrix describes the child tasks of a batch job: one task per gate, station and
+// day between DateFrom and DateTo. Filter and Settings are shared by all tasks.
+type BatchJobMatrix struct {
+	RootFolder string         `json:"root_folder"`
+	BranchID   int            `json:"branch_id"`
+	GateIDs    []int          `json:"gate_ids,omitempty"`    // All gates (-1) when empty
+	StationIDs []int          `json:"station_ids,omitempty"` // Station 0 when empty
+	DateFrom   string         `json:"date_from"`             // First day (YYYY-MM-DD)
+	DateTo     string         `json:"date_to"`               // Last day (YYYY-MM-DD), inclusive
+	Filter     TaskFilter     `json:"filter"`
+	Settings   map[string]any `json:"settings,omitempty"`
+}
+
+// Validate checks the IDs and date range, and that the matrix stays within MaxBatchJobTasks
+func (m *BatchJobMatrix) Validate() error {
+	if m.BranchID < 0 || m.BranchID > 100 {
+		return errors.New("Branch ID must be between 0 and 100")
+	}
+	if len(m.GateIDs) == 0 && len(m.StationIDs) == 0 {
+		return errors.New("At least one gate or station is required")
+	}
+	for _, id := range m.GateIDs {
+		if id < -1 || id > 100 {
+			return errors.New("Gate ID must be between -1 and 100")
+		}
+	}
+	for _, id := range m.StationIDs {
+		if id < 0 || id > 100 {
+			return errors.New("Station ID must be between 0 and 100")
+		}
+	}
+
+	dates, err := m.Dates()
+	if err != nil {
+		return err
+	}
+	if size := len(m.gates()) * len(m.stations()) * len(dates); size > MaxBatchJobTasks {
+		return fmt.Errorf("Job would create %d tasks, the limit is %d", size, MaxBatchJobTasks)
+	}
+	return nil
+}
+
+// Dates returns the days from DateFrom to DateTo
+func (m *BatchJobMatrix) Dates() ([]string, error) {
+	from, err := time.Parse("2006-01-02", m.DateFrom)
+	if err != nil {
+		return nil, errors.New("date_from must be a date (YYYY-MM-DD)")
+	}
+	to, err := time.Parse("2006-01-02", m.DateTo)
+	if err != nil {
+		return nil, errors.New("date_to must be a date (YYYY-MM-DD)")
+	}
+	if to.Before(from) {
+		return nil, errors.New("date_to must not be before date_from")
+	}
+	// Bounded before expanding so a very long range cannot allocate the whole span
+	if days := int(to.Sub(from).Hours()/24) + 1; days > MaxBatchJobTasks {
+		return nil, fmt.Errorf("Date range must not exceed %d days", MaxBatchJobTasks)
+	}
+
+	var dates []string
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format("2006-01-02"))
+	}
+	return dates, nil
+}
+
+// Tasks expands the matrix into the metadata of each child task, ordered by date, gate and station
+func (m *BatchJobMatrix) Tasks(priority TaskPriority) ([]TaskMetadata, error) {
+	dates, err := m.Dates()
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []TaskMetadata
+	for _, date := range dates {
+		for _, gateID := range m.gates() {
+			for _, stationID := range m.stations() {
+				filter := m.Filter
+				filter.Date = date
+				filter.RangeStart = ""
+				filter.RangeEnd = ""
+				filter.GateID = nil
+				if gateID != -1 {
+					id := gateID
+					filter.GateID = &id
+				}
+				tasks = append(tasks, TaskMetadata{
+					RootFolder: m.RootFolder,
+					BranchID:   m.BranchID,
+					GateID:     gateID,
+					StationID:  stationID,
+					Filter:     filter,
+					Settings:   m.Settings,
+					Priority:   priority,
+				})
+			}
+		}
+	}
+	return tasks, nil
+}
+
+func (m *BatchJobMatrix) gates() []int {
+	if len(m.GateIDs) == 0 {
+		return []int{-1}
+	}
+	return m.GateIDs
+}
+
+func (m *BatchJobMatrix) stations() []int {
+	if len(m.StationIDs) == 0 {
+		return []int{0}
+	}
+	return m.StationIDs
+}
+
+// BatchJobCounts counts the child tasks of a batch job by status
+type BatchJobCounts struct {
+	Total     int64 `json:"total"`
+	Queued    int64 `json:"queued"` // Queued or pending
+	Running   int64 `json:"running"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+	Cancelled int64 `json:"cancelled"` // Cancelled or removed
+}
+
+// Add counts n tasks in the given status
+func (c *BatchJobCounts) Add(status TaskStatus, n int64) {
+	c.Total += n
+	switch status {
+	case TaskStatusQueued, TaskStatusPending:
+		c.Queued += n
+	case TaskStatusRunning:
+		c.Running += n
+	case TaskStatusCompleted:
+		c.Completed += n
+	case TaskStatusFailed:
+		c.Failed += n
+	case TaskStatusCancelled, TaskStatusRemoved:
+		c.Cancelled += n
+	}
+}
+
+// Status derives the aggregate status of the job
+func (c BatchJobCounts) Status() BatchJobStatus {
+	switch {
+	case c.Queued+c.Running > 0:
+		return BatchJobStatusRunning
+	case c.Completed == c.Total:
+		return BatchJobStatusCompleted
+	case c.Cancelled == c.Total:
+		return BatchJobStatusCancelled
+	case c.Completed == 0:
+		return BatchJobStatusFailed
+	}
+	return BatchJobStatusPartial
+}
+
+// Progress returns the share of finished tasks in percent
+func (c BatchJobCounts) Progress() int {
+	if c.Total == 0 {
+		return 100
+	}
+	return int((c.Completed + c.Failed + c.Cancelled) * 100 / c.Total)
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+)
+
+// EmailStatus represents the delivery state of the report email of a task
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending"
+	EmailStatusSent    EmailStatus = "sent"
+	EmailStatusFailed  EmailStatus = "failed"
+)
+
+// SMTPTLSMode selects how the SMTP connection is encrypted
+type SMTPTLSMode string
+
+const (
+	SMTPTLSStartTLS SMTPTLSMode = "starttls" // Upgrade a plain connection, usually port 587
+	SMTPTLSImplicit SMTPTLSMode = "tls"      // TLS from the start, usually port 465
+	SMTPTLSNone     SMTPTLSMode = "none"     // Unencrypted, e.g. a local relay
+)
+
+// Valid reports whether m is a known TLS mode
+func (m SMTPTLSMode) Valid() bool {
+	switch m {
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+		return true
+	}
+	return false
+}
+
+// EmailRequest lists who receives the generated PDFs of a task by email.
+// Subject and body are templates using the filename variables ({BranchID}, {Date}, ...)
+// and default to the email templates in settings.
+type EmailRequest struct {
+	To      []string `json:"to"`
+	Cc      []string `json:"cc,omitempty"`
+	Subject string   `json:"subject,omitempty"`
+	Body    string   `json:"body,omitempty"`
+}
+
+// Validate checks that there is at least one recipient and that all addresses are valid
+func (r *EmailRequest) Validate() error {
+	if len(r.To) == 0 {
+		return errors.New("Email requires at least one recipient")
+	}
+	for _, list := range [][]string{r.To, r.Cc} {
+		for _, address := range list {
+			if _, err := mail.ParseAddress(address); err != nil {
+				return fmt.Errorf("Invalid email address %q", address)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+)
+
+// IdempotencyRecord stores the response of a request made with an Idempotency-Key
+// header so that retries of the same request can be replayed instead of re-executed
+type IdempotencyRecord struct {
+	Key         string    `gorm:"primaryKey;type:text" json:"key"`          // SHA256 of caller scope + header value
+	RequestHash string    `gorm:"type:text;not null" json:"request_hash"`   // SHA256 of method, path and body
+	StatusCode  int       `gorm:"type:integer;not null" json:"status_code"` // Stored response status
+	Response    string    `gorm:"type:text" json:"response"`                // Stored response body
+	ExpiresAt   time.Time `gorm:"type:datetime;index" json:"expires_at"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// IsExpired checks if the record is past its replay window
+func (r *IdempotencyRecord) IsExpired() bool {
+	return time.Now().After(r.ExpiresAt)
+}
+
+// IsPending checks if the first request with the key is still being executed
+func (r *IdempotencyRecord) IsPending() bool {
+	return r.StatusCode == 0
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"time"
+)
+
+// QueueState represents the dispatch state reported by the worker service
+type QueueState string
+
+const (
+	QueueStateRunning QueueState = "running"
+	QueueStatePausing QueueState = "pausing" // Pause requested, running tasks are finishing
+	QueueStatePaused  QueueState = "paused"
+)
+
+// QueueControlID is the primary key of the single queue control row
+const QueueControlID = 1
+
+// QueueControl is shared by the API and worker processes through the database.
+// The API writes the desired Paused flag, the worker applies it together with the
+// queue_concurrency setting and reports back its actual state
+type QueueControl struct {
+	ID         int        `gorm:"primaryKey" json:"-"`
+	Paused     bool       `gorm:"not null;default:false" json:"paused"`              // Desired state, set by admins
+	State      QueueState `gorm:"type:text;not null;default:'running'" json:"state"` // Actual state, reported by the worker
+	Workers    int        `gorm:"type:integer;default:0" json:"workers"`             // Active worker pool size
+	Running    int        `gorm:"type:integer;default:0" json:"running"`             // Tasks currently executing
+	ReportedAt *time.Time `gorm:"type:datetime" json:"reported_at,omitempty"`        // Last report from the worker
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
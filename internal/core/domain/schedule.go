@@ -13,6 +13,7 @@ type Schedule struct {
 	Cron        string     `gorm:"type:text;not null" json:"cron"`
 	TaskPayload string     `gorm:"type:text;not null" json:"task_payload"` // JSON of TaskMetadata
 	Active      bool       `gorm:"default:true" json:"active"`
+	APIKeyID    string     `gorm:"type:text;index" json:"api_key_id,omitempty"` // API key that created the schedule, owns its tasks
 	LastRun     *time.Time `gorm:"type:datetime" json:"last_run,omitempty"`
 	NextRun     *time.Time `gorm:"type:datetime" json:"next_run,omitempty"`
 	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
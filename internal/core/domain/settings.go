@@ -1,15 +1,23 @@
 package domain
 
+import "time"
+
 // Settings represents a key-value configuration entry
 type Settings struct {
-	Key       string  `gorm:"primaryKey;type:text" json:"key"`
-	Value     string  `gorm:"type:text;not null" json:"value"`
-	Name      string  `gorm:"type:text" json:"name"`
-	Icon      string  `gorm:"type:text" json:"icon"`
-	Group     string  `gorm:"type:text;default:'General'" json:"group"`
-	DataType  string  `gorm:"type:text;default:'string'" json:"datatype"` // string, number, boolean, text, html
-	Content   *string `gorm:"type:text" json:"content,omitempty"`         // HTML content for description/help
-	SortOrder int     `gorm:"type:int;default:0" json:"order"`
+	Key       string    `gorm:"primaryKey;type:text" json:"key"`
+	Value     string    `gorm:"type:text;not null" json:"value"`
+	Name      string    `gorm:"type:text" json:"name"`
+	Icon      string    `gorm:"type:text" json:"icon"`
+	Group     string    `gorm:"type:text;default:'General'" json:"group"`
+	DataType  string    `gorm:"type:text;default:'string'" json:"datatype"` // string, number, boolean, text, html, password
+	Content   *string   `gorm:"type:text" json:"content,omitempty"`         // HTML content for description/help
+	SortOrder int       `gorm:"type:int;default:0" json:"order"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Secret checks if the value is a credential, stored encrypted and never returned by the API
+func (s Settings) Secret() bool {
+	return s.DataType == "password"
 }
 
 // Known setting keys
@@ -22,14 +30,51 @@ const (
 	SettingPageSize              = "page_size"
 	SettingOutputFilenameFormat  = "output_filename_format"
 	SettingDataSourcePathFormat  = "datasource_path_format"
+	SettingDataSourceDrivers     = "datasource_drivers"
+	SettingDataSourcePassword    = "datasource_password" // Encrypted with utils.Encrypt
+	SettingDataSourceSnapshot    = "datasource_snapshot"
+	SettingDataSourceArchiveFmt  = "datasource_archive_path_format"
+	SettingDataSourceArchiveMB   = "datasource_archive_cache_mb"
+	SettingPDFChunkSize          = "pdf_chunk_size"
+	SettingPDFDateParallelism    = "pdf_date_parallelism"
 	SettingTimeOverlap           = "time_overlap"
 	SettingMaxOutputAgeDays      = "max_output_age_days"
 	SettingMaxConcurrentSessions = "max_concurrent_sessions"
+	SettingWebhookAllowedHosts   = "webhook_allowed_hosts"
 	SettingQueueConcurrency      = "queue_concurrency"
 	SettingWALCheckpointInterval = "wal_checkpoint_interval"
 	SettingWALMaxSizeMB          = "wal_max_size_mb"
+	SettingIdempotencyWindowHrs  = "idempotency_window_hours"
+	SettingTaskDedupEnabled      = "task_dedup_enabled"
+	SettingTaskDedupWindowHrs    = "task_dedup_window_hours"
+	SettingWorkerMode            = "worker_mode"
+	SettingTaskMaxAttempts       = "task_max_attempts"
+	SettingTaskRetryBackoffSecs  = "task_retry_backoff_seconds"
+	SettingSMTPHost              = "smtp_host"
+	SettingSMTPPort              = "smtp_port"
+	SettingSMTPTLS               = "smtp_tls"
+	SettingSMTPUsername          = "smtp_username"
+	SettingSMTPPassword          = "smtp_password" // Encrypted with utils.Encrypt
+	SettingSMTPFrom              = "smtp_from"
+	SettingEmailSubjectTemplate  = "email_subject_template"
+	SettingEmailBodyTemplate     = "email_body_template"
+	SettingEmailAttachmentMaxMB  = "email_attachment_max_mb"
+	SettingPublicURL             = "public_url"
+	SettingAlertTaskRunningMins  = "alert_task_running_minutes"
+	SettingAlertQueueAgeMins     = "alert_queue_age_minutes"
+	SettingAlertFailureRatePct   = "alert_failure_rate_percent"
+	SettingAlertWorkerDown       = "alert_worker_down"
+	SettingAlertDiskFreeMB       = "alert_disk_free_mb"
+	SettingAlertWebhookURL       = "alert_webhook_url"
+	SettingAlertWebhookSecret    = "alert_webhook_secret" // Encrypted with utils.Encrypt
 )
 
+// DefaultDataSourceDrivers are the Access drivers tried in order, one per line as name|driver|connection string|timeout seconds
+const DefaultDataSourceDrivers = "odbc|odbc|Driver={Microsoft Access Driver (*.mdb, *.accdb)};Dbq={Path};PWD={Password};|5\n" +
+	"adodb_ace|adodb|Provider=Microsoft.ACE.OLEDB.12.0;Data Source={Path};Jet OLEDB:Database Password={Password};|5\n" +
+	"adodb_ace16|adodb|Provider=Microsoft.ACE.OLEDB.16.0;Data Source={Path};Jet OLEDB:Database Password={Password};|5\n" +
+	"adodb_jet|adodb|Provider=Microsoft.Jet.OLEDB.4.0;Data Source={Path};Jet OLEDB:Database Password={Password};|5"
+
 // DefaultSettings returns the default configuration values
 func DefaultSettings() []Settings {
 	htmlContent := func(s string) *string { return &s }
@@ -44,7 +89,14 @@ func DefaultSettings() []Settings {
 		// PDF (200)
 		{SortOrder: 210, Key: SettingPageSize, Value: "A4", Name: "Page Size", Icon: "FileText", Group: "PDF", DataType: "string", Content: htmlContent("Page size for the generated PDF (e.g., A4, Letter).")},
 		{SortOrder: 220, Key: SettingOutputFilenameFormat, Value: "{BranchID}_{GateID}_{DATE}", Name: "Filename Format", Icon: "FileCode", Group: "PDF", DataType: "string", Content: htmlContent("Template for output filenames.<br>Available variables: {BranchID}, {GateID}, {StationID}, {YYYY}, {YY}, {MM}, {DD}, {Date}, {Time}")},
-		{SortOrder: 230, Key: SettingDataSourcePathFormat, Value: "{MM}-{YYYY}/{StationID}/{DD}{MM}{YYYY}.mdb", Name: "Data Source Path Format", Icon: "Database", Group: "PDF", DataType: "string", Content: htmlContent("Template for Access database source path.<br>Available variables: {BranchID}, {GateID}, {StationID}, {YYYY}, {YY}, {MM}, {DD}, {Date}, {Time}")},
+		{SortOrder: 230, Key: SettingDataSourcePathFormat, Value: "{MM}-{YYYY}/{StationID}/{DD}{MM}{YYYY}.mdb", Name: "Data Source Path Format", Icon: "Database", Group: "PDF", DataType: "string", Content: htmlContent("Templates of the Access database source path, separated by <code>;</code> and tried in order until one matches. Path elements are matched case-insensitively and may contain the wildcards <code>*</code>, <code>?</code> and <code>[...]</code>; a template matching more than one file fails the task as ambiguous.<br>Example: <code>{MM}-{YYYY}/{StationID}/{DD}{MM}{YYYY}.mdb;{MM}-{YYYY}/*/{DD}{MM}{YYYY}.accdb</code><br>Available variables: {BranchID}, {GateID}, {StationID}, {YYYY}, {YY}, {MM}, {DD}, {Date}, {Time}")},
+		{SortOrder: 231, Key: SettingDataSourceDrivers, Value: DefaultDataSourceDrivers, Name: "Access Drivers", Icon: "Plug", Group: "PDF", DataType: "text", Content: htmlContent("Drivers tried in order to open the Access database, one per line as <code>name|driver|connection string|timeout seconds</code>. The driver is <code>odbc</code> or <code>adodb</code>; the connection string holds <code>{Path}</code> and optionally <code>{Password}</code>, whose parts are left out when no password is set. The timeout is optional (default: 5). Lines starting with <code>#</code> are ignored.")},
+		{SortOrder: 232, Key: SettingDataSourcePassword, Value: "", Name: "Access Database Password", Icon: "Lock", Group: "PDF", DataType: "password", Content: htmlContent("Password of password-protected Access databases, passed to the drivers as <code>{Password}</code>. Stored encrypted.")},
+		{SortOrder: 235, Key: SettingDataSourceSnapshot, Value: "false", Name: "Data Source Snapshot", Icon: "Copy", Group: "PDF", DataType: "boolean", Content: htmlContent("Copy the Access file to a temporary snapshot and read only the copy, so the worker never locks the file the lane is writing. The copy waits until the file size and modification time are stable and is retried with backoff while the file is locked or changing.")},
+		{SortOrder: 236, Key: SettingDataSourceArchiveFmt, Value: "", Name: "Archive Path Format", Icon: "Archive", Group: "PDF", DataType: "string", Content: htmlContent("Templates of the zip or tar.gz archives searched when the data source file does not exist, separated by <code>;</code> and tried in order. Empty disables archives.<br>Example: <code>archive/{MM}{YY}.zip;archive/{MM}{YY}/{DD}{MM}{YYYY}.zip</code><br>Available variables: {BranchID}, {GateID}, {StationID}, {YYYY}, {YY}, {MM}, {DD}, {Date}, {Time}")},
+		{SortOrder: 237, Key: SettingDataSourceArchiveMB, Value: "2048", Name: "Archive Cache Size (MB)", Icon: "HardDrive", Group: "PDF", DataType: "number", Content: htmlContent("Size limit of the files extracted from archives. The least recently used files are evicted; a single file above the limit is not extracted.")},
+		{SortOrder: 240, Key: SettingPDFChunkSize, Value: "500", Name: "Chunk Size", Icon: "Layers", Group: "PDF", DataType: "number", Content: htmlContent("Transactions rendered into one intermediate PDF part. A task that fails or times out resumes after its last completed part.")},
+		{SortOrder: 250, Key: SettingPDFDateParallelism, Value: "4", Name: "Parallel Dates", Icon: "Cpu", Group: "PDF", DataType: "number", Content: htmlContent("Dates of a range task rendered at the same time. Lowered so that all running tasks (Queue Concurrency) together use no more rendering threads than the worker has CPU cores.")},
 
 		// Scheduling (300)
 		{SortOrder: 310, Key: SettingTimeOverlap, Value: "00:00", Name: "Day Start Time", Icon: "Clock", Group: "Scheduling", DataType: "time", Content: htmlContent("Daily transaction window start time (HH:MM).<br>Example: 02:00 means transactions from 02:00 today to 01:59:59 tomorrow.")},
@@ -52,13 +104,41 @@ func DefaultSettings() []Settings {
 		// Security (400)
 		{SortOrder: 410, Key: SettingSecurityEnabled, Value: "false", Name: "Security Enabled", Icon: "Shield", Group: "Security", DataType: "boolean", Content: htmlContent("Enable API security (authentication, HMAC). When disabled, all API endpoints are publicly accessible.")},
 		{SortOrder: 420, Key: SettingMaxConcurrentSessions, Value: "5", Name: "Max Sessions", Icon: "Users", Group: "Security", DataType: "number", Content: htmlContent("Maximum number of concurrent admin sessions allowed.")},
+		{SortOrder: 430, Key: SettingWebhookAllowedHosts, Value: "", Name: "Webhook Allowed Hosts", Icon: "Webhook", Group: "Security", DataType: "text", Content: htmlContent("Webhooks may only reach public addresses. Hosts, IP addresses and CIDR ranges listed here, separated by commas or lines, may be reached although they are loopback, private or link-local, e.g. <code>hooks.internal, 10.0.5.0/24</code>.")},
 
 		// System (500)
 		{SortOrder: 510, Key: SettingQueueConcurrency, Value: "1", Name: "Queue Concurrency", Icon: "Layers", Group: "System", DataType: "number", Content: htmlContent("Number of background workers processing the queue.")},
 		{SortOrder: 520, Key: SettingWALCheckpointInterval, Value: "30", Name: "WAL Checkpoint Interval", Icon: "Database", Group: "System", DataType: "number", Content: htmlContent("Interval in minutes to force a WAL checkpoint.")},
 		{SortOrder: 530, Key: SettingWALMaxSizeMB, Value: "20", Name: "WAL Max Size (MB)", Icon: "HardDrive", Group: "System", DataType: "number", Content: htmlContent("Maximum size of WAL file in MB before forcing checkpoint.")},
+		{SortOrder: 540, Key: SettingIdempotencyWindowHrs, Value: "24", Name: "Idempotency Window (Hours)", Icon: "RefreshCcw", Group: "System", DataType: "number", Content: htmlContent("How long a response submitted with an <code>Idempotency-Key</code> header is kept and replayed for retries.")},
+		{SortOrder: 550, Key: SettingTaskDedupEnabled, Value: "false", Name: "Duplicate Task Detection", Icon: "Copy", Group: "System", DataType: "boolean", Content: htmlContent("Return an existing queued, running or recently completed task instead of creating a new one when the same report is submitted again.")},
+		{SortOrder: 560, Key: SettingTaskDedupWindowHrs, Value: "1", Name: "Duplicate Window (Hours)", Icon: "Clock", Group: "System", DataType: "number", Content: htmlContent("How long a completed task is still considered a duplicate of a new identical submission.")},
+		{SortOrder: 570, Key: SettingWorkerMode, Value: "local", Name: "Worker Mode", Icon: "Server", Group: "System", DataType: "string", Content: htmlContent("Where PDF jobs run.<br><code>local</code>: the worker service on this machine.<br><code>remote</code>: worker nodes leasing jobs over HTTP; the local worker service stands by.")},
+		{SortOrder: 580, Key: SettingTaskMaxAttempts, Value: "3", Name: "Max Attempts", Icon: "RotateCw", Group: "System", DataType: "number", Content: htmlContent("How many times a task runs before it fails, for errors that may go away (e.g. a locked data source). Errors that can not (e.g. a missing data source) fail the task on the first attempt.")},
+		{SortOrder: 590, Key: SettingTaskRetryBackoffSecs, Value: "5", Name: "Retry Backoff (Seconds)", Icon: "Hourglass", Group: "System", DataType: "number", Content: htmlContent("How long a failed task waits before it runs again.")},
 
 		// Maintenance (600)
 		{SortOrder: 610, Key: SettingMaxOutputAgeDays, Value: "7", Name: "Max Output Age", Icon: "Trash2", Group: "Maintenance", DataType: "number", Content: htmlContent("Days to keep generated files before auto-deletion.")},
+
+		// Email (700)
+		{SortOrder: 710, Key: SettingSMTPHost, Value: "", Name: "SMTP Host", Icon: "Mail", Group: "Email", DataType: "string", Content: htmlContent("SMTP server used to email generated reports. Email is disabled while empty.")},
+		{SortOrder: 720, Key: SettingSMTPPort, Value: "587", Name: "SMTP Port", Icon: "Hash", Group: "Email", DataType: "number", Content: htmlContent("SMTP server port, usually 587 for STARTTLS and 465 for TLS.")},
+		{SortOrder: 730, Key: SettingSMTPTLS, Value: "starttls", Name: "SMTP Encryption", Icon: "Lock", Group: "Email", DataType: "string", Content: htmlContent("<code>starttls</code>, <code>tls</code> or <code>none</code>. Credentials are only sent unencrypted to localhost.")},
+		{SortOrder: 740, Key: SettingSMTPUsername, Value: "", Name: "SMTP Username", Icon: "User", Group: "Email", DataType: "string", Content: htmlContent("Leave empty if the server does not require authentication.")},
+		{SortOrder: 750, Key: SettingSMTPPassword, Value: "", Name: "SMTP Password", Icon: "KeyRound", Group: "Email", DataType: "password", Content: htmlContent("Stored encrypted and never shown again.")},
+		{SortOrder: 760, Key: SettingSMTPFrom, Value: "DataLane <noreply@localhost>", Name: "Sender", Icon: "AtSign", Group: "Email", DataType: "string", Content: htmlContent("From address of report emails.")},
+		{SortOrder: 770, Key: SettingEmailSubjectTemplate, Value: "Report {BranchID}-{GateID} {YYYY}-{MM}-{DD}", Name: "Subject Template", Icon: "Type", Group: "Email", DataType: "string", Content: htmlContent("Default subject of report emails.<br>Available variables: {BranchID}, {GateID}, {StationID}, {YYYY}, {YY}, {MM}, {DD}, {Date}, {Time}")},
+		{SortOrder: 780, Key: SettingEmailBodyTemplate, Value: "Attached is the report of branch {BranchID}, gate {GateID} for {DD}-{MM}-{YYYY}.", Name: "Body Template", Icon: "FileText", Group: "Email", DataType: "text", Content: htmlContent("Default plain text body of report emails. Uses the same variables as the subject.")},
+		{SortOrder: 790, Key: SettingEmailAttachmentMaxMB, Value: "10", Name: "Max Attachment Size (MB)", Icon: "Paperclip", Group: "Email", DataType: "number", Content: htmlContent("Reports larger than this are sent as a download link instead of an attachment.")},
+		{SortOrder: 795, Key: SettingPublicURL, Value: "", Name: "Public URL", Icon: "Link", Group: "Email", DataType: "string", Content: htmlContent("Base URL of this server used in download links, e.g. <code>https://datalane.example.com</code>.")},
+
+		// Alerts (800)
+		{SortOrder: 810, Key: SettingAlertTaskRunningMins, Value: "60", Name: "Stuck Task (Minutes)", Icon: "Hourglass", Group: "Alerts", DataType: "number", Content: htmlContent("Alert when a task has been running longer than this. <code>0</code> disables the rule.")},
+		{SortOrder: 820, Key: SettingAlertQueueAgeMins, Value: "30", Name: "Queue Age (Minutes)", Icon: "Timer", Group: "Alerts", DataType: "number", Content: htmlContent("Alert when the oldest queued task has been waiting longer than this. <code>0</code> disables the rule.")},
+		{SortOrder: 830, Key: SettingAlertFailureRatePct, Value: "50", Name: "Failure Rate (%)", Icon: "TrendingDown", Group: "Alerts", DataType: "number", Content: htmlContent("Alert when more than this share of the tasks finished in the last hour failed, once at least 5 tasks finished. <code>0</code> disables the rule.")},
+		{SortOrder: 840, Key: SettingAlertWorkerDown, Value: "true", Name: "Worker Service Down", Icon: "ServerOff", Group: "Alerts", DataType: "boolean", Content: htmlContent("Alert when the local worker service is not running. Not checked in remote worker mode.")},
+		{SortOrder: 850, Key: SettingAlertDiskFreeMB, Value: "1024", Name: "Min Free Disk (MB)", Icon: "HardDrive", Group: "Alerts", DataType: "number", Content: htmlContent("Alert when the disk of the output directory has less free space than this. <code>0</code> disables the rule.")},
+		{SortOrder: 860, Key: SettingAlertWebhookURL, Value: "", Name: "Alert Webhook URL", Icon: "Webhook", Group: "Alerts", DataType: "string", Content: htmlContent("Opened and resolved alerts are posted to this URL. Alerts are only logged while empty.")},
+		{SortOrder: 870, Key: SettingAlertWebhookSecret, Value: "", Name: "Alert Webhook Secret", Icon: "KeyRound", Group: "Alerts", DataType: "password", Content: htmlContent("Signs alert webhooks with an <code>X-Signature</code> header like task webhooks. Stored encrypted and never shown again.")},
 	}
 }
@@ -1,7 +1,11 @@
 package domain
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,12 +25,109 @@ const (
 	TaskStatusRemoved   TaskStatus = "removed"
 )
 
+// IsTerminal checks if the task will not run again
+func (s TaskStatus) IsTerminal() bool {
+	switch s {
+	case TaskStatusCompleted, TaskStatusFailed, TaskStatusCancelled, TaskStatusRemoved:
+		return true
+	}
+	return false
+}
+
+// TaskType is the kind of job a task runs, each is registered with the queue
+type TaskType string
+
+const (
+	TaskTypePDF TaskType = "pdf" // PDF report of the transactions of a station, the default
+)
+
+// TaskCreator is the kind of caller that created a task
+type TaskCreator string
+
+const (
+	TaskCreatorAdmin     TaskCreator = "admin"     // CreatorID is the admin user
+	TaskCreatorAPIKey    TaskCreator = "api_key"   // CreatorID is the API key ID
+	TaskCreatorSchedule  TaskCreator = "schedule"  // CreatorID is the schedule ID
+	TaskCreatorAnonymous TaskCreator = "anonymous" // Security disabled
+)
+
+// TaskPriority controls the order in which queued tasks are dispatched
+type TaskPriority string
+
+const (
+	TaskPriorityUrgent TaskPriority = "urgent"
+	TaskPriorityNormal TaskPriority = "normal"
+	TaskPriorityBulk   TaskPriority = "bulk"
+)
+
+// priorityBand is how far each priority level pulls a task's dispatch time back.
+// The queue dispatches by ascending dispatch time, so a task one band ahead is
+// always picked before any task enqueued at a lower priority.
+const priorityBand = 10 * 365 * 24 * time.Hour
+
+// Valid reports whether p is a known priority
+func (p TaskPriority) Valid() bool {
+	switch p {
+	case TaskPriorityUrgent, TaskPriorityNormal, TaskPriorityBulk:
+		return true
+	}
+	return false
+}
+
+// OrDefault returns p, or normal priority when p is empty
+func (p TaskPriority) OrDefault() TaskPriority {
+	if p == "" {
+		return TaskPriorityNormal
+	}
+	return p
+}
+
+// QueueOrder returns the dispatch order (unix milliseconds) for a task of the
+// given priority enqueued at the given time. Lower values are dispatched first.
+func QueueOrder(priority TaskPriority, at time.Time) int64 {
+	switch priority.OrDefault() {
+	case TaskPriorityUrgent:
+		at = at.Add(-2 * priorityBand)
+	case TaskPriorityNormal:
+		at = at.Add(-priorityBand)
+	}
+	return at.UnixMilli()
+}
+
 // Task represents a PDF generation job
 type Task struct {
-	ID           string     `gorm:"primaryKey;type:text" json:"id"`
-	ScheduleID   *string    `gorm:"type:text;index" json:"schedule_id,omitempty"`
-	Status       TaskStatus `gorm:"type:text;index;not null;default:'queued'" json:"status"`
-	ErrorMessage string     `gorm:"type:text" json:"error_message,omitempty"`
+	ID           string        `gorm:"primaryKey;type:text" json:"id"`
+	ScheduleID   *string       `gorm:"type:text;index" json:"schedule_id,omitempty"`
+	ParentID     *string       `gorm:"type:text;index" json:"parent_id,omitempty"` // Batch job that created the task
+	Type         TaskType      `gorm:"type:text;index;not null;default:'pdf'" json:"type"`
+	Status       TaskStatus    `gorm:"type:text;index;not null;default:'queued'" json:"status"`
+	ErrorMessage string        `gorm:"type:text" json:"error_message,omitempty"`
+	ErrorCode    TaskErrorCode `gorm:"type:text;index" json:"error_code,omitempty"` // Class of the error, see TaskErrorCode
+
+	// Dispatch ordering
+	Priority   TaskPriority `gorm:"type:text;not null;default:'normal'" json:"priority"`
+	QueueOrder int64        `gorm:"type:integer;index;default:0" json:"queue_order"` // Dispatch order, lower runs first
+	JobID      string       `gorm:"type:text;index" json:"job_id,omitempty"`         // Backlite job ID
+	WorkerID   string       `gorm:"type:text;index" json:"worker_id,omitempty"`      // Worker that last processed the task
+
+	// Expiry of the lease held by a remote worker, extended by its heartbeats
+	LeaseExpiresAt *time.Time `gorm:"type:datetime" json:"lease_expires_at,omitempty"`
+	// API key the lease was granted to, the worker must report on the task with the same key
+	LeaseAPIKeyID string `gorm:"type:text" json:"-"`
+
+	// API key the task was enqueued with, its webhooks receive the task events.
+	// API key callers only see tasks of their own key, including those of their schedules.
+	APIKeyID string `gorm:"type:text;index" json:"api_key_id,omitempty"`
+
+	// Creator of the task
+	CreatorType TaskCreator `gorm:"type:text;index" json:"creator_type,omitempty"`
+	CreatorID   string      `gorm:"type:text;index" json:"creator_id,omitempty"`
+
+	// Number of days the report covers, counted against the daily quota of the API key
+	ReportDays int `gorm:"type:integer;default:0" json:"report_days,omitempty"`
+
+	// Fingerprint of the normalized metadata, used for duplicate detection
+	Fingerprint string `gorm:"type:text;index" json:"fingerprint,omitempty"`
 
 	// Extracted metadata fields
 	RootFolder string `gorm:"type:text" json:"root_folder"`
@@ -34,6 +135,9 @@ type Task struct {
 	GateID     int    `gorm:"type:integer" json:"gate_id"`
 	StationID  int    `gorm:"type:integer" json:"station_id"`
 
+	// Parameters of job types other than PDF, which keep theirs in the fields below
+	Payload json.RawMessage `gorm:"type:text" json:"payload,omitempty"`
+
 	// Filters stored as object, serialized to JSON in database
 	Filters    *TaskFilter `gorm:"-" json:"filters,omitempty"`
 	FiltersRaw string      `gorm:"column:filter_json;type:text" json:"-"`
@@ -47,6 +151,36 @@ type Task struct {
 	ProgressTotal   int    `gorm:"type:integer;default:0" json:"progress_total"`   // Total transactions to process
 	ProgressCurrent int    `gorm:"type:integer;default:0" json:"progress_current"` // Current processed count
 
+	// Rendered chunks of large days, serialized to JSON in database
+	Chunks    []TaskChunk `gorm:"-" json:"chunks,omitempty"`
+	ChunksRaw string      `gorm:"column:chunks_json;type:text" json:"-"`
+
+	// Versions of the data source files read, serialized to JSON in database
+	Sources    []TaskSource `gorm:"-" json:"sources,omitempty"`
+	SourcesRaw string       `gorm:"column:sources_json;type:text" json:"-"`
+
+	// Report email, serialized to JSON in database
+	Email    *EmailRequest `gorm:"-" json:"email,omitempty"`
+	EmailRaw string        `gorm:"column:email_json;type:text" json:"-"`
+
+	// Report email delivery
+	EmailStatus   EmailStatus `gorm:"type:text" json:"email_status,omitempty"`
+	EmailAttempts int         `gorm:"type:integer;default:0" json:"email_attempts,omitempty"`
+	EmailError    string      `gorm:"type:text" json:"email_error,omitempty"`
+	EmailSentAt   *time.Time  `gorm:"type:datetime" json:"email_sent_at,omitempty"`
+
+	// Lifecycle timestamps, stamped on status transitions. A retried task is queued again.
+	QueuedAt   *time.Time `gorm:"type:datetime;index" json:"queued_at,omitempty"`
+	StartedAt  *time.Time `gorm:"type:datetime" json:"started_at,omitempty"`
+	FinishedAt *time.Time `gorm:"type:datetime" json:"finished_at,omitempty"`
+
+	// Derived from the lifecycle timestamps when loaded
+	WaitSeconds float64 `gorm:"-" json:"wait_seconds,omitempty"` // Queued until started
+	RunSeconds  float64 `gorm:"-" json:"run_seconds,omitempty"`  // Started until finished
+
+	// Archived tasks are hidden from the task list unless requested
+	ArchivedAt *time.Time `gorm:"type:datetime;index" json:"archived_at,omitempty"`
+
 	OutputFilePath string    `gorm:"type:text" json:"output_file_path,omitempty"`
 	OutputFileSize int64     `gorm:"type:integer;default:0" json:"output_file_size"`
 	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
@@ -57,20 +191,25 @@ func (t *Task) BeforeCreate(tx *gorm.DB) error {
 	if t.ID == "" {
 		t.ID = uuid.New().String()
 	}
+	if t.Type == "" {
+		t.Type = TaskTypePDF
+	}
+	t.Priority = t.Priority.OrDefault()
 	return t.serializeJSON()
 }
 
-// BeforeSave serializes Filters and Settings to JSON before saving
+// BeforeSave serializes Filters, Settings, Email, Chunks and Sources to JSON before saving
 func (t *Task) BeforeSave(tx *gorm.DB) error {
 	return t.serializeJSON()
 }
 
-// AfterFind deserializes JSON to Filters and Settings after loading
+// AfterFind deserializes JSON to Filters, Settings, Email, Chunks and Sources and derives the timings after loading
 func (t *Task) AfterFind(tx *gorm.DB) error {
+	t.deriveTimings()
 	return t.deserializeJSON()
 }
 
-// serializeJSON converts Filters and Settings objects to JSON strings
+// serializeJSON converts Filters, Settings, Email, Chunks and Sources objects to JSON strings
 func (t *Task) serializeJSON() error {
 	if t.Filters != nil {
 		data, err := json.Marshal(t.Filters)
@@ -88,10 +227,34 @@ func (t *Task) serializeJSON() error {
 		t.SettingsRaw = string(data)
 	}
 
+	if t.Email != nil {
+		data, err := json.Marshal(t.Email)
+		if err != nil {
+			return err
+		}
+		t.EmailRaw = string(data)
+	}
+
+	if t.Chunks != nil {
+		data, err := json.Marshal(t.Chunks)
+		if err != nil {
+			return err
+		}
+		t.ChunksRaw = string(data)
+	}
+
+	if t.Sources != nil {
+		data, err := json.Marshal(t.Sources)
+		if err != nil {
+			return err
+		}
+		t.SourcesRaw = string(data)
+	}
+
 	return nil
 }
 
-// deserializeJSON converts JSON strings to Filters and Settings objects
+// deserializeJSON converts JSON strings to Filters, Settings, Email, Chunks and Sources objects
 func (t *Task) deserializeJSON() error {
 	if t.FiltersRaw != "" {
 		var filters TaskFilter
@@ -107,9 +270,62 @@ func (t *Task) deserializeJSON() error {
 		}
 	}
 
+	if t.EmailRaw != "" {
+		var email EmailRequest
+		if err := json.Unmarshal([]byte(t.EmailRaw), &email); err == nil {
+			t.Email = &email
+		}
+	}
+
+	if t.ChunksRaw != "" {
+		var chunks []TaskChunk
+		if err := json.Unmarshal([]byte(t.ChunksRaw), &chunks); err == nil {
+			t.Chunks = chunks
+		}
+	}
+
+	if t.SourcesRaw != "" {
+		var sources []TaskSource
+		if err := json.Unmarshal([]byte(t.SourcesRaw), &sources); err == nil {
+			t.Sources = sources
+		}
+	}
+
 	return nil
 }
 
+// ResetForRetry queues a failed or cancelled task again, clearing the state of its previous run
+func (t *Task) ResetForRetry() {
+	t.Status = TaskStatusQueued
+	t.ErrorMessage = ""
+	t.ErrorCode = ""
+	t.ProgressStage = ""
+	t.ProgressCurrent = 0
+	t.ProgressTotal = 0
+	t.WorkerID = ""
+	t.LeaseExpiresAt = nil
+	t.LeaseAPIKeyID = ""
+	// Cleared so that reconciliation does not fail the task again from its previous job
+	t.JobID = ""
+}
+
+// Metadata rebuilds the queue payload from the stored task, used when a task has to be enqueued again
+func (t *Task) Metadata() TaskMetadata {
+	metadata := TaskMetadata{
+		RootFolder: t.RootFolder,
+		BranchID:   t.BranchID,
+		GateID:     t.GateID,
+		StationID:  t.StationID,
+		Settings:   t.Settings,
+		Priority:   t.Priority,
+		Email:      t.Email,
+	}
+	if t.Filters != nil {
+		metadata.Filter = *t.Filters
+	}
+	return metadata
+}
+
 // TaskMetadata contains the parameters for PDF generation (used in queue, not stored directly)
 type TaskMetadata struct {
 	RootFolder string         `json:"root_folder"`
@@ -118,6 +334,25 @@ type TaskMetadata struct {
 	StationID  int            `json:"station_id"`
 	Filter     TaskFilter     `json:"filter"`
 	Settings   map[string]any `json:"settings,omitempty"`
+	Priority   TaskPriority   `json:"priority,omitempty"`
+	Email      *EmailRequest  `json:"email,omitempty"`
+	TaskID     string         `json:"task_id,omitempty"` // Set when the task runs, its output is written below output/<task id>/
+}
+
+// Fingerprint returns a stable hash of the generation parameters.
+// Priority, email and task ID are excluded so that the same report submitted at a different priority
+// or for other recipients is still a duplicate
+func (m TaskMetadata) Fingerprint() string {
+	normalized := m
+	normalized.Priority = ""
+	normalized.Email = nil
+	normalized.TaskID = ""
+	normalized.RootFolder = strings.TrimRight(filepath.ToSlash(strings.TrimSpace(m.RootFolder)), "/")
+
+	// encoding/json sorts map keys, so Settings serialize deterministically
+	data, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
 // TaskFilter contains date and transaction filtering options
@@ -132,3 +367,16 @@ type TaskFilter struct {
 	OriginGateIDs     []int  `json:"origin_gate_ids,omitempty"`     // Filter by origin gate IDs
 	Limit             int    `json:"limit,omitempty"`               // Max transactions to fetch, 0 = unlimited
 }
+
+// Days returns the number of days the filter covers, 1 for a single date
+func (f TaskFilter) Days() int {
+	if f.Date != "" || len(f.RangeStart) < 10 || len(f.RangeEnd) < 10 {
+		return 1
+	}
+	start, err1 := time.Parse("2006-01-02", f.RangeStart[:10])
+	end, err2 := time.Parse("2006-01-02", f.RangeEnd[:10])
+	if err1 != nil || err2 != nil || end.Before(start) {
+		return 1
+	}
+	return int(end.Sub(start).Hours()/24) + 1
+}
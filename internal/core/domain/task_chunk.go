@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// TaskChunk is a range of transactions of a report date rendered into an intermediate PDF part.
+// Retries resume after the last chunk instead of rendering the date again.
+type TaskChunk struct {
+	Date        string    `json:"date"`         // Report date (YYYY-MM-DD)
+	Start       int       `json:"start"`        // Index of the first transaction
+	End         int       `json:"end"`          // Index after the last transaction
+	Total       int       `json:"total"`        // Transactions of the date when the chunk was rendered
+	Path        string    `json:"path"`         // The PDF part
+	GeneratedAt time.Time `json:"generated_at"` // Print time in the report header, the same for all parts of a date
+}
+
+// WithChunk returns the chunks with chunk added. Chunks of the same date from its start on
+// are replaced, they belong to an earlier render the date was restarted from.
+func WithChunk(chunks []TaskChunk, chunk TaskChunk) []TaskChunk {
+	result := make([]TaskChunk, 0, len(chunks)+1)
+	for _, c := range chunks {
+		if c.Date == chunk.Date && c.Start >= chunk.Start {
+			continue
+		}
+		result = append(result, c)
+	}
+	result = append(result, chunk)
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Date != result[j].Date {
+			return result[i].Date < result[j].Date
+		}
+		return result[i].Start < result[j].Start
+	})
+	return result
+}
@@ -0,0 +1,42 @@
+package domain
+
+// TaskErrorCode classifies why a task failed, so clients can react without parsing the message
+type TaskErrorCode string
+
+const (
+	TaskErrorDataSourceMissing   TaskErrorCode = "data_source_missing"   // The MDB file of the report date does not exist
+	TaskErrorDataSourceAmbiguous TaskErrorCode = "data_source_ambiguous" // A path format with wildcards matched several files
+	TaskErrorDriverUnavailable   TaskErrorCode = "driver_unavailable"    // No MS Access driver is installed on the worker
+	TaskErrorFileLocked          TaskErrorCode = "file_locked"           // The MDB file is opened exclusively by another program
+	TaskErrorConnect             TaskErrorCode = "connect_failed"        // The MDB file could not be opened for another reason
+	TaskErrorArchive             TaskErrorCode = "archive_failed"        // The MDB file could not be extracted from its archive
+	TaskErrorArchiveTooLarge     TaskErrorCode = "archive_too_large"     // The MDB file in the archive is above the extraction cache limit
+	TaskErrorQuery               TaskErrorCode = "query_failed"          // Reading the transactions failed
+	TaskErrorRender              TaskErrorCode = "render_failed"         // The PDF document could not be built
+	TaskErrorDiskFull            TaskErrorCode = "disk_full"             // No space left to write the PDF
+	TaskErrorInvalidInput        TaskErrorCode = "invalid_input"         // The task metadata can never be processed, e.g. an invalid date
+	TaskErrorTimeout             TaskErrorCode = "timeout"               // The attempt ran longer than the queue timeout
+	TaskErrorCancelled           TaskErrorCode = "cancelled"             // The attempt was interrupted, e.g. by a worker shutdown
+	TaskErrorLeaseExpired        TaskErrorCode = "lease_expired"         // A remote worker stopped renewing its lease
+	TaskErrorInternal            TaskErrorCode = "internal"              // Any other error
+)
+
+// Permanent reports whether retrying can not succeed, such tasks fail on the first attempt
+func (c TaskErrorCode) Permanent() bool {
+	switch c {
+	case TaskErrorDataSourceMissing, TaskErrorDataSourceAmbiguous, TaskErrorDriverUnavailable, TaskErrorArchiveTooLarge, TaskErrorRender, TaskErrorInvalidInput:
+		return true
+	}
+	return false
+}
+
+// IsValid checks if the error code is known
+func (c TaskErrorCode) IsValid() bool {
+	switch c {
+	case TaskErrorDataSourceMissing, TaskErrorDataSourceAmbiguous, TaskErrorDriverUnavailable, TaskErrorFileLocked, TaskErrorConnect,
+		TaskErrorArchive, TaskErrorArchiveTooLarge, TaskErrorQuery, TaskErrorRender, TaskErrorDiskFull, TaskErrorInvalidInput, TaskErrorTimeout,
+		TaskErrorCancelled, TaskErrorLeaseExpired, TaskErrorInternal:
+		return true
+	}
+	return false
+}
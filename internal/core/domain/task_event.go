@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// TaskEventType is the kind of change a task event records
+type TaskEventType string
+
+const (
+	TaskEventStatus TaskEventType = "status" // The task moved to another status
+	TaskEventStage  TaskEventType = "stage"  // The progress stage changed while the status stayed the same
+)
+
+// TaskEvent is an entry of a task's lifecycle history
+type TaskEvent struct {
+	ID        uint          `gorm:"primaryKey;autoIncrement" json:"id"`
+	TaskID    string        `gorm:"type:text;index" json:"task_id"`
+	Type      TaskEventType `gorm:"type:text" json:"type"`
+	Status    TaskStatus    `gorm:"type:text" json:"status"`
+	Stage     string        `gorm:"type:text" json:"stage,omitempty"`
+	WorkerID  string        `gorm:"type:text" json:"worker_id,omitempty"`
+	Message   string        `gorm:"type:text" json:"message,omitempty"` // Error of failed tasks
+	CreatedAt time.Time     `gorm:"index" json:"created_at"`
+}
+
+// Transition stamps the lifecycle timestamps for a change from the previous status and stage,
+// and returns the event to record, nil when neither changed. A task that is queued again
+// (retry) starts a new wait, so its start and finish times are cleared.
+func (t *Task) Transition(prevStatus TaskStatus, prevStage string, at time.Time) *TaskEvent {
+	event := &TaskEvent{
+		TaskID:    t.ID,
+		Status:    t.Status,
+		Stage:     t.ProgressStage,
+		WorkerID:  t.WorkerID,
+		CreatedAt: at,
+	}
+
+	switch {
+	case t.Status != prevStatus:
+		event.Type = TaskEventStatus
+		switch {
+		case t.Status == TaskStatusQueued:
+			t.QueuedAt = &at
+			t.StartedAt = nil
+			t.FinishedAt = nil
+		case t.Status == TaskStatusRunning:
+			t.StartedAt = &at
+			t.FinishedAt = nil
+		case t.Status.IsTerminal():
+			t.FinishedAt = &at
+		}
+		if t.Status == TaskStatusFailed {
+			event.Message = t.ErrorMessage
+		}
+	case t.ProgressStage != prevStage && t.ProgressStage != "":
+		event.Type = TaskEventStage
+	default:
+		return nil
+	}
+
+	t.deriveTimings()
+	return event
+}
+
+// deriveTimings computes the wait and run time from the lifecycle timestamps
+func (t *Task) deriveTimings() {
+	t.WaitSeconds, t.RunSeconds = 0, 0
+	if t.QueuedAt != nil && t.StartedAt != nil {
+		t.WaitSeconds = t.StartedAt.Sub(*t.QueuedAt).Seconds()
+	}
+	if t.StartedAt != nil && t.FinishedAt != nil {
+		t.RunSeconds = t.FinishedAt.Sub(*t.StartedAt).Seconds()
+	}
+}
+
+// SLADay aggregates the timings of the tasks queued on one day
+type SLADay struct {
+	Date      string `json:"date"` // YYYY-MM-DD
+	Tasks     int    `json:"tasks"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+
+	WaitP50 float64 `json:"wait_p50_seconds"`
+	WaitP95 float64 `json:"wait_p95_seconds"`
+	WaitMax float64 `json:"wait_max_seconds"`
+	RunP50  float64 `json:"run_p50_seconds"`
+	RunP95  float64 `json:"run_p95_seconds"`
+	RunMax  float64 `json:"run_max_seconds"`
+}
+
+// SLAReport groups finished tasks by the day they were queued, in the location of loc.
+// Tasks without lifecycle timestamps are skipped.
+func SLAReport(tasks []Task, loc *time.Location) []SLADay {
+	type day struct {
+		SLADay
+		waits, runs []float64
+	}
+	days := make(map[string]*day)
+
+	for i := range tasks {
+		task := &tasks[i]
+		if task.QueuedAt == nil || task.FinishedAt == nil {
+			continue
+		}
+		task.deriveTimings()
+
+		date := task.QueuedAt.In(loc).Format("2006-01-02")
+		d, ok := days[date]
+		if !ok {
+			d = &day{SLADay: SLADay{Date: date}}
+			days[date] = d
+		}
+		d.Tasks++
+		switch task.Status {
+		case TaskStatusCompleted:
+			d.Completed++
+		case TaskStatusFailed:
+			d.Failed++
+		}
+		// Tasks cancelled while queued never started
+		if task.StartedAt != nil {
+			d.waits = append(d.waits, task.WaitSeconds)
+			d.runs = append(d.runs, task.RunSeconds)
+		}
+	}
+
+	report := make([]SLADay, 0, len(days))
+	for _, d := range days {
+		d.WaitP50, d.WaitP95, d.WaitMax = percentile(d.waits, 50), percentile(d.waits, 95), percentile(d.waits, 100)
+		d.RunP50, d.RunP95, d.RunMax = percentile(d.runs, 50), percentile(d.runs, 95), percentile(d.runs, 100)
+		report = append(report, d.SLADay)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Date < report[j].Date })
+	return report
+}
+
+// percentile returns the nearest-rank percentile p (0-100) of values, 0 when empty
+func percentile(values []float64, p int) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// TaskSource records the version of the data source file a report date was read from
+type TaskSource struct {
+	Date     string    `json:"date"`              // Report date (YYYY-MM-DD)
+	Path     string    `json:"path"`              // The resolved data source file
+	Format   string    `json:"format,omitempty"`  // The data source path format that matched
+	Archive  string    `json:"archive,omitempty"` // Archive the file was extracted from, when it was missing
+	Entry    string    `json:"entry,omitempty"`   // Name of the file in the archive
+	Size     int64     `json:"size"`              // Size of the file when it was read
+	ModTime  time.Time `json:"mod_time"`          // Modification time of the file when it was read
+	SHA256   string    `json:"sha256,omitempty"`  // Checksum of the snapshot, empty when the live file was read
+	Snapshot bool      `json:"snapshot"`          // Read from a copy of the file
+	Driver   string    `json:"driver,omitempty"`  // Name of the driver attempt that opened the file
+	ReadAt   time.Time `json:"read_at"`
+}
+
+// WithSource returns the sources with source added, replacing an earlier read of the same date
+func WithSource(sources []TaskSource, source TaskSource) []TaskSource {
+	result := make([]TaskSource, 0, len(sources)+1)
+	for _, s := range sources {
+		if s.Date != source.Date {
+			result = append(result, s)
+		}
+	}
+	result = append(result, source)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Date < result[j].Date
+	})
+	return result
+}
@@ -0,0 +1,142 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebhookEvent is a task event that can be delivered to callback URLs
+type WebhookEvent string
+
+const (
+	WebhookEventTaskCompleted WebhookEvent = "task.completed"
+	WebhookEventTaskFailed    WebhookEvent = "task.failed"
+	WebhookEventTaskCancelled WebhookEvent = "task.cancelled"
+)
+
+// WebhookEvents lists all events, used when a webhook does not select any
+var WebhookEvents = []WebhookEvent{WebhookEventTaskCompleted, WebhookEventTaskFailed, WebhookEventTaskCancelled}
+
+// Valid reports whether e is a known event
+func (e WebhookEvent) Valid() bool {
+	for _, event := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEventForStatus returns the event sent when a task reaches the given status
+func WebhookEventForStatus(status TaskStatus) (WebhookEvent, bool) {
+	switch status {
+	case TaskStatusCompleted:
+		return WebhookEventTaskCompleted, true
+	case TaskStatusFailed:
+		return WebhookEventTaskFailed, true
+	case TaskStatusCancelled:
+		return WebhookEventTaskCancelled, true
+	}
+	return "", false
+}
+
+// Webhook is a callback URL notified of task events. It is scoped to a single task,
+// to the tasks created with an API key, or to all tasks when neither is set. The API
+// key of a task webhook is the key that registered it.
+type Webhook struct {
+	ID       string  `gorm:"primaryKey;type:text" json:"id"`
+	TaskID   *string `gorm:"type:text;index" json:"task_id,omitempty"`
+	APIKeyID *string `gorm:"type:text;index" json:"api_key_id,omitempty"`
+	URL      string  `gorm:"type:text;not null" json:"url"`
+
+	// Subscribed events, serialized to JSON in database
+	Events    []WebhookEvent `gorm:"-" json:"events"`
+	EventsRaw string         `gorm:"column:events_json;type:text" json:"-"`
+
+	EncryptedSecret string    `gorm:"type:text" json:"-"` // AES encrypted signing secret
+	Active          bool      `gorm:"default:true" json:"active"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Subscribed checks if the webhook receives the event
+func (w *Webhook) Subscribed(event WebhookEvent) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == "" {
+		w.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeSave serializes Events to JSON before saving
+func (w *Webhook) BeforeSave(tx *gorm.DB) error {
+	if w.Events == nil {
+		w.Events = []WebhookEvent{}
+	}
+	data, err := json.Marshal(w.Events)
+	if err != nil {
+		return err
+	}
+	w.EventsRaw = string(data)
+	return nil
+}
+
+// AfterFind deserializes Events after loading
+func (w *Webhook) AfterFind(tx *gorm.DB) error {
+	w.Events = []WebhookEvent{}
+	if w.EventsRaw != "" {
+		_ = json.Unmarshal([]byte(w.EventsRaw), &w.Events)
+	}
+	return nil
+}
+
+// DeliveryStatus represents the state of a webhook delivery
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "pending"
+	DeliveryStatusSucceeded DeliveryStatus = "succeeded"
+	DeliveryStatusFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is the delivery log entry of one event to one webhook
+type WebhookDelivery struct {
+	ID        string         `gorm:"primaryKey;type:text" json:"id"`
+	WebhookID string         `gorm:"type:text;index" json:"webhook_id"`
+	TaskID    string         `gorm:"type:text;index" json:"task_id"`
+	Event     WebhookEvent   `gorm:"type:text" json:"event"`
+	URL       string         `gorm:"type:text" json:"url"`
+	Payload   string         `gorm:"type:text" json:"payload,omitempty"`
+	Status    DeliveryStatus `gorm:"type:text;index;not null;default:'pending'" json:"status"`
+	ReplayOf  *string        `gorm:"type:text" json:"replay_of,omitempty"` // Delivery this one replays
+
+	Attempts      int        `gorm:"type:integer;default:0" json:"attempts"`
+	ResponseCode  int        `gorm:"type:integer;default:0" json:"response_code"`
+	ResponseBody  string     `gorm:"type:text" json:"response_body,omitempty"` // Truncated
+	Error         string     `gorm:"type:text" json:"error,omitempty"`
+	NextAttemptAt *time.Time `gorm:"type:datetime" json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `gorm:"type:datetime" json:"delivered_at,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	return nil
+}
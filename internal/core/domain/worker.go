@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WorkerStaleAfter is how long a worker may miss heartbeats before it is flagged as stale
+const WorkerStaleAfter = 30 * time.Second
+
+// WorkerLeaseTTL is how long a remote worker holds a task without renewing its lease
+const WorkerLeaseTTL = 2 * time.Minute
+
+// WorkerState represents the lifecycle state of a worker process
+type WorkerState string
+
+const (
+	WorkerStateRunning WorkerState = "running"
+	WorkerStatePausing WorkerState = "pausing"
+	WorkerStatePaused  WorkerState = "paused"
+	WorkerStateStopped WorkerState = "stopped"
+)
+
+// WorkerMode tells how a worker receives jobs
+type WorkerMode string
+
+const (
+	WorkerModeLocal  WorkerMode = "local"  // Runs the queue on the shared database
+	WorkerModeRemote WorkerMode = "remote" // Leases jobs from the API over HTTP
+)
+
+// Worker is a PDF worker process registered through heartbeats
+type Worker struct {
+	ID          string      `gorm:"primaryKey;type:text" json:"id"`
+	Host        string      `gorm:"type:text" json:"host"`
+	PID         int         `gorm:"type:integer" json:"pid"`
+	Version     string      `gorm:"type:text" json:"version"`
+	Build       string      `gorm:"type:text" json:"build"`
+	Concurrency int         `gorm:"type:integer;default:0" json:"concurrency"`
+	State       WorkerState `gorm:"type:text;not null;default:'running'" json:"state"`
+	Mode        WorkerMode  `gorm:"type:text;not null;default:'local'" json:"mode"`
+
+	// Tasks being processed, serialized to JSON in database
+	CurrentTasks    []string `gorm:"-" json:"current_tasks"`
+	CurrentTasksRaw string   `gorm:"column:current_tasks_json;type:text" json:"-"`
+
+	StartedAt     time.Time `gorm:"type:datetime" json:"started_at"`
+	LastHeartbeat time.Time `gorm:"type:datetime;index" json:"last_heartbeat"`
+
+	Stale bool `gorm:"-" json:"stale"` // Computed from LastHeartbeat
+}
+
+// IsStale checks if the worker stopped sending heartbeats without shutting down cleanly
+func (w *Worker) IsStale(now time.Time) bool {
+	return w.State != WorkerStateStopped && now.Sub(w.LastHeartbeat) > WorkerStaleAfter
+}
+
+// BeforeSave serializes CurrentTasks to JSON before saving
+func (w *Worker) BeforeSave(tx *gorm.DB) error {
+	if w.CurrentTasks == nil {
+		w.CurrentTasks = []string{}
+	}
+	data, err := json.Marshal(w.CurrentTasks)
+	if err != nil {
+		return err
+	}
+	w.CurrentTasksRaw = string(data)
+	return nil
+}
+
+// AfterFind deserializes CurrentTasks and computes the stale flag after loading
+func (w *Worker) AfterFind(tx *gorm.DB) error {
+	w.CurrentTasks = []string{}
+	if w.CurrentTasksRaw != "" {
+		_ = json.Unmarshal([]byte(w.CurrentTasksRaw), &w.CurrentTasks)
+	}
+	w.Stale = w.IsStale(time.Now())
+	return nil
+}
@@ -2,10 +2,29 @@ package ports
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"pdf_generator/internal/core/domain"
 )
 
+// ErrTaskNotQueued is returned when a task can no longer be reordered because it
+// has already been dispatched to a worker or was never enqueued
+var ErrTaskNotQueued = errors.New("task is not waiting in the queue")
+
+// ErrLeaseLost is returned when a remote worker reports on a task it no longer holds,
+// because its lease expired and the task was leased again or finished
+var ErrLeaseLost = errors.New("task lease is no longer held by this worker")
+
+// Lease is a job handed to a remote worker until ExpiresAt, extended by heartbeats
+type Lease struct {
+	TaskID    string              `json:"task_id"`
+	JobID     string              `json:"job_id"`
+	Attempt   int                 `json:"attempt"`
+	Metadata  domain.TaskMetadata `json:"metadata"`
+	ExpiresAt time.Time           `json:"expires_at"`
+}
+
 // TaskProgress holds the current progress state for a task
 type TaskProgress struct {
 	Stage   string `json:"stage"`
@@ -13,10 +32,45 @@ type TaskProgress struct {
 	Total   int    `json:"total"`
 }
 
+// ProgressEvent is a live task update pushed from the worker process to the API
+type ProgressEvent struct {
+	TaskID       string               `json:"task_id"`
+	Status       domain.TaskStatus    `json:"status"`
+	Stage        string               `json:"stage,omitempty"`
+	Current      int                  `json:"current"`
+	Total        int                  `json:"total"`
+	OutputSize   int64                `json:"output_size,omitempty"`
+	ErrorMessage string               `json:"error_message,omitempty"`
+	ErrorCode    domain.TaskErrorCode `json:"error_code,omitempty"`
+	Time         time.Time            `json:"time"`
+}
+
+// ProgressPublisher receives progress events as they happen
+type ProgressPublisher interface {
+	Publish(event ProgressEvent)
+}
+
+// ProgressSubscriber streams progress events of a task
+type ProgressSubscriber interface {
+	Subscribe(taskID string) (<-chan ProgressEvent, func())
+	Latest(taskID string) *ProgressEvent
+}
+
 // QueueService defines the interface for task queue operations
 type QueueService interface {
 	Enqueue(ctx context.Context, taskID string, metadata domain.TaskMetadata) ([]string, error)
+	EnqueueTask(ctx context.Context, task *domain.Task) ([]string, error)
 	Start(ctx context.Context)
 	GetProgress(taskID string) *TaskProgress
+	SetPriority(ctx context.Context, taskID string, priority domain.TaskPriority) error
+	Move(ctx context.Context, taskID string, position int) error
+	Pause(ctx context.Context) (*domain.QueueControl, error)
+	Resume(ctx context.Context) (*domain.QueueControl, error)
+	Control(ctx context.Context) (*domain.QueueControl, error)
+	Lease(ctx context.Context, workerID, apiKeyID string, ttl time.Duration) (*Lease, error)
+	RenewLease(ctx context.Context, taskID, workerID, apiKeyID string, ttl time.Duration) (time.Time, error)
+	CompleteLease(ctx context.Context, taskID, workerID, apiKeyID, output string, size int64) error
+	FailLease(ctx context.Context, taskID, workerID, apiKeyID string, code domain.TaskErrorCode, errMsg string) (domain.TaskStatus, error)
+	NotifyTask(ctx context.Context, task *domain.Task)
+	ReplayDelivery(ctx context.Context, deliveryID string) (*domain.WebhookDelivery, error)
 }
-
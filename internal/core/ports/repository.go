@@ -2,6 +2,7 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"pdf_generator/internal/core/domain"
 )
@@ -12,25 +13,59 @@ type TaskRepository interface {
 	GetByID(ctx context.Context, id string) (*domain.Task, error)
 	Update(ctx context.Context, task *domain.Task) error
 	UpdateProgress(ctx context.Context, id string, stage string, current, total int) error
-	UpdateError(ctx context.Context, id string, errMsg string) error
+	UpdateError(ctx context.Context, id string, code domain.TaskErrorCode, errMsg string) error
+	AddChunk(ctx context.Context, id string, chunk domain.TaskChunk) error
+	AddSource(ctx context.Context, id string, source domain.TaskSource) error
 	Delete(ctx context.Context, id string) error
 	List(ctx context.Context, filter TaskFilter) ([]domain.Task, int64, error)
 	CountByStatus(ctx context.Context, status domain.TaskStatus) (int64, error)
 	GetQueuePosition(ctx context.Context, id string) (int, error)
+	ListQueued(ctx context.Context) ([]domain.Task, error)
+	UpdateDispatch(ctx context.Context, id string, jobID string, priority domain.TaskPriority, order int64) error
+	FindByFingerprint(ctx context.Context, fingerprint string, completedSince time.Time) (*domain.Task, error)
 	FindExpiredCompleted(ctx context.Context, days int) ([]domain.Task, error)
+	ListByStatus(ctx context.Context, statuses ...domain.TaskStatus) ([]domain.Task, error)
+	ListByJobIDs(ctx context.Context, jobIDs []string) ([]domain.Task, error)
+	ListOutputPaths(ctx context.Context) ([]string, error)
+	ListByParent(ctx context.Context, parentID string, statuses ...domain.TaskStatus) ([]domain.Task, error)
+	CountByParent(ctx context.Context, parentIDs []string) (map[string]domain.BatchJobCounts, error)
+	UsageByAPIKey(ctx context.Context, since time.Time, apiKeyIDs ...string) (map[string]domain.APIKeyUsage, error)
+	ListEvents(ctx context.Context, taskID string) ([]domain.TaskEvent, error)
+	ListTimings(ctx context.Context, from, to time.Time) ([]domain.Task, error)
+	CountFinishedSince(ctx context.Context, since time.Time) (map[domain.TaskStatus]int64, error)
 }
 
 // TaskFilter for listing tasks
 type TaskFilter struct {
 	Status    string
+	Type      domain.TaskType
 	FromDate  string
 	ToDate    string
 	GateID    *int
 	StationID *int
+	ParentID  string
+	APIKeyID  string
+	Creator   domain.TaskCreator
+	CreatorID string
+	Archived  *bool // Archived or active tasks only, both when nil
 	Page      int
 	Limit     int
 }
 
+// BatchJobFilter for listing batch jobs
+type BatchJobFilter struct {
+	APIKeyID string
+	Page     int
+	Limit    int
+}
+
+// BatchJobRepository defines the interface for batch job data access
+type BatchJobRepository interface {
+	Create(ctx context.Context, job *domain.BatchJob, tasks []domain.Task) error
+	GetByID(ctx context.Context, id string) (*domain.BatchJob, error)
+	List(ctx context.Context, filter BatchJobFilter) ([]domain.BatchJob, int64, error)
+}
+
 // ScheduleRepository defines the interface for schedule data access
 type ScheduleRepository interface {
 	Create(ctx context.Context, schedule *domain.Schedule) error
@@ -38,7 +73,7 @@ type ScheduleRepository interface {
 	Update(ctx context.Context, schedule *domain.Schedule) error
 	Delete(ctx context.Context, id string) error
 	ListActive(ctx context.Context) ([]domain.Schedule, error)
-	List(ctx context.Context) ([]domain.Schedule, error)
+	List(ctx context.Context, apiKeyID string) ([]domain.Schedule, error)
 }
 
 // SettingsRepository defines the interface for settings data access
@@ -48,6 +83,12 @@ type SettingsRepository interface {
 	GetAll(ctx context.Context) ([]domain.Settings, error)
 }
 
+// Revisioned is implemented by repositories that tell cheaply whether their data changed,
+// so that workers reload cached data only after a change
+type Revisioned interface {
+	Revision(ctx context.Context) (string, error)
+}
+
 // SessionRepository defines the interface for session data access
 type SessionRepository interface {
 	Create(ctx context.Context, session *domain.Session) error
@@ -70,6 +111,69 @@ type APIKeyRepository interface {
 	List(ctx context.Context) ([]domain.APIKey, error)
 }
 
+// IdempotencyRepository defines the interface for idempotency record data access
+type IdempotencyRepository interface {
+	Get(ctx context.Context, key string) (*domain.IdempotencyRecord, error)
+	Save(ctx context.Context, record *domain.IdempotencyRecord) error
+	Reserve(ctx context.Context, record *domain.IdempotencyRecord) (bool, error) // Inserts unless the key exists
+	Delete(ctx context.Context, key string) error
+	DeleteExpired(ctx context.Context) error
+}
+
+// QueueControlRepository defines the interface for the shared queue control state
+type QueueControlRepository interface {
+	Get(ctx context.Context) (*domain.QueueControl, error)
+	SetPaused(ctx context.Context, paused bool) (*domain.QueueControl, error)
+	Report(ctx context.Context, state domain.QueueState, workers, running int) error
+}
+
+// WorkerRepository defines the interface for worker registry data access
+type WorkerRepository interface {
+	Save(ctx context.Context, worker *domain.Worker) error
+	List(ctx context.Context) ([]domain.Worker, error)
+	SetState(ctx context.Context, id string, state domain.WorkerState) error
+	DeleteInactive(ctx context.Context, before time.Time) error
+}
+
+// WebhookFilter filters webhooks and delivery logs
+type WebhookFilter struct {
+	APIKeyID  string
+	WebhookID string
+	TaskID    string
+	Status    string
+	Page      int
+	Limit     int
+}
+
+// WebhookRepository defines the interface for webhook and delivery log data access
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *domain.Webhook) error
+	GetByID(ctx context.Context, id string) (*domain.Webhook, error)
+	List(ctx context.Context, filter WebhookFilter) ([]domain.Webhook, error)
+	ListForTask(ctx context.Context, task *domain.Task) ([]domain.Webhook, error)
+	Delete(ctx context.Context, id string) error
+	CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error
+	GetDelivery(ctx context.Context, id string) (*domain.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error
+	ListDeliveries(ctx context.Context, filter WebhookFilter) ([]domain.WebhookDelivery, int64, error)
+}
+
+// AlertFilter for listing alerts
+type AlertFilter struct {
+	Status string
+	Rule   string
+	Page   int
+	Limit  int
+}
+
+// AlertRepository defines the interface for alert data access
+type AlertRepository interface {
+	Create(ctx context.Context, alert *domain.Alert) error
+	Update(ctx context.Context, alert *domain.Alert) error
+	ListOpen(ctx context.Context) ([]domain.Alert, error)
+	List(ctx context.Context, filter AlertFilter) ([]domain.Alert, int64, error)
+}
+
 // LogRepository defines the interface for log data access
 type LogRepository interface {
 	Create(ctx context.Context, log *domain.Log) error
@@ -0,0 +1,406 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/utils"
+	"pdf_generator/pkg/version"
+)
+
+const (
+	// alertInterval is how often the alert rules are evaluated
+	alertInterval = time.Minute
+
+	// minFailureRateTasks is how many tasks must have finished in the last hour before the failure rate is judged
+	minFailureRateTasks = 5
+
+	// alertWebhookTimeout bounds posting an alert to the alert webhook
+	alertWebhookTimeout = 15 * time.Second
+)
+
+// ServiceStatusReader reports the state of the local worker service, implemented by ProcessService
+type ServiceStatusReader interface {
+	GetStatus(ctx context.Context) (domain.ServiceStatus, error)
+}
+
+// AlertPayload is the body posted to the alert webhook
+type AlertPayload struct {
+	ID        string            `json:"id"`
+	Event     domain.AlertEvent `json:"event"`
+	CreatedAt time.Time         `json:"created_at"`
+	Alert     *domain.Alert     `json:"alert"`
+}
+
+// AlertService evaluates the alert rules, opens and resolves alerts and routes them to the log and the alert webhook
+type AlertService struct {
+	alertRepo       ports.AlertRepository
+	taskRepo        ports.TaskRepository
+	settingsService *SettingsService
+	worker          ServiceStatusReader // Nil skips the worker service rule
+	outputDir       string
+}
+
+// NewAlertService creates a new alert service. Free disk space is measured for outputDir.
+func NewAlertService(alertRepo ports.AlertRepository, taskRepo ports.TaskRepository, settingsService *SettingsService, worker ServiceStatusReader, outputDir string) *AlertService {
+	return &AlertService{
+		alertRepo:       alertRepo,
+		taskRepo:        taskRepo,
+		settingsService: settingsService,
+		worker:          worker,
+		outputDir:       outputDir,
+	}
+}
+
+// GetRepo returns the underlying alert repository
+func (s *AlertService) GetRepo() ports.AlertRepository {
+	return s.alertRepo
+}
+
+// Start evaluates the alert rules every minute until ctx is done
+func (s *AlertService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(alertInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Evaluate(ctx); err != nil {
+					log.Error().Err(err).Msg("Failed to evaluate alert rules")
+				}
+			}
+		}
+	}()
+}
+
+// Evaluate checks all rules once. Conditions without an open alert open one, open alerts
+// whose condition is gone are resolved. Alerts of rules that could not be checked stay as they are.
+func (s *AlertService) Evaluate(ctx context.Context) error {
+	now := time.Now()
+	conditions, checked := s.check(ctx, now)
+
+	open, err := s.alertRepo.ListOpen(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*domain.Alert, len(open))
+	for i := range open {
+		existing[open[i].Key()] = &open[i]
+	}
+
+	for _, condition := range conditions {
+		alert, ok := existing[condition.Key()]
+		delete(existing, condition.Key())
+		if ok {
+			alert.Severity = condition.Severity
+			alert.Message = condition.Message
+			alert.Value = condition.Value
+			alert.Threshold = condition.Threshold
+			alert.LastSeenAt = now
+			if err := s.alertRepo.Update(ctx, alert); err != nil {
+				return err
+			}
+			continue
+		}
+
+		alert = &domain.Alert{
+			Rule:       condition.Rule,
+			Subject:    condition.Subject,
+			Status:     domain.AlertStatusOpen,
+			Severity:   condition.Severity,
+			Message:    condition.Message,
+			Value:      condition.Value,
+			Threshold:  condition.Threshold,
+			OpenedAt:   now,
+			LastSeenAt: now,
+		}
+		if err := s.alertRepo.Create(ctx, alert); err != nil {
+			return err
+		}
+		s.notify(ctx, domain.AlertEventOpened, alert)
+	}
+
+	for _, alert := range existing {
+		if !checked[alert.Rule] {
+			continue
+		}
+		alert.Status = domain.AlertStatusResolved
+		alert.ResolvedAt = &now
+		if err := s.alertRepo.Update(ctx, alert); err != nil {
+			return err
+		}
+		s.notify(ctx, domain.AlertEventResolved, alert)
+	}
+	return nil
+}
+
+// check evaluates every rule and reports the violations found and the rules that could be checked.
+// Disabled rules count as checked, so their open alerts are resolved.
+func (s *AlertService) check(ctx context.Context, now time.Time) ([]domain.AlertCondition, map[domain.AlertRule]bool) {
+	var conditions []domain.AlertCondition
+	checked := make(map[domain.AlertRule]bool)
+
+	rules := []struct {
+		rule  domain.AlertRule
+		check func(ctx context.Context, now time.Time) ([]domain.AlertCondition, error)
+	}{
+		{domain.AlertRuleTaskStuck, s.checkStuckTasks},
+		{domain.AlertRuleQueueAge, s.checkQueueAge},
+		{domain.AlertRuleFailureRate, s.checkFailureRate},
+		{domain.AlertRuleWorkerDown, s.checkWorker},
+		{domain.AlertRuleDiskLow, s.checkDisk},
+	}
+	for _, r := range rules {
+		found, err := r.check(ctx, now)
+		if err != nil {
+			log.Warn().Err(err).Str("rule", string(r.rule)).Msg("Failed to check alert rule")
+			continue
+		}
+		checked[r.rule] = true
+		conditions = append(conditions, found...)
+	}
+	return conditions, checked
+}
+
+// checkStuckTasks finds tasks running longer than the configured minutes
+func (s *AlertService) checkStuckTasks(ctx context.Context, now time.Time) ([]domain.AlertCondition, error) {
+	limit := s.intSetting(ctx, domain.SettingAlertTaskRunningMins)
+	if limit <= 0 {
+		return nil, nil
+	}
+	tasks, err := s.taskRepo.ListByStatus(ctx, domain.TaskStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+
+	var conditions []domain.AlertCondition
+	for _, task := range tasks {
+		// Tasks started before lifecycle timestamps were recorded fall back to their last update
+		started := task.UpdatedAt
+		if task.StartedAt != nil {
+			started = *task.StartedAt
+		}
+		minutes := now.Sub(started).Minutes()
+		if minutes <= float64(limit) {
+			continue
+		}
+		worker := task.WorkerID
+		if worker == "" {
+			worker = "unknown worker"
+		}
+		conditions = append(conditions, domain.AlertCondition{
+			Rule:      domain.AlertRuleTaskStuck,
+			Subject:   task.ID,
+			Severity:  domain.AlertSeverityWarning,
+			Message:   fmt.Sprintf("Task %s has been running for %.0f minutes on %s", task.ID, minutes, worker),
+			Value:     minutes,
+			Threshold: float64(limit),
+		})
+	}
+	return conditions, nil
+}
+
+// checkQueueAge finds a queue whose oldest task waits longer than the configured minutes
+func (s *AlertService) checkQueueAge(ctx context.Context, now time.Time) ([]domain.AlertCondition, error) {
+	limit := s.intSetting(ctx, domain.SettingAlertQueueAgeMins)
+	if limit <= 0 {
+		return nil, nil
+	}
+	tasks, err := s.taskRepo.ListQueued(ctx)
+	if err != nil || len(tasks) == 0 {
+		return nil, err
+	}
+
+	var oldest time.Time
+	for _, task := range tasks {
+		queued := task.CreatedAt
+		if task.QueuedAt != nil {
+			queued = *task.QueuedAt
+		}
+		if oldest.IsZero() || queued.Before(oldest) {
+			oldest = queued
+		}
+	}
+	minutes := now.Sub(oldest).Minutes()
+	if minutes <= float64(limit) {
+		return nil, nil
+	}
+	return []domain.AlertCondition{{
+		Rule:      domain.AlertRuleQueueAge,
+		Severity:  domain.AlertSeverityWarning,
+		Message:   fmt.Sprintf("Oldest queued task has been waiting for %.0f minutes, %d tasks queued", minutes, len(tasks)),
+		Value:     minutes,
+		Threshold: float64(limit),
+	}}, nil
+}
+
+// checkFailureRate compares the share of failed tasks finished in the last hour with the configured percentage
+func (s *AlertService) checkFailureRate(ctx context.Context, now time.Time) ([]domain.AlertCondition, error) {
+	limit := s.intSetting(ctx, domain.SettingAlertFailureRatePct)
+	if limit <= 0 {
+		return nil, nil
+	}
+	counts, err := s.taskRepo.CountFinishedSince(ctx, now.Add(-time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	// Cancelled tasks say nothing about the health of the generation
+	failed := counts[domain.TaskStatusFailed]
+	finished := failed + counts[domain.TaskStatusCompleted]
+	if finished < minFailureRateTasks {
+		return nil, nil
+	}
+	rate := float64(failed) * 100 / float64(finished)
+	if rate <= float64(limit) {
+		return nil, nil
+	}
+	return []domain.AlertCondition{{
+		Rule:      domain.AlertRuleFailureRate,
+		Severity:  domain.AlertSeverityWarning,
+		Message:   fmt.Sprintf("%d of %d tasks failed in the last hour (%.0f%%)", failed, finished, rate),
+		Value:     rate,
+		Threshold: float64(limit),
+	}}, nil
+}
+
+// checkWorker reports a local worker service that is not running.
+// An unknown status cannot be judged and leaves the alert as it is.
+func (s *AlertService) checkWorker(ctx context.Context, now time.Time) ([]domain.AlertCondition, error) {
+	if s.worker == nil {
+		return nil, nil
+	}
+	if enabled, _ := s.settingsService.Get(ctx, domain.SettingAlertWorkerDown); enabled != "true" {
+		return nil, nil
+	}
+	if mode, _ := s.settingsService.Get(ctx, domain.SettingWorkerMode); domain.WorkerMode(mode) == domain.WorkerModeRemote {
+		return nil, nil
+	}
+
+	status, err := s.worker.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case domain.ServiceStatusRunning:
+		return nil, nil
+	case domain.ServiceStatusUnknown:
+		return nil, fmt.Errorf("worker service status is unknown")
+	}
+	return []domain.AlertCondition{{
+		Rule:     domain.AlertRuleWorkerDown,
+		Severity: domain.AlertSeverityCritical,
+		Message:  fmt.Sprintf("Worker service is %s, queued tasks are not processed", status),
+	}}, nil
+}
+
+// checkDisk compares the free space of the output directory's disk with the configured megabytes
+func (s *AlertService) checkDisk(ctx context.Context, now time.Time) ([]domain.AlertCondition, error) {
+	limit := s.intSetting(ctx, domain.SettingAlertDiskFreeMB)
+	if limit <= 0 {
+		return nil, nil
+	}
+	free, err := utils.DiskFree(s.outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	mb := float64(free) / (1024 * 1024)
+	if mb >= float64(limit) {
+		return nil, nil
+	}
+	return []domain.AlertCondition{{
+		Rule:      domain.AlertRuleDiskLow,
+		Severity:  domain.AlertSeverityCritical,
+		Message:   fmt.Sprintf("Only %.0f MB free on the disk of the output directory", mb),
+		Value:     mb,
+		Threshold: float64(limit),
+	}}, nil
+}
+
+// intSetting reads a numeric alert setting, 0 (disabled) when missing or invalid
+func (s *AlertService) intSetting(ctx context.Context, key string) int {
+	value, _ := s.settingsService.Get(ctx, key)
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+// notify logs an alert change and posts it to the alert webhook, if configured
+func (s *AlertService) notify(ctx context.Context, event domain.AlertEvent, alert *domain.Alert) {
+	logEvent := log.Warn()
+	switch {
+	case event == domain.AlertEventResolved:
+		logEvent = log.Info()
+	case alert.Severity == domain.AlertSeverityCritical:
+		logEvent = log.Error()
+	}
+	logEvent.
+		Str("alert_id", alert.ID).
+		Str("rule", string(alert.Rule)).
+		Str("subject", alert.Subject).
+		Str("severity", string(alert.Severity)).
+		Str("event", string(event)).
+		Msg(alert.Message)
+
+	url, _ := s.settingsService.Get(ctx, domain.SettingAlertWebhookURL)
+	if url == "" {
+		return
+	}
+	if err := s.post(ctx, url, event, alert); err != nil {
+		log.Warn().Err(err).Str("alert_id", alert.ID).Str("event", string(event)).Msg("Failed to send alert webhook")
+	}
+}
+
+// post sends the alert to the alert webhook, signed with the alert webhook secret when set
+func (s *AlertService) post(ctx context.Context, url string, event domain.AlertEvent, alert *domain.Alert) error {
+	payload, err := json.Marshal(AlertPayload{
+		ID:        uuid.New().String(),
+		Event:     event,
+		CreatedAt: time.Now(),
+		Alert:     alert,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, alertWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DataLane-Webhook/"+version.Version)
+	req.Header.Set("X-Webhook-Event", string(event))
+
+	if encrypted, _ := s.settingsService.Get(ctx, domain.SettingAlertWebhookSecret); encrypted != "" {
+		secret, err := utils.Decrypt(encrypted)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt alert webhook secret: %w", err)
+		}
+		req.Header.Set("X-Signature", utils.GenerateHMAC(string(payload), secret))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
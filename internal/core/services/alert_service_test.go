@@ -0,0 +1,138 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/adapters/repository"
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/internal/core/services"
+	"pdf_generator/pkg/database"
+	"pdf_generator/pkg/utils"
+)
+
+type fakeWorkerStatus struct {
+	status domain.ServiceStatus
+}
+
+func (f *fakeWorkerStatus) GetStatus(ctx context.Context) (domain.ServiceStatus, error) {
+	return f.status, nil
+}
+
+func TestAlertService_Evaluate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:alerts?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(database.Models()...))
+
+	var mu sync.Mutex
+	var received []services.AlertPayload
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.True(t, utils.VerifyHMAC(string(body), r.Header.Get("X-Signature"), "alert-secret"))
+		var payload services.AlertPayload
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+	deliveries := func() []services.AlertPayload {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]services.AlertPayload{}, received...)
+	}
+
+	ctx := context.Background()
+	settingsRepo := repository.NewSettingsRepository(db)
+	for _, setting := range domain.DefaultSettings() {
+		assert.NoError(t, settingsRepo.Set(ctx, &setting))
+	}
+	settingsService := services.NewSettingsService(settingsRepo)
+	assert.NoError(t, settingsService.LoadCache(ctx))
+	assert.NoError(t, settingsService.Set(ctx, domain.SettingAlertDiskFreeMB, "0"))
+	assert.NoError(t, settingsService.Set(ctx, domain.SettingAlertWebhookURL, webhook.URL))
+	assert.NoError(t, settingsService.Set(ctx, domain.SettingAlertWebhookSecret, "alert-secret"))
+
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time { at := now.Add(-d); return &at }
+	stuck := &domain.Task{Status: domain.TaskStatusRunning, WorkerID: "host-1", QueuedAt: ago(3 * time.Hour), StartedAt: ago(2 * time.Hour)}
+	tasks := []*domain.Task{
+		stuck,
+		{Status: domain.TaskStatusRunning, StartedAt: ago(time.Minute)},
+		{Status: domain.TaskStatusQueued, QueuedAt: ago(time.Hour)},
+		{Status: domain.TaskStatusCompleted, FinishedAt: ago(10 * time.Minute)},
+	}
+	for i := 0; i < 4; i++ {
+		tasks = append(tasks, &domain.Task{Status: domain.TaskStatusFailed, FinishedAt: ago(5 * time.Minute)})
+	}
+	for _, task := range tasks {
+		assert.NoError(t, db.Create(task).Error)
+	}
+
+	worker := &fakeWorkerStatus{status: domain.ServiceStatusStopped}
+	alertRepo := repository.NewAlertRepository(db)
+	service := services.NewAlertService(alertRepo, repository.NewTaskRepository(db), settingsService, worker, t.TempDir())
+
+	openRules := func() map[domain.AlertRule]string {
+		alerts, err := alertRepo.ListOpen(ctx)
+		assert.NoError(t, err)
+		rules := make(map[domain.AlertRule]string)
+		for _, alert := range alerts {
+			rules[alert.Rule] = alert.Subject
+		}
+		return rules
+	}
+
+	assert.NoError(t, service.Evaluate(ctx))
+	assert.Equal(t, map[domain.AlertRule]string{
+		domain.AlertRuleTaskStuck:   stuck.ID,
+		domain.AlertRuleQueueAge:    "",
+		domain.AlertRuleFailureRate: "",
+		domain.AlertRuleWorkerDown:  "",
+	}, openRules())
+	assert.Len(t, deliveries(), 4)
+	assert.Equal(t, domain.AlertEventOpened, deliveries()[0].Event)
+
+	// Conditions that persist do not open new alerts
+	assert.NoError(t, service.Evaluate(ctx))
+	assert.Len(t, deliveries(), 4)
+
+	// An unknown worker status keeps the alert, a running worker resolves it
+	worker.status = domain.ServiceStatusUnknown
+	assert.NoError(t, service.Evaluate(ctx))
+	assert.Contains(t, openRules(), domain.AlertRuleWorkerDown)
+
+	worker.status = domain.ServiceStatusRunning
+	stuck.Status = domain.TaskStatusCompleted
+	assert.NoError(t, db.Save(stuck).Error)
+	assert.NoError(t, service.Evaluate(ctx))
+	assert.Equal(t, map[domain.AlertRule]string{
+		domain.AlertRuleQueueAge:    "",
+		domain.AlertRuleFailureRate: "",
+	}, openRules())
+	sent := deliveries()
+	assert.Len(t, sent, 6)
+	assert.Equal(t, domain.AlertEventResolved, sent[5].Event)
+	assert.Equal(t, domain.AlertStatusResolved, sent[5].Alert.Status)
+
+	// Disabling a rule resolves its alert
+	assert.NoError(t, settingsService.Set(ctx, domain.SettingAlertFailureRatePct, "0"))
+	assert.NoError(t, service.Evaluate(ctx))
+	assert.Equal(t, map[domain.AlertRule]string{domain.AlertRuleQueueAge: ""}, openRules())
+
+	resolved, total, err := alertRepo.List(ctx, ports.AlertFilter{Status: string(domain.AlertStatusResolved)})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.NotNil(t, resolved[0].ResolvedAt)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"time"
 
 	"pdf_generator/internal/core/domain"
 	"pdf_generator/internal/core/ports"
@@ -10,16 +11,17 @@ import (
 
 // APIKeyService handles API key operations
 type APIKeyService struct {
-	repo ports.APIKeyRepository
+	repo    ports.APIKeyRepository
+	limiter *rateLimiter
 }
 
 // NewAPIKeyService creates a new API key service
 func NewAPIKeyService(repo ports.APIKeyRepository) *APIKeyService {
-	return &APIKeyService{repo: repo}
+	return &APIKeyService{repo: repo, limiter: newRateLimiter()}
 }
 
 // Create generates a new API key
-func (s *APIKeyService) Create(ctx context.Context, name string) (*domain.APIKey, string, error) {
+func (s *APIKeyService) Create(ctx context.Context, name string, worker bool, limits domain.APIKeyLimits) (*domain.APIKey, string, error) {
 	// Generate random key
 	rawKey, err := utils.GenerateRandomKey(16)
 	if err != nil {
@@ -43,6 +45,8 @@ func (s *APIKeyService) Create(ctx context.Context, name string) (*domain.APIKey
 		KeyHash:      keyHash,
 		EncryptedKey: encryptedKey,
 		Active:       true,
+		Worker:       worker,
+		APIKeyLimits: limits,
 	}
 
 	if err := s.repo.Create(ctx, apiKey); err != nil {
@@ -89,6 +93,30 @@ func (s *APIKeyService) Toggle(ctx context.Context, id string) (*domain.APIKey,
 	return key, nil
 }
 
+// SetLimits replaces the limits of an API key
+func (s *APIKeyService) SetLimits(ctx context.Context, id string, limits domain.APIKeyLimits) (*domain.APIKey, error) {
+	key, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	key.APIKeyLimits = limits
+	if err := s.repo.Update(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Allow counts a request of the key against its requests per minute.
+// Requests of unlimited keys are counted as well, for the usage shown in the key list.
+func (s *APIKeyService) Allow(key *domain.APIKey) RateLimit {
+	return s.limiter.allow(key.ID, key.RequestsPerMinute, time.Now())
+}
+
+// RequestsThisMinute returns how many requests the key made in the current window
+func (s *APIKeyService) RequestsThisMinute(id string) int {
+	return s.limiter.count(id, time.Now())
+}
+
 // Delete removes an API key
 func (s *APIKeyService) Delete(ctx context.Context, id string) error {
 	return s.repo.Delete(ctx, id)
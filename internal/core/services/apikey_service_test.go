@@ -0,0 +1,36 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/services"
+)
+
+func TestAPIKeyService_Allow(t *testing.T) {
+	service := services.NewAPIKeyService(nil)
+	limited := &domain.APIKey{ID: "limited", APIKeyLimits: domain.APIKeyLimits{RequestsPerMinute: 2}}
+	unlimited := &domain.APIKey{ID: "unlimited"}
+
+	first := service.Allow(limited)
+	assert.True(t, first.Allowed)
+	assert.Equal(t, 2, first.Limit)
+	assert.Equal(t, 1, first.Remaining)
+
+	assert.True(t, service.Allow(limited).Allowed)
+	rejected := service.Allow(limited)
+	assert.False(t, rejected.Allowed)
+	assert.Equal(t, 0, rejected.Remaining)
+	assert.Equal(t, first.Reset, rejected.Reset)
+
+	// Rejected requests are not counted
+	assert.Equal(t, 2, service.RequestsThisMinute("limited"))
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, service.Allow(unlimited).Allowed)
+	}
+	assert.Equal(t, 5, service.RequestsThisMinute("unlimited"))
+	assert.Equal(t, 0, service.RequestsThisMinute("unknown"))
+}
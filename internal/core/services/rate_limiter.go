@@ -0,0 +1,67 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// rateWindow is the length of a rate limit window
+const rateWindow = time.Minute
+
+// RateLimit is the state of an API key's rate limit window after a request
+type RateLimit struct {
+	Limit     int       // Requests per window, 0 when unlimited
+	Remaining int       // Requests left in the current window
+	Reset     time.Time // Start of the next window
+	Allowed   bool
+}
+
+// rateLimiter counts requests per API key in fixed one minute windows
+type rateLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{windows: make(map[string]*window)}
+}
+
+// allow counts a request of the key, unless it would exceed a limit above 0
+func (l *rateLimiter) allow(id string, limit int, now time.Time) RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w := l.current(id, now)
+	result := RateLimit{Limit: limit, Reset: w.start.Add(rateWindow), Allowed: true}
+	if limit > 0 && w.count >= limit {
+		result.Allowed = false
+		return result
+	}
+	w.count++
+	if limit > 0 {
+		result.Remaining = limit - w.count
+	}
+	return result
+}
+
+// count returns the requests of the key in the current window
+func (l *rateLimiter) count(id string, now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current(id, now).count
+}
+
+// current returns the window of the key containing now, starting a new one when the last expired
+func (l *rateLimiter) current(id string, now time.Time) *window {
+	w, ok := l.windows[id]
+	if !ok || !now.Before(w.start.Add(rateWindow)) {
+		w = &window{start: now.Truncate(rateWindow)}
+		l.windows[id] = w
+	}
+	return w
+}
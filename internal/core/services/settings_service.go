@@ -7,6 +7,7 @@ import (
 
 	"pdf_generator/internal/core/domain"
 	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/utils"
 )
 
 // SettingsService handles settings operations
@@ -66,7 +67,7 @@ func (s *SettingsService) Get(ctx context.Context, key string) (string, error) {
 	return repoSetting.Value, nil
 }
 
-// Set updates a setting in both repo and cache
+// Set updates a setting in both repo and cache. Secret values are stored encrypted.
 func (s *SettingsService) Set(ctx context.Context, key, value string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -85,6 +86,13 @@ func (s *SettingsService) Set(ctx context.Context, key, value string) error {
 		}
 	}
 
+	if setting.Secret() && value != "" {
+		encrypted, err := utils.Encrypt(value)
+		if err != nil {
+			return err
+		}
+		value = encrypted
+	}
 	setting.Value = value
 
 	// Default metadata if missing (for new keys)
@@ -123,6 +131,13 @@ func (s *SettingsService) GetAll(ctx context.Context) ([]domain.Settings, error)
 	return settings, nil
 }
 
+// IsSecret checks if the setting is a credential that must not be returned by the API
+func (s *SettingsService) IsSecret(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cache[key].Secret()
+}
+
 // GetRepo returns the underlying settings repository
 func (s *SettingsService) GetRepo() ports.SettingsRepository {
 	return s.repo
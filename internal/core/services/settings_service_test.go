@@ -112,3 +112,18 @@ func TestSettingsService_Ordering(t *testing.T) {
 	assert.Equal(t, "c", all[1].Key)
 	assert.Equal(t, "a", all[2].Key)
 }
+
+func TestSettingsService_IsSecret(t *testing.T) {
+	repo := new(MockSettingsRepo)
+	svc := services.NewSettingsService(repo)
+	ctx := context.Background()
+
+	repo.On("GetAll", ctx).Return(domain.DefaultSettings(), nil).Once()
+	assert.NoError(t, svc.LoadCache(ctx))
+
+	for _, key := range []string{domain.SettingSMTPPassword, domain.SettingDataSourcePassword, domain.SettingAlertWebhookSecret} {
+		assert.True(t, svc.IsSecret(key), key)
+	}
+	assert.False(t, svc.IsSecret(domain.SettingSMTPHost))
+	assert.False(t, svc.IsSecret("unknown_key"))
+}
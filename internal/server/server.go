@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"path"
 	"strings"
 
 	"github.com/gofiber/fiber/v3"
@@ -9,14 +10,27 @@ import (
 	"github.com/gofiber/fiber/v3/middleware/recover"
 	"github.com/gofiber/fiber/v3/middleware/static"
 	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
 
 	"pdf_generator/internal/adapters/handlers"
 	"pdf_generator/internal/adapters/middleware"
 	"pdf_generator/internal/assets"
+	"pdf_generator/internal/core/domain"
 	"pdf_generator/internal/core/ports"
 	"pdf_generator/internal/core/services"
+	"pdf_generator/pkg/generator"
+	"pdf_generator/pkg/metrics"
+	"pdf_generator/pkg/progress"
+	"pdf_generator/pkg/utils"
 )
 
+// uploadBodyLimit allows remote workers to upload generated PDFs, other requests keep
+// the default body limit
+const uploadBodyLimit = 256 * 1024 * 1024
+
+// uploadPath matches the route remote workers upload generated PDFs to
+const uploadPath = "/api/worker/tasks/*/complete"
+
 // Server holds dependencies for the HTTP server
 type Server struct {
 	app             *fiber.App
@@ -25,9 +39,15 @@ type Server struct {
 	settingsService *services.SettingsService
 	gateService     *services.GateService
 	processService  *services.ProcessService
+	alertService    *services.AlertService
 	taskRepo        ports.TaskRepository
 	scheduleRepo    ports.ScheduleRepository
+	idempotencyRepo ports.IdempotencyRepository
+	workerRepo      ports.WorkerRepository
+	webhookRepo     ports.WebhookRepository
+	batchJobRepo    ports.BatchJobRepository
 	queue           ports.QueueService
+	progressHub     *progress.Hub
 }
 
 // NewServer creates a new HTTP server
@@ -37,18 +57,25 @@ func NewServer(
 	settingsService *services.SettingsService,
 	gateService *services.GateService,
 	processService *services.ProcessService,
+	alertService *services.AlertService,
 	taskRepo ports.TaskRepository,
 	scheduleRepo ports.ScheduleRepository,
+	idempotencyRepo ports.IdempotencyRepository,
+	workerRepo ports.WorkerRepository,
+	webhookRepo ports.WebhookRepository,
+	batchJobRepo ports.BatchJobRepository,
 	queue ports.QueueService,
 ) *Server {
 	app := fiber.New(fiber.Config{
 		AppName: "PDF Generator",
 	})
+	app.Server().HeaderReceived = uploadRequestConfig
 
 	// Global middleware
 	app.Use(recover.New())
 	app.Use(cors.New())
 	app.Use(middleware.LoggerMiddleware())
+	app.Use(middleware.MetricsMiddleware())
 
 	return &Server{
 		app:             app,
@@ -57,10 +84,29 @@ func NewServer(
 		settingsService: settingsService,
 		gateService:     gateService,
 		processService:  processService,
+		alertService:    alertService,
 		taskRepo:        taskRepo,
 		scheduleRepo:    scheduleRepo,
+		idempotencyRepo: idempotencyRepo,
+		workerRepo:      workerRepo,
+		webhookRepo:     webhookRepo,
+		batchJobRepo:    batchJobRepo,
 		queue:           queue,
+		progressHub:     progress.NewHub(),
+	}
+}
+
+// uploadRequestConfig raises the body limit of PDF uploads. The limit is applied when the
+// headers are read, before the body is, so only this route accepts large bodies.
+func uploadRequestConfig(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+	if string(header.Method()) != fiber.MethodPost {
+		return fasthttp.RequestConfig{}
+	}
+	requestPath, _, _ := strings.Cut(string(header.RequestURI()), "?")
+	if ok, _ := path.Match(uploadPath, requestPath); !ok {
+		return fasthttp.RequestConfig{}
 	}
+	return fasthttp.RequestConfig{MaxRequestBodySize: uploadBodyLimit}
 }
 
 // SetupRoutes configures all routes
@@ -68,11 +114,25 @@ func (s *Server) SetupRoutes() {
 	// Handlers
 	authHandler := handlers.NewAuthHandler(s.authService)
 	settingsHandler := handlers.NewSettingsHandler(s.settingsService)
-	apiKeyHandler := handlers.NewAPIKeyHandler(s.apiKeyService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(s.apiKeyService, s.taskRepo)
 	gateHandler := handlers.NewGateHandler(s.gateService)
-	taskHandler := handlers.NewTaskHandler(s.taskRepo, s.settingsService.GetRepo(), s.queue)
+	taskHandler := handlers.NewTaskHandler(s.taskRepo, s.settingsService.GetRepo(), s.queue, s.webhookRepo)
 	scheduleHandler := handlers.NewScheduleHandler(s.scheduleRepo)
-	sseHandler := handlers.NewSSEHandler(s.taskRepo, s.queue)
+	sseHandler := handlers.NewSSEHandler(s.taskRepo, s.workerRepo, s.queue, s.progressHub, s.alertService.GetRepo())
+	workerSecret := utils.WorkerSecret()
+	if workerSecret == "" {
+		log.Warn().Msg("WORKER_SECRET is not set, progress from the worker service is refused")
+	}
+	progressHandler := handlers.NewProgressHandler(s.progressHub, workerSecret)
+	workerHandler := handlers.NewWorkerHandler(s.workerRepo)
+	webhookHandler := handlers.NewWebhookHandler(s.webhookRepo, s.taskRepo, s.settingsService.GetRepo(), s.queue)
+	batchJobHandler := handlers.NewBatchJobHandler(s.batchJobRepo, s.taskRepo, s.queue)
+	alertHandler := handlers.NewAlertHandler(s.alertService.GetRepo())
+	remoteWorkerHandler := handlers.NewRemoteWorkerHandler(s.queue, s.taskRepo, s.workerRepo, s.settingsService.GetRepo(), s.gateService, s.progressHub, generator.DefaultOutputDir)
+
+	// Prometheus metrics, outside the API so scrapers need no session or API key
+	metricsHandler := handlers.NewMetricsHandler(metrics.Default, metrics.TokenFromEnv())
+	s.app.Get("/metrics", metricsHandler.Get)
 
 	// API group
 	api := s.app.Group("/api")
@@ -80,6 +140,9 @@ func (s *Server) SetupRoutes() {
 	// Public routes
 	api.Post("/auth/login", authHandler.Login)
 
+	// Internal routes (Worker, signed with the worker secret)
+	api.Post("/internal/progress", progressHandler.Publish)
+
 	// Protected routes (Admin + API Key)
 	protected := api.Group("", middleware.AuthMiddleware(s.authService, s.apiKeyService, s.settingsService))
 
@@ -87,11 +150,34 @@ func (s *Server) SetupRoutes() {
 	hmacProtected := protected.Group("", middleware.HMACMiddleware(s.settingsService))
 
 	// Queue/Tasks (Shared)
-	hmacProtected.Post("/queue", taskHandler.Enqueue)
+	hmacProtected.Post("/queue", middleware.IdempotencyMiddleware(s.idempotencyRepo, s.settingsService), taskHandler.Enqueue)
 	protected.Get("/tasks", taskHandler.List)
 	protected.Get("/tasks/:id", taskHandler.Get)
 	protected.Delete("/tasks/:id", taskHandler.Cancel)
 	protected.Get("/tasks/:id/download", taskHandler.Download)
+	protected.Get("/tasks/:id/events", taskHandler.Events)
+	hmacProtected.Post("/tasks/bulk", taskHandler.Bulk) // Delete is Admin only
+
+	// Batch jobs (Shared)
+	hmacProtected.Post("/jobs", middleware.IdempotencyMiddleware(s.idempotencyRepo, s.settingsService), batchJobHandler.Create)
+	protected.Get("/jobs", batchJobHandler.List)
+	protected.Get("/jobs/:id", batchJobHandler.Get)
+	protected.Get("/jobs/:id/outputs", batchJobHandler.Outputs)
+	protected.Post("/jobs/:id/cancel", batchJobHandler.Cancel)
+	protected.Post("/jobs/:id/retry", batchJobHandler.Retry)
+
+	// Webhooks (API keys manage their own)
+	hmacProtected.Post("/webhooks", webhookHandler.Create)
+	protected.Get("/webhooks", webhookHandler.List)
+	protected.Delete("/webhooks/:id", webhookHandler.Delete)
+
+	// Remote worker protocol (API Key)
+	remoteWorker := hmacProtected.Group("/worker", middleware.WorkerKeyOnly(s.settingsService))
+	remoteWorker.Post("/heartbeat", remoteWorkerHandler.Heartbeat)
+	remoteWorker.Post("/lease", remoteWorkerHandler.Lease)
+	remoteWorker.Post("/tasks/:id/progress", remoteWorkerHandler.Progress)
+	remoteWorker.Post("/tasks/:id/complete", remoteWorkerHandler.Complete)
+	remoteWorker.Post("/tasks/:id/fail", remoteWorkerHandler.Fail)
 
 	// Transaction Statuses (Public - for dropdown options)
 	protected.Get("/transaction-statuses", func(c fiber.Ctx) error {
@@ -130,14 +216,37 @@ func (s *Server) SetupRoutes() {
 	// Settings (Admin)
 	admin.Get("/settings", settingsHandler.GetAll)
 	hmacAdmin.Put("/settings", settingsHandler.Update)
+	hmacAdmin.Post("/settings/email/test", settingsHandler.TestEmail)
+	hmacAdmin.Post("/settings/datasource/test", settingsHandler.TestDataSource)
 
 	// API Keys (Admin)
 	admin.Get("/api-keys", apiKeyHandler.List)
 	hmacAdmin.Post("/api-keys", apiKeyHandler.Create)
 	admin.Get("/api-keys/:id/show", apiKeyHandler.Show)
 	admin.Put("/api-keys/:id/toggle", apiKeyHandler.Toggle)
+	hmacAdmin.Put("/api-keys/:id/limits", apiKeyHandler.UpdateLimits)
 	admin.Delete("/api-keys/:id", apiKeyHandler.Delete)
 
+	// Queue ordering & control (Admin)
+	hmacAdmin.Put("/queue/:id/priority", taskHandler.UpdatePriority)
+	hmacAdmin.Put("/queue/:id/position", taskHandler.Move)
+	admin.Post("/queue/pause", taskHandler.Pause)
+	admin.Post("/queue/resume", taskHandler.Resume)
+
+	// Task SLA timings (Admin)
+	admin.Get("/stats/sla", taskHandler.SLA)
+
+	// Workers (Admin)
+	admin.Get("/workers", workerHandler.List)
+
+	// Alerts (Admin)
+	admin.Get("/alerts", alertHandler.List)
+
+	// Webhook delivery log (Admin)
+	admin.Get("/webhooks/deliveries", webhookHandler.ListDeliveries)
+	admin.Get("/webhooks/deliveries/:id", webhookHandler.GetDelivery)
+	admin.Post("/webhooks/deliveries/:id/replay", webhookHandler.Replay)
+
 	// SSE Global (Admin)
 	admin.Get("/sse/events", sseHandler.GlobalEvents)
 
@@ -222,13 +331,19 @@ func (s *Server) Start(addr string) error {
 
 	// Start service monitoring
 	if s.processService != nil {
-		// Auto-start worker service
-		if err := s.processService.EnsureRunning(context.Background()); err != nil {
+		// In remote mode jobs run on worker nodes, the local worker service is not needed
+		if mode, _ := s.settingsService.Get(context.Background(), domain.SettingWorkerMode); domain.WorkerMode(mode) == domain.WorkerModeRemote {
+			log.Info().Msg("Worker mode is remote, local worker service is not started")
+		} else if err := s.processService.EnsureRunning(context.Background()); err != nil {
+			// Auto-start worker service
 			log.Error().Err(err).Msg("Failed to auto-start worker service")
 		}
 		s.processService.StartMonitoring(context.Background())
 	}
 
+	// Start alert rule evaluation
+	s.alertService.Start(context.Background())
+
 	return s.app.Listen(addr, fiber.ListenConfig{
 		DisableStartupMessage: true,
 	})
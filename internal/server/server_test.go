@@ -1,11 +1,14 @@
 package server
 
 import (
+	"bytes"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
 )
 
 // Mock services/repos would be ideal, but for route verification we can pass nil where safe
@@ -47,3 +50,21 @@ func TestRoutes(t *testing.T) {
 	// We can read body... but app.Test returns *http.Response.
 	// We need to read the body.
 }
+
+func TestUploadRequestConfig(t *testing.T) {
+	app := fiber.New()
+	app.Server().HeaderReceived = uploadRequestConfig
+	ok := func(c fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Post("/api/worker/tasks/:id/complete", ok)
+	app.Post("/api/queue", ok)
+
+	// Bodies above the default limit are only accepted for PDF uploads
+	body := bytes.Repeat([]byte{'a'}, fiber.DefaultBodyLimit+1)
+	for _, path := range []string{"/api/worker/tasks/task-1/complete", "/api/worker/tasks/task-1/complete?a=b"} {
+		resp, err := app.Test(httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		require.NoError(t, err, path)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode, path)
+	}
+	_, err := app.Test(httptest.NewRequest("POST", "/api/queue", bytes.NewReader(body)))
+	assert.ErrorIs(t, err, fasthttp.ErrBodyTooLarge)
+}
@@ -22,6 +22,9 @@ const (
 	CodeHMACMismatch          = 2006
 	CodeNotFound              = 3001
 	CodeTaskNotReady          = 3002
+	CodeLeaseLost             = 3003
+	CodeRateLimited           = 4001
+	CodeRequestInProgress     = 4002
 	CodeInternalError         = 5001
 )
 
@@ -41,6 +44,10 @@ func Error(c fiber.Ctx, code int, message string) error {
 		status = fiber.StatusUnauthorized
 	} else if code >= 3000 && code < 4000 {
 		status = fiber.StatusNotFound
+	} else if code == CodeRequestInProgress {
+		status = fiber.StatusConflict
+	} else if code >= 4000 && code < 5000 {
+		status = fiber.StatusTooManyRequests
 	} else if code >= 5000 {
 		status = fiber.StatusInternalServerError
 	} else if code >= 1000 && code < 2000 {
@@ -12,6 +12,7 @@ import (
 	"gorm.io/gorm/logger"
 
 	"pdf_generator/internal/core/domain"
+	"pdf_generator/pkg/metrics"
 )
 
 var DB *gorm.DB
@@ -103,14 +104,12 @@ func startBackgroundWALSync(dbPath string) {
 			shouldCheckpoint = true
 		}
 
-		// Size check
-		if !shouldCheckpoint {
-			info, err := os.Stat(walPath)
-			if err == nil {
-				sizeMB := float64(info.Size()) / 1024 / 1024
-				if sizeMB >= maxSizeMB {
-					shouldCheckpoint = true
-				}
+		// Size check, the size is also reported in metrics
+		if info, err := os.Stat(walPath); err == nil {
+			metrics.SQLiteWALBytes.Set(float64(info.Size()))
+			sizeMB := float64(info.Size()) / 1024 / 1024
+			if sizeMB >= maxSizeMB {
+				shouldCheckpoint = true
 			}
 		}
 
@@ -118,20 +117,34 @@ func startBackgroundWALSync(dbPath string) {
 			// log.Println("Running WAL checkpoint...")
 			DB.Exec("PRAGMA wal_checkpoint(TRUNCATE);")
 			lastCheckpoint = time.Now()
+			metrics.SQLiteWALCheckpoints.Inc()
 		}
 	}
 }
 
-func runMigrations() error {
-	return DB.AutoMigrate(
+// Models returns every persisted model, in migration order
+func Models() []any {
+	return []any{
 		&domain.Task{},
+		&domain.TaskEvent{},
+		&domain.Alert{},
 		&domain.Schedule{},
 		&domain.Settings{},
 		&domain.Session{},
 		&domain.APIKey{},
 		&domain.Log{},
 		&domain.Gate{},
-	)
+		&domain.IdempotencyRecord{},
+		&domain.QueueControl{},
+		&domain.Worker{},
+		&domain.Webhook{},
+		&domain.WebhookDelivery{},
+		&domain.BatchJob{},
+	}
+}
+
+func runMigrations() error {
+	return DB.AutoMigrate(Models()...)
 }
 
 func seedDefaults() error {
@@ -3,7 +3,11 @@ package datasource
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"strings"
 	"time"
 
 	_ "github.com/alexbrainman/odbc"
@@ -14,6 +18,37 @@ import (
 	"pdf_generator/pkg/utils"
 )
 
+var (
+	// ErrDataSourceMissing is returned when the MDB file does not exist
+	ErrDataSourceMissing = errors.New("data source file not found")
+	// ErrDriverUnavailable is returned when none of the MS Access drivers is installed
+	ErrDriverUnavailable = errors.New("no MS Access driver available")
+	// ErrFileLocked is returned when the MDB file is opened exclusively by another program
+	ErrFileLocked = errors.New("data source file is locked")
+	// ErrConnect is returned when no driver could open the data source for another reason
+	ErrConnect = errors.New("failed to connect to MS Access")
+	// ErrQuery is returned when the transaction query fails
+	ErrQuery = errors.New("query failed")
+)
+
+// Parts of driver errors, lower case, telling that the driver or provider is not installed
+var driverMissingMessages = []string{
+	"im002", // ODBC: data source name not found and no default driver specified
+	"provider cannot be found",
+	"class not registered",
+	"unknown driver",
+	"can't open lib",
+}
+
+// Parts of driver errors, lower case, telling that another program holds the file
+var fileLockedMessages = []string{
+	"already in use",
+	"could not lock file",
+	"used by another process",
+	"opened exclusively",
+	"prevents it from being opened or locked",
+}
+
 // Transaction represents a toll transaction
 type Transaction struct {
 	ID          int
@@ -36,68 +71,46 @@ type Transaction struct {
 	SecondImage []byte
 }
 
-// LoadTransactions loads transactions from MS Access database
-func LoadTransactions(ctx context.Context, dbPath string, filter domain.TaskFilter) ([]Transaction, error) {
-	// Try multiple drivers as fallback
-	var db *sql.DB
-	var err error
-	var lastErr error
-
-	// Define driver attempts
-	type driverAttempt struct {
-		driver string
-		dsn    string
+// connectError classifies the errors of all driver attempts. The file is locked when
+// any driver says so, the drivers are unavailable only when none of them is installed.
+func connectError(errs []error) error {
+	missing := 0
+	for _, err := range errs {
+		msg := strings.ToLower(err.Error())
+		if containsAny(msg, fileLockedMessages) {
+			return fmt.Errorf("%w: %w", ErrFileLocked, err)
+		}
+		if containsAny(msg, driverMissingMessages) {
+			missing++
+		}
 	}
 
-	attempts := []driverAttempt{
-		{
-			driver: "odbc",
-			dsn:    fmt.Sprintf("Driver={Microsoft Access Driver (*.mdb, *.accdb)};Dbq=%s;", dbPath),
-		},
-		{
-			driver: "adodb",
-			dsn:    fmt.Sprintf("Provider=Microsoft.ACE.OLEDB.12.0;Data Source=%s;", dbPath),
-		},
-		{
-			driver: "adodb",
-			dsn:    fmt.Sprintf("Provider=Microsoft.Jet.OLEDB.4.0;Data Source=%s;", dbPath),
-		},
+	lastErr := errs[len(errs)-1]
+	if missing == len(errs) {
+		return fmt.Errorf("%w: %w", ErrDriverUnavailable, lastErr)
 	}
+	return fmt.Errorf("%w after all attempts: %w", ErrConnect, lastErr)
+}
 
-	for _, attempt := range attempts {
-		log.Debug().Str("driver", attempt.driver).Str("dsn", attempt.dsn).Msg("Attempting to connect to MS Access")
-
-		db, err = sql.Open(attempt.driver, attempt.dsn)
-		if err != nil {
-			log.Warn().Err(err).Str("driver", attempt.driver).Msg("Failed to open database with driver, trying next fallback")
-			lastErr = err
-			continue
-		}
-
-		// Set connection timeout and limits
-		db.SetConnMaxLifetime(5 * time.Minute)
-		db.SetMaxOpenConns(1)
-
-		// Create a shorter timeout for pinging
-		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		err = db.PingContext(pingCtx)
-		cancel()
-
-		if err != nil {
-			db.Close()
-			log.Warn().Err(err).Str("driver", attempt.driver).Msg("Failed to ping database with driver, trying next fallback")
-			lastErr = err
-			continue
+func containsAny(s string, parts []string) bool {
+	for _, part := range parts {
+		if strings.Contains(s, part) {
+			return true
 		}
+	}
+	return false
+}
 
-		// Success!
-		log.Info().Str("driver", attempt.driver).Msg("Successfully connected to MS Access database")
-		lastErr = nil
-		break
+// LoadTransactions loads transactions from MS Access database and returns the name of the driver attempt that opened it
+func LoadTransactions(ctx context.Context, dbPath string, filter domain.TaskFilter, opts DriverOptions) ([]Transaction, string, error) {
+	if _, err := os.Stat(dbPath); errors.Is(err, fs.ErrNotExist) {
+		return nil, "", fmt.Errorf("%w: %s", ErrDataSourceMissing, dbPath)
 	}
 
-	if lastErr != nil {
-		return nil, fmt.Errorf("failed to connect to MS Access after all attempts: %w", lastErr)
+	// Try the configured drivers as fallback
+	db, attempt, err := Connect(ctx, dbPath, opts)
+	if err != nil {
+		return nil, "", err
 	}
 	defer db.Close()
 
@@ -112,9 +125,9 @@ func LoadTransactions(ctx context.Context, dbPath string, filter domain.TaskFilt
 
 	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		return nil, "", fmt.Errorf("%w: %w", ErrQuery, err)
 	} else if rows == nil {
-		return nil, fmt.Errorf("query returned no rows")
+		return nil, "", fmt.Errorf("%w: query returned no rows", ErrQuery)
 	}
 	defer rows.Close()
 
@@ -155,7 +168,7 @@ func LoadTransactions(ctx context.Context, dbPath string, filter domain.TaskFilt
 	}
 
 	log.Debug().Int("count", len(transactions)).Msg("Loaded transactions")
-	return transactions, nil
+	return transactions, attempt.Name, nil
 }
 
 // buildQuery constructs the SQL query for loading transactions
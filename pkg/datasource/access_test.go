@@ -1,10 +1,15 @@
 package datasource
 
 import (
+	"context"
+	"errors"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/core/domain"
 )
 
 func TestGetDataSourcePath(t *testing.T) {
@@ -33,3 +38,22 @@ func TestGetDataSourcePath(t *testing.T) {
 	actual3 := GetDataSourcePath(format3, rootFolder, txTime3, branchID, 0, stationID2)
 	assert.Equal(t, expected3, actual3)
 }
+
+func TestLoadTransactions_MissingFile(t *testing.T) {
+	_, _, err := LoadTransactions(context.Background(), filepath.Join(t.TempDir(), "01012024.mdb"), domain.TaskFilter{}, DriverOptions{})
+	assert.ErrorIs(t, err, ErrDataSourceMissing)
+}
+
+func TestConnectError(t *testing.T) {
+	notInstalled := errors.New("[Microsoft][ODBC Driver Manager] Data source name not found and no default driver specified (SQLSTATE IM002)")
+	providerMissing := errors.New("ADODB.Connection: Provider cannot be found. It may not be properly installed.")
+	locked := errors.New("[Microsoft][ODBC Microsoft Access Driver] Could not use '(unknown)'; file already in use.")
+	other := errors.New("Unrecognized database format")
+
+	assert.ErrorIs(t, connectError([]error{notInstalled, providerMissing, providerMissing}), ErrDriverUnavailable)
+	assert.ErrorIs(t, connectError([]error{locked, providerMissing}), ErrFileLocked)
+
+	err := connectError([]error{notInstalled, other})
+	assert.ErrorIs(t, err, ErrConnect)
+	assert.ErrorIs(t, err, other)
+}
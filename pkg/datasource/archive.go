@@ -0,0 +1,487 @@
+package datasource
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrArchive is returned when an archive can not be read or extracted
+	ErrArchive = errors.New("failed to extract data source from archive")
+	// ErrArchiveTooLarge is returned when the data source file in an archive does not fit the cache
+	ErrArchiveTooLarge = errors.New("data source in archive does not fit the cache")
+)
+
+// extractPrefix names the files being extracted, renamed once complete
+const extractPrefix = "extract-"
+
+// staleExtractAge is when an unfinished extraction is considered abandoned
+const staleExtractAge = time.Hour
+
+// ArchiveCache extracts data source files from zip and tar.gz archives into a directory.
+// The least recently used files are evicted to keep the directory within a size limit.
+type ArchiveCache struct {
+	dir string
+
+	mu       sync.Mutex
+	inUse    map[string]int           // Files being read, never evicted
+	inflight map[string]chan struct{} // Files being extracted
+	reserved int64                    // Bytes of the extractions in progress
+}
+
+// CachedFile is a data source file extracted from an archive. Release it once it was read.
+type CachedFile struct {
+	Path    string    // The extracted file
+	Archive string    // The archive it was extracted from
+	Entry   string    // Name of the file in the archive
+	Size    int64     // Uncompressed size
+	ModTime time.Time // Modification time of the entry
+
+	release func()
+}
+
+// Release allows the file to be evicted
+func (f *CachedFile) Release() {
+	if f.release != nil {
+		f.release()
+		f.release = nil
+	}
+}
+
+// NewArchiveCache creates a cache in dir
+func NewArchiveCache(dir string) *ArchiveCache {
+	return &ArchiveCache{
+		dir:      dir,
+		inUse:    make(map[string]int),
+		inflight: make(map[string]chan struct{}),
+	}
+}
+
+// Extract returns the file of the first archive containing the data source file relPath, the
+// path below the data source root. Archives that do not exist are skipped; when none contains
+// the file ErrDataSourceMissing is returned. The cache is kept within maxSize bytes.
+func (c *ArchiveCache) Extract(ctx context.Context, archives []string, relPath string, maxSize int64) (*CachedFile, error) {
+	for _, archive := range archives {
+		info, err := os.Stat(archive)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrArchive, err)
+		}
+
+		file, err := c.extract(ctx, archive, info, relPath, maxSize)
+		if errors.Is(err, ErrDataSourceMissing) {
+			continue
+		}
+		return file, err
+	}
+	return nil, fmt.Errorf("%w: %s in archives %s", ErrDataSourceMissing, relPath, strings.Join(archives, ", "))
+}
+
+// extract returns the cached file of an archive, extracting it on a miss
+func (c *ArchiveCache) extract(ctx context.Context, archive string, info fs.FileInfo, relPath string, maxSize int64) (*CachedFile, error) {
+	// A changed archive gets a new key, its old files age out of the cache
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%s", archive, info.Size(), info.ModTime().UnixNano(), relPath)))
+	key := hex.EncodeToString(sum[:8])
+
+	if err := c.acquire(ctx, key); err != nil {
+		return nil, err
+	}
+	file := &CachedFile{Archive: archive, release: func() { c.release(key) }}
+
+	if cachedPath, entryName, ok := c.lookup(key); ok {
+		if cached, err := os.Stat(cachedPath); err == nil {
+			if cached.Size() > maxSize {
+				err := fmt.Errorf("%w: %s is %d bytes, above the cache limit of %d", ErrArchiveTooLarge, entryName, cached.Size(), maxSize)
+				c.finish(key, err)
+				return nil, err
+			}
+			c.finish(key, nil)
+			now := time.Now()
+			os.Chtimes(cachedPath, now, now) // Recently used
+			file.Path, file.Entry, file.Size, file.ModTime = cachedPath, entryName, cached.Size(), cached.ModTime()
+			return file, nil
+		}
+	}
+
+	entry, cachedPath, err := c.extractEntry(ctx, archive, relPath, key, maxSize)
+	c.finish(key, err)
+	if err != nil {
+		return nil, err
+	}
+	file.Path, file.Entry, file.Size, file.ModTime = cachedPath, entry.name, entry.size, entry.modTime
+
+	log.Info().
+		Str("archive", archive).
+		Str("entry", entry.name).
+		Int64("size", entry.size).
+		Msg("Extracted data source from archive")
+	return file, nil
+}
+
+// Cached files are named by their key and the escaped entry name, which keeps the extension
+func cachedName(key, entry string) string {
+	return key + "_" + url.PathEscape(entry)
+}
+
+// cacheKey returns the key of a cached file name
+func cacheKey(name string) string {
+	key, _, _ := strings.Cut(name, "_")
+	return key
+}
+
+// lookup returns the cached file of a key and the name of its entry
+func (c *ArchiveCache) lookup(key string) (string, string, bool) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return "", "", false
+	}
+	for _, e := range entries {
+		if cacheKey(e.Name()) != key {
+			continue
+		}
+		_, escaped, _ := strings.Cut(e.Name(), "_")
+		entry, err := url.PathUnescape(escaped)
+		if err != nil {
+			entry = escaped
+		}
+		return filepath.Join(c.dir, e.Name()), entry, true
+	}
+	return "", "", false
+}
+
+// acquire marks the key in use, waiting while another goroutine extracts it
+func (c *ArchiveCache) acquire(ctx context.Context, key string) error {
+	c.mu.Lock()
+	for {
+		ch, ok := c.inflight[key]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		c.mu.Lock()
+	}
+	c.inflight[key] = make(chan struct{})
+	c.inUse[key]++
+	c.mu.Unlock()
+	return nil
+}
+
+// finish ends the extraction of a key, a failed one is no longer in use
+func (c *ArchiveCache) finish(key string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	close(c.inflight[key])
+	delete(c.inflight, key)
+	if err != nil {
+		c.releaseLocked(key)
+	}
+}
+
+func (c *ArchiveCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.releaseLocked(key)
+}
+
+func (c *ArchiveCache) releaseLocked(key string) {
+	if c.inUse[key]--; c.inUse[key] <= 0 {
+		delete(c.inUse, key)
+	}
+}
+
+// archiveEntry is a file in an archive
+type archiveEntry struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// extractEntry finds the data source file in the archive and extracts it into the cache
+func (c *ArchiveCache) extractEntry(ctx context.Context, archive, relPath, key string, maxSize int64) (archiveEntry, string, error) {
+	var (
+		entries []archiveEntry
+		open    func(name string) (io.ReadCloser, error)
+		closer  io.Closer
+	)
+	switch lower := strings.ToLower(archive); {
+	case strings.HasSuffix(lower, ".zip"):
+		reader, err := zip.OpenReader(archive)
+		if err != nil {
+			return archiveEntry{}, "", fmt.Errorf("%w: %w", ErrArchive, err)
+		}
+		closer = reader
+		files := make(map[string]*zip.File)
+		for _, f := range reader.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			files[f.Name] = f
+			entries = append(entries, archiveEntry{name: f.Name, size: int64(f.UncompressedSize64), modTime: f.Modified})
+		}
+		open = func(name string) (io.ReadCloser, error) { return files[name].Open() }
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		var err error
+		entries, err = tarEntries(archive)
+		if err != nil {
+			return archiveEntry{}, "", err
+		}
+		open = func(name string) (io.ReadCloser, error) { return openTarEntry(archive, name) }
+	default:
+		return archiveEntry{}, "", fmt.Errorf("%w: unsupported archive format %s", ErrArchive, filepath.Ext(archive))
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	entry, err := matchEntry(entries, relPath)
+	if err != nil {
+		return archiveEntry{}, "", fmt.Errorf("%w in %s", err, archive)
+	}
+	if entry.size > maxSize {
+		return archiveEntry{}, "", fmt.Errorf("%w: %s is %d bytes, above the cache limit of %d", ErrArchiveTooLarge, entry.name, entry.size, maxSize)
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return archiveEntry{}, "", err
+	}
+
+	// Space is reserved while extracting, so concurrent extractions evict for each other
+	c.reserve(entry.size, maxSize)
+	defer c.unreserve(entry.size)
+
+	src, err := open(entry.name)
+	if err != nil {
+		return archiveEntry{}, "", fmt.Errorf("%w: %w", ErrArchive, err)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(c.dir, extractPrefix+"*")
+	if err != nil {
+		return archiveEntry{}, "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	// Sizes in archive headers are not trusted
+	written, err := io.Copy(tmp, io.LimitReader(&contextReader{ctx: ctx, r: src}, maxSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return archiveEntry{}, "", ctx.Err()
+		}
+		return archiveEntry{}, "", fmt.Errorf("%w: %w", ErrArchive, err)
+	}
+	if written > maxSize {
+		return archiveEntry{}, "", fmt.Errorf("%w: %s is above the cache limit of %d bytes", ErrArchiveTooLarge, entry.name, maxSize)
+	}
+	dst := filepath.Join(c.dir, cachedName(key, entry.name))
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return archiveEntry{}, "", err
+	}
+
+	// The size in the header may have been lower than the file written
+	if written > entry.size {
+		c.mu.Lock()
+		c.evictLocked(maxSize - (c.reserved - entry.size))
+		c.mu.Unlock()
+	}
+	entry.size = written
+	return entry, dst, nil
+}
+
+// reserve evicts files until size more bytes fit within maxSize and reserves them
+func (c *ArchiveCache) reserve(size, maxSize int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictLocked(maxSize - c.reserved - size)
+	c.reserved += size
+}
+
+func (c *ArchiveCache) unreserve(size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reserved -= size
+}
+
+// evictLocked removes the least recently used files not in use until the cache holds at most limit bytes
+func (c *ArchiveCache) evictLocked(limit int64) {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	type cachedFile struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cachedFile
+	var total int64
+	for _, e := range dirEntries {
+		info, err := e.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(e.Name(), extractPrefix) {
+			if time.Since(info.ModTime()) > staleExtractAge {
+				os.Remove(filepath.Join(c.dir, e.Name()))
+			}
+			continue
+		}
+		files = append(files, cachedFile{name: e.Name(), size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	for _, f := range files {
+		if total <= limit {
+			return
+		}
+		if _, ok := c.inUse[cacheKey(f.name)]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, f.name)); err != nil {
+			log.Warn().Err(err).Str("file", f.name).Msg("Failed to evict cached data source")
+			continue
+		}
+		log.Info().Str("file", f.name).Int64("size", f.size).Msg("Evicted cached data source")
+		total -= f.size
+	}
+}
+
+// matchEntry picks the entry whose path ends with relPath, or that is the end of relPath for archives
+// holding a single directory or date. Entries matching more elements are preferred; several entries
+// matching as many elements fail with ErrAmbiguousDataSource. Elements are compared case-insensitively
+// and may contain glob wildcards.
+func matchEntry(entries []archiveEntry, relPath string) (archiveEntry, error) {
+	want := strings.Split(strings.ToLower(path.Clean(filepath.ToSlash(relPath))), "/")
+
+	var best []archiveEntry
+	bestScore := 0
+	for _, entry := range entries {
+		parts := strings.Split(strings.ToLower(path.Clean(entry.name)), "/")
+		score := 0
+		for score < len(want) && score < len(parts) && matchElement(want[len(want)-1-score], parts[len(parts)-1-score]) {
+			score++
+		}
+		if score < min(len(want), len(parts)) {
+			// Another station or date with the same file name
+			continue
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore = []archiveEntry{entry}, score
+		case score == bestScore:
+			best = append(best, entry)
+		}
+	}
+
+	switch len(best) {
+	case 0:
+		return archiveEntry{}, fmt.Errorf("%w: %s", ErrDataSourceMissing, relPath)
+	case 1:
+		return best[0], nil
+	}
+	names := make([]string, len(best))
+	for i, entry := range best {
+		names[i] = entry.name
+	}
+	sort.Strings(names)
+	return archiveEntry{}, fmt.Errorf("%w: %d files matched %s: %s", ErrAmbiguousDataSource, len(best), relPath, strings.Join(names, ", "))
+}
+
+// matchElement compares a lower case path element with a pattern element
+func matchElement(pattern, elem string) bool {
+	if strings.ContainsAny(pattern, "*?[") {
+		ok, err := path.Match(pattern, elem)
+		return err == nil && ok
+	}
+	return pattern == elem
+}
+
+// tarEntries lists the files of a tar.gz archive
+func tarEntries(archive string) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	err := walkTar(archive, func(header *tar.Header, r io.Reader) (bool, error) {
+		if header.Typeflag == tar.TypeReg {
+			entries = append(entries, archiveEntry{name: header.Name, size: header.Size, modTime: header.ModTime})
+		}
+		return false, nil
+	})
+	return entries, err
+}
+
+// openTarEntry returns a reader of a file of a tar.gz archive
+func openTarEntry(archive, name string) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		found := false
+		err := walkTar(archive, func(header *tar.Header, r io.Reader) (bool, error) {
+			if header.Name != name {
+				return false, nil
+			}
+			found = true
+			_, err := io.Copy(pw, r)
+			return true, err
+		})
+		if err == nil && !found {
+			err = fmt.Errorf("%s not found", name)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// walkTar calls fn for each entry of a tar.gz archive until it returns true or an error
+func walkTar(archive string, fn func(header *tar.Header, r io.Reader) (bool, error)) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrArchive, err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrArchive, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrArchive, err)
+		}
+		done, err := fn(header, tr)
+		if done || err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package datasource
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeZip creates a zip archive of the given files
+func writeZip(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		entry, err := w.Create(name)
+		assert.NoError(t, err)
+		entry.Write([]byte(content))
+	}
+	assert.NoError(t, w.Close())
+}
+
+// writeTarGz creates a tar.gz archive of the given files
+func writeTarGz(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	w := tar.NewWriter(gz)
+	for name, content := range files {
+		assert.NoError(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg, ModTime: time.Now()}))
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, gz.Close())
+}
+
+func TestMatchEntry(t *testing.T) {
+	entries := []archiveEntry{{name: "02-2024/02/05022024.mdb"}, {name: "02-2024/01/05022024.MDB"}, {name: "readme.txt"}}
+
+	entry, err := matchEntry(entries, "02-2024/01/05022024.mdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "02-2024/01/05022024.MDB", entry.name)
+
+	// The same file name of another station is not used
+	_, err = matchEntry(entries, "02-2024/07/05022024.mdb")
+	assert.ErrorIs(t, err, ErrDataSourceMissing)
+	_, err = matchEntry(entries, "0224/01/05022024.mdb")
+	assert.ErrorIs(t, err, ErrDataSourceMissing)
+
+	_, err = matchEntry(entries, "02-2024/01/06022024.mdb")
+	assert.ErrorIs(t, err, ErrDataSourceMissing)
+
+	entry, err = matchEntry(entries, "02-*/01/05022024.*")
+	assert.NoError(t, err)
+	assert.Equal(t, "02-2024/01/05022024.MDB", entry.name)
+
+	// Entries below the path, or the end of the path in archives of one station or date
+	entry, err = matchEntry([]archiveEntry{{name: "backup/0224/01/05022024.mdb"}, {name: "0224/02/05022024.mdb"}}, "0224/01/05022024.mdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "backup/0224/01/05022024.mdb", entry.name)
+	entry, err = matchEntry([]archiveEntry{{name: "05022024.mdb"}}, "0224/01/05022024.mdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "05022024.mdb", entry.name)
+
+	// Several entries matching as much are ambiguous
+	_, err = matchEntry([]archiveEntry{{name: "a/0224/01/05022024.mdb"}, {name: "b/0224/01/05022024.mdb"}}, "0224/01/05022024.mdb")
+	assert.ErrorIs(t, err, ErrAmbiguousDataSource)
+	_, err = matchEntry(entries, "02-2024/*/05022024.mdb")
+	assert.ErrorIs(t, err, ErrAmbiguousDataSource)
+}
+
+func TestArchiveCache_Extract(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	monthly := filepath.Join(dir, "0224.zip")
+	daily := filepath.Join(dir, "06022024.tar.gz")
+	writeZip(t, monthly, map[string]string{"0224/01/05022024.mdb": "fifth", "0224/01/04022024.mdb": "fourth"})
+	writeTarGz(t, daily, map[string]string{"06022024.mdb": "sixth"})
+	archives := []string{filepath.Join(dir, "missing.zip"), monthly, daily}
+	cache := NewArchiveCache(filepath.Join(dir, "cache"))
+
+	file, err := cache.Extract(ctx, archives, "0224/01/05022024.mdb", 1024)
+	assert.NoError(t, err)
+	content, _ := os.ReadFile(file.Path)
+	assert.Equal(t, "fifth", string(content))
+	assert.Equal(t, monthly, file.Archive)
+	assert.Equal(t, "0224/01/05022024.mdb", file.Entry)
+	assert.Equal(t, int64(5), file.Size)
+	file.Release()
+
+	// Served from the cache while the archive is unchanged
+	assert.NoError(t, os.WriteFile(file.Path, []byte("cached"), 0644))
+	cached, err := cache.Extract(ctx, archives, "0224/01/05022024.mdb", 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, file.Path, cached.Path)
+	content, _ = os.ReadFile(cached.Path)
+	assert.Equal(t, "cached", string(content))
+	cached.Release()
+
+	// Wildcards match entries, cached under the entry name
+	for i := 0; i < 2; i++ {
+		file, err = cache.Extract(ctx, archives, "0224/*/04022024.MDB", 1024)
+		assert.NoError(t, err)
+		assert.Equal(t, "0224/01/04022024.mdb", file.Entry)
+		assert.Equal(t, ".mdb", filepath.Ext(file.Path))
+		file.Release()
+	}
+
+	file, err = cache.Extract(ctx, archives, "0224/01/06022024.mdb", 1024)
+	assert.NoError(t, err)
+	content, _ = os.ReadFile(file.Path)
+	assert.Equal(t, "sixth", string(content))
+	assert.Equal(t, daily, file.Archive)
+	file.Release()
+
+	_, err = cache.Extract(ctx, archives, "0224/01/07022024.mdb", 1024)
+	assert.ErrorIs(t, err, ErrDataSourceMissing)
+
+	// Files above the limit are refused
+	_, err = cache.Extract(ctx, archives, "0224/01/05022024.mdb", 3)
+	assert.ErrorIs(t, err, ErrArchiveTooLarge)
+
+	_, err = cache.Extract(ctx, []string{filepath.Join(dir, "0224.7z")}, "0224/01/05022024.mdb", 1024)
+	assert.ErrorIs(t, err, ErrDataSourceMissing)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "0224.7z"), []byte("7z"), 0644))
+	_, err = cache.Extract(ctx, []string{filepath.Join(dir, "0224.7z")}, "0224/01/05022024.mdb", 1024)
+	assert.ErrorIs(t, err, ErrArchive)
+}
+
+func TestArchiveCache_Evict(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "0224.zip")
+	writeZip(t, archive, map[string]string{"01.mdb": "1111", "02.mdb": "2222", "03.mdb": "3333"})
+	cacheDir := filepath.Join(dir, "cache")
+	cache := NewArchiveCache(cacheDir)
+
+	first, err := cache.Extract(ctx, []string{archive}, "01.mdb", 8)
+	assert.NoError(t, err)
+	second, err := cache.Extract(ctx, []string{archive}, "02.mdb", 8)
+	assert.NoError(t, err)
+	second.Release()
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(first.Path, old, old))
+
+	// The oldest file is still in use, so the other one is evicted
+	third, err := cache.Extract(ctx, []string{archive}, "03.mdb", 8)
+	assert.NoError(t, err)
+	assert.FileExists(t, first.Path)
+	assert.NoFileExists(t, second.Path)
+	assert.FileExists(t, third.Path)
+
+	// Once released it is the least recently used
+	first.Release()
+	third.Release()
+	second, err = cache.Extract(ctx, []string{archive}, "02.mdb", 8)
+	assert.NoError(t, err)
+	defer second.Release()
+	assert.NoFileExists(t, first.Path)
+	assert.FileExists(t, third.Path)
+}
+
+func TestArchiveCache_Reserve(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewArchiveCache(dir)
+	cached := filepath.Join(dir, cachedName("0123456789abcdef", "01.mdb"))
+	assert.NoError(t, os.WriteFile(cached, []byte("1111"), 0644))
+
+	cache.reserve(4, 8)
+	assert.FileExists(t, cached)
+
+	// A second extraction in progress counts against the limit too
+	cache.reserve(4, 8)
+	assert.NoFileExists(t, cached)
+	assert.Equal(t, int64(8), cache.reserved)
+
+	cache.unreserve(4)
+	cache.unreserve(4)
+	assert.Zero(t, cache.reserved)
+}
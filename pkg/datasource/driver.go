@@ -0,0 +1,233 @@
+package datasource
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/pkg/metrics"
+)
+
+// DefaultDriverTimeout bounds the ping of a driver attempt without a timeout of its own
+const DefaultDriverTimeout = 5 * time.Second
+
+// Placeholders of a driver attempt's connection string
+const (
+	PathPlaceholder     = "{Path}"
+	PasswordPlaceholder = "{Password}"
+)
+
+// DriverAttempt is one way of opening an Access database. Attempts are tried in order until one connects.
+type DriverAttempt struct {
+	Name    string        // Reported in metrics and recorded in the task's sources
+	Driver  string        // The database/sql driver, odbc or adodb
+	DSN     string        // Connection string with {Path} and optionally {Password}
+	Timeout time.Duration // Of the ping, DefaultDriverTimeout when zero
+}
+
+// DefaultDriverAttempts are tried when no driver attempts are configured
+var DefaultDriverAttempts = []DriverAttempt{
+	{Name: "odbc", Driver: "odbc", DSN: "Driver={Microsoft Access Driver (*.mdb, *.accdb)};Dbq={Path};PWD={Password};", Timeout: DefaultDriverTimeout},
+	{Name: "adodb_ace", Driver: "adodb", DSN: "Provider=Microsoft.ACE.OLEDB.12.0;Data Source={Path};Jet OLEDB:Database Password={Password};", Timeout: DefaultDriverTimeout},
+	{Name: "adodb_ace16", Driver: "adodb", DSN: "Provider=Microsoft.ACE.OLEDB.16.0;Data Source={Path};Jet OLEDB:Database Password={Password};", Timeout: DefaultDriverTimeout},
+	{Name: "adodb_jet", Driver: "adodb", DSN: "Provider=Microsoft.Jet.OLEDB.4.0;Data Source={Path};Jet OLEDB:Database Password={Password};", Timeout: DefaultDriverTimeout},
+}
+
+// DriverOptions controls how Access databases are opened
+type DriverOptions struct {
+	Attempts []DriverAttempt // DefaultDriverAttempts when empty
+	Password string          // Database password, empty for databases without one
+}
+
+// ParseDriverAttempts parses driver attempts, one per line as name|driver|connection string|timeout seconds.
+// The timeout is optional. Empty lines and lines starting with # are skipped; without any attempt the
+// defaults are returned.
+func ParseDriverAttempts(value string) ([]DriverAttempt, error) {
+	var attempts []DriverAttempt
+	for i, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "|")
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("line %d: expected name|driver|connection string|timeout seconds", i+1)
+		}
+		attempt := DriverAttempt{
+			Name:    strings.TrimSpace(fields[0]),
+			Driver:  strings.TrimSpace(fields[1]),
+			DSN:     strings.TrimSpace(fields[2]),
+			Timeout: DefaultDriverTimeout,
+		}
+		if attempt.Name == "" {
+			return nil, fmt.Errorf("line %d: name is required", i+1)
+		}
+		if slices.ContainsFunc(attempts, func(a DriverAttempt) bool { return a.Name == attempt.Name }) {
+			return nil, fmt.Errorf("line %d: duplicate name %q", i+1, attempt.Name)
+		}
+		if !slices.Contains(sql.Drivers(), attempt.Driver) {
+			return nil, fmt.Errorf("line %d: unknown driver %q, registered: %s", i+1, attempt.Driver, strings.Join(sql.Drivers(), ", "))
+		}
+		if !strings.Contains(attempt.DSN, PathPlaceholder) {
+			return nil, fmt.Errorf("line %d: connection string must contain %s", i+1, PathPlaceholder)
+		}
+		if len(fields) == 4 {
+			seconds, err := strconv.Atoi(strings.TrimSpace(fields[3]))
+			if err != nil || seconds < 1 {
+				return nil, fmt.Errorf("line %d: timeout must be a positive number of seconds", i+1)
+			}
+			attempt.Timeout = time.Duration(seconds) * time.Second
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if len(attempts) == 0 {
+		return DefaultDriverAttempts, nil
+	}
+	return attempts, nil
+}
+
+// ConnectionString returns the connection string opening path. Without a password, the parts
+// of the connection string holding {Password} are left out.
+func (a DriverAttempt) ConnectionString(path, password string) string {
+	var parts []string
+	for _, part := range strings.Split(a.DSN, ";") {
+		if part == "" || (password == "" && strings.Contains(part, PasswordPlaceholder)) {
+			continue
+		}
+		part = strings.ReplaceAll(part, PathPlaceholder, quoteValue(a.Driver, path))
+		part = strings.ReplaceAll(part, PasswordPlaceholder, quoteValue(a.Driver, password))
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ";") + ";"
+}
+
+// quoteValue quotes a connection string value with characters ending or quoting values:
+// in braces for ODBC, in double quotes for OLE DB
+func quoteValue(driver, value string) string {
+	if !strings.ContainsAny(value, `;{}"'`) && strings.TrimSpace(value) == value {
+		return value
+	}
+	if driver == "odbc" {
+		return "{" + strings.ReplaceAll(value, "}", "}}") + "}"
+	}
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
+
+// open opens the database with one attempt and pings it within the attempt's timeout
+func (a DriverAttempt) open(ctx context.Context, path, password string) (*sql.DB, error) {
+	db, err := sql.Open(a.Driver, a.ConnectionString(path, password))
+	if err != nil {
+		return nil, err
+	}
+
+	// Set connection timeout and limits
+	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetMaxOpenConns(1)
+
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDriverTimeout
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Connect opens the database with the first driver attempt that connects and returns the attempt used
+func Connect(ctx context.Context, path string, opts DriverOptions) (*sql.DB, DriverAttempt, error) {
+	attempts := opts.Attempts
+	if len(attempts) == 0 {
+		attempts = DefaultDriverAttempts
+	}
+
+	var errs []error
+	for _, attempt := range attempts {
+		// The template is logged, it does not hold the password
+		log.Debug().Str("driver", attempt.Name).Str("dsn", attempt.DSN).Msg("Attempting to connect to MS Access")
+		start := time.Now()
+
+		db, err := attempt.open(ctx, path, opts.Password)
+		if err != nil {
+			log.Warn().Err(err).Str("driver", attempt.Name).Msg("Failed to connect with driver, trying next fallback")
+			metrics.DatasourceConnect.ObserveDuration(start, attempt.Name, "error")
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		metrics.DatasourceConnect.ObserveDuration(start, attempt.Name, "ok")
+		log.Info().Str("driver", attempt.Name).Msg("Successfully connected to MS Access database")
+		return db, attempt, nil
+	}
+	return nil, DriverAttempt{}, connectError(errs)
+}
+
+// DriverReport is the result of trying every driver attempt on a file
+type DriverReport struct {
+	Path       string         `json:"path"`
+	Registered []string       `json:"registered"` // database/sql drivers compiled into the worker
+	Attempts   []DriverResult `json:"attempts"`
+	Selected   string         `json:"selected"` // The attempt tasks would use, empty when none connects
+}
+
+// DriverResult is the outcome of one driver attempt
+type DriverResult struct {
+	Name       string `json:"name"`
+	Driver     string `json:"driver"`
+	DSN        string `json:"dsn"` // The template, without the password
+	Registered bool   `json:"registered"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Diagnose tries every driver attempt on the file, unlike Connect which stops at the first that connects
+func Diagnose(ctx context.Context, path string, opts DriverOptions) DriverReport {
+	attempts := opts.Attempts
+	if len(attempts) == 0 {
+		attempts = DefaultDriverAttempts
+	}
+
+	report := DriverReport{Path: path, Registered: sql.Drivers(), Attempts: make([]DriverResult, 0, len(attempts))}
+	for _, attempt := range attempts {
+		result := DriverResult{
+			Name:       attempt.Name,
+			Driver:     attempt.Driver,
+			DSN:        attempt.DSN,
+			Registered: slices.Contains(report.Registered, attempt.Driver),
+		}
+
+		start := time.Now()
+		db, err := attempt.open(ctx, path, opts.Password)
+		result.DurationMs = time.Since(start).Milliseconds()
+		if err != nil {
+			result.Error = connectError([]error{err}).Error()
+		} else {
+			db.Close()
+			result.OK = true
+			if report.Selected == "" {
+				report.Selected = attempt.Name
+			}
+		}
+		report.Attempts = append(report.Attempts, result)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return report
+}
@@ -0,0 +1,126 @@
+package datasource
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/core/domain"
+)
+
+// fakeAccess is a database/sql driver failing like a missing provider or a wrong password
+type fakeAccess struct{}
+
+func (fakeAccess) Open(dsn string) (driver.Conn, error) {
+	switch {
+	case strings.Contains(dsn, "Provider=Missing"):
+		return nil, errors.New("ADODB.Connection: Provider cannot be found. It may not be properly installed.")
+	case strings.Contains(dsn, "Password=secret;"):
+		return fakeConn{}, nil
+	}
+	return nil, errors.New("Not a valid password.")
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("fakeaccess", fakeAccess{})
+}
+
+func TestParseDriverAttempts(t *testing.T) {
+	// The default setting holds the default attempts
+	attempts, err := ParseDriverAttempts(domain.DefaultDataSourceDrivers)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDriverAttempts, attempts)
+
+	attempts, err = ParseDriverAttempts("  \n# Disabled\n")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDriverAttempts, attempts)
+
+	attempts, err = ParseDriverAttempts("ace16 | adodb | Provider=Microsoft.ACE.OLEDB.16.0;Data Source={Path}; | 20\nodbc|odbc|Driver={Microsoft Access Driver (*.mdb, *.accdb)};Dbq={Path};")
+	assert.NoError(t, err)
+	assert.Equal(t, []DriverAttempt{
+		{Name: "ace16", Driver: "adodb", DSN: "Provider=Microsoft.ACE.OLEDB.16.0;Data Source={Path};", Timeout: 20 * time.Second},
+		{Name: "odbc", Driver: "odbc", DSN: "Driver={Microsoft Access Driver (*.mdb, *.accdb)};Dbq={Path};", Timeout: DefaultDriverTimeout},
+	}, attempts)
+
+	for _, value := range []string{
+		"odbc|odbc",
+		"|odbc|Dbq={Path};",
+		"odbc|odbc|Dbq={Path};\nodbc|odbc|Dbq={Path};",
+		"oracle|oci8|Dbq={Path};",
+		"odbc|odbc|Dbq=D:/data.mdb;",
+		"odbc|odbc|Dbq={Path};|0",
+	} {
+		_, err := ParseDriverAttempts(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestDriverAttempt_ConnectionString(t *testing.T) {
+	ace := DriverAttempt{Driver: "adodb", DSN: "Provider=Microsoft.ACE.OLEDB.12.0;Data Source={Path};Jet OLEDB:Database Password={Password};"}
+	odbc := DriverAttempt{Driver: "odbc", DSN: "Driver={Microsoft Access Driver (*.mdb, *.accdb)};Dbq={Path};PWD={Password};"}
+
+	// Without a password its part is left out
+	assert.Equal(t, `Provider=Microsoft.ACE.OLEDB.12.0;Data Source=D:\data\05022024.mdb;`, ace.ConnectionString(`D:\data\05022024.mdb`, ""))
+	assert.Equal(t, `Provider=Microsoft.ACE.OLEDB.12.0;Data Source=D:\data\05022024.mdb;Jet OLEDB:Database Password=secret;`, ace.ConnectionString(`D:\data\05022024.mdb`, "secret"))
+
+	// Values ending or quoting a value are quoted
+	assert.Equal(t, `Provider=Microsoft.ACE.OLEDB.12.0;Data Source=D:\data\05022024.mdb;Jet OLEDB:Database Password="a;""b";`, ace.ConnectionString(`D:\data\05022024.mdb`, `a;"b`))
+	assert.Equal(t, `Driver={Microsoft Access Driver (*.mdb, *.accdb)};Dbq=D:\data\05022024.mdb;PWD={a;}}b};`, odbc.ConnectionString(`D:\data\05022024.mdb`, "a;}b"))
+}
+
+func TestConnect(t *testing.T) {
+	ctx := context.Background()
+	attempts := []DriverAttempt{
+		{Name: "missing", Driver: "fakeaccess", DSN: "Provider=Missing;Data Source={Path};"},
+		{Name: "ace", Driver: "fakeaccess", DSN: "Provider=Fake;Data Source={Path};Password={Password};"},
+	}
+
+	db, attempt, err := Connect(ctx, "05022024.mdb", DriverOptions{Attempts: attempts, Password: "secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ace", attempt.Name)
+	db.Close()
+
+	_, _, err = Connect(ctx, "05022024.mdb", DriverOptions{Attempts: attempts, Password: "wrong"})
+	assert.ErrorIs(t, err, ErrConnect)
+
+	_, _, err = Connect(ctx, "05022024.mdb", DriverOptions{Attempts: attempts[:1]})
+	assert.ErrorIs(t, err, ErrDriverUnavailable)
+}
+
+func TestDiagnose(t *testing.T) {
+	attempts := []DriverAttempt{
+		{Name: "missing", Driver: "fakeaccess", DSN: "Provider=Missing;Data Source={Path};"},
+		{Name: "ace", Driver: "fakeaccess", DSN: "Provider=Fake;Data Source={Path};Password={Password};"},
+		{Name: "jet", Driver: "fakeaccess", DSN: "Provider=Jet;Data Source={Path};Password={Password};"},
+	}
+
+	report := Diagnose(context.Background(), "05022024.mdb", DriverOptions{Attempts: attempts, Password: "secret"})
+	assert.Equal(t, "05022024.mdb", report.Path)
+	assert.Contains(t, report.Registered, "fakeaccess")
+	assert.Equal(t, "ace", report.Selected)
+
+	// Every attempt is tried, the password is not shown
+	assert.Len(t, report.Attempts, 3)
+	assert.False(t, report.Attempts[0].OK)
+	assert.Contains(t, report.Attempts[0].Error, ErrDriverUnavailable.Error())
+	assert.True(t, report.Attempts[1].Registered)
+	assert.True(t, report.Attempts[1].OK)
+	assert.True(t, report.Attempts[2].OK)
+	assert.Equal(t, attempts[1].DSN, report.Attempts[1].DSN)
+
+	report = Diagnose(context.Background(), "05022024.mdb", DriverOptions{Attempts: attempts})
+	assert.Empty(t, report.Selected)
+	assert.Contains(t, report.Attempts[1].Error, "Not a valid password")
+}
@@ -0,0 +1,129 @@
+package datasource
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pdf_generator/pkg/utils"
+)
+
+// ErrAmbiguousDataSource is returned when a path format with wildcards matches more than one file
+var ErrAmbiguousDataSource = errors.New("ambiguous data source")
+
+// Resolution is the data source file found for a report date
+type Resolution struct {
+	Path   string // The file, or the path of the first format when none matched
+	Format string // The path format the file matched
+}
+
+// PathFormats splits a ;-separated list of path formats, dropping empty ones
+func PathFormats(value string) []string {
+	var formats []string
+	for _, format := range strings.Split(value, ";") {
+		if format = strings.TrimSpace(format); format != "" {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// ResolveDataSource returns the file of the first path format matching one, trying the formats in
+// order. Below the root folder, path elements are matched case-insensitively and may contain glob
+// wildcards (*, ? and [...]). A format matching several files fails with ErrAmbiguousDataSource.
+// When no format matches, ErrDataSourceMissing is returned with the path of the first format.
+func ResolveDataSource(formats []string, rootFolder string, transactionTime time.Time, branchID int, gateID int, stationID int) (Resolution, error) {
+	params := utils.PathParams{Time: transactionTime, BranchID: branchID, GateID: gateID, StationID: stationID}
+	root := filepath.FromSlash(rootFolder)
+	if root == "" {
+		root = string(filepath.Separator)
+	}
+
+	var first string
+	for _, format := range formats {
+		candidate := filepath.FromSlash(GetDataSourcePath(format, rootFolder, transactionTime, branchID, gateID, stationID))
+		if first == "" {
+			first = candidate
+		}
+
+		matches := matchPath(root, utils.FormatPath(format, params))
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return Resolution{Path: matches[0], Format: format}, nil
+		default:
+			return Resolution{Path: candidate, Format: format}, fmt.Errorf("%w: %d files matched %s: %s",
+				ErrAmbiguousDataSource, len(matches), format, strings.Join(matches, ", "))
+		}
+	}
+	return Resolution{Path: first}, fmt.Errorf("%w: %s", ErrDataSourceMissing, first)
+}
+
+// matchPath returns the files below root matching the slash-separated pattern
+func matchPath(root, pattern string) []string {
+	elems := strings.FieldsFunc(pattern, func(r rune) bool { return r == '/' || r == '\\' })
+	if len(elems) == 0 {
+		return nil
+	}
+
+	matches := []string{root}
+	for i, elem := range elems {
+		last := i == len(elems)-1
+		var next []string
+		for _, dir := range matches {
+			next = append(next, matchElem(dir, elem, last)...)
+		}
+		if matches = next; len(matches) == 0 {
+			return nil
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// matchElem returns the entries of dir matching a path element: files for the last element, directories otherwise
+func matchElem(dir, elem string, last bool) []string {
+	wanted := func(info os.FileInfo) bool { return info.IsDir() != last }
+
+	wildcard := strings.ContainsAny(elem, "*?[")
+	if !wildcard {
+		// The exact name needs no directory listing
+		path := filepath.Join(dir, elem)
+		if info, err := os.Stat(path); err == nil {
+			if wanted(info) {
+				return []string{path}
+			}
+			return nil
+		}
+		if elem == "." || elem == ".." {
+			return nil
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	pattern := strings.ToLower(elem)
+	var matches []string
+	for _, entry := range entries {
+		name := strings.ToLower(entry.Name())
+		if wildcard {
+			if ok, err := filepath.Match(pattern, name); err != nil || !ok {
+				continue
+			}
+		} else if name != pattern {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err == nil && wanted(info) {
+			matches = append(matches, path)
+		}
+	}
+	return matches
+}
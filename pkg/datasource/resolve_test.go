@@ -0,0 +1,55 @@
+package datasource
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathFormats(t *testing.T) {
+	assert.Equal(t, []string{"{MM}{YY}/{DD}.mdb", "{MM}-{YYYY}/{DD}.accdb"}, PathFormats(" {MM}{YY}/{DD}.mdb ;; {MM}-{YYYY}/{DD}.accdb;"))
+	assert.Empty(t, PathFormats(""))
+}
+
+func TestResolveDataSource(t *testing.T) {
+	root := t.TempDir()
+	file := func(rel string) string {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("mdb"), 0644))
+		return path
+	}
+	legacy := file("0224/01/05022024.mdb")
+	accdb := file("02-2024/01/06022024.ACCDB")
+	file("02-2024/02/07022024.accdb")
+	file("02-2024/03/07022024.accdb")
+	date := time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)
+	formats := []string{"{MM}{YY}/{StationID}/{DD}{MM}{YYYY}.mdb", "{MM}-{YYYY}/{StationID}/{DD}{MM}{YYYY}.accdb"}
+
+	resolved, err := ResolveDataSource(formats, root, date, 0, 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, Resolution{Path: legacy, Format: formats[0]}, resolved)
+
+	// Falls back to the next format, names are matched case-insensitively
+	resolved, err = ResolveDataSource(formats, root, date.AddDate(0, 0, 1), 0, 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, Resolution{Path: accdb, Format: formats[1]}, resolved)
+
+	// Wildcards
+	wildcard := []string{"{MM}-*/*/{DD}{MM}{YYYY}.acc?b"}
+	resolved, err = ResolveDataSource(wildcard, root, date.AddDate(0, 0, 1), 0, 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, accdb, resolved.Path)
+
+	_, err = ResolveDataSource(wildcard, root, date.AddDate(0, 0, 2), 0, 0, 1)
+	assert.ErrorIs(t, err, ErrAmbiguousDataSource)
+	assert.Contains(t, err.Error(), "2 files matched")
+
+	resolved, err = ResolveDataSource(formats, root, date.AddDate(0, 0, 3), 0, 0, 1)
+	assert.ErrorIs(t, err, ErrDataSourceMissing)
+	assert.Equal(t, filepath.Join(root, "0224", "01", "08022024.mdb"), resolved.Path)
+	assert.Empty(t, resolved.Format)
+}
@@ -0,0 +1,222 @@
+package datasource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SnapshotDirPrefix names the temporary directories holding snapshots
+const SnapshotDirPrefix = "source-"
+
+// errChanged is returned when the file was modified while it was checked or copied
+var errChanged = errors.New("file changed while copying")
+
+// SnapshotOptions controls how a data source file is copied while the toll application may write to it
+type SnapshotOptions struct {
+	Attempts int           // Copies tried while the file is locked or changing
+	Backoff  time.Duration // Wait before the second attempt, doubled after each attempt
+	Settle   time.Duration // The file must keep its size and modification time this long before it is copied
+}
+
+// DefaultSnapshotOptions waits up to about a minute for a locked or changing file
+var DefaultSnapshotOptions = SnapshotOptions{Attempts: 5, Backoff: 2 * time.Second, Settle: time.Second}
+
+// FileVersion identifies the content of a data source file
+type FileVersion struct {
+	Size    int64
+	ModTime time.Time
+	SHA256  string
+}
+
+// Snapshot is a copy of a data source file, read instead of the live file
+type Snapshot struct {
+	Path    string      // The copy
+	Source  string      // The live file
+	Version FileVersion // Of the live file when it was copied
+	Locked  bool        // A lock file existed, the live file was open in another program
+
+	dir string
+}
+
+// Remove deletes the copy
+func (s *Snapshot) Remove() error {
+	return os.RemoveAll(s.dir)
+}
+
+// LockFile returns the lock file Access keeps next to an open database:
+// .laccdb for .accdb files, .ldb otherwise
+func LockFile(path string) string {
+	ext := filepath.Ext(path)
+	if strings.EqualFold(ext, ".accdb") {
+		return strings.TrimSuffix(path, ext) + ".laccdb"
+	}
+	return strings.TrimSuffix(path, ext) + ".ldb"
+}
+
+// TakeSnapshot copies the data source file into a new directory below dir. The file is copied
+// once its size and modification time stayed the same for the settle time and did not change
+// during the copy. Attempts that find the file locked or changing are retried with backoff.
+// The live file is only read, never opened through a driver, so no lock is placed next to it.
+func TakeSnapshot(ctx context.Context, path, dir string, opts SnapshotOptions) (*Snapshot, error) {
+	attempts := max(1, opts.Attempts)
+	backoff := opts.Backoff
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			if err := sleep(ctx, backoff); err != nil {
+				return nil, err
+			}
+			backoff *= 2
+		}
+
+		snapshot, err := copySnapshot(ctx, path, dir, opts.Settle)
+		if err == nil {
+			log.Info().
+				Str("path", path).
+				Int64("size", snapshot.Version.Size).
+				Bool("locked", snapshot.Locked).
+				Int("attempt", attempt).
+				Msg("Copied data source snapshot")
+			return snapshot, nil
+		}
+		if !errors.Is(err, ErrFileLocked) && !errors.Is(err, errChanged) {
+			return nil, err
+		}
+		lastErr = err
+		log.Warn().Err(err).Str("path", path).Int("attempt", attempt).Msg("Data source busy, retrying snapshot")
+	}
+	return nil, fmt.Errorf("%w: no stable copy after %d attempts: %w", ErrFileLocked, attempts, lastErr)
+}
+
+// copySnapshot makes one attempt at copying the file
+func copySnapshot(ctx context.Context, path, dir string, settle time.Duration) (*Snapshot, error) {
+	before, err := statSource(path)
+	if err != nil {
+		return nil, err
+	}
+	_, lockErr := os.Stat(LockFile(path))
+	locked := lockErr == nil
+
+	if err := sleep(ctx, settle); err != nil {
+		return nil, err
+	}
+	settled, err := statSource(path)
+	if err != nil {
+		return nil, err
+	}
+	if !sameVersion(before, settled) {
+		return nil, errChanged
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp(dir, SnapshotDirPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{Path: filepath.Join(tmpDir, filepath.Base(path)), Source: path, Locked: locked, dir: tmpDir}
+
+	checksum, err := copyFile(ctx, path, snapshot.Path)
+	if err == nil {
+		var after fs.FileInfo
+		after, err = statSource(path)
+		if err == nil && !sameVersion(settled, after) {
+			err = errChanged
+		}
+	}
+	if err != nil {
+		snapshot.Remove()
+		return nil, err
+	}
+
+	snapshot.Version = FileVersion{Size: settled.Size(), ModTime: settled.ModTime(), SHA256: checksum}
+	return snapshot, nil
+}
+
+// copyFile copies src to dst and returns the SHA-256 of the content
+func copyFile(ctx context.Context, src, dst string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", lockedError(err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), &contextReader{ctx: ctx, r: in}); err != nil {
+		return "", lockedError(err)
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// statSource returns the file info of the data source
+func statSource(path string) (fs.FileInfo, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrDataSourceMissing, path)
+	}
+	if err != nil {
+		return nil, lockedError(err)
+	}
+	return info, nil
+}
+
+// lockedError classifies the error of reading a file another program holds exclusively
+func lockedError(err error) error {
+	if containsAny(strings.ToLower(err.Error()), fileLockedMessages) {
+		return fmt.Errorf("%w: %w", ErrFileLocked, err)
+	}
+	return err
+}
+
+func sameVersion(a, b fs.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// contextReader stops a copy once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
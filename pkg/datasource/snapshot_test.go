@@ -0,0 +1,87 @@
+package datasource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockFile(t *testing.T) {
+	assert.Equal(t, filepath.Join("data", "05022024.ldb"), LockFile(filepath.Join("data", "05022024.mdb")))
+	assert.Equal(t, filepath.Join("data", "05022024.laccdb"), LockFile(filepath.Join("data", "05022024.ACCDB")))
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	source := filepath.Join(dir, "05022024.mdb")
+	content := []byte("transactions")
+	assert.NoError(t, os.WriteFile(source, content, 0644))
+	assert.NoError(t, os.WriteFile(LockFile(source), nil, 0644))
+	snapshotDir := filepath.Join(dir, "parts")
+	opts := SnapshotOptions{Attempts: 3, Backoff: 10 * time.Millisecond, Settle: 20 * time.Millisecond}
+
+	snapshot, err := TakeSnapshot(ctx, source, snapshotDir, opts)
+	assert.NoError(t, err)
+	copied, err := os.ReadFile(snapshot.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, content, copied)
+	assert.Equal(t, "05022024.mdb", filepath.Base(snapshot.Path))
+	assert.Equal(t, source, snapshot.Source)
+	assert.True(t, snapshot.Locked)
+	sum := sha256.Sum256(content)
+	assert.Equal(t, hex.EncodeToString(sum[:]), snapshot.Version.SHA256)
+	assert.Equal(t, int64(len(content)), snapshot.Version.Size)
+
+	assert.NoError(t, snapshot.Remove())
+	entries, _ := os.ReadDir(snapshotDir)
+	assert.Empty(t, entries)
+
+	// Missing files are not retried
+	_, err = TakeSnapshot(ctx, filepath.Join(dir, "missing.mdb"), snapshotDir, opts)
+	assert.ErrorIs(t, err, ErrDataSourceMissing)
+}
+
+func TestTakeSnapshot_Changing(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	source := filepath.Join(dir, "05022024.mdb")
+	assert.NoError(t, os.WriteFile(source, []byte("a"), 0644))
+	opts := SnapshotOptions{Attempts: 2, Backoff: 10 * time.Millisecond, Settle: 30 * time.Millisecond}
+
+	// The file keeps growing while the lane writes to it
+	var stop atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for size := 2; !stop.Load(); size++ {
+			os.WriteFile(source, make([]byte, size), 0644)
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	_, err := TakeSnapshot(ctx, source, dir, opts)
+	assert.ErrorIs(t, err, ErrFileLocked)
+	stop.Store(true)
+	<-done
+
+	// Copied once the writes stopped
+	snapshot, err := TakeSnapshot(ctx, source, dir, opts)
+	assert.NoError(t, err)
+	defer snapshot.Remove()
+	info, _ := os.Stat(source)
+	assert.Equal(t, info.Size(), snapshot.Version.Size)
+
+	// Waiting stops with the context
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = TakeSnapshot(cancelled, source, dir, opts)
+	assert.ErrorIs(t, err, context.Canceled)
+}
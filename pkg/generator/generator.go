@@ -2,11 +2,14 @@ package generator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"embed"
@@ -22,9 +25,10 @@ import (
 	"github.com/johnfercher/maroto/v2/pkg/consts/extension"
 	"github.com/johnfercher/maroto/v2/pkg/consts/fontstyle"
 	"github.com/johnfercher/maroto/v2/pkg/consts/pagesize"
-	"github.com/johnfercher/maroto/v2/pkg/core/entity"
+	"github.com/johnfercher/maroto/v2/pkg/core"
 	"github.com/johnfercher/maroto/v2/pkg/props"
-	"github.com/johnfercher/maroto/v2/pkg/repository"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
 	"github.com/rs/zerolog/log"
 
 	"pdf_generator/internal/core/domain"
@@ -36,14 +40,86 @@ import (
 // DefaultOutputDir is the default directory for PDF output files
 const DefaultOutputDir = "output"
 
+// PartsDir is the directory below the output directory holding the PDF parts of unfinished reports
+const PartsDir = "parts"
+
+// DefaultChunkSize is how many transactions are rendered into one PDF part
+const DefaultChunkSize = 500
+
+// DefaultDateParallelism is how many dates of a range are rendered at the same time
+const DefaultDateParallelism = 4
+
+// DefaultDataSourcePathFormat locates the data source file when no path format is configured
+const DefaultDataSourcePathFormat = "{MM}{YY}/{StationID}/{DD}{MM}{YYYY}.mdb"
+
+// ArchiveCacheDir is the directory below the output directory holding data source files extracted from archives
+const ArchiveCacheDir = "cache"
+
+// DefaultArchiveCacheMB is the size limit of the extracted data source files
+const DefaultArchiveCacheMB = 2048
+
+// The render time budget of a date: a base plus a share per transaction left to render.
+// Queue timeouts still apply, a date that runs out of time resumes on the next attempt.
+const (
+	renderTimeoutBase           = 2 * time.Minute
+	renderTimeoutPerTransaction = 100 * time.Millisecond
+)
+
+var (
+	// ErrInvalidInput is returned when the task metadata can not be processed, e.g. an invalid date
+	ErrInvalidInput = errors.New("invalid task input")
+	// ErrRender is returned when the PDF document could not be built
+	ErrRender = errors.New("failed to render PDF")
+	// ErrDiskFull is returned when there is no space left to write the PDF
+	ErrDiskFull = errors.New("not enough disk space")
+)
+
 //go:embed fonts/nunito-sans/*.ttf
 var nunitoSansFonts embed.FS
 
+// archiveCache is shared by all reports of the process, so it keeps track of the files in use
+var archiveCache = sync.OnceValue(func() *datasource.ArchiveCache {
+	dir, err := filepath.Abs(filepath.Join(DefaultOutputDir, ArchiveCacheDir))
+	if err != nil {
+		dir = filepath.Join(DefaultOutputDir, ArchiveCacheDir)
+	}
+	return datasource.NewArchiveCache(dir)
+})
+
 // ProgressCallback is called to report generation progress
 type ProgressCallback func(stage string, current, total int)
 
+// Checkpoint records the chunks rendered for a task, so that a retry resumes after them.
+// Without a checkpoint the parts are rendered in a temporary directory and nothing is resumed.
+type Checkpoint struct {
+	Key    string             // Names the parts directory, e.g. the task ID
+	Chunks []domain.TaskChunk // Chunks rendered by earlier attempts
+	Save   func(ctx context.Context, chunk domain.TaskChunk) error
+
+	// Optionally records the version of the data source file each date was read from
+	SaveSource func(ctx context.Context, source domain.TaskSource) error
+
+	mu sync.Mutex // Dates of a range are rendered in parallel
+}
+
+// save records a chunk, one at a time
+func (c *Checkpoint) save(ctx context.Context, chunk domain.TaskChunk) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Save(ctx, chunk)
+}
+
+// saveSource records a data source version, one at a time
+func (c *Checkpoint) saveSource(ctx context.Context, source domain.TaskSource) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.SaveSource(ctx, source)
+}
+
 // GeneratePDFWithProgress creates a PDF from the given metadata with progress reporting
-func GeneratePDFWithProgress(ctx context.Context, metadata domain.TaskMetadata, settingsRepo ports.SettingsRepository, gateRepo ports.GateRepository, onProgress ProgressCallback) (string, int64, error) {
+// The transactions are rendered in chunks into PDF parts, merged into the output at the end.
+// Settings and gate names are taken from the snapshot, defaults apply when it is nil.
+func GeneratePDFWithProgress(ctx context.Context, metadata domain.TaskMetadata, snapshot *Snapshot, onProgress ProgressCallback, checkpoint *Checkpoint) (string, int64, error) {
 	log.Info().Int("branch_id", metadata.BranchID).Int("gate_id", metadata.GateID).Int("station_id", metadata.StationID).Msg("Starting PDF generation")
 
 	// Report initial progress
@@ -52,34 +128,34 @@ func GeneratePDFWithProgress(ctx context.Context, metadata domain.TaskMetadata,
 	}
 
 	// Load settings
-	branchName := getSettingOrDefault(ctx, settingsRepo, domain.SettingBranchName, strconv.Itoa(metadata.BranchID))
+	branchName := snapshot.Setting(domain.SettingBranchName, strconv.Itoa(metadata.BranchID))
 	if name, ok := metadata.Settings["branch_name"].(string); ok && name != "" {
 		branchName = name
 	}
 
-	company := getSettingOrDefault(ctx, settingsRepo, domain.SettingManagementCompany, "PT JASA MARGA TBK")
+	company := snapshot.Setting(domain.SettingManagementCompany, "PT JASA MARGA TBK")
 	if c, ok := metadata.Settings["management_company"].(string); ok && c != "" {
 		company = c
 	}
 
-	pageSize := getSettingOrDefault(ctx, settingsRepo, domain.SettingPageSize, "A4")
+	pageSize := snapshot.Setting(domain.SettingPageSize, "A4")
 	if ps, ok := metadata.Settings["page_size"].(string); ok && ps != "" {
 		pageSize = ps
 	}
 
-	filenameFormat := getSettingOrDefault(ctx, settingsRepo, domain.SettingOutputFilenameFormat, "{branch_id}_{date}")
+	filenameFormat := snapshot.Setting(domain.SettingOutputFilenameFormat, "{branch_id}_{date}")
 	if ff, ok := metadata.Settings["output_filename_format"].(string); ok && ff != "" {
 		filenameFormat = ff
 	}
 
 	// Get day start time for daily transaction window
-	dayStartTime := getSettingOrDefault(ctx, settingsRepo, domain.SettingTimeOverlap, "00:00")
+	dayStartTime := snapshot.Setting(domain.SettingTimeOverlap, "00:00")
 	if dst, ok := metadata.Settings["day_start_time"].(string); ok && dst != "" {
 		dayStartTime = dst
 	}
 
 	// Get analyzer operator name for PDF header
-	analyzerOperatorName := getSettingOrDefault(ctx, settingsRepo, domain.SettingAnalyzerOperatorName, "Analyzer Operator")
+	analyzerOperatorName := snapshot.Setting(domain.SettingAnalyzerOperatorName, "Analyzer Operator")
 	if aon, ok := metadata.Settings["analyzer_operator_name"].(string); ok && aon != "" {
 		analyzerOperatorName = aon
 	}
@@ -97,24 +173,71 @@ func GeneratePDFWithProgress(ctx context.Context, metadata domain.TaskMetadata,
 	}
 
 	if err != nil {
-		log.Warn().Err(err).Msg("Failed to parse date for data source path, using current time")
-		targetDate = time.Now()
+		return "", 0, fmt.Errorf("%w: date: %w", ErrInvalidInput, err)
 	}
 
-	datasourceFormat := getSettingOrDefault(ctx, settingsRepo, domain.SettingDataSourcePathFormat, "{MM}{YY}/{StationID}/{DD}{MM}{YYYY}.mdb")
+	datasourceFormats := datasource.PathFormats(snapshot.Setting(domain.SettingDataSourcePathFormat, DefaultDataSourcePathFormat))
+	if len(datasourceFormats) == 0 {
+		datasourceFormats = []string{DefaultDataSourcePathFormat}
+	}
 
 	if onProgress != nil {
 		onProgress("Connecting to database", 0, 0)
 	}
 
-	dbPath := datasource.GetDataSourcePath(datasourceFormat, metadata.RootFolder, targetDate, metadata.BranchID, metadata.GateID, metadata.StationID)
-	dbPath = filepath.FromSlash(dbPath) // Ensure correct separators for Windows
+	// Find the file of the first matching path format
+	resolved, resolveErr := datasource.ResolveDataSource(datasourceFormats, metadata.RootFolder, targetDate, metadata.BranchID, metadata.GateID, metadata.StationID)
+	if errors.Is(resolveErr, datasource.ErrAmbiguousDataSource) {
+		log.Error().Err(resolveErr).Msg("Datasource path format matched several files")
+		return "", 0, resolveErr
+	}
+	dbPath := resolved.Path
 
 	// Check datasource from filepath while running the task
-	if _, err := os.Stat(dbPath); err != nil {
-		log.Info().Str("path", dbPath).Msg("Datasource file not found while running task")
+	source := domain.TaskSource{Date: targetDate.Format("2006-01-02"), Path: dbPath, Format: resolved.Format}
+	readPath := dbPath
+	archiveFormats := datasource.PathFormats(snapshot.Setting(domain.SettingDataSourceArchiveFmt, ""))
+	if resolveErr == nil {
+		log.Info().Str("path", dbPath).Str("format", resolved.Format).Msg("Datasource file found while running task")
+		if info, err := os.Stat(dbPath); err == nil {
+			source.Size, source.ModTime = info.Size(), info.ModTime()
+		}
+	} else if len(archiveFormats) > 0 {
+		log.Info().Str("path", dbPath).Msg("Datasource file not found, looking in archives")
+		if onProgress != nil {
+			onProgress("Extracting data source from archive", 0, 0)
+		}
+		archived, format, err := extractArchived(ctx, snapshot, archiveFormats, datasourceFormats, metadata, targetDate)
+		if err != nil {
+			log.Error().Err(err).Str("path", dbPath).Msg("Failed to extract data source from archive")
+			return "", 0, err
+		}
+		defer archived.Release()
+		readPath = archived.Path
+		source.Format, source.Archive, source.Entry = format, archived.Archive, archived.Entry
+		source.Size, source.ModTime = archived.Size, archived.ModTime
 	} else {
-		log.Info().Str("path", dbPath).Msg("Datasource file found while running task")
+		log.Info().Str("path", dbPath).Msg("Datasource file not found while running task")
+	}
+
+	// Optionally read a copy, the lane may still be writing the live file. Archived files are not written.
+	if readPath == dbPath && snapshot.Setting(domain.SettingDataSourceSnapshot, "false") == "true" {
+		if onProgress != nil {
+			onProgress("Copying data source", 0, 0)
+		}
+		snapshotDir, err := filepath.Abs(filepath.Join(DefaultOutputDir, PartsDir))
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to get absolute parts path: %w", err)
+		}
+		sourceCopy, err := datasource.TakeSnapshot(ctx, dbPath, snapshotDir, datasource.DefaultSnapshotOptions)
+		if err != nil {
+			log.Error().Err(err).Str("path", dbPath).Msg("Failed to copy data source")
+			return "", 0, err
+		}
+		defer sourceCopy.Remove()
+		readPath = sourceCopy.Path
+		source.Size, source.ModTime, source.SHA256 = sourceCopy.Version.Size, sourceCopy.Version.ModTime, sourceCopy.Version.SHA256
+		source.Snapshot = true
 	}
 
 	// Populate DayStartTime in filter for daily queries
@@ -123,64 +246,33 @@ func GeneratePDFWithProgress(ctx context.Context, metadata domain.TaskMetadata,
 		filter.DayStartTime = dayStartTime
 	}
 
-	transactions, err := datasource.LoadTransactions(ctx, dbPath, filter)
+	driverOpts, err := DriverOptions(snapshot)
+	if err != nil {
+		return "", 0, err
+	}
+	transactions, driver, err := datasource.LoadTransactions(ctx, readPath, filter, driverOpts)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to load transactions")
 		return "", 0, err
 	}
+	source.Driver = driver
 
-	totalTransactions := len(transactions)
-	log.Info().Int("count", totalTransactions).Msg("Loaded transactions")
-
-	// Build gate name lookup map
-	gateNameMap := make(map[int]string)
-	if gateRepo != nil {
-		gates, _, err := gateRepo.List(ctx, ports.GateFilter{})
-		if err == nil {
-			for _, g := range gates {
-				gateNameMap[g.ID] = g.Name
-			}
+	source.ReadAt = time.Now()
+	if checkpoint != nil && checkpoint.SaveSource != nil {
+		if err := checkpoint.saveSource(ctx, source); err != nil {
+			log.Warn().Err(err).Str("date", source.Date).Msg("Failed to record data source version")
 		}
 	}
 
-	// Helper function to get gate name by ID
-	getGateName := func(gateID int) string {
-		if name, ok := gateNameMap[gateID]; ok {
-			return name
-		}
-		return strconv.Itoa(gateID) // Fallback to ID if name not found
-	}
+	totalTransactions := len(transactions)
+	log.Info().Int("count", totalTransactions).Msg("Loaded transactions")
 
 	if onProgress != nil {
 		onProgress("Loading fonts", 0, totalTransactions)
 	}
 
-	// Load Fonts
-	fontName := "nunito-sans"
-	var fonts []*entity.CustomFont
-	var loadErr error
-
-	// Load fonts from embedded FS
-	regFont, _ := nunitoSansFonts.ReadFile("fonts/nunito-sans/nunito-sans.regular.ttf")
-	italicFont, _ := nunitoSansFonts.ReadFile("fonts/nunito-sans/nunito-sans.italic.ttf")
-	boldFont, _ := nunitoSansFonts.ReadFile("fonts/nunito-sans/nunito-sans.bold.ttf")
-	boldItalicFont, _ := nunitoSansFonts.ReadFile("fonts/nunito-sans/nunito-sans.bold-italic.ttf")
-
-	if len(regFont) == 0 || len(italicFont) == 0 || len(boldFont) == 0 || len(boldItalicFont) == 0 {
-		log.Error().Msg("Failed to read one or more embedded font files")
-	} else {
-		fonts, loadErr = repository.New().
-			AddUTF8FontFromBytes(fontName, fontstyle.Normal, regFont).
-			AddUTF8FontFromBytes(fontName, fontstyle.Italic, italicFont).
-			AddUTF8FontFromBytes(fontName, fontstyle.Bold, boldFont).
-			AddUTF8FontFromBytes(fontName, fontstyle.BoldItalic, boldItalicFont).
-			Load()
-
-		if loadErr != nil {
-			log.Error().Err(loadErr).Msg("Failed to load custom fonts from bytes, falling back to default")
-			fonts = nil // Ensure nil if error
-		}
-	}
+	// Fonts are parsed once per process
+	fonts := loadFonts()
 
 	if onProgress != nil {
 		onProgress("Building PDF header", 0, totalTransactions)
@@ -199,41 +291,44 @@ func GeneratePDFWithProgress(ctx context.Context, metadata domain.TaskMetadata,
 
 	if fonts != nil {
 		builder.WithCustomFonts(fonts).
-			WithDefaultFont(&props.Font{Family: fontName})
+			WithDefaultFont(&props.Font{Family: fontFamily})
 	}
 
 	cfg := builder.Build()
 
-	m := maroto.New(cfg)
-
 	// Header Logic adapted from deprecated
 	headerTextStyle := props.Text{Size: 11, Style: fontstyle.Bold, Align: align.Left, Top: 1}
 
 	// Use gate name from lookup for header
-	gateLabel := fmt.Sprintf("GERBANG : %s", getGateName(metadata.StationID))
-
-	dateStr := time.Now().Format("02/01/2006 15:04:05")
-
-	m.RegisterHeader(
-		row.New().Add(
-			col.New(16).Add(text.New(company, headerTextStyle)),
-			col.New(6).Add(text.New(dateStr,
-				props.Text{Size: 10, Style: fontstyle.Normal, Align: align.Left, Top: 1, Bottom: 2},
-			)),
-		),
-		row.New().Add(
-			col.New(16).Add(text.New(fmt.Sprintf("CABANG : %s", branchName), headerTextStyle)),
-			col.New(6).Add(text.New("Kabang Tol/Analis",
-				props.Text{Size: 10, Style: fontstyle.Normal, Align: align.Left, Top: 0, Bottom: 4},
-			)),
-		),
-		row.New().Add(
-			col.New(16).Add(text.New(gateLabel, headerTextStyle)),
-			col.New(6).Add(text.New(analyzerOperatorName,
-				props.Text{Size: 10, Style: fontstyle.Normal, Align: align.Left, Top: 2, Bottom: 3},
-			)),
-		),
-	)
+	gateLabel := fmt.Sprintf("GERBANG : %s", snapshot.GateName(metadata.StationID))
+
+	// Every part is a document of its own with the report header
+	newDocument := func(generatedAt time.Time) core.Maroto {
+		m := maroto.New(cfg)
+		dateStr := generatedAt.Format("02/01/2006 15:04:05")
+
+		m.RegisterHeader(
+			row.New().Add(
+				col.New(16).Add(text.New(company, headerTextStyle)),
+				col.New(6).Add(text.New(dateStr,
+					props.Text{Size: 10, Style: fontstyle.Normal, Align: align.Left, Top: 1, Bottom: 2},
+				)),
+			),
+			row.New().Add(
+				col.New(16).Add(text.New(fmt.Sprintf("CABANG : %s", branchName), headerTextStyle)),
+				col.New(6).Add(text.New("Kabang Tol/Analis",
+					props.Text{Size: 10, Style: fontstyle.Normal, Align: align.Left, Top: 0, Bottom: 4},
+				)),
+			),
+			row.New().Add(
+				col.New(16).Add(text.New(gateLabel, headerTextStyle)),
+				col.New(6).Add(text.New(analyzerOperatorName,
+					props.Text{Size: 10, Style: fontstyle.Normal, Align: align.Left, Top: 2, Bottom: 3},
+				)),
+			),
+		)
+		return m
+	}
 
 	// Body Logic (Transactions)
 	textSpace := 4.5
@@ -246,79 +341,6 @@ func GeneratePDFWithProgress(ctx context.Context, metadata domain.TaskMetadata,
 		BorderThickness: 0.42,
 	}
 
-	for i, t := range transactions {
-		// Report progress for each transaction
-		if onProgress != nil {
-			onProgress(fmt.Sprintf("Appending transaction %d of %d", i+1, totalTransactions), i+1, totalTransactions)
-		}
-
-		firstImage := col.New(8)
-		if len(t.FirstImage) > 0 {
-			firstImage.Add(image.NewFromBytes(t.FirstImage, extension.Jpg, imageStyle))
-		} else {
-			firstImage.Add(text.New("[No Capture]", props.Text{Size: 8, Style: fontstyle.Bold, Align: align.Center}))
-		}
-
-		secondImage := col.New(8)
-		if len(t.SecondImage) > 0 {
-			secondImage.Add(image.NewFromBytes(t.SecondImage, extension.Jpg, imageStyle))
-		} else {
-			// Align logic from deprecated: Top: 25 to push it down?
-			secondImage.Add(text.New("[No Capture]", props.Text{Size: 8, Style: fontstyle.Bold, Align: align.Center, Top: 25}))
-		}
-
-		lastSpace := 1.0
-
-		m.AddRows(
-			row.New().WithStyle(borderStyle).Add(
-				col.New(2).Add(
-					text.New("GARDU", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace, true)),
-					text.New("SHF/PRD", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
-					text.New("NIK PUL", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
-					text.New("NIK PAS", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
-					text.New("WAKTU", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
-					text.New("GOL/AVC", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
-					text.New("METODA", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
-					text.New("SERI", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
-					text.New("STATUS", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
-					text.New("ASAL", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
-					text.New("KARTU", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
-				),
-				col.New(4).Add(
-					text.New(fmt.Sprintf(": %s", t.GetStation()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace, true)),
-					text.New(fmt.Sprintf(": %s / %s", t.GetShift(), t.GetPeriod()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
-					text.New(fmt.Sprintf(": %s", t.GetCollectorID()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
-					text.New(fmt.Sprintf(": %s", t.GetPasID()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
-					text.New(fmt.Sprintf(": %s", t.GetDatetime()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
-					text.New(fmt.Sprintf(": %s / %s", t.GetClass(), t.GetAvc()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
-					text.New(fmt.Sprintf(": %s", t.GetMethod()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
-					text.New(fmt.Sprintf(": %s", t.GetSerial()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
-					text.New(fmt.Sprintf(": %s", t.GetStatus()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
-					text.New(fmt.Sprintf(": %s", func() string {
-						// Look up origin gate name by ID
-						originGateStr := t.GetOriginGate()
-						if originGateID, err := strconv.Atoi(originGateStr); err == nil {
-							return getGateName(originGateID)
-						}
-						return originGateStr // Return original if not a valid number
-					}()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
-					text.New(fmt.Sprintf(": %s", t.GetCardNumber()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
-				),
-				firstImage,
-				secondImage,
-			),
-		)
-	}
-
-	// Report completion of transaction appending
-	if onProgress != nil {
-		onProgress("All transactions appended", totalTransactions, totalTransactions)
-	}
-
-	if onProgress != nil {
-		onProgress("Rendering PDF document", totalTransactions, totalTransactions)
-	}
-
 	// Generate output filename
 	filename := formatFilename(filenameFormat, metadata)
 
@@ -328,21 +350,167 @@ func GeneratePDFWithProgress(ctx context.Context, metadata domain.TaskMetadata,
 		return "", 0, fmt.Errorf("failed to get absolute output path: %w", err)
 	}
 
-	outputPath := filepath.Join(outputDir, filename+".pdf")
+	// Reports of different tasks may have the same name, each task writes to a directory of its own
+	taskDir, err := TaskOutputDir(metadata.TaskID)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create task output directory: %w", err)
+	}
+	outputPath := filepath.Join(taskDir, filename+".pdf")
+
+	chunkSize, err := strconv.Atoi(snapshot.Setting(domain.SettingPDFChunkSize, strconv.Itoa(DefaultChunkSize)))
+	if err != nil || chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
 
-	// Generate document
-	doc, err := m.Generate()
+	partDir, err := partDirectory(outputDir, checkpoint)
 	if err != nil {
-		return "", 0, err
+		return "", 0, fmt.Errorf("failed to create parts directory: %w", err)
+	}
+	if checkpoint == nil || checkpoint.Key == "" {
+		defer os.RemoveAll(partDir)
+	}
+
+	// Resume after the chunks earlier attempts rendered
+	date := targetDate.Format("2006-01-02")
+	generatedAt := time.Now()
+	next := 0
+	var parts []string
+	for _, chunk := range resumableChunks(checkpoint, date, totalTransactions) {
+		if len(parts) == 0 {
+			generatedAt = chunk.GeneratedAt
+		}
+		parts = append(parts, chunk.Path)
+		next = chunk.End
+	}
+	if len(parts) > 0 {
+		log.Info().Str("date", date).Int("transactions", next).Int("parts", len(parts)).Msg("Resuming PDF generation")
+		if onProgress != nil {
+			onProgress(fmt.Sprintf("Resuming after transaction %d of %d", next, totalTransactions), next, totalTransactions)
+		}
+	}
+
+	// The time budget grows with the transactions left to render
+	renderCtx, cancel := context.WithTimeout(ctx, renderTimeout(totalTransactions-next))
+	defer cancel()
+
+	// A day without transactions still gets a report with its header
+	for next < totalTransactions || len(parts) == 0 {
+		end := min(next+chunkSize, totalTransactions)
+		m := newDocument(generatedAt)
+
+		for i := next; i < end; i++ {
+			if err := renderCtx.Err(); err != nil {
+				return "", 0, err
+			}
+			t := transactions[i]
+
+			// Report progress for each transaction
+			if onProgress != nil {
+				onProgress(fmt.Sprintf("Appending transaction %d of %d", i+1, totalTransactions), i+1, totalTransactions)
+			}
+
+			firstImage := col.New(8)
+			if len(t.FirstImage) > 0 {
+				firstImage.Add(image.NewFromBytes(t.FirstImage, extension.Jpg, imageStyle))
+			} else {
+				firstImage.Add(text.New("[No Capture]", props.Text{Size: 8, Style: fontstyle.Bold, Align: align.Center}))
+			}
+
+			secondImage := col.New(8)
+			if len(t.SecondImage) > 0 {
+				secondImage.Add(image.NewFromBytes(t.SecondImage, extension.Jpg, imageStyle))
+			} else {
+				// Align logic from deprecated: Top: 25 to push it down?
+				secondImage.Add(text.New("[No Capture]", props.Text{Size: 8, Style: fontstyle.Bold, Align: align.Center, Top: 25}))
+			}
+
+			lastSpace := 1.0
+
+			m.AddRows(
+				row.New().WithStyle(borderStyle).Add(
+					col.New(2).Add(
+						text.New("GARDU", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace, true)),
+						text.New("SHF/PRD", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
+						text.New("NIK PUL", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
+						text.New("NIK PAS", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
+						text.New("WAKTU", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
+						text.New("GOL/AVC", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
+						text.New("METODA", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
+						text.New("SERI", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
+						text.New("STATUS", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
+						text.New("ASAL", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
+						text.New("KARTU", nextTextPropTop(bodyCheckTextStyle, textSpace, &lastSpace)),
+					),
+					col.New(4).Add(
+						text.New(fmt.Sprintf(": %s", t.GetStation()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace, true)),
+						text.New(fmt.Sprintf(": %s / %s", t.GetShift(), t.GetPeriod()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
+						text.New(fmt.Sprintf(": %s", t.GetCollectorID()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
+						text.New(fmt.Sprintf(": %s", t.GetPasID()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
+						text.New(fmt.Sprintf(": %s", t.GetDatetime()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
+						text.New(fmt.Sprintf(": %s / %s", t.GetClass(), t.GetAvc()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
+						text.New(fmt.Sprintf(": %s", t.GetMethod()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
+						text.New(fmt.Sprintf(": %s", t.GetSerial()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
+						text.New(fmt.Sprintf(": %s", t.GetStatus()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
+						text.New(fmt.Sprintf(": %s", func() string {
+							// Look up origin gate name by ID
+							originGateStr := t.GetOriginGate()
+							if originGateID, err := strconv.Atoi(originGateStr); err == nil {
+								return snapshot.GateName(originGateID)
+							}
+							return originGateStr // Return original if not a valid number
+						}()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
+						text.New(fmt.Sprintf(": %s", t.GetCardNumber()), nextTextPropTop(valueTextStyle, textSpace, &lastSpace)),
+					),
+					firstImage,
+					secondImage,
+				),
+			)
+		}
+
+		if onProgress != nil {
+			onProgress(fmt.Sprintf("Rendering transactions %d to %d of %d", next+1, end, totalTransactions), end, totalTransactions)
+		}
+
+		// Generate document
+		doc, err := m.Generate()
+		if err != nil {
+			return "", 0, fmt.Errorf("%w: %w", ErrRender, err)
+		}
+
+		partPath := filepath.Join(partDir, fmt.Sprintf("%s_%06d.pdf", date, next))
+		if err := doc.Save(partPath); err != nil {
+			if utils.IsDiskFull(err) {
+				return "", 0, fmt.Errorf("%w: %w", ErrDiskFull, err)
+			}
+			return "", 0, fmt.Errorf("failed to save PDF: %w", err)
+		}
+
+		chunk := domain.TaskChunk{Date: date, Start: next, End: end, Total: totalTransactions, Path: partPath, GeneratedAt: generatedAt}
+		if checkpoint != nil && checkpoint.Save != nil {
+			if err := checkpoint.save(ctx, chunk); err != nil {
+				log.Warn().Err(err).Str("path", partPath).Msg("Failed to record rendered chunk")
+			}
+		}
+		parts = append(parts, partPath)
+		next = end
+	}
+
+	// Report completion of transaction appending
+	if onProgress != nil {
+		onProgress("All transactions appended", totalTransactions, totalTransactions)
 	}
 
 	if onProgress != nil {
 		onProgress("Writing file to disk", totalTransactions, totalTransactions)
 	}
 
-	if err := doc.Save(outputPath); err != nil {
-		return "", 0, err
+	if err := mergeParts(parts, outputPath); err != nil {
+		if utils.IsDiskFull(err) {
+			return "", 0, fmt.Errorf("%w: %w", ErrDiskFull, err)
+		}
+		return "", 0, fmt.Errorf("failed to merge PDF parts: %w", err)
 	}
+	removeParts(parts)
 
 	// Get file size
 	info, err := os.Stat(outputPath)
@@ -354,114 +522,442 @@ func GeneratePDFWithProgress(ctx context.Context, metadata domain.TaskMetadata,
 		onProgress("Completed", totalTransactions, totalTransactions)
 	}
 
-	log.Info().Str("output", outputPath).Int64("size", info.Size()).Msg("PDF generated")
+	log.Info().Str("output", outputPath).Int64("size", info.Size()).Int("parts", len(parts)).Msg("PDF generated")
 	return outputPath, info.Size(), nil
 }
 
 // GeneratePDF creates a PDF from the given metadata (legacy wrapper without progress)
 func GeneratePDF(ctx context.Context, metadata domain.TaskMetadata, settingsRepo ports.SettingsRepository, gateRepo ports.GateRepository) (string, int64, error) {
-	return GeneratePDFWithProgress(ctx, metadata, settingsRepo, gateRepo, nil)
+	snapshot, err := LoadSnapshot(ctx, settingsRepo, gateRepo)
+	if err != nil {
+		return "", 0, err
+	}
+	return GeneratePDFWithProgress(ctx, metadata, snapshot, nil, nil)
 }
 
 // GenerateMultiDatePDF handles date range generation, producing one PDF per date
-// Returns comma-separated output paths and total size across all files
-func GenerateMultiDatePDF(ctx context.Context, metadata domain.TaskMetadata, settingsRepo ports.SettingsRepository, gateRepo ports.GateRepository, onProgress ProgressCallback) (string, int64, error) {
+// Returns comma-separated output paths and total size across all files. All dates are rendered with the same snapshot.
+func GenerateMultiDatePDF(ctx context.Context, metadata domain.TaskMetadata, snapshot *Snapshot, onProgress ProgressCallback, checkpoint *Checkpoint) (string, int64, error) {
+	defer removePartDirectory(checkpoint)
+
 	// Check if this is a date range request
 	if metadata.Filter.RangeStart == "" || metadata.Filter.RangeEnd == "" {
 		// Single date mode - use existing generator
-		return GeneratePDFWithProgress(ctx, metadata, settingsRepo, gateRepo, onProgress)
+		return GeneratePDFWithProgress(ctx, metadata, snapshot, onProgress, checkpoint)
 	}
 
 	// Parse date range
 	startDate, err := time.Parse("2006-01-02", metadata.Filter.RangeStart)
 	if err != nil {
-		return "", 0, fmt.Errorf("invalid range_start date: %w", err)
+		return "", 0, fmt.Errorf("%w: range_start: %w", ErrInvalidInput, err)
 	}
 	endDate, err := time.Parse("2006-01-02", metadata.Filter.RangeEnd)
 	if err != nil {
-		return "", 0, fmt.Errorf("invalid range_end date: %w", err)
+		return "", 0, fmt.Errorf("%w: range_end: %w", ErrInvalidInput, err)
 	}
 
 	// Calculate number of days
 	days := int(endDate.Sub(startDate).Hours()/24) + 1
 	if days <= 0 {
-		return "", 0, fmt.Errorf("invalid date range: end date must be after start date")
+		return "", 0, fmt.Errorf("%w: end date must be after start date", ErrInvalidInput)
 	}
 
+	parallelism := dateParallelism(snapshot, days)
 	log.Info().
 		Str("range_start", metadata.Filter.RangeStart).
 		Str("range_end", metadata.Filter.RangeEnd).
 		Int("days", days).
+		Int("parallelism", parallelism).
 		Msg("Starting multi-date PDF generation")
 
-	if onProgress != nil {
-		onProgress(fmt.Sprintf("Processing date range: %d days", days), 0, days)
+	progress := newRangeProgress(days, onProgress)
+	progress.report(fmt.Sprintf("Processing date range: %d days", days))
+
+	type dateResult struct {
+		output string
+		size   int64
+		err    error
+	}
+	results := make([]dateResult, days)
+
+	// Dates are rendered by a bounded number of goroutines, each reads its own data source
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallelism)
+	for i := 0; i < days; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			currentDate := startDate.AddDate(0, 0, i)
+			dateStr := currentDate.Format("2006-01-02")
+
+			// Create a copy of metadata with single date filter
+			singleDayMetadata := metadata
+			singleDayMetadata.Filter = domain.TaskFilter{
+				Date:              dateStr,
+				DayStartTime:      metadata.Filter.DayStartTime,
+				TransactionStatus: metadata.Filter.TransactionStatus,
+				Limit:             metadata.Filter.Limit,
+			}
+
+			// Generate PDF for this single date
+			output, size, err := GeneratePDFWithProgress(ctx, singleDayMetadata, snapshot, progress.date(i, dateStr), checkpoint)
+			progress.done(i)
+			results[i] = dateResult{output: output, size: size, err: err}
+			if err != nil {
+				log.Warn().Err(err).Str("date", dateStr).Msg("Failed to generate PDF for date, skipping")
+				return // Skip failed dates but continue with others
+			}
+
+			log.Info().
+				Str("date", dateStr).
+				Str("output", output).
+				Int64("size", size).
+				Msg("Generated PDF for date")
+		}(i)
 	}
+	wg.Wait()
 
 	var outputPaths []string
 	var totalSize int64
+	var errs []error
+	for _, result := range results {
+		if result.err != nil {
+			errs = append(errs, result.err)
+			continue
+		}
+		outputPaths = append(outputPaths, result.output)
+		totalSize += result.size
+	}
 
-	// Iterate through each date
-	for i := 0; i < days; i++ {
-		currentDate := startDate.AddDate(0, 0, i)
-		dateStr := currentDate.Format("2006-01-02")
+	if len(outputPaths) == 0 {
+		return "", 0, fmt.Errorf("no PDFs were generated for the date range: %w", rangeError(errs))
+	}
 
-		if onProgress != nil {
-			onProgress(fmt.Sprintf("Processing date %d of %d: %s", i+1, days, dateStr), i, days)
+	progress.report(fmt.Sprintf("Completed: %d PDFs generated", len(outputPaths)))
+
+	// Return comma-separated paths for multiple files
+	return strings.Join(outputPaths, ","), totalSize, nil
+}
+
+// rangeError picks the error reported for a range whose dates all failed. The range is only
+// failed for good when every date failed permanently, otherwise a retry may still succeed
+// and the error of a date that can be retried is returned.
+func rangeError(errs []error) error {
+	var last error
+	for _, err := range errs {
+		if !ErrorCode(err).Permanent() {
+			return err
 		}
+		last = err
+	}
+	return last
+}
+
+// dateParallelism returns how many dates of a range are rendered at the same time: the
+// pdf_date_parallelism setting, lowered so that all tasks running at once (queue_concurrency)
+// together use no more rendering goroutines than there are CPUs
+func dateParallelism(snapshot *Snapshot, days int) int {
+	limit, err := strconv.Atoi(snapshot.Setting(domain.SettingPDFDateParallelism, strconv.Itoa(DefaultDateParallelism)))
+	if err != nil || limit < 1 {
+		limit = DefaultDateParallelism
+	}
+	concurrency, err := strconv.Atoi(snapshot.Setting(domain.SettingQueueConcurrency, "1"))
+	if err != nil || concurrency < 1 {
+		concurrency = 1
+	}
+	return max(1, min(limit, runtime.GOMAXPROCS(0)/concurrency, days))
+}
+
+// rangeProgress merges the progress of the dates of a range into one: the transactions
+// rendered and loaded so far across all dates, with the stage of the date reporting last
+type rangeProgress struct {
+	mu         sync.Mutex
+	onProgress ProgressCallback
+	days       int
+	completed  int
+	current    []int
+	total      []int
+}
 
-		// Create a copy of metadata with single date filter
-		singleDayMetadata := metadata
-		singleDayMetadata.Filter = domain.TaskFilter{
-			Date:              dateStr,
-			DayStartTime:      metadata.Filter.DayStartTime,
-			TransactionStatus: metadata.Filter.TransactionStatus,
-			Limit:             metadata.Filter.Limit,
+func newRangeProgress(days int, onProgress ProgressCallback) *rangeProgress {
+	return &rangeProgress{onProgress: onProgress, days: days, current: make([]int, days), total: make([]int, days)}
+}
+
+// date returns the progress callback of the i-th date, prefixing its stages with the date
+func (p *rangeProgress) date(i int, date string) ProgressCallback {
+	return func(stage string, current, total int) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.current[i], p.total[i] = current, total
+		p.emit(fmt.Sprintf("[%s] %s (%d of %d dates done)", date, stage, p.completed, p.days))
+	}
+}
+
+// done marks the i-th date as finished, its transactions count as rendered
+func (p *rangeProgress) done(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.completed++
+	p.current[i] = p.total[i]
+}
+
+// report reports a stage of the whole range
+func (p *rangeProgress) report(stage string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit(stage)
+}
+
+func (p *rangeProgress) emit(stage string) {
+	if p.onProgress == nil {
+		return
+	}
+	current, total := 0, 0
+	for i := range p.current {
+		current += p.current[i]
+		total += p.total[i]
+	}
+	p.onProgress(stage, current, total)
+}
+
+// ErrorCode classifies a generation error, stored on the failed task
+func ErrorCode(err error) domain.TaskErrorCode {
+	switch {
+	case errors.Is(err, ErrInvalidInput):
+		return domain.TaskErrorInvalidInput
+	case errors.Is(err, datasource.ErrDataSourceMissing):
+		return domain.TaskErrorDataSourceMissing
+	case errors.Is(err, datasource.ErrAmbiguousDataSource):
+		return domain.TaskErrorDataSourceAmbiguous
+	case errors.Is(err, datasource.ErrDriverUnavailable):
+		return domain.TaskErrorDriverUnavailable
+	case errors.Is(err, datasource.ErrFileLocked):
+		return domain.TaskErrorFileLocked
+	case errors.Is(err, datasource.ErrConnect):
+		return domain.TaskErrorConnect
+	case errors.Is(err, datasource.ErrArchive):
+		return domain.TaskErrorArchive
+	case errors.Is(err, datasource.ErrArchiveTooLarge):
+		return domain.TaskErrorArchiveTooLarge
+	case errors.Is(err, datasource.ErrQuery):
+		return domain.TaskErrorQuery
+	case errors.Is(err, ErrRender):
+		return domain.TaskErrorRender
+	case errors.Is(err, ErrDiskFull), utils.IsDiskFull(err):
+		return domain.TaskErrorDiskFull
+	case errors.Is(err, context.DeadlineExceeded):
+		return domain.TaskErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return domain.TaskErrorCancelled
+	}
+	return domain.TaskErrorInternal
+}
+
+// ErrorClass groups generation errors for metrics, the same as the task error codes
+func ErrorClass(err error) string {
+	return string(ErrorCode(err))
+}
+
+// renderTimeout returns the time budget to render the given number of transactions
+func renderTimeout(transactions int) time.Duration {
+	return renderTimeoutBase + time.Duration(transactions)*renderTimeoutPerTransaction
+}
+
+// extractArchived extracts the data source file of a date from the first archive containing it.
+// The data source path formats are tried in order, the one found is returned with the file.
+func extractArchived(ctx context.Context, snapshot *Snapshot, archiveFormats, datasourceFormats []string, metadata domain.TaskMetadata, targetDate time.Time) (*datasource.CachedFile, string, error) {
+	var archives []string
+	for _, format := range archiveFormats {
+		path := datasource.GetDataSourcePath(format, metadata.RootFolder, targetDate, metadata.BranchID, metadata.GateID, metadata.StationID)
+		archives = append(archives, filepath.FromSlash(path))
+	}
+
+	limitMB, err := strconv.Atoi(snapshot.Setting(domain.SettingDataSourceArchiveMB, strconv.Itoa(DefaultArchiveCacheMB)))
+	if err != nil || limitMB <= 0 {
+		limitMB = DefaultArchiveCacheMB
+	}
+
+	for _, format := range datasourceFormats {
+		relPath := utils.FormatPath(format, utils.PathParams{
+			Time:      targetDate,
+			BranchID:  metadata.BranchID,
+			GateID:    metadata.GateID,
+			StationID: metadata.StationID,
+		})
+		file, err := archiveCache().Extract(ctx, archives, relPath, int64(limitMB)<<20)
+		if errors.Is(err, datasource.ErrDataSourceMissing) {
+			continue
 		}
+		return file, format, err
+	}
+	return nil, "", fmt.Errorf("%w: in archives %s", datasource.ErrDataSourceMissing, strings.Join(archives, ", "))
+}
 
-		// Create per-date progress callback that prefixes with date info
-		perDateProgress := func(stage string, current, total int) {
-			if onProgress != nil {
-				prefixedStage := fmt.Sprintf("[%s] %s", dateStr, stage)
-				onProgress(prefixedStage, current, total)
-			}
+// DriverOptions returns the Access driver attempts and the decrypted database password of the settings
+func DriverOptions(snapshot *Snapshot) (datasource.DriverOptions, error) {
+	attempts, err := datasource.ParseDriverAttempts(snapshot.Setting(domain.SettingDataSourceDrivers, ""))
+	if err != nil {
+		return datasource.DriverOptions{}, fmt.Errorf("%w: %s: %w", ErrInvalidInput, domain.SettingDataSourceDrivers, err)
+	}
+	opts := datasource.DriverOptions{Attempts: attempts}
+
+	if encrypted := snapshot.Setting(domain.SettingDataSourcePassword, ""); encrypted != "" {
+		password, err := utils.Decrypt(encrypted)
+		if err != nil {
+			return opts, fmt.Errorf("%w: failed to decrypt %s, set it again", ErrInvalidInput, domain.SettingDataSourcePassword)
 		}
+		opts.Password = password
+	}
+	return opts, nil
+}
 
-		// Generate PDF for this single date
-		output, size, err := GeneratePDFWithProgress(ctx, singleDayMetadata, settingsRepo, gateRepo, perDateProgress)
+// DiagnoseDataSource tries every configured driver on the file. With datasource_snapshot
+// enabled a copy is opened, as the worker would, so the live file is not locked.
+func DiagnoseDataSource(ctx context.Context, snapshot *Snapshot, path string) (datasource.DriverReport, error) {
+	opts, err := DriverOptions(snapshot)
+	if err != nil {
+		return datasource.DriverReport{}, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return datasource.DriverReport{}, fmt.Errorf("%w: %s", datasource.ErrDataSourceMissing, path)
+	}
+
+	readPath := path
+	if snapshot.Setting(domain.SettingDataSourceSnapshot, "false") == "true" {
+		snapshotDir, err := filepath.Abs(filepath.Join(DefaultOutputDir, PartsDir))
+		if err != nil {
+			return datasource.DriverReport{}, fmt.Errorf("failed to get absolute parts path: %w", err)
+		}
+		sourceCopy, err := datasource.TakeSnapshot(ctx, path, snapshotDir, datasource.DefaultSnapshotOptions)
 		if err != nil {
-			log.Warn().Err(err).Str("date", dateStr).Msg("Failed to generate PDF for date, skipping")
-			continue // Skip failed dates but continue with others
+			return datasource.DriverReport{}, err
 		}
+		defer sourceCopy.Remove()
+		readPath = sourceCopy.Path
+	}
 
-		outputPaths = append(outputPaths, output)
-		totalSize += size
+	report := datasource.Diagnose(ctx, readPath, opts)
+	report.Path = path
+	return report, nil
+}
 
-		log.Info().
-			Str("date", dateStr).
-			Str("output", output).
-			Int64("size", size).
-			Msg("Generated PDF for date")
+// TaskOutputDir returns the absolute directory the output files of a task are written to,
+// output/<task id>, and creates it. Without a task ID it is the output directory itself.
+func TaskOutputDir(taskID string) (string, error) {
+	dir := DefaultOutputDir
+	if taskID != "" {
+		if strings.ContainsAny(taskID, `/\`) || taskID == "." || taskID == ".." {
+			return "", fmt.Errorf("%w: task ID %q", ErrInvalidInput, taskID)
+		}
+		dir = filepath.Join(dir, taskID)
 	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return dir, os.MkdirAll(dir, 0755)
+}
 
-	if len(outputPaths) == 0 {
-		return "", 0, fmt.Errorf("no PDFs were generated for the date range")
+// RemoveOutputs removes the comma-separated output files of a task and the task's output
+// directory once it is empty
+func RemoveOutputs(outputPath string) error {
+	dirs := make(map[string]struct{})
+	for _, path := range strings.Split(outputPath, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		dirs[filepath.Dir(path)] = struct{}{}
 	}
 
-	if onProgress != nil {
-		onProgress(fmt.Sprintf("Completed: %d PDFs generated", len(outputPaths)), days, days)
+	root, err := filepath.Abs(DefaultOutputDir)
+	if err != nil {
+		return nil
+	}
+	for dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil && filepath.Dir(abs) == root {
+			os.Remove(abs) // Fails while other files are left
+		}
+	}
+	return nil
+}
+
+// partDirectory creates the directory of the PDF parts. Parts of a checkpoint are kept
+// until the report is merged, others are rendered in a directory of their own.
+func partDirectory(outputDir string, checkpoint *Checkpoint) (string, error) {
+	root := filepath.Join(outputDir, PartsDir)
+	if checkpoint == nil || checkpoint.Key == "" {
+		if err := os.MkdirAll(root, 0755); err != nil {
+			return "", err
+		}
+		return os.MkdirTemp(root, "render-")
 	}
+	dir := filepath.Join(root, checkpoint.Key)
+	return dir, os.MkdirAll(dir, 0755)
+}
 
-	// Return comma-separated paths for multiple files
-	return strings.Join(outputPaths, ","), totalSize, nil
+// resumableChunks returns the chunks of the date that earlier attempts rendered, in order from
+// the first transaction on. They only count while the date still has the same transactions
+// and their parts still exist.
+func resumableChunks(checkpoint *Checkpoint, date string, total int) []domain.TaskChunk {
+	if checkpoint == nil {
+		return nil
+	}
+	var chunks []domain.TaskChunk
+	next := 0
+	for _, chunk := range checkpoint.Chunks {
+		if chunk.Date != date {
+			continue
+		}
+		if chunk.Start != next || chunk.Total != total || chunk.End <= chunk.Start {
+			break
+		}
+		if _, err := os.Stat(chunk.Path); err != nil {
+			break
+		}
+		chunks = append(chunks, chunk)
+		next = chunk.End
+	}
+	return chunks
+}
+
+// mergeParts writes the PDF parts, in order, to the output file
+func mergeParts(parts []string, outputPath string) error {
+	if len(parts) == 1 {
+		return os.Rename(parts[0], outputPath)
+	}
+	conf := model.NewDefaultConfiguration()
+	conf.WriteXRefStream = false
+	return api.MergeCreateFile(parts, outputPath, false, conf)
+}
+
+// removeParts deletes the merged parts
+func removeParts(parts []string) {
+	for _, part := range parts {
+		if err := os.Remove(part); err != nil && !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("path", part).Msg("Failed to remove PDF part")
+		}
+	}
 }
 
-func getSettingOrDefault(ctx context.Context, repo ports.SettingsRepository, key, defaultVal string) string {
-	setting, err := repo.Get(ctx, key)
-	if err != nil || setting == nil {
-		return defaultVal
+// removePartDirectory removes the parts directory of a checkpoint once it is empty
+func removePartDirectory(checkpoint *Checkpoint) {
+	if checkpoint == nil || checkpoint.Key == "" {
+		return
+	}
+	if outputDir, err := filepath.Abs(DefaultOutputDir); err == nil {
+		os.Remove(filepath.Join(outputDir, PartsDir, checkpoint.Key))
 	}
-	return setting.Value
 }
 
 func getPageSize(size string) pagesize.Type {
@@ -478,6 +974,11 @@ func getPageSize(size string) pagesize.Type {
 }
 
 func formatFilename(format string, metadata domain.TaskMetadata) string {
+	return utils.FormatPath(format, ReportPathParams(metadata))
+}
+
+// ReportPathParams returns the template variables of a report: its (first) date and IDs
+func ReportPathParams(metadata domain.TaskMetadata) utils.PathParams {
 	targetDate := time.Now()
 	if metadata.Filter.Date != "" {
 		if parsed, err := time.Parse("2006-01-02", metadata.Filter.Date); err == nil {
@@ -489,12 +990,12 @@ func formatFilename(format string, metadata domain.TaskMetadata) string {
 		}
 	}
 
-	return utils.FormatPath(format, utils.PathParams{
+	return utils.PathParams{
 		Time:      targetDate,
 		BranchID:  metadata.BranchID,
 		GateID:    metadata.GateID,
 		StationID: metadata.StationID,
-	})
+	}
 }
 
 func nextTextPropTop(p props.Text, space float64, last *float64, reset ...bool) props.Text {
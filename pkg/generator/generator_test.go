@@ -1,11 +1,29 @@
 package generator
 
 import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	maroto "github.com/johnfercher/maroto/v2"
+	"github.com/johnfercher/maroto/v2/pkg/components/text"
 	"github.com/johnfercher/maroto/v2/pkg/consts/pagesize"
 	"github.com/johnfercher/maroto/v2/pkg/props"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/pkg/datasource"
+	"pdf_generator/pkg/utils"
 )
 
 func TestGetPageSize(t *testing.T) {
@@ -44,3 +62,266 @@ func TestNextTextPropTop(t *testing.T) {
 	assert.Equal(t, 6.0, res.Top)
 	assert.Equal(t, 6.0, last)
 }
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected domain.TaskErrorCode
+	}{
+		{"InvalidInput", fmt.Errorf("%w: range_start", ErrInvalidInput), domain.TaskErrorInvalidInput},
+		{"Missing", fmt.Errorf("%w: d:/data/01.mdb", datasource.ErrDataSourceMissing), domain.TaskErrorDataSourceMissing},
+		{"Locked", fmt.Errorf("%w: in use", datasource.ErrFileLocked), domain.TaskErrorFileLocked},
+		{"Archive", fmt.Errorf("%w: unexpected EOF", datasource.ErrArchive), domain.TaskErrorArchive},
+		{"ArchiveTooLarge", fmt.Errorf("%w: 05022024.mdb", datasource.ErrArchiveTooLarge), domain.TaskErrorArchiveTooLarge},
+		{"Query", fmt.Errorf("%w: syntax", datasource.ErrQuery), domain.TaskErrorQuery},
+		{"Render", fmt.Errorf("%w: font", ErrRender), domain.TaskErrorRender},
+		{"DiskFull", fmt.Errorf("%w: write", ErrDiskFull), domain.TaskErrorDiskFull},
+		{"Timeout", context.DeadlineExceeded, domain.TaskErrorTimeout},
+		{"Range", fmt.Errorf("no PDFs were generated for the date range: %w", datasource.ErrDataSourceMissing), domain.TaskErrorDataSourceMissing},
+		{"Other", errors.New("boom"), domain.TaskErrorInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ErrorCode(tt.err))
+		})
+	}
+
+	// Reading an archive may succeed on another attempt, a file above the cache limit does not
+	assert.False(t, domain.TaskErrorArchive.Permanent())
+	assert.True(t, domain.TaskErrorArchiveTooLarge.Permanent())
+}
+
+func TestGenerateMultiDatePDF_InvalidRange(t *testing.T) {
+	metadata := domain.TaskMetadata{Filter: domain.TaskFilter{RangeStart: "2024-02-10", RangeEnd: "2024-02-01"}}
+	_, _, err := GenerateMultiDatePDF(context.Background(), metadata, nil, nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	metadata.Filter.RangeEnd = "2024-02-31"
+	_, _, err = GenerateMultiDatePDF(context.Background(), metadata, nil, nil, nil)
+	assert.Equal(t, domain.TaskErrorInvalidInput, ErrorCode(err))
+}
+
+func TestResumableChunks(t *testing.T) {
+	dir := t.TempDir()
+	part := func(name string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte("%PDF"), 0644))
+		return path
+	}
+	first := domain.TaskChunk{Date: "2024-02-05", Start: 0, End: 500, Total: 1200, Path: part("a.pdf")}
+	second := domain.TaskChunk{Date: "2024-02-05", Start: 500, End: 1000, Total: 1200, Path: part("b.pdf")}
+	other := domain.TaskChunk{Date: "2024-02-06", Start: 0, End: 500, Total: 900, Path: part("c.pdf")}
+
+	var chunks []domain.TaskChunk
+	for _, chunk := range []domain.TaskChunk{first, other, second} {
+		chunks = domain.WithChunk(chunks, chunk)
+	}
+	checkpoint := &Checkpoint{Key: "task", Chunks: chunks}
+
+	assert.Equal(t, []domain.TaskChunk{first, second}, resumableChunks(checkpoint, "2024-02-05", 1200))
+	assert.Equal(t, []domain.TaskChunk{other}, resumableChunks(checkpoint, "2024-02-06", 900))
+	assert.Empty(t, resumableChunks(nil, "2024-02-05", 1200))
+
+	// The date gained transactions since, it is rendered again
+	assert.Empty(t, resumableChunks(checkpoint, "2024-02-05", 1300))
+
+	// Chunks after a missing part are rendered again
+	assert.NoError(t, os.Remove(first.Path))
+	assert.Empty(t, resumableChunks(checkpoint, "2024-02-05", 1200))
+
+	// A restart from the first transaction replaces the chunks of the date
+	restarted := domain.TaskChunk{Date: "2024-02-05", Start: 0, End: 400, Total: 1300, Path: part("d.pdf")}
+	chunks = domain.WithChunk(chunks, restarted)
+	assert.Equal(t, []domain.TaskChunk{restarted, other}, chunks)
+}
+
+func TestMergeParts(t *testing.T) {
+	dir := t.TempDir()
+	var parts []string
+	for i := 0; i < 3; i++ {
+		m := maroto.New()
+		m.AddRows(text.NewRow(10, fmt.Sprintf("part %d", i)))
+		doc, err := m.Generate()
+		assert.NoError(t, err)
+		path := filepath.Join(dir, fmt.Sprintf("part_%d.pdf", i))
+		assert.NoError(t, doc.Save(path))
+		parts = append(parts, path)
+	}
+
+	output := filepath.Join(dir, "report.pdf")
+	assert.NoError(t, mergeParts(parts, output))
+	pages, err := api.PageCountFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pages)
+
+	// A single part is moved
+	single := filepath.Join(dir, "single.pdf")
+	assert.NoError(t, mergeParts(parts[:1], single))
+	_, err = os.Stat(parts[0])
+	assert.True(t, os.IsNotExist(err))
+	pages, err = api.PageCountFile(single)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pages)
+}
+
+func TestTaskOutputDir(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// Tasks with the same report name write to different directories
+	first, err := TaskOutputDir("task-a")
+	assert.NoError(t, err)
+	second, err := TaskOutputDir("task-b")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, "task-a", filepath.Base(first))
+	assert.DirExists(t, first)
+
+	for _, id := range []string{"..", "../task-a", `a\b`} {
+		_, err := TaskOutputDir(id)
+		assert.ErrorIs(t, err, ErrInvalidInput, id)
+	}
+
+	// Removing the outputs removes the emptied task directory, not the output directory
+	paths := []string{filepath.Join(first, "1_2_20251215.pdf"), filepath.Join(first, "1_2_20251216.pdf")}
+	for _, path := range paths {
+		assert.NoError(t, os.WriteFile(path, []byte("%PDF"), 0644))
+	}
+	legacy := filepath.Join(filepath.Dir(first), "1_2_20251215.pdf")
+	assert.NoError(t, os.WriteFile(legacy, []byte("%PDF"), 0644))
+
+	assert.NoError(t, RemoveOutputs(strings.Join(paths, ",")))
+	assert.NoDirExists(t, first)
+	assert.NoError(t, RemoveOutputs(legacy))
+	assert.NoFileExists(t, legacy)
+	assert.DirExists(t, filepath.Dir(first))
+}
+
+func TestDateParallelism(t *testing.T) {
+	cpus := runtime.GOMAXPROCS(0)
+	settings := func(values map[string]string) *Snapshot {
+		return NewSnapshot(values, nil)
+	}
+
+	assert.Equal(t, min(DefaultDateParallelism, cpus, 31), dateParallelism(nil, 31))
+	assert.Equal(t, min(2, cpus), dateParallelism(settings(map[string]string{domain.SettingPDFDateParallelism: "2"}), 31))
+	assert.Equal(t, 1, dateParallelism(settings(map[string]string{domain.SettingPDFDateParallelism: "8"}), 1))
+	assert.Equal(t, min(DefaultDateParallelism, cpus), dateParallelism(settings(map[string]string{domain.SettingPDFDateParallelism: "0"}), 31))
+
+	// Running tasks share the CPUs
+	values := map[string]string{domain.SettingPDFDateParallelism: "64", domain.SettingQueueConcurrency: "2"}
+	assert.Equal(t, max(1, cpus/2), dateParallelism(settings(values), 31))
+	values[domain.SettingQueueConcurrency] = strconv.Itoa(cpus + 1)
+	assert.Equal(t, 1, dateParallelism(settings(values), 31))
+}
+
+func TestRangeProgress(t *testing.T) {
+	type update struct {
+		stage          string
+		current, total int
+	}
+	var updates []update
+	progress := newRangeProgress(3, func(stage string, current, total int) {
+		updates = append(updates, update{stage, current, total})
+	})
+
+	progress.date(0, "2024-02-01")("Loading fonts", 0, 100)
+	progress.date(1, "2024-02-02")("Appending transaction 10 of 50", 10, 50)
+	progress.date(0, "2024-02-01")("Appending transaction 40 of 100", 40, 100)
+	progress.done(0)
+	progress.date(2, "2024-02-03")("Loading fonts", 0, 20)
+
+	assert.Equal(t, []update{
+		{"[2024-02-01] Loading fonts (0 of 3 dates done)", 0, 100},
+		{"[2024-02-02] Appending transaction 10 of 50 (0 of 3 dates done)", 10, 150},
+		{"[2024-02-01] Appending transaction 40 of 100 (0 of 3 dates done)", 50, 150},
+		{"[2024-02-03] Loading fonts (1 of 3 dates done)", 110, 170},
+	}, updates)
+}
+
+func TestGenerateMultiDatePDF_Parallel(t *testing.T) {
+	// Every date misses its data source, all of them are still tried
+	var mu sync.Mutex
+	dates := map[string]bool{}
+	onProgress := func(stage string, current, total int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasPrefix(stage, "[") {
+			dates[stage[1:11]] = true
+		}
+	}
+	metadata := domain.TaskMetadata{RootFolder: t.TempDir(), StationID: 1, Filter: domain.TaskFilter{RangeStart: "2024-02-01", RangeEnd: "2024-02-10"}}
+	snapshot := NewSnapshot(map[string]string{domain.SettingPDFDateParallelism: "3"}, nil)
+
+	_, _, err := GenerateMultiDatePDF(context.Background(), metadata, snapshot, onProgress, nil)
+	assert.Equal(t, domain.TaskErrorDataSourceMissing, ErrorCode(err))
+	assert.Len(t, dates, 10)
+}
+
+func TestRangeError(t *testing.T) {
+	missing := fmt.Errorf("date 1: %w", datasource.ErrDataSourceMissing)
+	locked := fmt.Errorf("date 2: %w", datasource.ErrFileLocked)
+	invalid := fmt.Errorf("date 3: %w", ErrInvalidInput)
+
+	// One date that can be retried makes the range retryable
+	assert.Equal(t, locked, rangeError([]error{missing, locked, invalid}))
+	assert.False(t, ErrorCode(rangeError([]error{missing, locked})).Permanent())
+
+	assert.Equal(t, invalid, rangeError([]error{missing, invalid}))
+	assert.True(t, ErrorCode(rangeError([]error{missing, invalid})).Permanent())
+}
+
+func TestExtractArchived(t *testing.T) {
+	t.Chdir(t.TempDir())
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "archive"), 0755))
+	archive := filepath.Join(root, "archive", "0224.zip")
+	f, err := os.Create(archive)
+	assert.NoError(t, err)
+	w := zip.NewWriter(f)
+	entry, _ := w.Create("0224/01/05022024.mdb")
+	entry.Write([]byte("transactions"))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+
+	metadata := domain.TaskMetadata{RootFolder: root, StationID: 1}
+	date := time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)
+	archives := []string{"archive/{DD}{MM}{YYYY}.zip", "archive/{MM}{YY}.zip"}
+	formats := []string{"{MM}-{YYYY}/{StationID}/{DD}{MM}{YYYY}.accdb", "{MM}{YY}/{StationID}/{DD}{MM}{YYYY}.mdb"}
+	file, format, err := extractArchived(context.Background(), nil, archives, formats, metadata, date)
+	assert.NoError(t, err)
+	defer file.Release()
+	assert.Equal(t, formats[1], format)
+	assert.Equal(t, archive, file.Archive)
+	assert.Equal(t, "0224/01/05022024.mdb", file.Entry)
+	wd, _ := os.Getwd()
+	assert.Equal(t, filepath.Join(wd, DefaultOutputDir, ArchiveCacheDir), filepath.Dir(file.Path))
+
+	_, _, err = extractArchived(context.Background(), nil, archives, formats, metadata, date.AddDate(0, 0, 1))
+	assert.Equal(t, domain.TaskErrorDataSourceMissing, ErrorCode(err))
+}
+
+func TestDriverOptions(t *testing.T) {
+	opts, err := DriverOptions(NewSnapshot(nil, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, datasource.DefaultDriverAttempts, opts.Attempts)
+	assert.Empty(t, opts.Password)
+
+	encrypted, err := utils.Encrypt("secret")
+	assert.NoError(t, err)
+	opts, err = DriverOptions(NewSnapshot(map[string]string{
+		domain.SettingDataSourceDrivers:  "ace16|adodb|Provider=Microsoft.ACE.OLEDB.16.0;Data Source={Path};|10",
+		domain.SettingDataSourcePassword: encrypted,
+	}, nil))
+	assert.NoError(t, err)
+	assert.Len(t, opts.Attempts, 1)
+	assert.Equal(t, "ace16", opts.Attempts[0].Name)
+	assert.Equal(t, 10*time.Second, opts.Attempts[0].Timeout)
+	assert.Equal(t, "secret", opts.Password)
+
+	_, err = DriverOptions(NewSnapshot(map[string]string{domain.SettingDataSourceDrivers: "ace16|adodb"}, nil))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = DriverOptions(NewSnapshot(map[string]string{domain.SettingDataSourcePassword: "not encrypted"}, nil))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
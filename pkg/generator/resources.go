@@ -0,0 +1,175 @@
+package generator
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/johnfercher/maroto/v2/pkg/consts/fontstyle"
+	"github.com/johnfercher/maroto/v2/pkg/core/entity"
+	"github.com/johnfercher/maroto/v2/pkg/repository"
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+)
+
+// fontFamily is the family name of the embedded report fonts
+const fontFamily = "nunito-sans"
+
+var (
+	fontsOnce sync.Once
+	fonts     []*entity.CustomFont
+)
+
+// loadFonts parses the embedded fonts once per process. It returns nil when they can not
+// be loaded, the reports then use the default font.
+func loadFonts() []*entity.CustomFont {
+	fontsOnce.Do(func() {
+		regFont, _ := nunitoSansFonts.ReadFile("fonts/nunito-sans/nunito-sans.regular.ttf")
+		italicFont, _ := nunitoSansFonts.ReadFile("fonts/nunito-sans/nunito-sans.italic.ttf")
+		boldFont, _ := nunitoSansFonts.ReadFile("fonts/nunito-sans/nunito-sans.bold.ttf")
+		boldItalicFont, _ := nunitoSansFonts.ReadFile("fonts/nunito-sans/nunito-sans.bold-italic.ttf")
+
+		if len(regFont) == 0 || len(italicFont) == 0 || len(boldFont) == 0 || len(boldItalicFont) == 0 {
+			log.Error().Msg("Failed to read one or more embedded font files")
+			return
+		}
+
+		loaded, err := repository.New().
+			AddUTF8FontFromBytes(fontFamily, fontstyle.Normal, regFont).
+			AddUTF8FontFromBytes(fontFamily, fontstyle.Italic, italicFont).
+			AddUTF8FontFromBytes(fontFamily, fontstyle.Bold, boldFont).
+			AddUTF8FontFromBytes(fontFamily, fontstyle.BoldItalic, boldItalicFont).
+			Load()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load custom fonts from bytes, falling back to default")
+			return
+		}
+		fonts = loaded
+	})
+	return fonts
+}
+
+// Snapshot holds the settings and gate names a report is rendered with.
+// It is read-only, so the dates of a range share one snapshot.
+type Snapshot struct {
+	settings  map[string]string
+	gateNames map[int]string
+}
+
+// NewSnapshot creates a snapshot of the given settings and gates
+func NewSnapshot(settings map[string]string, gates []domain.Gate) *Snapshot {
+	s := &Snapshot{
+		settings:  make(map[string]string, len(settings)),
+		gateNames: make(map[int]string, len(gates)),
+	}
+	for key, value := range settings {
+		s.settings[key] = value
+	}
+	for _, g := range gates {
+		s.gateNames[g.ID] = g.Name
+	}
+	return s
+}
+
+// LoadSnapshot reads all settings and gates. The gate repository is optional.
+func LoadSnapshot(ctx context.Context, settingsRepo ports.SettingsRepository, gateRepo ports.GateRepository) (*Snapshot, error) {
+	settings := make(map[string]string)
+	if settingsRepo != nil {
+		all, err := settingsRepo.GetAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, setting := range all {
+			settings[setting.Key] = setting.Value
+		}
+	}
+
+	var gates []domain.Gate
+	if gateRepo != nil {
+		var err error
+		gates, _, err = gateRepo.List(ctx, ports.GateFilter{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewSnapshot(settings, gates), nil
+}
+
+// Setting returns the value of a setting, or defaultVal when it is not set
+func (s *Snapshot) Setting(key, defaultVal string) string {
+	if s == nil {
+		return defaultVal
+	}
+	if value, ok := s.settings[key]; ok {
+		return value
+	}
+	return defaultVal
+}
+
+// GateName returns the name of a gate, or its ID when the gate is unknown
+func (s *Snapshot) GateName(id int) string {
+	if s != nil {
+		if name, ok := s.gateNames[id]; ok {
+			return name
+		}
+	}
+	return strconv.Itoa(id)
+}
+
+// Resources caches the snapshot of a worker between tasks. The snapshot is reloaded when
+// the revision of the repositories changed, or for every task when they have none.
+type Resources struct {
+	settingsRepo ports.SettingsRepository
+	gateRepo     ports.GateRepository
+
+	mu       sync.Mutex
+	snapshot *Snapshot
+	revision string
+}
+
+// NewResources creates a resource cache over the given repositories
+func NewResources(settingsRepo ports.SettingsRepository, gateRepo ports.GateRepository) *Resources {
+	return &Resources{settingsRepo: settingsRepo, gateRepo: gateRepo}
+}
+
+// Snapshot returns the current snapshot, reloading it after a change
+func (r *Resources) Snapshot(ctx context.Context) (*Snapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	revision, ok := r.currentRevision(ctx)
+	if ok && r.snapshot != nil && revision == r.revision {
+		return r.snapshot, nil
+	}
+
+	snapshot, err := LoadSnapshot(ctx, r.settingsRepo, r.gateRepo)
+	if err != nil {
+		return nil, err
+	}
+	r.snapshot, r.revision = snapshot, revision
+	return snapshot, nil
+}
+
+// currentRevision combines the revisions of both repositories, ok is false when
+// one of them can not tell
+func (r *Resources) currentRevision(ctx context.Context) (string, bool) {
+	var revision string
+	for _, repo := range []any{r.settingsRepo, r.gateRepo} {
+		if repo == nil {
+			continue
+		}
+		revisioned, ok := repo.(ports.Revisioned)
+		if !ok {
+			return "", false
+		}
+		rev, err := revisioned.Revision(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to read repository revision, reloading resources")
+			return "", false
+		}
+		revision += rev + ";"
+	}
+	return revision, true
+}
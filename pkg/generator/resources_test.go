@@ -0,0 +1,147 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/adapters/repository"
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/database"
+)
+
+// settingsStub serves fixed settings and counts the loads
+type settingsStub struct {
+	values   map[string]string
+	revision int
+	loads    int
+}
+
+func (s *settingsStub) Get(ctx context.Context, key string) (*domain.Settings, error) {
+	value, ok := s.values[key]
+	if !ok {
+		return nil, errors.New("setting not found")
+	}
+	return &domain.Settings{Key: key, Value: value}, nil
+}
+
+func (s *settingsStub) Set(ctx context.Context, setting *domain.Settings) error { return nil }
+
+func (s *settingsStub) GetAll(ctx context.Context) ([]domain.Settings, error) {
+	s.loads++
+	var settings []domain.Settings
+	for key, value := range s.values {
+		settings = append(settings, domain.Settings{Key: key, Value: value})
+	}
+	return settings, nil
+}
+
+// revisionedSettingsStub also tells its revision
+type revisionedSettingsStub struct{ *settingsStub }
+
+func (s revisionedSettingsStub) Revision(ctx context.Context) (string, error) {
+	return strconv.Itoa(s.revision), nil
+}
+
+// gateStub serves fixed gates
+type gateStub struct {
+	ports.GateRepository
+	gates []domain.Gate
+}
+
+func (g gateStub) List(ctx context.Context, filter ports.GateFilter) ([]domain.Gate, int64, error) {
+	return g.gates, int64(len(g.gates)), nil
+}
+
+func (g gateStub) Revision(ctx context.Context) (string, error) { return "gates", nil }
+
+func TestSnapshot(t *testing.T) {
+	snapshot := NewSnapshot(map[string]string{domain.SettingPageSize: "A3"}, []domain.Gate{{ID: 12, Name: "CIKUNIR"}})
+	assert.Equal(t, "A3", snapshot.Setting(domain.SettingPageSize, "A4"))
+	assert.Equal(t, "Analyzer", snapshot.Setting(domain.SettingAnalyzerOperatorName, "Analyzer"))
+	assert.Equal(t, "CIKUNIR", snapshot.GateName(12))
+	assert.Equal(t, "13", snapshot.GateName(13))
+
+	// Defaults apply without a snapshot
+	var empty *Snapshot
+	assert.Equal(t, "A4", empty.Setting(domain.SettingPageSize, "A4"))
+	assert.Equal(t, "12", empty.GateName(12))
+}
+
+func TestResources_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	settings := &settingsStub{values: map[string]string{domain.SettingPageSize: "A4"}}
+	resources := NewResources(revisionedSettingsStub{settings}, gateStub{gates: []domain.Gate{{ID: 1, Name: "GATE 1"}}})
+
+	first, err := resources.Snapshot(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "GATE 1", first.GateName(1))
+
+	// Cached until the revision changes
+	second, err := resources.Snapshot(ctx)
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Equal(t, 1, settings.loads)
+
+	settings.values[domain.SettingPageSize] = "A3"
+	settings.revision++
+	third, err := resources.Snapshot(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "A3", third.Setting(domain.SettingPageSize, ""))
+	assert.Equal(t, 2, settings.loads)
+
+	// Repositories without a revision are read for every snapshot
+	plain := &settingsStub{values: map[string]string{}}
+	resources = NewResources(plain, nil)
+	for i := 0; i < 2; i++ {
+		_, err := resources.Snapshot(ctx)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, plain.loads)
+}
+
+func TestResources_RepositoryRevision(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open("file:resources?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(database.Models()...))
+	settingsRepo := repository.NewSettingsRepository(db)
+	gateRepo := repository.NewGateRepository(db)
+	resources := NewResources(settingsRepo, gateRepo)
+
+	assert.NoError(t, settingsRepo.Set(ctx, &domain.Settings{Key: domain.SettingBranchName, Value: "CIKAMPEK"}))
+	assert.NoError(t, gateRepo.Create(ctx, &domain.Gate{ID: 1, Name: "GATE 1"}))
+	first, err := resources.Snapshot(ctx)
+	assert.NoError(t, err)
+	second, err := resources.Snapshot(ctx)
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+
+	// Saving a setting or a gate reloads the snapshot
+	assert.NoError(t, settingsRepo.Set(ctx, &domain.Settings{Key: domain.SettingBranchName, Value: "CIAWI"}))
+	third, err := resources.Snapshot(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "CIAWI", third.Setting(domain.SettingBranchName, ""))
+
+	assert.NoError(t, gateRepo.Update(ctx, &domain.Gate{ID: 1, Name: "CIKUNIR"}))
+	fourth, err := resources.Snapshot(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "CIKUNIR", fourth.GateName(1))
+
+	assert.NoError(t, gateRepo.Delete(ctx, 1))
+	fifth, err := resources.Snapshot(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", fifth.GateName(1))
+}
+
+func TestLoadFonts(t *testing.T) {
+	fonts := loadFonts()
+	assert.Len(t, fonts, 4)
+	assert.Same(t, fonts[0], loadFonts()[0])
+}
@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/utils"
+)
+
+// ErrNotConfigured is returned when no SMTP host is set
+var ErrNotConfigured = errors.New("SMTP is not configured, set smtp_host")
+
+// LoadConfig reads the SMTP settings and decrypts the password
+func LoadConfig(ctx context.Context, repo ports.SettingsRepository) (Config, error) {
+	get := func(key, def string) string {
+		if setting, err := repo.Get(ctx, key); err == nil && setting != nil && setting.Value != "" {
+			return setting.Value
+		}
+		return def
+	}
+
+	cfg := Config{
+		Host:     get(domain.SettingSMTPHost, ""),
+		Port:     587,
+		TLS:      domain.SMTPTLSMode(get(domain.SettingSMTPTLS, string(domain.SMTPTLSStartTLS))),
+		Username: get(domain.SettingSMTPUsername, ""),
+		From:     get(domain.SettingSMTPFrom, "DataLane <noreply@localhost>"),
+	}
+	if cfg.Host == "" {
+		return cfg, ErrNotConfigured
+	}
+	if port, err := strconv.Atoi(get(domain.SettingSMTPPort, "")); err == nil && port > 0 {
+		cfg.Port = port
+	}
+	if !cfg.TLS.Valid() {
+		return cfg, errors.New("smtp_tls must be one of starttls, tls or none")
+	}
+
+	if encrypted := get(domain.SettingSMTPPassword, ""); encrypted != "" {
+		password, err := utils.Decrypt(encrypted)
+		if err != nil {
+			return cfg, errors.New("failed to decrypt smtp_password, set it again")
+		}
+		cfg.Password = password
+	}
+	return cfg, nil
+}
@@ -0,0 +1,85 @@
+package mailer_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/pkg/mailer"
+	"pdf_generator/pkg/mailer/mailertest"
+)
+
+func TestSend_WithAttachment(t *testing.T) {
+	server, err := mailertest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "01_02_20251215.pdf")
+	assert.NoError(t, os.WriteFile(file, []byte("%PDF-1.4 report"), 0644))
+
+	cfg := mailer.Config{Host: server.Host(), Port: server.Port(), TLS: domain.SMTPTLSNone, From: "DataLane <noreply@example.com>"}
+	err = mailer.Send(context.Background(), cfg, mailer.Message{
+		To:          []string{"Branch Head <head@example.com>"},
+		Cc:          []string{"audit@example.com"},
+		Subject:     "Report 01-02 2025-12-15",
+		Body:        "Attached is the report.",
+		Attachments: []string{file},
+	})
+	assert.NoError(t, err)
+
+	messages := server.Messages()
+	if !assert.Len(t, messages, 1) {
+		return
+	}
+	assert.Equal(t, "noreply@example.com", messages[0].From)
+	assert.Equal(t, []string{"head@example.com", "audit@example.com"}, messages[0].To)
+
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0].Data))
+	assert.NoError(t, err)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.Equal(t, "Report 01-02 2025-12-15", subject)
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+
+	body, err := reader.NextPart()
+	assert.NoError(t, err)
+	text, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, body))
+	assert.Equal(t, "Attached is the report.", string(text))
+
+	attachment, err := reader.NextPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "01_02_20251215.pdf", attachment.FileName())
+	content, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	assert.Equal(t, "%PDF-1.4 report", string(content))
+}
+
+func TestSend_Errors(t *testing.T) {
+	server, err := mailertest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	cfg := mailer.Config{Host: server.Host(), Port: server.Port(), TLS: domain.SMTPTLSNone, From: "noreply@example.com"}
+	msg := mailer.Message{To: []string{"head@example.com"}, Subject: "Report"}
+
+	// Temporary rejection by the server
+	server.FailNext(1)
+	assert.Error(t, mailer.Send(context.Background(), cfg, msg))
+	assert.NoError(t, mailer.Send(context.Background(), cfg, msg))
+
+	// STARTTLS is required unless disabled
+	cfg.TLS = domain.SMTPTLSStartTLS
+	assert.ErrorContains(t, mailer.Send(context.Background(), cfg, msg), "STARTTLS")
+}
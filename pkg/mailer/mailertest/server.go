@@ -0,0 +1,148 @@
+// Package mailertest provides a local SMTP stand-in that records received messages
+package mailertest
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Message is an email received by the server
+type Message struct {
+	From string
+	To   []string
+	Data string // Raw message including headers
+}
+
+// Server accepts SMTP sessions without authentication or TLS
+type Server struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	messages []Message
+	failures int
+}
+
+// NewServer starts a server on a random local port
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ln: ln}
+	go s.serve()
+	return s, nil
+}
+
+// Host returns the host the server listens on
+func (s *Server) Host() string {
+	return s.ln.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port the server listens on
+func (s *Server) Port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	return s.ln.Close()
+}
+
+// Messages returns the messages received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message{}, s.messages...)
+}
+
+// FailNext rejects the next n messages with a temporary error
+func (s *Server) FailNext(n int) {
+	s.mu.Lock()
+	s.failures = n
+	s.mu.Unlock()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	tp := textproto.NewConn(conn)
+	defer tp.Close()
+
+	var msg Message
+	tp.PrintfLine("220 localhost mailertest")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		arg := strings.TrimSpace(line[len(verb):])
+
+		switch verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			if s.reject() {
+				tp.PrintfLine("451 Temporary failure, try again later")
+				continue
+			}
+			msg = Message{From: address(arg)}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, address(arg))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			id := len(s.messages)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK: queued as %d", id)
+		case "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// reject consumes one of the failures set by FailNext
+func (s *Server) reject() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return true
+	}
+	return false
+}
+
+// address extracts the address from "FROM:<a@b>" or "TO:<a@b>"
+func address(arg string) string {
+	if i := strings.Index(arg, "<"); i >= 0 {
+		if j := strings.Index(arg[i:], ">"); j > 0 {
+			return arg[i+1 : i+j]
+		}
+	}
+	return arg
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/version"
+)
+
+// DefaultWorkerAddr is where the worker serves /metrics unless WORKER_METRICS_ADDR is set
+const DefaultWorkerAddr = "localhost:3111"
+
+// Metrics shared by the API and the worker
+var (
+	Tasks = NewGauge("datalane_tasks",
+		"Tasks by status.", "status")
+	TaskDuration = NewHistogram("datalane_task_duration_seconds",
+		"Time spent generating the PDFs of a task, by result (completed or failed).",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600, 1200}, "result")
+	TaskTransactions = NewHistogram("datalane_task_transactions",
+		"Transactions per completed task.",
+		[]float64{0, 100, 500, 1000, 5000, 10000, 50000, 100000})
+	TaskFailures = NewCounter("datalane_task_failures_total",
+		"Failed generation attempts by error class.", "class")
+	DatasourceConnect = NewHistogram("datalane_datasource_connect_seconds",
+		"Time to open an MS Access data source, by driver and result (ok or error).",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}, "driver", "result")
+	OutputBytes = NewGauge("datalane_output_bytes",
+		"Disk usage of the output directory in bytes.")
+	OutputFiles = NewGauge("datalane_output_files",
+		"Files in the output directory.")
+	SQLiteWALBytes = NewGauge("datalane_sqlite_wal_bytes",
+		"Size of the SQLite write-ahead log in bytes, sampled every minute.")
+	SQLiteWALCheckpoints = NewCounter("datalane_sqlite_wal_checkpoints_total",
+		"SQLite WAL checkpoints run by the background sync.")
+	ActiveSessions = NewGauge("datalane_active_sessions",
+		"Active admin sessions.")
+	HTTPRequests = NewCounter("datalane_http_requests_total",
+		"HTTP requests by method, route and status code.", "method", "route", "status")
+	HTTPDuration = NewHistogram("datalane_http_request_duration_seconds",
+		"HTTP request latency by method and route.",
+		[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}, "method", "route")
+
+	buildInfo = NewGauge("datalane_build_info",
+		"Version and build of the running binary, always 1.", "version", "build")
+	goroutines = NewGauge("go_goroutines",
+		"Number of goroutines that currently exist.")
+	heapBytes = NewGauge("go_memstats_heap_alloc_bytes",
+		"Number of heap bytes allocated and still in use.")
+)
+
+func init() {
+	buildInfo.Set(1, version.Version, version.Build)
+	Default.OnCollect(func(ctx context.Context) {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		goroutines.Set(float64(runtime.NumGoroutine()))
+		heapBytes.Set(float64(stats.HeapAlloc))
+	})
+}
+
+// TaskCompleted records a completed task that took the time since start
+func TaskCompleted(start time.Time, transactions int) {
+	TaskDuration.ObserveDuration(start, "completed")
+	TaskTransactions.Observe(float64(transactions))
+}
+
+// TaskFailed records a failed generation attempt that took the time since start
+func TaskFailed(start time.Time, class string) {
+	TaskDuration.ObserveDuration(start, "failed")
+	TaskFailures.Inc(class)
+}
+
+// CollectTasks counts the tasks by status on every scrape
+func CollectTasks(taskRepo ports.TaskRepository) {
+	statuses := []domain.TaskStatus{
+		domain.TaskStatusQueued, domain.TaskStatusPending, domain.TaskStatusRunning, domain.TaskStatusCompleted,
+		domain.TaskStatusFailed, domain.TaskStatusCancelled, domain.TaskStatusRemoved,
+	}
+	Default.OnCollect(func(ctx context.Context) {
+		for _, status := range statuses {
+			count, err := taskRepo.CountByStatus(ctx, status)
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed to count tasks for metrics")
+				return
+			}
+			Tasks.Set(float64(count), string(status))
+		}
+	})
+}
+
+// CollectSessions counts the active sessions on every scrape
+func CollectSessions(sessionRepo ports.SessionRepository) {
+	Default.OnCollect(func(ctx context.Context) {
+		if count, err := sessionRepo.CountActive(ctx); err == nil {
+			ActiveSessions.Set(float64(count))
+		}
+	})
+}
+
+// CollectOutputDir measures the output directory on every scrape
+func CollectOutputDir(dir string) {
+	Default.OnCollect(func(ctx context.Context) {
+		var size, files int64
+		filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+				files++
+			}
+			return nil
+		})
+		OutputBytes.Set(float64(size))
+		OutputFiles.Set(float64(files))
+	})
+}
+
+// TokenFromEnv returns the bearer token required to scrape /metrics, none when METRICS_TOKEN is empty
+func TokenFromEnv() string {
+	return os.Getenv("METRICS_TOKEN")
+}
+
+// Serve serves /metrics of the default registry on addr until ctx is done.
+// Used by the worker, which has no HTTP server of its own.
+func Serve(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Default.Handler(TokenFromEnv()))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.Info().Str("address", addr).Msg("Serving metrics")
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error().Err(err).Str("address", addr).Msg("Metrics server failed")
+	}
+}
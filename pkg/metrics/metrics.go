@@ -0,0 +1,299 @@
+// Package metrics exposes counters, gauges and histograms in the Prometheus text format.
+// It implements only what DataLane needs, without pulling in the Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the content type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// collectTimeout bounds the collectors run on each scrape
+const collectTimeout = 5 * time.Second
+
+// Registry holds metric families and the collectors refreshing them on scrape
+type Registry struct {
+	mu         sync.Mutex
+	families   []*family
+	collectors []func(ctx context.Context)
+}
+
+// Default is the registry the package level constructors register with
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// OnCollect registers fn to run before every scrape, e.g. to set gauges from the database
+func (r *Registry) OnCollect(fn func(ctx context.Context)) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, fn)
+	r.mu.Unlock()
+}
+
+// Write runs the collectors and writes all metrics in the Prometheus text format
+func (r *Registry) Write(ctx context.Context, w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]func(ctx context.Context){}, r.collectors...)
+	families := append([]*family{}, r.families...)
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, collectTimeout)
+	defer cancel()
+	for _, collect := range collectors {
+		collect(ctx)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry over net/http. When token is set, requests must send it as a bearer token.
+func (r *Registry) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !Authorized(req.Header.Get("Authorization"), token) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		r.Write(req.Context(), w)
+	})
+}
+
+// Authorized checks an Authorization header against the metrics token. Any request is allowed without a token.
+func Authorized(header, token string) bool {
+	if token == "" {
+		return true
+	}
+	given := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	r.families = append(r.families, f)
+	r.mu.Unlock()
+	return f
+}
+
+// family is a metric with all its label combinations
+type family struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or histogram
+	labels  []string
+	buckets []float64 // Upper bounds of histogram buckets, ascending
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string // Label values
+	value  float64  // Counter and gauge value, histogram sum
+	counts []uint64 // Histogram observations per bucket, not cumulative
+	count  uint64   // Histogram observations
+}
+
+// get returns the series of the label values, creating it on first use
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string{}, values...)}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(s.values, ""), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.values, formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.values, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelString(s.values, ""), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelString(s.values, ""), s.count)
+	}
+}
+
+// labelString formats the labels of a sample, adding le for histogram buckets
+func (f *family) labelString(values []string, le string) string {
+	if len(values) == 0 && le == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range f.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	if le != "" {
+		if len(values) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "le=\"%s\"", le)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Counter is a value that only goes up, e.g. the number of failed tasks
+type Counter struct{ f *family }
+
+// NewCounter registers a counter with the default registry
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewCounter registers a counter with the registry
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(newFamily(name, help, "counter", labels, nil))}
+}
+
+// Inc adds one to the counter of the label values
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds v to the counter of the label values
+func (c *Counter) Add(v float64, labels ...string) {
+	c.f.mu.Lock()
+	c.f.get(labels).value += v
+	c.f.mu.Unlock()
+}
+
+// Gauge is a value that goes up and down, e.g. the size of a file
+type Gauge struct{ f *family }
+
+// NewGauge registers a gauge with the default registry
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewGauge registers a gauge with the registry
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(newFamily(name, help, "gauge", labels, nil))}
+}
+
+// Set sets the gauge of the label values
+func (g *Gauge) Set(v float64, labels ...string) {
+	g.f.mu.Lock()
+	g.f.get(labels).value = v
+	g.f.mu.Unlock()
+}
+
+// Add adds v, which may be negative, to the gauge of the label values
+func (g *Gauge) Add(v float64, labels ...string) {
+	g.f.mu.Lock()
+	g.f.get(labels).value += v
+	g.f.mu.Unlock()
+}
+
+// Histogram counts observations in buckets, e.g. task durations
+type Histogram struct{ f *family }
+
+// NewHistogram registers a histogram with the default registry.
+// Buckets are the upper bounds of the buckets, ascending; +Inf is added automatically.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// NewHistogram registers a histogram with the registry
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r.register(newFamily(name, help, "histogram", labels, buckets))}
+}
+
+// Observe records v for the label values
+func (h *Histogram) Observe(v float64, labels ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+
+	s := h.f.get(labels)
+	s.value += v
+	s.count++
+	for i, bound := range h.f.buckets {
+		if v <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+}
+
+// ObserveDuration records the time passed since start in seconds
+func (h *Histogram) ObserveDuration(start time.Time, labels ...string) {
+	h.Observe(time.Since(start).Seconds(), labels...)
+}
+
+func newFamily(name, help, kind string, labels []string, buckets []float64) *family {
+	return &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,68 @@
+package metrics_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/pkg/metrics"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	registry := metrics.NewRegistry()
+	requests := registry.NewCounter("http_requests_total", "Requests.", "method", "route")
+	queued := registry.NewGauge("tasks", "Tasks by status.", "status")
+	duration := registry.NewHistogram("duration_seconds", "Duration.", []float64{1, 5})
+
+	registry.OnCollect(func(ctx context.Context) {
+		queued.Set(3, "queued")
+	})
+	requests.Inc("GET", "/api/tasks/:id")
+	requests.Add(2, "GET", "/api/tasks/:id")
+	requests.Inc("POST", `/say "hi"`)
+	duration.Observe(0.5)
+	duration.Observe(3)
+	duration.Observe(10)
+
+	var out strings.Builder
+	assert.NoError(t, registry.Write(context.Background(), &out))
+	assert.Equal(t, `# HELP http_requests_total Requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/api/tasks/:id"} 3
+http_requests_total{method="POST",route="/say \"hi\""} 1
+# HELP tasks Tasks by status.
+# TYPE tasks gauge
+tasks{status="queued"} 3
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="1"} 1
+duration_seconds_bucket{le="5"} 2
+duration_seconds_bucket{le="+Inf"} 3
+duration_seconds_sum 13.5
+duration_seconds_count 3
+`, out.String())
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.NewGauge("up", "Up.").Set(1)
+	handler := registry.Handler("secret")
+
+	for header, status := range map[string]int{"": 401, "Bearer wrong": 401, "Bearer secret": 200} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, status, rec.Code, header)
+		if status == http.StatusOK {
+			assert.Equal(t, metrics.ContentType, rec.Header().Get("Content-Type"))
+			assert.Contains(t, rec.Body.String(), "up 1\n")
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package progress
+
+import (
+	"sync"
+
+	"pdf_generator/internal/core/ports"
+)
+
+// subscriberBuffer is the number of events a slow subscriber may lag behind before older ones are dropped
+const subscriberBuffer = 16
+
+// Hub fans out progress events received from workers to SSE subscribers in the API process
+type Hub struct {
+	mu     sync.RWMutex
+	latest map[string]ports.ProgressEvent
+	subs   map[string]map[chan ports.ProgressEvent]struct{}
+}
+
+// NewHub creates a new progress hub
+func NewHub() *Hub {
+	return &Hub{
+		latest: make(map[string]ports.ProgressEvent),
+		subs:   make(map[string]map[chan ports.ProgressEvent]struct{}),
+	}
+}
+
+// Publish stores the event as the latest state of its task and delivers it to subscribers
+func (h *Hub) Publish(event ports.ProgressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Finished tasks are served from the database, only live progress is kept
+	if event.Status.IsTerminal() {
+		delete(h.latest, event.TaskID)
+	} else {
+		h.latest[event.TaskID] = event
+	}
+
+	for ch := range h.subs[event.TaskID] {
+		select {
+		case ch <- event:
+		default:
+			// Drop the oldest event so the subscriber always ends with the newest state
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
+
+// Subscribe returns a channel receiving events of the task and a function to unsubscribe
+func (h *Hub) Subscribe(taskID string) (<-chan ports.ProgressEvent, func()) {
+	ch := make(chan ports.ProgressEvent, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subs[taskID] == nil {
+		h.subs[taskID] = make(map[chan ports.ProgressEvent]struct{})
+	}
+	h.subs[taskID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs[taskID], ch)
+			if len(h.subs[taskID]) == 0 {
+				delete(h.subs, taskID)
+			}
+			h.mu.Unlock()
+		})
+	}
+}
+
+// Latest returns the most recent live progress of the task, if any
+func (h *Hub) Latest(taskID string) *ports.ProgressEvent {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if event, ok := h.latest[taskID]; ok {
+		return &event
+	}
+	return nil
+}
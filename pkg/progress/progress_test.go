@@ -0,0 +1,154 @@
+package progress_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/progress"
+)
+
+func TestHub_PublishSubscribe(t *testing.T) {
+	hub := progress.NewHub()
+
+	events, unsubscribe := hub.Subscribe("task-1")
+	defer unsubscribe()
+
+	hub.Publish(ports.ProgressEvent{TaskID: "task-2", Status: domain.TaskStatusRunning, Stage: "Other"})
+	hub.Publish(ports.ProgressEvent{TaskID: "task-1", Status: domain.TaskStatusRunning, Stage: "Loading", Current: 1, Total: 10})
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, "Loading", ev.Stage)
+	case <-time.After(time.Second):
+		t.Fatal("event not delivered")
+	}
+
+	latest := hub.Latest("task-1")
+	assert.NotNil(t, latest)
+	assert.Equal(t, 1, latest.Current)
+
+	// Terminal events are delivered but not kept as live progress
+	hub.Publish(ports.ProgressEvent{TaskID: "task-1", Status: domain.TaskStatusCompleted})
+	ev := <-events
+	assert.Equal(t, domain.TaskStatusCompleted, ev.Status)
+	assert.Nil(t, hub.Latest("task-1"))
+}
+
+func TestHub_SlowSubscriberKeepsNewest(t *testing.T) {
+	hub := progress.NewHub()
+	events, unsubscribe := hub.Subscribe("task-1")
+
+	for i := 1; i <= 100; i++ {
+		hub.Publish(ports.ProgressEvent{TaskID: "task-1", Status: domain.TaskStatusRunning, Current: i})
+	}
+
+	var last ports.ProgressEvent
+	for len(events) > 0 {
+		last = <-events
+	}
+	assert.Equal(t, 100, last.Current)
+
+	unsubscribe()
+	unsubscribe() // Safe to call twice
+	hub.Publish(ports.ProgressEvent{TaskID: "task-1", Status: domain.TaskStatusRunning})
+	assert.Len(t, events, 0)
+}
+
+func TestReporter_SignsAndCoalesces(t *testing.T) {
+	received := make(chan ports.ProgressEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !progress.Verify(body, r.Header.Get(progress.TimestampHeader), r.Header.Get("X-Signature"), "secret", time.Now()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var ev ports.ProgressEvent
+		json.Unmarshal(body, &ev)
+		received <- ev
+	}))
+	defer server.Close()
+
+	reporter := progress.NewReporter(server.URL+progress.EndpointPath, "secret")
+
+	// Published before Run starts, so only the newest event per task is sent
+	reporter.Publish(ports.ProgressEvent{TaskID: "task-1", Status: domain.TaskStatusRunning, Current: 1})
+	reporter.Publish(ports.ProgressEvent{TaskID: "task-1", Status: domain.TaskStatusRunning, Current: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reporter.Run(ctx)
+
+	select {
+	case ev := <-received:
+		assert.Equal(t, 2, ev.Current)
+		assert.False(t, ev.Time.IsZero())
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not sent")
+	}
+
+	select {
+	case ev := <-received:
+		t.Fatalf("unexpected extra event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestReporter_WithoutSecret(t *testing.T) {
+	sent := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent <- struct{}{}
+	}))
+	defer server.Close()
+
+	reporter := progress.NewReporter(server.URL+progress.EndpointPath, "")
+	reporter.Publish(ports.ProgressEvent{TaskID: "task-1", Status: domain.TaskStatusRunning})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reporter.Run(ctx)
+
+	select {
+	case <-sent:
+		t.Fatal("progress sent without a secret")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"task_id":"task-1"}`)
+	now := time.Now()
+	signedAt := now.Add(-time.Minute).Unix()
+	signature := progress.Sign(body, signedAt, "secret")
+	timestamp := strconv.FormatInt(signedAt, 10)
+
+	assert.True(t, progress.Verify(body, timestamp, signature, "secret", now))
+	assert.False(t, progress.Verify(body, timestamp, signature, "other", now))
+	assert.False(t, progress.Verify([]byte(`{"task_id":"task-2"}`), timestamp, signature, "secret", now))
+	assert.False(t, progress.Verify(body, "", signature, "secret", now))
+
+	// The timestamp is signed, so it can not be moved to replay the request later
+	assert.False(t, progress.Verify(body, strconv.FormatInt(now.Unix(), 10), signature, "secret", now))
+	assert.False(t, progress.Verify(body, timestamp, signature, "secret", now.Add(progress.SignatureWindow)))
+
+	// Without a secret nothing is valid, not even a signature made with an empty key
+	assert.False(t, progress.Verify(body, timestamp, progress.Sign(body, signedAt, ""), "", now))
+}
+
+func TestEndpointFromEnv(t *testing.T) {
+	t.Setenv("API_URL", "")
+	t.Setenv("SERVER_URL", "0.0.0.0:3110")
+	assert.Equal(t, "http://127.0.0.1:3110/api/internal/progress", progress.EndpointFromEnv())
+
+	t.Setenv("API_URL", "https://pdf.example.com/")
+	assert.Equal(t, "https://pdf.example.com/api/internal/progress", progress.EndpointFromEnv())
+}
@@ -0,0 +1,181 @@
+package progress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/utils"
+)
+
+// EndpointPath is the API route receiving progress events from workers
+const EndpointPath = "/api/internal/progress"
+
+// TimestampHeader carries the Unix time a progress request was signed at, it is part of the signature
+const TimestampHeader = "X-Timestamp"
+
+// SignatureWindow is how far the signing time of a progress request may be from the clock of the API
+const SignatureWindow = 5 * time.Minute
+
+// sendInterval limits how often a reporter posts to the API; events in between are coalesced per task
+const sendInterval = 250 * time.Millisecond
+
+// Reporter pushes progress events from the worker process to the API.
+// Publish never blocks task processing: events are coalesced per task and sent in the background
+type Reporter struct {
+	endpoint string
+	secret   string
+	client   *http.Client
+
+	mu      sync.Mutex
+	pending map[string]ports.ProgressEvent
+	notify  chan struct{}
+}
+
+// NewReporter creates a reporter posting to the given API endpoint, signing bodies with secret.
+// Without a secret nothing is sent, the API refuses unsigned progress
+func NewReporter(endpoint, secret string) *Reporter {
+	return &Reporter{
+		endpoint: endpoint,
+		secret:   secret,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		pending:  make(map[string]ports.ProgressEvent),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Publish queues the event, replacing an unsent event of the same task
+func (r *Reporter) Publish(event ports.ProgressEvent) {
+	if r.secret == "" {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	r.mu.Lock()
+	r.pending[event.TaskID] = event
+	r.mu.Unlock()
+
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends queued events until ctx is done
+func (r *Reporter) Run(ctx context.Context) {
+	if r.secret == "" {
+		log.Warn().Msg("WORKER_SECRET is not set, live progress is not pushed to the API")
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.notify:
+		}
+
+		r.mu.Lock()
+		events := make([]ports.ProgressEvent, 0, len(r.pending))
+		for _, event := range r.pending {
+			events = append(events, event)
+		}
+		r.pending = make(map[string]ports.ProgressEvent)
+		r.mu.Unlock()
+
+		for _, event := range events {
+			// Progress is best effort, the database stays the source of truth
+			if err := r.send(ctx, event); err != nil {
+				log.Debug().Err(err).Str("task_id", event.TaskID).Msg("Failed to push progress to API")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sendInterval):
+		}
+	}
+}
+
+func (r *Reporter) send(ctx context.Context, event ports.ProgressEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	timestamp := time.Now().Unix()
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Signature", Sign(body, timestamp, r.secret))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature of a progress request body signed at timestamp
+func Sign(body []byte, timestamp int64, secret string) string {
+	return utils.GenerateHMAC(strconv.FormatInt(timestamp, 10)+"."+string(body), secret)
+}
+
+// Verify checks the signature of a progress request and that it was signed within SignatureWindow of now.
+// Nothing is valid without a secret
+func Verify(body []byte, timestamp, signature, secret string, now time.Time) bool {
+	if secret == "" {
+		return false
+	}
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > SignatureWindow || age < -SignatureWindow {
+		return false
+	}
+	return utils.VerifyHMAC(strconv.FormatInt(signedAt, 10)+"."+string(body), signature, secret)
+}
+
+// EndpointFromEnv builds the progress endpoint from API_URL, falling back to SERVER_URL
+func EndpointFromEnv() string {
+	return BaseURLFromEnv() + EndpointPath
+}
+
+// BaseURLFromEnv returns the API base URL from API_URL, falling back to SERVER_URL
+func BaseURLFromEnv() string {
+	base := os.Getenv("API_URL")
+	if base == "" {
+		base = os.Getenv("SERVER_URL")
+	}
+	if base == "" {
+		base = "localhost:3110"
+	}
+	if !strings.HasPrefix(base, "http://") && !strings.HasPrefix(base, "https://") {
+		base = "http://" + base
+	}
+	// The API may listen on all interfaces, but the worker reaches it locally
+	base = strings.Replace(base, "://0.0.0.0", "://127.0.0.1", 1)
+
+	return strings.TrimRight(base, "/")
+}
@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikestefanello/backlite"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/pkg/generator"
+	"pdf_generator/pkg/mailer"
+	"pdf_generator/pkg/utils"
+)
+
+const (
+	// emailQueueName is the backlite queue name of report emails
+	emailQueueName = "send_email"
+
+	// maxEmailAttempts is how often a report email is sent before it is failed
+	maxEmailAttempts = 5
+
+	// emailBackoff is the wait before the second attempt, doubled for every further attempt
+	emailBackoff = time.Minute
+
+	// defaultAttachmentMaxMB is used when email_attachment_max_mb is not set
+	defaultAttachmentMaxMB = 10
+)
+
+// EmailTask is the backlite job sending the report email of a task
+type EmailTask struct {
+	TaskID string `json:"task_id"`
+}
+
+// Config returns the backlite task configuration. SMTP failures are retried by scheduling a
+// new job with exponential backoff; backlite retries only cover errors of the task update.
+func (t EmailTask) Config() backlite.QueueConfig {
+	return backlite.QueueConfig{
+		Name:        emailQueueName,
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		Timeout:     5 * time.Minute,
+	}
+}
+
+// queueEmail schedules the report email of a completed task that has recipients
+func (q *Queue) queueEmail(ctx context.Context, task *domain.Task) {
+	if task.Status != domain.TaskStatusCompleted || task.Email == nil || len(task.Email.To) == 0 || task.EmailStatus != "" {
+		return
+	}
+
+	task.EmailStatus = domain.EmailStatusPending
+	if err := q.taskRepo.Update(ctx, task); err != nil {
+		log.Error().Err(err).Str("task_id", task.ID).Msg("Failed to record report email")
+		return
+	}
+	q.enqueueEmail(task.ID, time.Now())
+}
+
+// enqueueEmail schedules a report email attempt
+func (q *Queue) enqueueEmail(taskID string, at time.Time) error {
+	_, err := q.currentClient().Add(EmailTask{TaskID: taskID}).At(at).Save()
+	if err != nil {
+		log.Error().Err(err).Str("task_id", taskID).Msg("Failed to enqueue report email")
+	}
+	return err
+}
+
+// handleEmail sends the report email and schedules the next attempt on failure
+func (q *Queue) handleEmail(ctx context.Context, t EmailTask) error {
+	task, err := q.taskRepo.GetByID(ctx, t.TaskID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if task.EmailStatus != domain.EmailStatusPending || task.Email == nil {
+		return nil
+	}
+
+	task.EmailAttempts++
+	sendErr := q.sendReport(ctx, task)
+
+	retry := false
+	switch {
+	case sendErr == nil:
+		now := time.Now()
+		task.EmailStatus = domain.EmailStatusSent
+		task.EmailSentAt = &now
+		task.EmailError = ""
+	case errors.Is(sendErr, mailer.ErrNotConfigured) || task.Status != domain.TaskStatusCompleted || task.EmailAttempts >= maxEmailAttempts:
+		task.EmailStatus = domain.EmailStatusFailed
+		task.EmailError = sendErr.Error()
+	default:
+		task.EmailError = sendErr.Error()
+		retry = true
+	}
+
+	if err := q.taskRepo.Update(ctx, task); err != nil {
+		return err
+	}
+	if retry {
+		log.Warn().Err(sendErr).Str("task_id", task.ID).Int("attempt", task.EmailAttempts).Msg("Report email failed, retrying")
+		return q.enqueueEmail(task.ID, time.Now().Add(emailBackoff<<(task.EmailAttempts-1)))
+	}
+	if sendErr != nil {
+		log.Error().Err(sendErr).Str("task_id", task.ID).Msg("Report email failed")
+	} else {
+		log.Info().Str("task_id", task.ID).Strs("to", task.Email.To).Msg("Report email sent")
+	}
+	return nil
+}
+
+// sendReport emails the output of the task
+func (q *Queue) sendReport(ctx context.Context, task *domain.Task) error {
+	if task.Status != domain.TaskStatusCompleted {
+		return errors.New("report is no longer available")
+	}
+	cfg, err := mailer.LoadConfig(ctx, q.settingsRepo)
+	if err != nil {
+		return err
+	}
+	msg, err := q.reportMessage(ctx, task)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, cfg, msg)
+}
+
+// reportMessage renders the email of a task. Files are attached unless together they
+// exceed email_attachment_max_mb, then a download link is added to the body instead.
+func (q *Queue) reportMessage(ctx context.Context, task *domain.Task) (mailer.Message, error) {
+	setting := func(key string) string {
+		if s, err := q.settingsRepo.Get(ctx, key); err == nil && s != nil {
+			return s.Value
+		}
+		return ""
+	}
+
+	subject, body := task.Email.Subject, task.Email.Body
+	if subject == "" {
+		subject = setting(domain.SettingEmailSubjectTemplate)
+	}
+	if body == "" {
+		body = setting(domain.SettingEmailBodyTemplate)
+	}
+	params := generator.ReportPathParams(task.Metadata())
+
+	msg := mailer.Message{
+		To:      task.Email.To,
+		Cc:      task.Email.Cc,
+		Subject: utils.FormatPath(subject, params),
+		Body:    utils.FormatPath(body, params),
+	}
+
+	var files []string
+	for _, path := range strings.Split(task.OutputFilePath, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			files = append(files, outputPath(path))
+		}
+	}
+	if len(files) == 0 {
+		return msg, errors.New("task has no output files")
+	}
+
+	maxMB, err := strconv.Atoi(setting(domain.SettingEmailAttachmentMaxMB))
+	if err != nil || maxMB < 0 {
+		maxMB = defaultAttachmentMaxMB
+	}
+	if task.OutputFileSize <= int64(maxMB)*1024*1024 {
+		msg.Attachments = files
+		return msg, nil
+	}
+
+	link := strings.TrimRight(setting(domain.SettingPublicURL), "/") + "/api/tasks/" + task.ID + "/download"
+	msg.Body += fmt.Sprintf("\r\n\r\nThe report is too large to attach (%.1f MB). Download it from:\r\n%s\r\n",
+		float64(task.OutputFileSize)/1024/1024, link)
+	return msg, nil
+}
+
+// outputPath resolves a stored output path the same way downloads do
+func outputPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join("output", path)
+}
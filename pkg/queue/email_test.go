@@ -0,0 +1,111 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/pkg/mailer/mailertest"
+)
+
+func TestQueue_ReportEmail(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, err := mailertest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	db, taskRepo, q := newReconcileQueue(t, "email", map[string]string{
+		domain.SettingWorkerMode:           string(domain.WorkerModeRemote), // Emails are sent by the standby loop of Watch
+		domain.SettingSMTPHost:             server.Host(),
+		domain.SettingSMTPPort:             strconv.Itoa(server.Port()),
+		domain.SettingSMTPTLS:              string(domain.SMTPTLSNone),
+		domain.SettingSMTPFrom:             "noreply@example.com",
+		domain.SettingEmailSubjectTemplate: "Report {BranchID}-{GateID} {Date}",
+		domain.SettingEmailAttachmentMaxMB: "1",
+		domain.SettingPublicURL:            "https://datalane.example.com/",
+	})
+	sqlDB, _ := db.DB()
+
+	output := filepath.Join(t.TempDir(), "01_02_20251215.pdf")
+	assert.NoError(t, os.WriteFile(output, []byte("%PDF-1.4"), 0644))
+
+	complete := func(size int64) *domain.Task {
+		task := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+		task.BranchID = 1
+		task.GateID = 2
+		task.Filters = &domain.TaskFilter{Date: "2025-12-15"}
+		task.Email = &domain.EmailRequest{To: []string{"head@example.com"}, Body: "Gate {GateID}"}
+		assert.NoError(t, taskRepo.Update(ctx, task))
+
+		_, err := q.Lease(ctx, "worker-a", "", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, q.CompleteLease(ctx, task.ID, "worker-a", "", output, size))
+		task, _ = taskRepo.GetByID(ctx, task.ID)
+		assert.Equal(t, domain.EmailStatusPending, task.EmailStatus)
+		return task
+	}
+
+	server.FailNext(1)
+	small := complete(8)
+
+	q.Start(ctx)
+	go q.Watch(ctx, 20*time.Millisecond)
+
+	// The failed attempt is recorded and scheduled again
+	var task *domain.Task
+	assert.Eventually(t, func() bool {
+		task, err = taskRepo.GetByID(ctx, small.ID)
+		return err == nil && task.EmailAttempts == 1
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Equal(t, domain.EmailStatusPending, task.EmailStatus)
+	assert.NotEmpty(t, task.EmailError)
+
+	_, err = sqlDB.Exec("UPDATE backlite_tasks SET wait_until = 0 WHERE queue = 'send_email'")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		task, err = taskRepo.GetByID(ctx, small.ID)
+		return err == nil && task.EmailStatus == domain.EmailStatusSent
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.NotNil(t, task.EmailSentAt)
+	assert.Empty(t, task.EmailError)
+
+	// Reports above the attachment limit are linked instead
+	large := complete(2 * 1024 * 1024)
+	assert.Eventually(t, func() bool {
+		task, err = taskRepo.GetByID(ctx, large.ID)
+		return err == nil && task.EmailStatus == domain.EmailStatusSent
+	}, 2*time.Second, 20*time.Millisecond)
+
+	messages := server.Messages()
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, []string{"head@example.com"}, messages[0].To)
+		assert.Contains(t, messages[0].Data, "Subject: Report 01-02 20251215")
+		assert.Contains(t, messages[0].Data, "filename=01_02_20251215.pdf")
+
+		assert.NotContains(t, messages[1].Data, "filename=")
+		assert.Contains(t, decodeBody(t, messages[1].Data), "https://datalane.example.com/api/tasks/"+large.ID+"/download")
+		assert.Contains(t, decodeBody(t, messages[1].Data), "Gate 02")
+	}
+}
+
+// decodeBody returns the text of a single part message
+func decodeBody(t *testing.T, data string) string {
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	body, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, msg.Body))
+	return string(body)
+}
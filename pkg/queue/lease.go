@@ -0,0 +1,329 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+)
+
+// leaseCandidates limits how many ready jobs are inspected per lease request
+const leaseCandidates = 20
+
+// leaseCandidate is a backlite job that may be handed to a remote worker
+type leaseCandidate struct {
+	id        string
+	payload   []byte
+	attempts  int
+	claimedAt sql.NullInt64
+}
+
+// Lease claims the next ready job for a remote worker. The job is held until ttl elapses
+// unless the worker renews it, reporting with the same API key. Returns nil when no job is
+// ready or the queue is paused.
+func (q *Queue) Lease(ctx context.Context, workerID, apiKeyID string, ttl time.Duration) (*ports.Lease, error) {
+	if control, err := q.controlRepo.Get(ctx); err == nil && control.Paused {
+		return nil, nil
+	}
+
+	// Leases are only granted by the API process, so a mutex is enough to serialize claims
+	q.leaseMu.Lock()
+	defer q.leaseMu.Unlock()
+
+	now := time.Now()
+	rows, err := q.db.QueryContext(ctx, `SELECT id, task, attempts, claimed_at FROM backlite_tasks
+		WHERE queue = ? AND (wait_until IS NULL OR wait_until <= ?) AND (claimed_at IS NULL OR claimed_at < ?)
+		ORDER BY wait_until, id LIMIT ?`,
+		pdfQueueName, now.UnixMilli(), now.Add(-ttl).UnixMilli(), leaseCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []leaseCandidate
+	for rows.Next() {
+		var job leaseCandidate
+		if err := rows.Scan(&job.id, &job.payload, &job.attempts, &job.claimedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, job := range jobs {
+		lease, err := q.claim(ctx, job, workerID, apiKeyID, now, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if lease != nil {
+			return lease, nil
+		}
+	}
+	return nil, nil
+}
+
+// claim hands a single job to the worker, returning nil when the job cannot be leased
+func (q *Queue) claim(ctx context.Context, job leaseCandidate, workerID, apiKeyID string, now time.Time, ttl time.Duration) (*ports.Lease, error) {
+	var payload PDFTask
+	if err := json.Unmarshal(job.payload, &payload); err != nil {
+		log.Warn().Err(err).Str("job_id", job.id).Msg("Skipping job with invalid payload")
+		return nil, nil
+	}
+
+	task, err := q.taskRepo.GetByID(ctx, payload.TaskID)
+	if err != nil {
+		return nil, nil
+	}
+
+	if job.claimedAt.Valid {
+		// A claim is only taken over once the remote lease expired, or once backlite would release it too
+		leaseExpired := task.LeaseExpiresAt != nil && task.LeaseExpiresAt.Before(now)
+		if !leaseExpired && job.claimedAt.Int64 >= now.Add(-releaseAfter).UnixMilli() {
+			return nil, nil
+		}
+		if job.attempts >= q.retryPolicy(ctx).attempts {
+			log.Warn().Str("task_id", task.ID).Str("worker_id", task.WorkerID).Msg("Lease expired on last attempt")
+			return nil, q.failLeased(ctx, task, job.id, domain.TaskErrorLeaseExpired, "worker lease expired")
+		}
+	}
+
+	switch {
+	case task.Status == domain.TaskStatusCancelled && !job.claimedAt.Valid:
+		_, err := q.db.ExecContext(ctx, "DELETE FROM backlite_tasks WHERE id = ? AND claimed_at IS NULL", job.id)
+		return nil, err
+	case task.Status.IsTerminal():
+		return nil, nil
+	}
+
+	res, err := q.db.ExecContext(ctx,
+		"UPDATE backlite_tasks SET claimed_at = ?, attempts = attempts + 1, last_executed_at = ? WHERE id = ? AND claimed_at IS ?",
+		now.UnixMilli(), now.UnixMilli(), job.id, job.claimedAt)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+
+	expiresAt := now.Add(ttl)
+	task.Status = domain.TaskStatusRunning
+	task.WorkerID = workerID
+	task.LeaseExpiresAt = &expiresAt
+	task.LeaseAPIKeyID = apiKeyID
+	if err := q.taskRepo.Update(ctx, task); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("task_id", task.ID).Str("worker_id", workerID).Int("attempt", job.attempts+1).Msg("Task leased to remote worker")
+	return &ports.Lease{
+		TaskID:    task.ID,
+		JobID:     job.id,
+		Attempt:   job.attempts + 1,
+		Metadata:  payload.Metadata,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// RenewLease extends the lease of a task held by the worker and returns the new expiry
+func (q *Queue) RenewLease(ctx context.Context, taskID, workerID, apiKeyID string, ttl time.Duration) (time.Time, error) {
+	task, err := q.leasedTask(ctx, taskID, workerID, apiKeyID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	res, err := q.db.ExecContext(ctx,
+		"UPDATE backlite_tasks SET claimed_at = ? WHERE id = ? AND claimed_at IS NOT NULL", now.UnixMilli(), task.JobID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return time.Time{}, ports.ErrLeaseLost
+	}
+
+	expiresAt := now.Add(ttl)
+	task.LeaseExpiresAt = &expiresAt
+	if err := q.taskRepo.Update(ctx, task); err != nil {
+		return time.Time{}, err
+	}
+	return expiresAt, nil
+}
+
+// CompleteLease records the output of a leased task and removes its job
+func (q *Queue) CompleteLease(ctx context.Context, taskID, workerID, apiKeyID, output string, size int64) error {
+	task, err := q.leasedTask(ctx, taskID, workerID, apiKeyID)
+	if err != nil {
+		return err
+	}
+
+	// Successful jobs are not retained, matching the backlite queue config
+	if _, err := q.db.ExecContext(ctx, "DELETE FROM backlite_tasks WHERE id = ?", task.JobID); err != nil {
+		return err
+	}
+
+	task.Status = domain.TaskStatusCompleted
+	task.OutputFilePath = output
+	task.OutputFileSize = size
+	task.ProgressStage = "Completed"
+	task.LeaseExpiresAt = nil
+	if err := q.taskRepo.Update(ctx, task); err != nil {
+		return err
+	}
+	q.NotifyTask(ctx, task)
+
+	log.Info().Str("task_id", task.ID).Str("worker_id", workerID).Str("output", output).Msg("Remote worker completed task")
+	return nil
+}
+
+// FailLease records a failed attempt of a leased task. The job is retried after the retry
+// backoff while attempts are left and the error is not permanent, otherwise the task is failed.
+// Returns the new task status.
+func (q *Queue) FailLease(ctx context.Context, taskID, workerID, apiKeyID string, code domain.TaskErrorCode, errMsg string) (domain.TaskStatus, error) {
+	task, err := q.leasedTask(ctx, taskID, workerID, apiKeyID)
+	if err != nil {
+		return "", err
+	}
+
+	policy := q.retryPolicy(ctx)
+	attempts := policy.attempts
+	err = q.db.QueryRowContext(ctx, "SELECT attempts FROM backlite_tasks WHERE id = ?", task.JobID).Scan(&attempts)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	if code.Permanent() || attempts >= policy.attempts {
+		return domain.TaskStatusFailed, q.failLeased(ctx, task, task.JobID, code, errMsg)
+	}
+
+	now := time.Now()
+	_, err = q.db.ExecContext(ctx,
+		"UPDATE backlite_tasks SET claimed_at = NULL, wait_until = ?, last_executed_at = ? WHERE id = ?",
+		now.Add(policy.backoff).UnixMilli(), now.UnixMilli(), task.JobID)
+	if err != nil {
+		return "", err
+	}
+
+	task.Status = domain.TaskStatusQueued
+	task.ErrorMessage = errMsg
+	task.ErrorCode = code
+	task.LeaseExpiresAt = nil
+	if err := q.taskRepo.Update(ctx, task); err != nil {
+		return "", err
+	}
+	return task.Status, nil
+}
+
+// failLeased fails the job and the task
+func (q *Queue) failLeased(ctx context.Context, task *domain.Task, jobID string, code domain.TaskErrorCode, errMsg string) error {
+	if err := q.failJob(ctx, jobID, errMsg); err != nil {
+		return err
+	}
+
+	task.Status = domain.TaskStatusFailed
+	task.ErrorMessage = errMsg
+	task.ErrorCode = code
+	task.LeaseExpiresAt = nil
+	if err := q.taskRepo.Update(ctx, task); err != nil {
+		return err
+	}
+	q.NotifyTask(ctx, task)
+	return nil
+}
+
+// failJob moves the job to the completed table as failed, the same way backlite
+// retains failed jobs
+func (q *Queue) failJob(ctx context.Context, jobID, errMsg string) error {
+	now := time.Now()
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO backlite_tasks_completed
+		(id, created_at, queue, last_executed_at, attempts, last_duration_micro, succeeded, expires_at, error)
+		SELECT id, created_at, queue, last_executed_at, attempts, (? - COALESCE(last_executed_at, ?)) * 1000, 0, ?, ?
+		FROM backlite_tasks WHERE id = ?`,
+		now.UnixMilli(), now.UnixMilli(), now.Add(PDFTask{}.Config().Retention.Duration).UnixMilli(), errMsg, jobID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM backlite_tasks WHERE id = ?", jobID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// leasedTask returns the task if its lease is still held by the worker, reporting with the
+// API key the lease was granted to
+func (q *Queue) leasedTask(ctx context.Context, taskID, workerID, apiKeyID string) (*domain.Task, error) {
+	task, err := q.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != domain.TaskStatusRunning || task.WorkerID != workerID || task.LeaseAPIKeyID != apiKeyID || task.LeaseExpiresAt == nil {
+		return nil, ports.ErrLeaseLost
+	}
+	return task, nil
+}
+
+// releaseClaims releases the claims of jobs left behind by a crashed local worker,
+// including webhook deliveries. Jobs leased to remote workers keep their claim while
+// the lease is valid.
+func (q *Queue) releaseClaims(ctx context.Context) (int, error) {
+	rows, err := q.db.QueryContext(ctx, "SELECT id FROM backlite_tasks WHERE claimed_at IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+	var jobIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		jobIDs = append(jobIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(jobIDs) == 0 {
+		return 0, nil
+	}
+
+	tasks, err := q.taskRepo.ListByJobIDs(ctx, jobIDs)
+	if err != nil {
+		return 0, err
+	}
+	leased := make(map[string]bool)
+	now := time.Now()
+	for _, task := range tasks {
+		if task.LeaseExpiresAt != nil && task.LeaseExpiresAt.After(now) {
+			leased[task.JobID] = true
+		}
+	}
+
+	released := 0
+	for _, id := range jobIDs {
+		if leased[id] {
+			continue
+		}
+		res, err := q.db.ExecContext(ctx, "UPDATE backlite_tasks SET claimed_at = NULL WHERE id = ?", id)
+		if err != nil {
+			return released, err
+		}
+		n, _ := res.RowsAffected()
+		released += int(n)
+	}
+	return released, nil
+}
@@ -0,0 +1,184 @@
+package queue_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+)
+
+func TestQueue_LeaseLifecycle(t *testing.T) {
+	ctx := context.Background()
+	db, taskRepo, q := newReconcileQueue(t, "lease", nil)
+	sqlDB, _ := db.DB()
+
+	first := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+	second := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+
+	// Jobs are leased in dispatch order, each only once
+	lease, err := q.Lease(ctx, "worker-a", "", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID, lease.TaskID)
+	assert.Equal(t, 1, lease.Attempt)
+	assert.Equal(t, first.StationID, lease.Metadata.StationID)
+
+	task, _ := taskRepo.GetByID(ctx, first.ID)
+	assert.Equal(t, domain.TaskStatusRunning, task.Status)
+	assert.Equal(t, "worker-a", task.WorkerID)
+	assert.NotNil(t, task.LeaseExpiresAt)
+
+	other, err := q.Lease(ctx, "worker-b", "", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, second.ID, other.TaskID)
+
+	empty, err := q.Lease(ctx, "worker-b", "", time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, empty)
+
+	// Only the holder may renew or report
+	_, err = q.RenewLease(ctx, first.ID, "worker-b", "", time.Minute)
+	assert.ErrorIs(t, err, ports.ErrLeaseLost)
+	expiresAt, err := q.RenewLease(ctx, first.ID, "worker-a", "", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, expiresAt.After(time.Now()))
+
+	// A failed attempt goes back to the queue with a backoff
+	status, err := q.FailLease(ctx, second.ID, "worker-b", "", domain.TaskErrorFileLocked, "archive unavailable")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusQueued, status)
+	task, _ = taskRepo.GetByID(ctx, second.ID)
+	assert.Equal(t, "archive unavailable", task.ErrorMessage)
+	assert.Equal(t, domain.TaskErrorFileLocked, task.ErrorCode)
+	assert.Nil(t, task.LeaseExpiresAt)
+	empty, _ = q.Lease(ctx, "worker-b", "", time.Minute)
+	assert.Nil(t, empty, "retry must wait for the backoff")
+
+	// Completion removes the job and records the output
+	assert.NoError(t, q.CompleteLease(ctx, first.ID, "worker-a", "", "/out/a.pdf", 1234))
+	task, _ = taskRepo.GetByID(ctx, first.ID)
+	assert.Equal(t, domain.TaskStatusCompleted, task.Status)
+	assert.Equal(t, "/out/a.pdf", task.OutputFilePath)
+	assert.Equal(t, int64(1234), task.OutputFileSize)
+	var jobs int
+	assert.NoError(t, sqlDB.QueryRow("SELECT COUNT(*) FROM backlite_tasks WHERE id = ?", first.JobID).Scan(&jobs))
+	assert.Equal(t, 0, jobs)
+
+	assert.ErrorIs(t, q.CompleteLease(ctx, first.ID, "worker-a", "", "/out/a.pdf", 1), ports.ErrLeaseLost)
+}
+
+func TestQueue_LeaseAPIKey(t *testing.T) {
+	ctx := context.Background()
+	_, taskRepo, q := newReconcileQueue(t, "lease_key", nil)
+
+	task := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+	_, err := q.Lease(ctx, "worker-a", "key-a", time.Minute)
+	assert.NoError(t, err)
+
+	// Another API key reporting with the worker ID of the holder is refused
+	_, err = q.RenewLease(ctx, task.ID, "worker-a", "key-b", time.Minute)
+	assert.ErrorIs(t, err, ports.ErrLeaseLost)
+	assert.ErrorIs(t, q.CompleteLease(ctx, task.ID, "worker-a", "key-b", "/out/a.pdf", 1), ports.ErrLeaseLost)
+	_, err = q.FailLease(ctx, task.ID, "worker-a", "key-b", domain.TaskErrorFileLocked, "file already in use")
+	assert.ErrorIs(t, err, ports.ErrLeaseLost)
+
+	_, err = q.RenewLease(ctx, task.ID, "worker-a", "key-a", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, q.CompleteLease(ctx, task.ID, "worker-a", "key-a", "/out/a.pdf", 1))
+}
+
+func TestQueue_LeaseExpiry(t *testing.T) {
+	ctx := context.Background()
+	db, taskRepo, q := newReconcileQueue(t, "lease_expiry", nil)
+	sqlDB, _ := db.DB()
+
+	task := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+	_, err := q.Lease(ctx, "worker-a", "", time.Minute)
+	assert.NoError(t, err)
+
+	// A valid lease survives the startup reconciliation of a local worker
+	report, err := q.Reconcile(ctx, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.ReleasedClaims)
+
+	// The worker disappears and its lease expires
+	expire := func() {
+		past := time.Now().Add(-time.Minute)
+		assert.NoError(t, db.Model(&domain.Task{}).Where("id = ?", task.ID).UpdateColumn("lease_expires_at", past).Error)
+		_, err := sqlDB.Exec("UPDATE backlite_tasks SET claimed_at = ? WHERE id = ?", past.Add(-time.Minute).UnixMilli(), task.JobID)
+		assert.NoError(t, err)
+	}
+	expire()
+
+	lease, err := q.Lease(ctx, "worker-b", "", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, task.ID, lease.TaskID)
+	assert.Equal(t, 2, lease.Attempt)
+
+	_, err = q.RenewLease(ctx, task.ID, "worker-a", "", time.Minute)
+	assert.ErrorIs(t, err, ports.ErrLeaseLost)
+
+	// An expired lease on the last attempt fails the task
+	_, err = sqlDB.Exec("UPDATE backlite_tasks SET attempts = 3 WHERE id = ?", task.JobID)
+	assert.NoError(t, err)
+	expire()
+
+	lease, err = q.Lease(ctx, "worker-c", "", time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, lease)
+
+	current, _ := taskRepo.GetByID(ctx, task.ID)
+	assert.Equal(t, domain.TaskStatusFailed, current.Status)
+	assert.Equal(t, domain.TaskErrorLeaseExpired, current.ErrorCode)
+	var errMsg string
+	assert.NoError(t, sqlDB.QueryRow("SELECT error FROM backlite_tasks_completed WHERE id = ?", task.JobID).Scan(&errMsg))
+	assert.Equal(t, "worker lease expired", errMsg)
+}
+
+func TestQueue_LeaseRetryPolicy(t *testing.T) {
+	ctx := context.Background()
+	db, taskRepo, q := newReconcileQueue(t, "lease_retry", map[string]string{
+		domain.SettingTaskMaxAttempts:      "2",
+		domain.SettingTaskRetryBackoffSecs: "0",
+	})
+	sqlDB, _ := db.DB()
+
+	completed := func(jobID string) (attempts int) {
+		assert.NoError(t, sqlDB.QueryRow("SELECT attempts FROM backlite_tasks_completed WHERE id = ?", jobID).Scan(&attempts))
+		return attempts
+	}
+
+	// Transient errors are retried without a backoff until the configured attempts are used
+	locked := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+	for attempt := 1; attempt <= 2; attempt++ {
+		lease, err := q.Lease(ctx, "worker-a", "", time.Minute)
+		assert.NoError(t, err)
+		if assert.NotNil(t, lease) {
+			assert.Equal(t, attempt, lease.Attempt)
+		}
+		status, err := q.FailLease(ctx, locked.ID, "worker-a", "", domain.TaskErrorFileLocked, "file already in use")
+		assert.NoError(t, err)
+		if attempt < 2 {
+			assert.Equal(t, domain.TaskStatusQueued, status)
+		} else {
+			assert.Equal(t, domain.TaskStatusFailed, status)
+		}
+	}
+	assert.Equal(t, 2, completed(locked.JobID))
+
+	// Permanent errors fail on the first attempt
+	missing := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+	_, err := q.Lease(ctx, "worker-a", "", time.Minute)
+	assert.NoError(t, err)
+	status, err := q.FailLease(ctx, missing.ID, "worker-a", "", domain.TaskErrorDataSourceMissing, "data source file not found")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusFailed, status)
+	assert.Equal(t, 1, completed(missing.JobID))
+
+	task, _ := taskRepo.GetByID(ctx, missing.ID)
+	assert.Equal(t, domain.TaskErrorDataSourceMissing, task.ErrorCode)
+	assert.Nil(t, task.LeaseExpiresAt)
+}
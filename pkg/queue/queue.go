@@ -2,9 +2,12 @@ package queue
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mikestefanello/backlite"
@@ -16,28 +19,96 @@ import (
 	"pdf_generator/pkg/generator"
 )
 
-// PDFTask represents the task data for PDF generation
+// PDFTask is the backlite payload of a PDF job
 type PDFTask struct {
 	TaskID   string              `json:"task_id"`
 	Metadata domain.TaskMetadata `json:"metadata"`
 }
 
-// Config returns the backlite task configuration
+const (
+	// pdfQueueName is the backlite queue name of PDF generation jobs
+	pdfQueueName = "generate_pdf"
+
+	// defaultMaxAttempts is how many times a job runs before it is failed, unless the
+	// task_max_attempts setting says otherwise
+	defaultMaxAttempts = 3
+
+	// maxAttemptsLimit caps the task_max_attempts setting
+	maxAttemptsLimit = 10
+
+	// defaultRetryBackoff is how long a failed job waits before it runs again, unless
+	// the task_retry_backoff_seconds setting says otherwise
+	defaultRetryBackoff = 5 * time.Second
+
+	// releaseAfter is when backlite considers a claimed job abandoned and runs it again
+	releaseAfter = 30 * time.Minute
+
+	// pdfJobTimeout caps an attempt of a PDF job below releaseAfter. The generator derives
+	// a shorter budget from the transactions of a date, and large dates resume after the
+	// chunks rendered so far on the next attempt.
+	pdfJobTimeout = 25 * time.Minute
+
+	// reorderGap is the gap (milliseconds) left between tasks renumbered to make room for a moved task
+	reorderGap = 16
+)
+
+// Config returns the backlite task configuration. The attempts and backoff are
+// defaults, clients apply the configuration of the PDF job type when they are created.
 func (t PDFTask) Config() backlite.QueueConfig {
 	return backlite.QueueConfig{
-		Name:        "generate_pdf",
-		MaxAttempts: 3,
-		Backoff:     5 * time.Second,
-		Timeout:     10 * time.Minute,
+		Name:        pdfQueueName,
+		MaxAttempts: defaultMaxAttempts,
+		Backoff:     defaultRetryBackoff,
+		Timeout:     pdfJobTimeout,
+		// Failed jobs are kept so reconciliation can copy their last error to the task
+		Retention: &backlite.Retention{
+			Duration:   7 * 24 * time.Hour,
+			OnlyFailed: true,
+		},
 	}
 }
 
 // Queue wraps the backlite queue
 type Queue struct {
-	client       *backlite.Client
+	db           *sql.DB
 	taskRepo     ports.TaskRepository
 	settingsRepo ports.SettingsRepository
-	gateRepo     ports.GateRepository
+	controlRepo  ports.QueueControlRepository
+
+	// Settings and gate names of the reports, reloaded after they changed
+	resources *generator.Resources
+
+	// The backlite client is replaced when the worker pool is resized or resumed,
+	// since its worker count is fixed for the lifetime of a client
+	clientMu  sync.RWMutex
+	client    *backlite.Client
+	workers   int
+	policy    retryPolicy
+	consumers bool
+	state     domain.QueueState
+	runCtx    context.Context
+	running   atomic.Int32
+
+	// Tasks executing in this process, skipped by reconciliation
+	active sync.Map
+
+	// Set while a standby pass runs notification jobs, see startStandby
+	standby atomic.Bool
+
+	// Registered job types, see RegisterJobType
+	jobTypes map[domain.TaskType]*jobType
+
+	// Serializes job claims made for remote workers
+	leaseMu sync.Mutex
+
+	// Registry ID of this worker process, recorded on processed tasks
+	workerID string
+
+	// Optional receiver of live progress, e.g. a reporter pushing to the API
+	publisher ports.ProgressPublisher
+
+	// Webhooks notified of final task states, none are sent when unset
+	webhookRepo ports.WebhookRepository
 
 	// Progress tracking for SSE
 	progressMu sync.RWMutex
@@ -45,68 +116,289 @@ type Queue struct {
 }
 
 // NewQueue creates a new queue instance
-func NewQueue(db *gorm.DB, taskRepo ports.TaskRepository, settingsRepo ports.SettingsRepository, gateRepo ports.GateRepository) (*Queue, error) {
-	// Get concurrency from settings
+func NewQueue(db *gorm.DB, taskRepo ports.TaskRepository, settingsRepo ports.SettingsRepository, gateRepo ports.GateRepository, controlRepo ports.QueueControlRepository) (*Queue, error) {
+	// Get generic database object for backlite
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		db:           sqlDB,
+		taskRepo:     taskRepo,
+		settingsRepo: settingsRepo,
+		controlRepo:  controlRepo,
+		resources:    generator.NewResources(settingsRepo, gateRepo),
+		state:        domain.QueueStateRunning,
+		jobTypes:     make(map[domain.TaskType]*jobType),
+		progress:     make(map[string]*ports.TaskProgress),
+	}
+	RegisterJobType(q, JobType[domain.TaskMetadata]{
+		Type:    domain.TaskTypePDF,
+		Queue:   pdfQueueName,
+		Timeout: pdfJobTimeout,
+		Handle:  q.generatePDF,
+	})
+
+	q.workers = q.concurrency(context.Background())
+	q.policy = q.retryPolicy(context.Background())
+	client, err := q.newClient(q.workers, q.policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure queue tables exist
+	if err := client.Install(); err != nil {
+		return nil, err
+	}
+	q.client = client
+
+	return q, nil
+}
+
+// concurrency reads the worker pool size from settings
+func (q *Queue) concurrency(ctx context.Context) int {
 	concurrency := 1
-	setting, err := settingsRepo.Get(context.Background(), domain.SettingQueueConcurrency)
+	setting, err := q.settingsRepo.Get(ctx, domain.SettingQueueConcurrency)
 	if err == nil && setting != nil {
 		if val, _ := strconv.Atoi(setting.Value); val > 0 {
 			concurrency = val
 		}
 	}
+	return concurrency
+}
 
-	// Get generic database object for backlite
-	sqlDB, err := db.DB()
-	if err != nil {
-		return nil, err
+// retryPolicy is how often and after what delay failed jobs run again
+type retryPolicy struct {
+	attempts int
+	backoff  time.Duration
+}
+
+// retryPolicy reads the retry policy from settings
+func (q *Queue) retryPolicy(ctx context.Context) retryPolicy {
+	policy := retryPolicy{attempts: defaultMaxAttempts, backoff: defaultRetryBackoff}
+	setting, err := q.settingsRepo.Get(ctx, domain.SettingTaskMaxAttempts)
+	if err == nil && setting != nil {
+		if val, _ := strconv.Atoi(setting.Value); val > 0 {
+			policy.attempts = min(val, maxAttemptsLimit)
+		}
+	}
+	setting, err = q.settingsRepo.Get(ctx, domain.SettingTaskRetryBackoffSecs)
+	if err == nil && setting != nil {
+		if val, err := strconv.Atoi(setting.Value); err == nil && val >= 0 {
+			policy.backoff = time.Duration(val) * time.Second
+		}
 	}
+	return policy
+}
 
+// newClient creates a backlite client with the given number of workers and retry policy
+func (q *Queue) newClient(workers int, policy retryPolicy) (*backlite.Client, error) {
 	client, err := backlite.NewClient(backlite.ClientConfig{
-		DB:              sqlDB,
+		DB:              q.db,
 		Logger:          &BackliteLogger{},
-		NumWorkers:      concurrency,
-		ReleaseAfter:    30 * time.Minute,
+		NumWorkers:      workers,
+		ReleaseAfter:    releaseAfter,
 		CleanupInterval: 1 * time.Hour,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Ensure queue tables exist
-	if err := client.Install(); err != nil {
-		return nil, err
-	}
-
-	q := &Queue{
-		client:       client,
-		taskRepo:     taskRepo,
-		settingsRepo: settingsRepo,
-		gateRepo:     gateRepo,
-		progress:     make(map[string]*ports.TaskProgress),
+	if q.consumers {
+		for _, queue := range q.jobQueues(policy) {
+			client.Register(queue)
+		}
+		client.Register(backlite.NewQueue(q.handleWebhook))
+		client.Register(backlite.NewQueue(q.handleEmail))
 	}
+	return client, nil
+}
 
-	return q, nil
+// currentClient returns the active backlite client
+func (q *Queue) currentClient() *backlite.Client {
+	q.clientMu.RLock()
+	defer q.clientMu.RUnlock()
+	return q.client
 }
 
 // RegisterConsumers registers the task handlers for the queue consumers
 func (q *Queue) RegisterConsumers() {
-	// Register task handler
-	pdfQueue := backlite.NewQueue(q.handlePDFTask)
-	q.client.Register(pdfQueue)
+	q.clientMu.Lock()
+	defer q.clientMu.Unlock()
+
+	// Register the handlers of all job types
+	q.consumers = true
+	for _, queue := range q.jobQueues(q.policy) {
+		q.client.Register(queue)
+	}
+
+	// The dispatcher claims jobs of all queues, so notifications are always
+	// consumed here, even when this process has no webhook repository
+	q.client.Register(backlite.NewQueue(q.handleWebhook))
+	q.client.Register(backlite.NewQueue(q.handleEmail))
 }
 
-// Enqueue adds a task to the queue
+// Enqueue adds a PDF task to the queue, ordered by its priority
 func (q *Queue) Enqueue(ctx context.Context, taskID string, metadata domain.TaskMetadata) ([]string, error) {
 	task := PDFTask{
 		TaskID:   taskID,
 		Metadata: metadata,
 	}
-	return q.client.Add(task).Save()
+	return q.add(ctx, taskID, task, metadata.Priority)
+}
+
+// add adds the job of a task to its backlite queue, ordered by the priority
+func (q *Queue) add(ctx context.Context, taskID string, job backlite.Task, priority domain.TaskPriority) ([]string, error) {
+	// Backlite dispatches by wait_until, so the dispatch order doubles as a
+	// (past) wait time that is immediately eligible
+	priority = priority.OrDefault()
+	order := domain.QueueOrder(priority, time.Now())
+
+	ids, err := q.currentClient().Add(job).At(time.UnixMilli(order)).Save()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) > 0 {
+		if err := q.taskRepo.UpdateDispatch(ctx, taskID, ids[0], priority, order); err != nil {
+			log.Warn().Err(err).Str("task_id", taskID).Msg("Failed to record dispatch order")
+		}
+	}
+
+	return ids, nil
+}
+
+// SetPriority changes the priority of a queued task, placing it after the
+// tasks of the new priority that were created before it
+func (q *Queue) SetPriority(ctx context.Context, taskID string, priority domain.TaskPriority) error {
+	task, err := q.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	return q.reorder(ctx, task, priority, domain.QueueOrder(priority, task.CreatedAt))
+}
+
+// Move places a queued task at the given 1-based position in dispatch order
+func (q *Queue) Move(ctx context.Context, taskID string, position int) error {
+	task, err := q.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	queued, err := q.taskRepo.ListQueued(ctx)
+	if err != nil {
+		return err
+	}
+
+	others := make([]domain.Task, 0, len(queued))
+	for _, t := range queued {
+		if t.ID != task.ID {
+			others = append(others, t)
+		}
+	}
+
+	order, ok := orderAtPosition(others, position, task.QueueOrder)
+	if !ok {
+		// The neighbours are adjacent, the tasks after the position make room first
+		q.spreadOrders(ctx, others, position-1)
+		order, _ = orderAtPosition(others, position, task.QueueOrder)
+	}
+	return q.reorder(ctx, task, task.Priority, order)
+}
+
+// spreadOrders renumbers the queued tasks from index start on, until the gap to the previous
+// task is at least reorderGap again. Tasks that were claimed meanwhile are left as they are.
+func (q *Queue) spreadOrders(ctx context.Context, queued []domain.Task, start int) {
+	for i := max(start, 1); i < len(queued); i++ {
+		order := queued[i-1].QueueOrder + reorderGap
+		if queued[i].QueueOrder >= order {
+			return
+		}
+		if err := q.reorder(ctx, &queued[i], queued[i].Priority, order); err != nil && !errors.Is(err, ports.ErrTaskNotQueued) {
+			log.Warn().Err(err).Str("task_id", queued[i].ID).Msg("Failed to renumber queued task")
+		}
+		queued[i].QueueOrder = order
+	}
+}
+
+// reorder updates the dispatch order of a task that has not been claimed yet
+func (q *Queue) reorder(ctx context.Context, task *domain.Task, priority domain.TaskPriority, order int64) error {
+	if task.Status != domain.TaskStatusQueued || task.JobID == "" {
+		return ports.ErrTaskNotQueued
+	}
+
+	res, err := q.db.ExecContext(ctx,
+		"UPDATE backlite_tasks SET wait_until = ? WHERE id = ? AND claimed_at IS NULL",
+		order, task.JobID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ports.ErrTaskNotQueued
+	}
+
+	return q.taskRepo.UpdateDispatch(ctx, task.ID, "", priority, order)
+}
+
+// orderAtPosition returns a dispatch order that sorts at the given 1-based
+// position among queued tasks (which must already be in dispatch order).
+// It reports false when the neighbours at the position leave no order between them.
+func orderAtPosition(queued []domain.Task, position int, current int64) (int64, bool) {
+	switch {
+	case len(queued) == 0:
+		return current, true
+	case position <= 1:
+		return queued[0].QueueOrder - 1, true
+	case position > len(queued):
+		return queued[len(queued)-1].QueueOrder + 1, true
+	}
+
+	before := queued[position-2].QueueOrder
+	after := queued[position-1].QueueOrder
+	if after-before < 2 {
+		return 0, false
+	}
+	return before + (after-before)/2, true
+}
+
+// restoreDispatchOrder puts delayed jobs back in dispatch order once they are due. Backlite
+// dispatches every queue by wait_until and delays retries, webhooks and emails to a real time,
+// which sorts behind all tasks whose order was pulled back by a priority band. Due tasks return
+// to their queue_order, due webhook and email jobs run ahead of the tasks.
+func (q *Queue) restoreDispatchOrder(ctx context.Context) {
+	now := time.Now()
+	_, err := q.db.ExecContext(ctx, `UPDATE backlite_tasks SET wait_until = NULL
+		WHERE queue IN (?, ?) AND claimed_at IS NULL AND wait_until <= ?`,
+		webhookQueueName, emailQueueName, now.UnixMilli())
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to restore the dispatch order of notifications")
+	}
+
+	// Orders after the current time of the normal band are real times: bulk tasks and delayed jobs
+	_, err = q.db.ExecContext(ctx, `UPDATE backlite_tasks
+		SET wait_until = (SELECT queue_order FROM tasks WHERE tasks.job_id = backlite_tasks.id)
+		WHERE claimed_at IS NULL AND wait_until <= ? AND wait_until > ?
+		AND EXISTS (SELECT 1 FROM tasks WHERE tasks.job_id = backlite_tasks.id AND tasks.queue_order <> backlite_tasks.wait_until)`,
+		now.UnixMilli(), domain.QueueOrder(domain.TaskPriorityNormal, now))
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to restore the dispatch order of retried tasks")
+	}
 }
 
 // Start starts the queue workers
 func (q *Queue) Start(ctx context.Context) {
-	q.client.Start(ctx)
+	remote := q.remoteMode(ctx)
+
+	q.clientMu.Lock()
+	q.runCtx = ctx
+	if remote {
+		// Stand by until the worker mode is switched back to local, see Watch
+		q.state = domain.QueueStatePaused
+	} else {
+		q.client.Start(ctx)
+	}
+	q.clientMu.Unlock()
 
 	// Periodically notify to ensure frequent polling (every 1s)
 	// This forces the workers to check for new tasks even if idle
@@ -118,12 +410,202 @@ func (q *Queue) Start(ctx context.Context) {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				q.client.Notify()
+				q.clientMu.RLock()
+				if q.state == domain.QueueStateRunning {
+					q.client.Notify()
+				}
+				q.clientMu.RUnlock()
 			}
 		}
 	}()
 }
 
+// SetWorkerID sets the registry ID recorded on tasks processed by this queue
+func (q *Queue) SetWorkerID(id string) {
+	q.workerID = id
+}
+
+// SetProgressPublisher sets where live progress and status changes are pushed
+func (q *Queue) SetProgressPublisher(publisher ports.ProgressPublisher) {
+	q.publisher = publisher
+}
+
+// SetWebhookRepository enables webhook notifications of final task states
+func (q *Queue) SetWebhookRepository(repo ports.WebhookRepository) {
+	q.webhookRepo = repo
+}
+
+// publish pushes a live update of the task when a publisher is set
+func (q *Queue) publish(event ports.ProgressEvent) {
+	if q.publisher == nil {
+		return
+	}
+	event.Time = time.Now()
+	q.publisher.Publish(event)
+}
+
+// Status returns the dispatch state, worker pool size and IDs of tasks executing in this process
+func (q *Queue) Status() (domain.QueueState, int, []string) {
+	q.clientMu.RLock()
+	state, workers := q.state, q.workers
+	q.clientMu.RUnlock()
+
+	taskIDs := []string{}
+	q.active.Range(func(key, _ any) bool {
+		taskIDs = append(taskIDs, key.(string))
+		return true
+	})
+	return state, workers, taskIDs
+}
+
+// Pause requests the worker service to stop dispatching new tasks
+func (q *Queue) Pause(ctx context.Context) (*domain.QueueControl, error) {
+	return q.controlRepo.SetPaused(ctx, true)
+}
+
+// Resume requests the worker service to dispatch tasks again
+func (q *Queue) Resume(ctx context.Context) (*domain.QueueControl, error) {
+	return q.controlRepo.SetPaused(ctx, false)
+}
+
+// Control returns the desired and reported queue state
+func (q *Queue) Control(ctx context.Context) (*domain.QueueControl, error) {
+	return q.controlRepo.Get(ctx)
+}
+
+// Watch applies changes to the queue_concurrency setting and the pause flag
+// without restarting the worker service. It must be called after Start and
+// blocks until ctx is done.
+func (q *Queue) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		q.reconcileControl(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcileControl brings the worker pool in line with the desired state and reports it
+func (q *Queue) reconcileControl(ctx context.Context) {
+	control, err := q.controlRepo.Get(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read queue control state")
+		return
+	}
+	workers := q.concurrency(ctx)
+	policy := q.retryPolicy(ctx)
+
+	// Remote workers lease jobs through the API, this process must not dispatch them too
+	remote := q.remoteMode(ctx)
+	paused := control.Paused || remote
+
+	q.clientMu.RLock()
+	state, current, currentPolicy := q.state, q.workers, q.policy
+	q.clientMu.RUnlock()
+
+	switch {
+	case paused && state == domain.QueueStateRunning:
+		q.setState(domain.QueueStatePausing)
+		q.report(ctx)
+		q.stopClient(ctx)
+		q.setState(domain.QueueStatePaused)
+		log.Info().Msg("Queue paused")
+
+	case !paused && state != domain.QueueStateRunning:
+		if err := q.startClient(workers, policy); err != nil {
+			log.Error().Err(err).Msg("Failed to resume queue")
+			break
+		}
+		log.Info().Int("workers", workers).Msg("Queue resumed")
+
+	case state == domain.QueueStateRunning && (workers != current || policy != currentPolicy):
+		// The new pool starts right away, running tasks finish on the old one in the background
+		old := q.currentClient()
+		if err := q.startClient(workers, policy); err != nil {
+			log.Error().Err(err).Msg("Failed to resize queue")
+			break
+		}
+		q.drainClient(ctx, old)
+		log.Info().Int("from", current).Int("to", workers).
+			Int("max_attempts", policy.attempts).Dur("retry_backoff", policy.backoff).
+			Msg("Queue worker pool resized")
+
+	case state != domain.QueueStateRunning:
+		// Applied on resume
+		q.clientMu.Lock()
+		q.workers = workers
+		q.policy = policy
+		q.clientMu.Unlock()
+	}
+
+	q.restoreDispatchOrder(ctx)
+	if remote && !control.Paused {
+		q.startStandby(ctx)
+	}
+
+	q.report(ctx)
+}
+
+// remoteMode checks if jobs are assigned to remote workers instead of this process
+func (q *Queue) remoteMode(ctx context.Context) bool {
+	setting, err := q.settingsRepo.Get(ctx, domain.SettingWorkerMode)
+	return err == nil && setting != nil && domain.WorkerMode(setting.Value) == domain.WorkerModeRemote
+}
+
+// stopClient gracefully stops the current client, waiting for running tasks to finish
+func (q *Queue) stopClient(ctx context.Context) {
+	if !q.currentClient().Stop(ctx) {
+		log.Warn().Msg("Queue stopped before running tasks finished")
+	}
+}
+
+// drainClient stops a replaced client in the background. It claims no new jobs, its
+// running tasks may take up to the job timeout to finish.
+func (q *Queue) drainClient(ctx context.Context, client *backlite.Client) {
+	go func() {
+		if !client.Stop(ctx) {
+			log.Warn().Msg("Queue stopped before tasks of the replaced worker pool finished")
+		}
+	}()
+}
+
+// startClient replaces the client with a new one of the given size and retry policy and starts it
+func (q *Queue) startClient(workers int, policy retryPolicy) error {
+	client, err := q.newClient(workers, policy)
+	if err != nil {
+		return err
+	}
+
+	q.clientMu.Lock()
+	defer q.clientMu.Unlock()
+	q.client = client
+	q.workers = workers
+	q.policy = policy
+	q.state = domain.QueueStateRunning
+	client.Start(q.runCtx)
+	return nil
+}
+
+func (q *Queue) setState(state domain.QueueState) {
+	q.clientMu.Lock()
+	q.state = state
+	q.clientMu.Unlock()
+}
+
+// report publishes the actual queue state for the API process
+func (q *Queue) report(ctx context.Context) {
+	state, workers, _ := q.Status()
+	if err := q.controlRepo.Report(ctx, state, workers, int(q.running.Load())); err != nil {
+		log.Warn().Err(err).Msg("Failed to report queue state")
+	}
+}
+
 // GetProgress returns the current progress for a task
 func (q *Queue) GetProgress(taskID string) *ports.TaskProgress {
 	q.progressMu.RLock()
@@ -140,6 +622,14 @@ func (q *Queue) setProgress(taskID, stage string, current, total int) {
 		Total:   total,
 	}
 	q.progressMu.Unlock()
+
+	q.publish(ports.ProgressEvent{
+		TaskID:  taskID,
+		Status:  domain.TaskStatusRunning,
+		Stage:   stage,
+		Current: current,
+		Total:   total,
+	})
 }
 
 // clearProgress removes progress tracking for a task
@@ -149,88 +639,74 @@ func (q *Queue) clearProgress(taskID string) {
 	q.progressMu.Unlock()
 }
 
-// handlePDFTask processes a PDF generation task
-func (q *Queue) handlePDFTask(ctx context.Context, task PDFTask) error {
-	log.Info().Str("task_id", task.TaskID).Msg("Processing PDF task")
-
-	// Update task status to running
-	dbTask, err := q.taskRepo.GetByID(ctx, task.TaskID)
-	if err != nil {
-		log.Error().Err(err).Str("task_id", task.TaskID).Msg("Task not found")
-		return err
+// recordFailure stores the error of a failed attempt and returns whether the job runs again.
+// The task goes back to queued while the job still has attempts left, and is failed once they
+// are exhausted or right away when the error is permanent.
+func (q *Queue) recordFailure(ctx context.Context, jobID, taskID string, maxAttempts int, code domain.TaskErrorCode, err error) bool {
+	retry := !code.Permanent() && q.retryPending(ctx, jobID, maxAttempts)
+	if updateErr := q.taskRepo.UpdateError(ctx, taskID, code, err.Error()); updateErr != nil {
+		log.Error().Err(updateErr).Str("task_id", taskID).Msg("Failed to update error in DB")
+		return retry
 	}
 
-	dbTask.Status = domain.TaskStatusRunning
-	if err := q.taskRepo.Update(ctx, dbTask); err != nil {
-		return err
-	}
+	event := ports.ProgressEvent{TaskID: taskID, Status: domain.TaskStatusFailed, ErrorMessage: err.Error(), ErrorCode: code}
+	defer func() { q.publish(event) }()
 
-	// Initialize progress tracking
-	q.setProgress(task.TaskID, "Initializing settings", 0, 0)
-
-	// Create a progress callback that:
-	// - Always updates in-memory progress immediately
-	// - Immediately updates DB when stage changes
-	// - Throttles DB updates to once per second when stage stays the same
-	var lastUpdate time.Time
-	var lastStage string
-	progressCallback := func(stage string, current, total int) {
-		// Always update in-memory progress immediately
-		q.setProgress(task.TaskID, stage, current, total)
-
-		now := time.Now()
-		stageChanged := stage != lastStage
-		
-		// Update DB immediately on stage change, or throttled (once per second) for same stage
-		if stageChanged || now.Sub(lastUpdate) >= time.Second {
-			lastUpdate = now
-			lastStage = stage
-			if err := q.taskRepo.UpdateProgress(ctx, task.TaskID, stage, current, total); err != nil {
-				log.Warn().Err(err).Str("task_id", task.TaskID).Msg("Failed to update progress in DB")
-			}
-		}
+	dbTask, getErr := q.taskRepo.GetByID(ctx, taskID)
+	if getErr != nil {
+		return retry
 	}
+	if !retry {
+		q.NotifyTask(ctx, dbTask)
+		return retry
+	}
+	dbTask.Status = domain.TaskStatusQueued
+	if updateErr := q.taskRepo.Update(ctx, dbTask); updateErr != nil {
+		log.Error().Err(updateErr).Str("task_id", taskID).Msg("Failed to requeue task for retry")
+		return retry
+	}
+	event.Status = domain.TaskStatusQueued
+	return retry
+}
 
-	// Generate PDF(s) with progress tracking
-	// Uses GenerateMultiDatePDF which handles both single-date and date-range scenarios
-	output, size, err := generator.GenerateMultiDatePDF(ctx, task.Metadata, q.settingsRepo, q.gateRepo, progressCallback)
-	if err != nil {
-		log.Error().Err(err).Str("task_id", task.TaskID).Msg("PDF generation failed")
-
-		// Update error message in database
-		if updateErr := q.taskRepo.UpdateError(ctx, task.TaskID, err.Error()); updateErr != nil {
-			log.Error().Err(updateErr).Str("task_id", task.TaskID).Msg("Failed to update error in DB")
-		}
-
-		q.clearProgress(task.TaskID)
-		return err
+// retryPending checks if backlite will run the job again after the current attempt,
+// given the attempts of the queue configuration backlite applies
+func (q *Queue) retryPending(ctx context.Context, jobID string, maxAttempts int) bool {
+	if jobID == "" {
+		return false
 	}
+	var attempts int
+	err := q.db.QueryRowContext(ctx, "SELECT attempts FROM backlite_tasks WHERE id = ?", jobID).Scan(&attempts)
+	return err == nil && attempts < maxAttempts
+}
 
-	// Re-fetch task to get latest progress values from DB
-	dbTask, err = q.taskRepo.GetByID(ctx, task.TaskID)
+// generatePDF is the handler of PDF jobs. Rendered chunks are recorded on the task, so
+// that a retry resumes after them.
+func (q *Queue) generatePDF(ctx context.Context, job Job[domain.TaskMetadata]) (JobResult, error) {
+	task, err := q.taskRepo.GetByID(ctx, job.TaskID)
 	if err != nil {
-		q.clearProgress(task.TaskID)
-		return err
+		return JobResult{}, err
 	}
-
-	// Update task with output - include final progress values from in-memory cache
-	finalProgress := q.GetProgress(task.TaskID)
-	dbTask.Status = domain.TaskStatusCompleted
-	dbTask.OutputFilePath = output
-	dbTask.OutputFileSize = size
-	dbTask.ProgressStage = "Completed"
-	if finalProgress != nil {
-		dbTask.ProgressTotal = finalProgress.Total
-		dbTask.ProgressCurrent = finalProgress.Current
+	snapshot, err := q.resources.Snapshot(ctx)
+	if err != nil {
+		return JobResult{}, err
 	}
-	if err := q.taskRepo.Update(ctx, dbTask); err != nil {
-		q.clearProgress(task.TaskID)
-		return err
+	checkpoint := &generator.Checkpoint{
+		Key:    task.ID,
+		Chunks: task.Chunks,
+		Save: func(ctx context.Context, chunk domain.TaskChunk) error {
+			return q.taskRepo.AddChunk(ctx, task.ID, chunk)
+		},
+		SaveSource: func(ctx context.Context, source domain.TaskSource) error {
+			return q.taskRepo.AddSource(ctx, task.ID, source)
+		},
 	}
 
-	q.clearProgress(task.TaskID)
-	log.Info().Str("task_id", task.TaskID).Str("output", output).Msg("PDF generated successfully")
-	return nil
+	// Uses GenerateMultiDatePDF which handles both single-date and date-range scenarios
+	metadata := job.Payload
+	metadata.TaskID = task.ID
+	output, size, err := generator.GenerateMultiDatePDF(ctx, metadata, snapshot, generator.ProgressCallback(job.Progress), checkpoint)
+	return JobResult{OutputPath: output, OutputSize: size}, err
 }
 
 // ParseTaskMetadata parses JSON metadata string
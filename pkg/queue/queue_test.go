@@ -2,15 +2,20 @@ package queue_test
 
 import (
 	"context"
+	"database/sql"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"gorm.io/gorm"
 
+	"pdf_generator/internal/adapters/repository"
 	"pdf_generator/internal/core/domain"
 	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/database"
 	"pdf_generator/pkg/queue"
 )
 
@@ -26,8 +31,16 @@ func (m *MockTaskRepo) Update(ctx context.Context, task *domain.Task) error
 func (m *MockTaskRepo) UpdateProgress(ctx context.Context, id string, stage string, current, total int) error {
 	return nil
 }
-func (m *MockTaskRepo) UpdateError(ctx context.Context, id string, errMsg string) error { return nil }
-func (m *MockTaskRepo) Delete(ctx context.Context, id string) error                     { return nil }
+func (m *MockTaskRepo) UpdateError(ctx context.Context, id string, code domain.TaskErrorCode, errMsg string) error {
+	return nil
+}
+func (m *MockTaskRepo) AddChunk(ctx context.Context, id string, chunk domain.TaskChunk) error {
+	return nil
+}
+func (m *MockTaskRepo) AddSource(ctx context.Context, id string, source domain.TaskSource) error {
+	return nil
+}
+func (m *MockTaskRepo) Delete(ctx context.Context, id string) error { return nil }
 func (m *MockTaskRepo) List(ctx context.Context, filter ports.TaskFilter) ([]domain.Task, int64, error) {
 	return nil, 0, nil
 }
@@ -38,6 +51,41 @@ func (m *MockTaskRepo) GetQueuePosition(ctx context.Context, id string) (int, er
 func (m *MockTaskRepo) FindExpiredCompleted(ctx context.Context, days int) ([]domain.Task, error) {
 	return nil, nil
 }
+func (m *MockTaskRepo) ListQueued(ctx context.Context) ([]domain.Task, error) { return nil, nil }
+func (m *MockTaskRepo) UpdateDispatch(ctx context.Context, id string, jobID string, priority domain.TaskPriority, order int64) error {
+	return nil
+}
+func (m *MockTaskRepo) FindByFingerprint(ctx context.Context, fingerprint string, completedSince time.Time) (*domain.Task, error) {
+	return nil, nil
+}
+func (m *MockTaskRepo) ListByStatus(ctx context.Context, statuses ...domain.TaskStatus) ([]domain.Task, error) {
+	return nil, nil
+}
+func (m *MockTaskRepo) ListByJobIDs(ctx context.Context, jobIDs []string) ([]domain.Task, error) {
+	return nil, nil
+}
+func (m *MockTaskRepo) ListOutputPaths(ctx context.Context) ([]string, error) { return nil, nil }
+func (m *MockTaskRepo) ListByParent(ctx context.Context, parentID string, statuses ...domain.TaskStatus) ([]domain.Task, error) {
+	return nil, nil
+}
+func (m *MockTaskRepo) CountByParent(ctx context.Context, parentIDs []string) (map[string]domain.BatchJobCounts, error) {
+	return nil, nil
+}
+func (m *MockTaskRepo) UsageByAPIKey(ctx context.Context, since time.Time, apiKeyIDs ...string) (map[string]domain.APIKeyUsage, error) {
+	return nil, nil
+}
+
+func (m *MockTaskRepo) ListEvents(ctx context.Context, taskID string) ([]domain.TaskEvent, error) {
+	return nil, nil
+}
+
+func (m *MockTaskRepo) ListTimings(ctx context.Context, from, to time.Time) ([]domain.Task, error) {
+	return nil, nil
+}
+
+func (m *MockTaskRepo) CountFinishedSince(ctx context.Context, since time.Time) (map[domain.TaskStatus]int64, error) {
+	return nil, nil
+}
 
 // We need to match the signature of List EXACTLY with ports definition, which I can't check easily without looking at ports.
 // Assuming ports.TaskFilter.
@@ -73,8 +121,7 @@ func (m *MockGateRepo) BatchDelete(ctx context.Context, ids []int) error
 
 func TestNewQueue(t *testing.T) {
 	// Setup in-memory SQLite DB for backlite
-	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
-	assert.NoError(t, err)
+	db := newTestDB(t, "new_queue")
 
 	taskRepo := new(MockTaskRepo)
 	settingsRepo := new(MockSettingsRepo)
@@ -82,8 +129,10 @@ func TestNewQueue(t *testing.T) {
 
 	// Mock settings call
 	settingsRepo.On("Get", mock.Anything, domain.SettingQueueConcurrency).Return(&domain.Settings{Value: "1"}, nil).Once()
+	settingsRepo.On("Get", mock.Anything, domain.SettingTaskMaxAttempts).Return(&domain.Settings{Value: "3"}, nil).Once()
+	settingsRepo.On("Get", mock.Anything, domain.SettingTaskRetryBackoffSecs).Return(nil, gorm.ErrRecordNotFound).Once()
 
-	q, err := queue.NewQueue(db, taskRepo, settingsRepo, gateRepo)
+	q, err := queue.NewQueue(db, taskRepo, settingsRepo, gateRepo, repository.NewQueueControlRepository(db))
 	assert.NoError(t, err)
 	assert.NotNil(t, q)
 
@@ -96,3 +145,226 @@ func TestPDFTask_Config(t *testing.T) {
 	assert.Equal(t, "generate_pdf", cfg.Name)
 	assert.Equal(t, 3, cfg.MaxAttempts)
 }
+
+// concurrencySettingsRepo serves a queue_concurrency value that can change while the queue watches it,
+// and optionally other settings
+// newTestDB opens an in-memory database with every model migrated. Tests use distinct names
+// because databases with the same name are shared.
+func newTestDB(t *testing.T, name string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(database.Models()...))
+	return db
+}
+
+type concurrencySettingsRepo struct {
+	mu     sync.Mutex
+	value  string
+	others map[string]string
+}
+
+func (r *concurrencySettingsRepo) set(value string) {
+	r.mu.Lock()
+	r.value = value
+	r.mu.Unlock()
+}
+func (r *concurrencySettingsRepo) Get(ctx context.Context, key string) (*domain.Settings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key == domain.SettingQueueConcurrency {
+		return &domain.Settings{Key: key, Value: r.value}, nil
+	}
+	if value, ok := r.others[key]; ok {
+		return &domain.Settings{Key: key, Value: value}, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+func (r *concurrencySettingsRepo) Set(ctx context.Context, setting *domain.Settings) error {
+	return nil
+}
+func (r *concurrencySettingsRepo) GetAll(ctx context.Context) ([]domain.Settings, error) {
+	return nil, nil
+}
+
+func TestQueue_WatchPauseResumeResize(t *testing.T) {
+	db := newTestDB(t, "watch")
+
+	controlRepo := repository.NewQueueControlRepository(db)
+	settingsRepo := &concurrencySettingsRepo{value: "1"}
+
+	q, err := queue.NewQueue(db, new(MockTaskRepo), settingsRepo, new(MockGateRepo), controlRepo)
+	assert.NoError(t, err)
+	q.RegisterConsumers()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx)
+	go q.Watch(ctx, 20*time.Millisecond)
+
+	waitFor := func(check func(c *domain.QueueControl) bool) {
+		assert.Eventually(t, func() bool {
+			c, err := q.Control(ctx)
+			return err == nil && check(c)
+		}, 2*time.Second, 20*time.Millisecond)
+	}
+
+	waitFor(func(c *domain.QueueControl) bool { return c.State == domain.QueueStateRunning && c.Workers == 1 })
+
+	control, err := q.Pause(ctx)
+	assert.NoError(t, err)
+	assert.True(t, control.Paused)
+	waitFor(func(c *domain.QueueControl) bool { return c.State == domain.QueueStatePaused })
+
+	// Resizing while paused is applied on resume
+	settingsRepo.set("3")
+	_, err = q.Resume(ctx)
+	assert.NoError(t, err)
+	waitFor(func(c *domain.QueueControl) bool { return c.State == domain.QueueStateRunning && c.Workers == 3 })
+
+	settingsRepo.set("2")
+	waitFor(func(c *domain.QueueControl) bool { return c.State == domain.QueueStateRunning && c.Workers == 2 })
+}
+
+func TestQueue_ResizeWhileTaskRuns(t *testing.T) {
+	db := newTestDB(t, "resize_running")
+	taskRepo := repository.NewTaskRepository(db)
+	settingsRepo := &concurrencySettingsRepo{value: "1"}
+	q, err := queue.NewQueue(db, taskRepo, settingsRepo, new(MockGateRepo), repository.NewQueueControlRepository(db))
+	assert.NoError(t, err)
+
+	// The job keeps its worker until it is released
+	started := make(chan struct{})
+	release := make(chan struct{})
+	queue.RegisterJobType(q, queue.JobType[exportPayload]{
+		Type: "slow",
+		Handle: func(ctx context.Context, job queue.Job[exportPayload]) (queue.JobResult, error) {
+			close(started)
+			<-release
+			return queue.JobResult{}, nil
+		},
+	})
+	q.RegisterConsumers()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	task := &domain.Task{Type: "slow"}
+	assert.NoError(t, q.Submit(ctx, task, exportPayload{}))
+	q.Start(ctx)
+	go q.Watch(ctx, 20*time.Millisecond)
+	<-started
+
+	// The new pool starts without waiting for the running task
+	settingsRepo.set("2")
+	assert.Eventually(t, func() bool {
+		c, err := q.Control(ctx)
+		return err == nil && c.State == domain.QueueStateRunning && c.Workers == 2 && c.Running == 1
+	}, 2*time.Second, 20*time.Millisecond)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		got, err := taskRepo.GetByID(ctx, task.ID)
+		return err == nil && got.Status == domain.TaskStatusCompleted
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestQueue_PermanentFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db, taskRepo, q := newReconcileQueue(t, "permanent_failure", nil)
+	sqlDB, _ := db.DB()
+	q.RegisterConsumers()
+
+	// The data source of the task does not exist, retrying can not help
+	task := &domain.Task{Status: domain.TaskStatusQueued, RootFolder: t.TempDir(), StationID: 1, Filters: &domain.TaskFilter{Date: "2024-02-05"}}
+	assert.NoError(t, taskRepo.Create(ctx, task))
+	_, err := q.Enqueue(ctx, task.ID, task.Metadata())
+	assert.NoError(t, err)
+	q.Start(ctx)
+
+	var got *domain.Task
+	assert.Eventually(t, func() bool {
+		got, err = taskRepo.GetByID(ctx, task.ID)
+		return err == nil && got.Status == domain.TaskStatusFailed
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, domain.TaskErrorDataSourceMissing, got.ErrorCode)
+	assert.Contains(t, got.ErrorMessage, "data source file not found")
+
+	var attempts int
+	assert.NoError(t, sqlDB.QueryRow("SELECT attempts FROM backlite_tasks_completed WHERE id = ?", got.JobID).Scan(&attempts))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestQueue_MoveBetweenAdjacentTasks(t *testing.T) {
+	ctx := context.Background()
+	db, taskRepo, q := newReconcileQueue(t, "move_adjacent", nil)
+	sqlDB, _ := db.DB()
+
+	// Orders one millisecond apart leave no room between the tasks
+	var tasks []*domain.Task
+	for i := range 3 {
+		task := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+		order := int64(1000 + i)
+		assert.NoError(t, taskRepo.UpdateDispatch(ctx, task.ID, "", domain.TaskPriorityNormal, order))
+		_, err := sqlDB.Exec("UPDATE backlite_tasks SET wait_until = ? WHERE id = ?", order, task.JobID)
+		assert.NoError(t, err)
+		tasks = append(tasks, task)
+	}
+
+	assert.NoError(t, q.Move(ctx, tasks[2].ID, 2))
+
+	queued, err := taskRepo.ListQueued(ctx)
+	assert.NoError(t, err)
+	var ids []string
+	for i, task := range queued {
+		ids = append(ids, task.ID)
+		if i > 0 {
+			assert.Greater(t, task.QueueOrder, queued[i-1].QueueOrder)
+		}
+	}
+	assert.Equal(t, []string{tasks[0].ID, tasks[2].ID, tasks[1].ID}, ids)
+
+	// Backlite dispatches in the same order
+	var jobs []string
+	rows, err := sqlDB.Query("SELECT id FROM backlite_tasks ORDER BY wait_until, id")
+	assert.NoError(t, err)
+	for rows.Next() {
+		var id string
+		assert.NoError(t, rows.Scan(&id))
+		jobs = append(jobs, id)
+	}
+	rows.Close()
+	assert.Equal(t, []string{tasks[0].JobID, tasks[2].JobID, tasks[1].JobID}, jobs)
+}
+
+func TestQueue_RestoreDispatchOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db, taskRepo, q := newReconcileQueue(t, "restore_order", nil)
+	sqlDB, _ := db.DB()
+	_, err := q.Pause(ctx)
+	assert.NoError(t, err)
+
+	// A retry whose delay passed, and one still waiting
+	now := time.Now()
+	retried := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+	waiting := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+	_, err = sqlDB.Exec("UPDATE backlite_tasks SET wait_until = ? WHERE id = ?", now.Add(-time.Second).UnixMilli(), retried.JobID)
+	assert.NoError(t, err)
+	_, err = sqlDB.Exec("UPDATE backlite_tasks SET wait_until = ? WHERE id = ?", now.Add(time.Hour).UnixMilli(), waiting.JobID)
+	assert.NoError(t, err)
+	_, err = sqlDB.Exec("INSERT INTO backlite_tasks (id, created_at, queue, task, wait_until) VALUES ('hook', ?, 'webhook_delivery', x'7b7d', ?)",
+		now.UnixMilli(), now.Add(-time.Second).UnixMilli())
+	assert.NoError(t, err)
+
+	go q.Watch(ctx, 20*time.Millisecond)
+
+	waitUntil := func(id string) sql.NullInt64 {
+		var value sql.NullInt64
+		assert.NoError(t, sqlDB.QueryRow("SELECT wait_until FROM backlite_tasks WHERE id = ?", id).Scan(&value))
+		return value
+	}
+	assert.Eventually(t, func() bool {
+		return waitUntil(retried.JobID).Int64 == retried.QueueOrder && !waitUntil("hook").Valid
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Equal(t, now.Add(time.Hour).UnixMilli(), waitUntil(waiting.JobID).Int64)
+}
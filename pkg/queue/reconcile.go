@@ -0,0 +1,382 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/pkg/datasource"
+	"pdf_generator/pkg/generator"
+)
+
+const (
+	// lostJobGrace is how long a task must be unchanged before its missing job is considered lost,
+	// so that tasks completing while reconciliation runs are not enqueued twice
+	lostJobGrace = time.Minute
+
+	// orphanedOutputGrace is the minimum age of an unreferenced output file before it is removed.
+	// It is longer than the job timeout so files of a running multi-date task are never touched
+	orphanedOutputGrace = time.Hour
+
+	// partsRetention is how long the PDF parts of an unfinished task are kept for a retry to resume
+	partsRetention = 7 * 24 * time.Hour
+)
+
+// ReconcileReport summarizes the corrections made by Reconcile
+type ReconcileReport struct {
+	ReleasedClaims int `json:"released_claims"` // Claims left behind by a crashed worker
+	Requeued       int `json:"requeued"`        // Tasks set back to queued while their job waits for a retry
+	Reenqueued     int `json:"reenqueued"`      // Tasks whose job was lost and has been added again
+	Failed         int `json:"failed"`          // Tasks failed because their job exhausted its attempts
+	CancelledJobs  int `json:"cancelled_jobs"`  // Jobs removed because their task was cancelled
+	RemovedFiles   int `json:"removed_files"`   // Orphaned output files deleted
+	RemovedParts   int `json:"removed_parts"`   // PDF part directories of finished or lost tasks deleted
+}
+
+// Changed reports if reconciliation corrected anything
+func (r ReconcileReport) Changed() bool {
+	return r != ReconcileReport{}
+}
+
+// pendingJob is a row of backlite_tasks
+type pendingJob struct {
+	claimed bool
+}
+
+// Reconcile aligns the tasks table with the backlite job tables.
+// On startup, before the workers start, every claim not covered by a remote worker lease is a leftover
+// of a crashed worker and is released.
+func (q *Queue) Reconcile(ctx context.Context, startup bool) (ReconcileReport, error) {
+	var report ReconcileReport
+
+	if startup {
+		released, err := q.releaseClaims(ctx)
+		if err != nil {
+			return report, err
+		}
+		report.ReleasedClaims = released
+	}
+
+	pending, err := q.pendingJobs(ctx)
+	if err != nil {
+		return report, err
+	}
+	failed, err := q.failedJobs(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	// Tasks that should have a job: align their status with it
+	tasks, err := q.taskRepo.ListByStatus(ctx, domain.TaskStatusQueued, domain.TaskStatusPending, domain.TaskStatusRunning)
+	if err != nil {
+		return report, err
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		if task.JobID == "" || q.isActive(task.ID) {
+			continue
+		}
+
+		if job, ok := pending[task.JobID]; ok {
+			if task.Status == domain.TaskStatusRunning && !job.claimed {
+				task.Status = domain.TaskStatusQueued
+				if q.updateTask(ctx, task) {
+					report.Requeued++
+				}
+			}
+			continue
+		}
+
+		if errMsg, ok := failed[task.JobID]; ok {
+			task.Status = domain.TaskStatusFailed
+			if errMsg != "" {
+				task.ErrorMessage = errMsg
+			}
+			if task.ErrorCode == "" {
+				task.ErrorCode = domain.TaskErrorInternal
+			}
+			if q.updateTask(ctx, task) {
+				report.Failed++
+				q.NotifyTask(ctx, task)
+			}
+			continue
+		}
+
+		if q.requeueLost(ctx, task) {
+			report.Reenqueued++
+		}
+	}
+
+	// Jobs whose task already reached a final state
+	jobIDs := make([]string, 0, len(pending))
+	for id := range pending {
+		jobIDs = append(jobIDs, id)
+	}
+	tasks, err = q.taskRepo.ListByJobIDs(ctx, jobIDs)
+	if err != nil {
+		return report, err
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		job := pending[task.JobID]
+
+		switch task.Status {
+		case domain.TaskStatusFailed:
+			// A failed attempt that backlite will retry
+			task.Status = domain.TaskStatusQueued
+			if q.updateTask(ctx, task) {
+				report.Requeued++
+			}
+		case domain.TaskStatusCancelled:
+			if job.claimed {
+				continue
+			}
+			res, err := q.db.ExecContext(ctx,
+				"DELETE FROM backlite_tasks WHERE id = ? AND claimed_at IS NULL", task.JobID)
+			if err != nil {
+				log.Warn().Err(err).Str("task_id", task.ID).Msg("Failed to remove job of cancelled task")
+				continue
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				report.CancelledJobs++
+			}
+		}
+	}
+
+	if !startup {
+		removed, err := q.CleanupOrphanedOutputs(ctx, generator.DefaultOutputDir, orphanedOutputGrace)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to clean up orphaned output files")
+		}
+		report.RemovedFiles = removed
+
+		removed, err = q.CleanupParts(ctx, filepath.Join(generator.DefaultOutputDir, generator.PartsDir), orphanedOutputGrace)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to clean up PDF parts")
+		}
+		report.RemovedParts = removed
+	}
+
+	return report, nil
+}
+
+// requeueLost enqueues a task again when its job no longer exists in backlite
+func (q *Queue) requeueLost(ctx context.Context, task *domain.Task) bool {
+	if time.Since(task.UpdatedAt) < lostJobGrace {
+		return false
+	}
+
+	// Re-read to avoid racing a task that just completed
+	current, err := q.taskRepo.GetByID(ctx, task.ID)
+	if err != nil || current.JobID != task.JobID || current.Status.IsTerminal() {
+		return false
+	}
+
+	if _, err := q.EnqueueTask(ctx, current); err != nil {
+		log.Error().Err(err).Str("task_id", current.ID).Msg("Failed to enqueue task with lost job")
+		return false
+	}
+
+	current, err = q.taskRepo.GetByID(ctx, task.ID)
+	if err != nil {
+		return true
+	}
+	current.Status = domain.TaskStatusQueued
+	q.updateTask(ctx, current)
+	log.Warn().Str("task_id", current.ID).Str("lost_job_id", task.JobID).Msg("Task job was lost, enqueued again")
+	return true
+}
+
+// updateTask saves a reconciled task and logs failures
+func (q *Queue) updateTask(ctx context.Context, task *domain.Task) bool {
+	if err := q.taskRepo.Update(ctx, task); err != nil {
+		log.Warn().Err(err).Str("task_id", task.ID).Msg("Failed to reconcile task")
+		return false
+	}
+	log.Info().Str("task_id", task.ID).Str("status", string(task.Status)).Msg("Task reconciled")
+	return true
+}
+
+// isActive checks if the task is executing in this process
+func (q *Queue) isActive(taskID string) bool {
+	_, ok := q.active.Load(taskID)
+	return ok
+}
+
+// pendingJobs returns the jobs waiting or running in backlite, keyed by job ID.
+// Claims older than releaseAfter count as unclaimed since backlite will run them again
+func (q *Queue) pendingJobs(ctx context.Context) (map[string]pendingJob, error) {
+	rows, err := q.db.QueryContext(ctx,
+		"SELECT id, claimed_at FROM backlite_tasks WHERE queue = ?", pdfQueueName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	staleBefore := time.Now().Add(-releaseAfter).UnixMilli()
+	jobs := make(map[string]pendingJob)
+	for rows.Next() {
+		var id string
+		var claimedAt sql.NullInt64
+		if err := rows.Scan(&id, &claimedAt); err != nil {
+			return nil, err
+		}
+		jobs[id] = pendingJob{claimed: claimedAt.Valid && claimedAt.Int64 >= staleBefore}
+	}
+	return jobs, rows.Err()
+}
+
+// failedJobs returns the last error of jobs that exhausted their attempts, keyed by job ID
+func (q *Queue) failedJobs(ctx context.Context) (map[string]string, error) {
+	rows, err := q.db.QueryContext(ctx,
+		"SELECT id, error FROM backlite_tasks_completed WHERE queue = ? AND succeeded = 0", pdfQueueName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make(map[string]string)
+	for rows.Next() {
+		var id string
+		var errMsg sql.NullString
+		if err := rows.Scan(&id, &errMsg); err != nil {
+			return nil, err
+		}
+		jobs[id] = errMsg.String
+	}
+	return jobs, rows.Err()
+}
+
+// CleanupOrphanedOutputs removes PDF files in dir and in the task directories below it that no task
+// references and that are older than grace. Task directories left empty are removed as well.
+func (q *Queue) CleanupOrphanedOutputs(ctx context.Context, dir string, grace time.Duration) (int, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(absDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	paths, err := q.taskRepo.ListOutputPaths(ctx)
+	if err != nil {
+		return 0, err
+	}
+	referenced := make(map[string]struct{})
+	for _, joined := range paths {
+		// Multi-date tasks store comma-separated paths
+		for _, p := range strings.Split(joined, ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(absDir, p)
+			}
+			referenced[filepath.Clean(p)] = struct{}{}
+		}
+	}
+
+	cutoff := time.Now().Add(-grace)
+	removed := removeOrphanedPDFs(absDir, entries, referenced, cutoff)
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == generator.PartsDir || entry.Name() == generator.ArchiveCacheDir {
+			continue
+		}
+		taskDir := filepath.Join(absDir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files, err := os.ReadDir(taskDir)
+		if err != nil {
+			continue
+		}
+		removed += removeOrphanedPDFs(taskDir, files, referenced, cutoff)
+
+		// The directory of a task that is being generated may still be empty
+		if info.ModTime().Before(cutoff) {
+			os.Remove(taskDir) // Fails while files are left
+		}
+	}
+
+	return removed, nil
+}
+
+// removeOrphanedPDFs removes the PDF files among the entries of dir that are not referenced and older than cutoff
+func removeOrphanedPDFs(dir string, entries []os.DirEntry, referenced map[string]struct{}, cutoff time.Time) int {
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".pdf") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if _, ok := referenced[path]; ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Failed to remove orphaned output file")
+			continue
+		}
+		log.Info().Str("path", path).Msg("Removed orphaned output file")
+		removed++
+	}
+	return removed
+}
+
+// CleanupParts removes the part directories in dir that no retry will resume: those of completed or
+// deleted tasks, of renders without a checkpoint, data source snapshots, and any unchanged for partsRetention. Directories
+// changed within grace are left alone, their task may still be rendering.
+func (q *Queue) CleanupParts(ctx context.Context, dir string, grace time.Duration) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < grace {
+			continue
+		}
+		if time.Since(info.ModTime()) < partsRetention && !strings.HasPrefix(entry.Name(), "render-") && !strings.HasPrefix(entry.Name(), datasource.SnapshotDirPrefix) {
+			task, err := q.taskRepo.GetByID(ctx, entry.Name())
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err == nil && task.Status != domain.TaskStatusCompleted {
+				continue
+			}
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Failed to remove PDF parts")
+			continue
+		}
+		log.Info().Str("path", path).Msg("Removed PDF parts")
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,182 @@
+package queue_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/adapters/repository"
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/queue"
+)
+
+// newReconcileQueue creates a queue with a concurrency of 1 and the given settings on a new test database
+func newReconcileQueue(t *testing.T, name string, settings map[string]string) (*gorm.DB, ports.TaskRepository, *queue.Queue) {
+	db := newTestDB(t, name)
+	taskRepo := repository.NewTaskRepository(db)
+	q, err := queue.NewQueue(db, taskRepo, &concurrencySettingsRepo{value: "1", others: settings}, new(MockGateRepo), repository.NewQueueControlRepository(db))
+	assert.NoError(t, err)
+	return db, taskRepo, q
+}
+
+// enqueueTask creates a task with a backlite job and sets its status
+func enqueueTask(t *testing.T, ctx context.Context, taskRepo ports.TaskRepository, q *queue.Queue, status domain.TaskStatus) *domain.Task {
+	task := &domain.Task{Status: domain.TaskStatusQueued, RootFolder: "/data", StationID: 1}
+	assert.NoError(t, taskRepo.Create(ctx, task))
+	_, err := q.Enqueue(ctx, task.ID, task.Metadata())
+	assert.NoError(t, err)
+
+	task, err = taskRepo.GetByID(ctx, task.ID)
+	assert.NoError(t, err)
+	task.Status = status
+	assert.NoError(t, taskRepo.Update(ctx, task))
+	return task
+}
+
+func TestQueue_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	db, taskRepo, q := newReconcileQueue(t, "reconcile", nil)
+	sqlDB, _ := db.DB()
+
+	// Worker died mid-task: job released but task still running
+	running := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusRunning)
+
+	// Crash left a claim behind
+	claimed := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+	_, err := sqlDB.Exec("UPDATE backlite_tasks SET claimed_at = ? WHERE id = ?", time.Now().UnixMilli(), claimed.JobID)
+	assert.NoError(t, err)
+
+	// Cancelled before dispatch
+	cancelled := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusCancelled)
+
+	// Job exhausted its attempts
+	exhausted := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusRunning)
+	_, err = sqlDB.Exec("DELETE FROM backlite_tasks WHERE id = ?", exhausted.JobID)
+	assert.NoError(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO backlite_tasks_completed (id, created_at, queue, attempts, succeeded, error)
+		VALUES (?, ?, 'generate_pdf', 3, 0, 'datasource not found')`, exhausted.JobID, time.Now().UnixMilli())
+	assert.NoError(t, err)
+
+	// Job disappeared entirely
+	lost := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusRunning)
+	_, err = sqlDB.Exec("DELETE FROM backlite_tasks WHERE id = ?", lost.JobID)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Model(&domain.Task{}).Where("id = ?", lost.ID).UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error)
+
+	report, err := q.Reconcile(ctx, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.ReleasedClaims)
+	assert.Equal(t, 1, report.Requeued)
+	assert.Equal(t, 1, report.CancelledJobs)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, 1, report.Reenqueued)
+
+	got, _ := taskRepo.GetByID(ctx, running.ID)
+	assert.Equal(t, domain.TaskStatusQueued, got.Status)
+
+	var jobs int
+	assert.NoError(t, sqlDB.QueryRow("SELECT COUNT(*) FROM backlite_tasks WHERE id = ?", cancelled.JobID).Scan(&jobs))
+	assert.Equal(t, 0, jobs)
+
+	got, _ = taskRepo.GetByID(ctx, exhausted.ID)
+	assert.Equal(t, domain.TaskStatusFailed, got.Status)
+	assert.Equal(t, "datasource not found", got.ErrorMessage)
+
+	got, _ = taskRepo.GetByID(ctx, lost.ID)
+	assert.Equal(t, domain.TaskStatusQueued, got.Status)
+	assert.NotEqual(t, lost.JobID, got.JobID)
+
+	// A second pass finds nothing left to fix
+	report, err = q.Reconcile(ctx, false)
+	assert.NoError(t, err)
+	assert.False(t, report.Changed())
+}
+
+func TestQueue_CleanupOrphanedOutputs(t *testing.T) {
+	ctx := context.Background()
+	_, taskRepo, q := newReconcileQueue(t, "orphans", nil)
+
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	write := func(name string, modTime time.Time) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("%PDF"), 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+		return path
+	}
+
+	referenced := write("referenced.pdf", old)
+	second := write("second.pdf", old)
+	orphaned := write("orphaned.pdf", old)
+	recent := write("recent.pdf", time.Now())
+
+	// Task directories
+	inTaskDir := write(filepath.Join("task-a", "referenced.pdf"), old)
+	orphanedTaskDir := filepath.Dir(write(filepath.Join("task-b", "orphaned.pdf"), old))
+	assert.NoError(t, os.Chtimes(orphanedTaskDir, old, old))
+	parts := write(filepath.Join("parts", "task-c", "000001.pdf"), old)
+
+	assert.NoError(t, taskRepo.Create(ctx, &domain.Task{
+		Status:         domain.TaskStatusCompleted,
+		OutputFilePath: referenced + "," + second,
+	}))
+	assert.NoError(t, taskRepo.Create(ctx, &domain.Task{Status: domain.TaskStatusCompleted, OutputFilePath: inTaskDir}))
+
+	removed, err := q.CleanupOrphanedOutputs(ctx, dir, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	for path, exists := range map[string]bool{
+		referenced: true, second: true, orphaned: false, recent: true,
+		inTaskDir: true, orphanedTaskDir: false, parts: true,
+	} {
+		_, err := os.Stat(path)
+		assert.Equal(t, exists, err == nil, path)
+	}
+}
+
+func TestQueue_CleanupParts(t *testing.T) {
+	ctx := context.Background()
+	_, taskRepo, q := newReconcileQueue(t, "parts", nil)
+
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	parts := func(name string, modTime time.Time) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(path, 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(path, "part.pdf"), []byte("%PDF"), 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+		return path
+	}
+
+	failed := &domain.Task{Status: domain.TaskStatusFailed}
+	stale := &domain.Task{Status: domain.TaskStatusFailed}
+	completed := &domain.Task{Status: domain.TaskStatusCompleted}
+	for _, task := range []*domain.Task{failed, stale, completed} {
+		assert.NoError(t, taskRepo.Create(ctx, task))
+	}
+
+	resumable := parts(failed.ID, old)
+	finished := parts(completed.ID, old)
+	deleted := parts("0b6f2c1e-deleted", old)
+	temporary := parts("render-123", old)
+	expired := parts(stale.ID, time.Now().Add(-8*24*time.Hour))
+	rendering := parts("render-456", time.Now())
+	snapshot := parts("source-789", old)
+
+	removed, err := q.CleanupParts(ctx, dir, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, removed)
+
+	for path, exists := range map[string]bool{resumable: true, finished: false, deleted: false, temporary: false, expired: false, rendering: true, snapshot: false} {
+		_, err := os.Stat(path)
+		assert.Equal(t, exists, err == nil, path)
+	}
+}
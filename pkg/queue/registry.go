@@ -0,0 +1,307 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mikestefanello/backlite"
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/generator"
+	"pdf_generator/pkg/metrics"
+)
+
+// ErrUnknownTaskType is returned when a task's type has no registered job type
+var ErrUnknownTaskType = errors.New("unknown task type")
+
+// defaultJobTimeout is how long an attempt of a job may run when its type sets no timeout
+const defaultJobTimeout = 10 * time.Minute
+
+// JobType defines a kind of task run by the queue. The queue keeps the task row up to date
+// (status, progress, errors, retries and notifications), the handler only does the work.
+type JobType[P any] struct {
+	Type  domain.TaskType // Stored in the type column of its tasks
+	Queue string          // Backlite queue name, the type when empty
+
+	// Retry and timeout policy. The task_max_attempts and task_retry_backoff_seconds
+	// settings apply when zero, attempts are capped at 10.
+	MaxAttempts int
+	Backoff     time.Duration
+	Timeout     time.Duration // 10 minutes when zero
+
+	// Handle runs one attempt of a task with the payload it was enqueued with
+	Handle func(ctx context.Context, job Job[P]) (JobResult, error)
+}
+
+// Job is one attempt of a task
+type Job[P any] struct {
+	TaskID   string
+	Payload  P
+	Progress ProgressFunc
+}
+
+// ProgressFunc reports the progress of a job, stored on the task and pushed to subscribers
+type ProgressFunc func(stage string, current, total int)
+
+// JobResult is the outcome of a completed job
+type JobResult struct {
+	OutputPath string // Comma-separated when the job wrote several files
+	OutputSize int64
+}
+
+// jobType is a registered job type with its payload type erased
+type jobType struct {
+	taskType    domain.TaskType
+	queue       string
+	maxAttempts int
+	backoff     time.Duration
+	timeout     time.Duration
+	run         func(ctx context.Context, taskID string, payload json.RawMessage, progress ProgressFunc) (JobResult, error)
+}
+
+// RegisterJobType adds a job type to the queue. Types must be registered before the
+// consumers are, the PDF job type is registered by NewQueue.
+func RegisterJobType[P any](q *Queue, t JobType[P]) {
+	queue := t.Queue
+	if queue == "" {
+		queue = string(t.Type)
+	}
+	q.jobTypes[t.Type] = &jobType{
+		taskType:    t.Type,
+		queue:       queue,
+		maxAttempts: t.MaxAttempts,
+		backoff:     t.Backoff,
+		timeout:     t.Timeout,
+		run: func(ctx context.Context, taskID string, payload json.RawMessage, progress ProgressFunc) (JobResult, error) {
+			var p P
+			if len(payload) > 0 {
+				if err := json.Unmarshal(payload, &p); err != nil {
+					return JobResult{}, fmt.Errorf("%w: payload: %w", generator.ErrInvalidInput, err)
+				}
+			}
+			return t.Handle(ctx, Job[P]{TaskID: taskID, Payload: p, Progress: progress})
+		},
+	}
+}
+
+// config returns the backlite configuration of the job type, falling back to the retry policy of the settings
+func (t *jobType) config(policy retryPolicy) backlite.QueueConfig {
+	config := backlite.QueueConfig{
+		Name:        t.queue,
+		MaxAttempts: policy.attempts,
+		Backoff:     policy.backoff,
+		Timeout:     defaultJobTimeout,
+		// Failed jobs are kept so reconciliation can copy their last error to the task
+		Retention: &backlite.Retention{
+			Duration:   7 * 24 * time.Hour,
+			OnlyFailed: true,
+		},
+	}
+	if t.maxAttempts > 0 {
+		config.MaxAttempts = min(t.maxAttempts, maxAttemptsLimit)
+	}
+	if t.backoff > 0 {
+		config.Backoff = t.backoff
+	}
+	if t.timeout > 0 {
+		config.Timeout = t.timeout
+	}
+	return config
+}
+
+// jobQueue runs the jobs of a registered type for backlite
+type jobQueue struct {
+	q       *Queue
+	jobType *jobType
+	config  backlite.QueueConfig
+}
+
+func (j *jobQueue) Config() *backlite.QueueConfig {
+	return &j.config
+}
+
+func (j *jobQueue) Process(ctx context.Context, payload []byte) error {
+	return j.q.runJob(ctx, j, payload)
+}
+
+// jobQueues returns the backlite queues of the registered job types
+func (q *Queue) jobQueues(policy retryPolicy) []*jobQueue {
+	queues := make([]*jobQueue, 0, len(q.jobTypes))
+	for _, t := range q.jobTypes {
+		queues = append(queues, &jobQueue{q: q, jobType: t, config: t.config(policy)})
+	}
+	return queues
+}
+
+// jobPayload is the backlite payload of a job. PDFTask has the same shape.
+type jobPayload struct {
+	TaskID   string          `json:"task_id"`
+	Metadata json.RawMessage `json:"metadata"`
+	queue    string
+}
+
+// Config returns the backlite queue the job is added to
+func (p jobPayload) Config() backlite.QueueConfig {
+	return backlite.QueueConfig{Name: p.queue}
+}
+
+// EnqueueTask adds a stored task to the queue of its job type, e.g. when it is retried
+func (q *Queue) EnqueueTask(ctx context.Context, task *domain.Task) ([]string, error) {
+	if task.Type == "" || task.Type == domain.TaskTypePDF {
+		return q.Enqueue(ctx, task.ID, task.Metadata())
+	}
+
+	t, ok := q.jobTypes[task.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTaskType, task.Type)
+	}
+	return q.add(ctx, task.ID, jobPayload{TaskID: task.ID, Metadata: task.Payload, queue: t.queue}, task.Priority)
+}
+
+// Submit creates a task of a registered job type with the given payload and enqueues it
+func (q *Queue) Submit(ctx context.Context, task *domain.Task, payload any) error {
+	if _, ok := q.jobTypes[task.Type]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTaskType, task.Type)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	task.Payload = data
+	task.Status = domain.TaskStatusQueued
+
+	if err := q.taskRepo.Create(ctx, task); err != nil {
+		return err
+	}
+	if _, err := q.EnqueueTask(ctx, task); err != nil {
+		q.taskRepo.UpdateError(ctx, task.ID, domain.TaskErrorInternal, "Failed to enqueue task: "+err.Error())
+		return err
+	}
+	return nil
+}
+
+// runJob runs one attempt of a job and keeps its task up to date
+func (q *Queue) runJob(ctx context.Context, queue *jobQueue, data []byte) error {
+	var payload jobPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	taskID := payload.TaskID
+	log.Info().Str("task_id", taskID).Str("type", string(queue.jobType.taskType)).Msg("Processing task")
+
+	q.running.Add(1)
+	q.active.Store(taskID, struct{}{})
+	defer func() {
+		q.active.Delete(taskID)
+		q.running.Add(-1)
+	}()
+
+	// Update task status to running
+	dbTask, err := q.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		log.Error().Err(err).Str("task_id", taskID).Msg("Task not found")
+		return err
+	}
+	// The task was cancelled or finished after the job was claimed, the job is done
+	if dbTask.Status.IsTerminal() {
+		log.Info().Str("task_id", taskID).Str("status", string(dbTask.Status)).Msg("Task already finished, job skipped")
+		return nil
+	}
+
+	dbTask.Status = domain.TaskStatusRunning
+	dbTask.WorkerID = q.workerID
+	if err := q.taskRepo.Update(ctx, dbTask); err != nil {
+		return err
+	}
+
+	// Initialize progress tracking
+	q.setProgress(taskID, "Initializing settings", 0, 0)
+	start := time.Now()
+
+	// Create a progress callback that:
+	// - Always updates in-memory progress immediately
+	// - Immediately updates DB when stage changes
+	// - Throttles DB updates to once per second when stage stays the same
+	var lastUpdate time.Time
+	var lastStage string
+	progress := func(stage string, current, total int) {
+		// Always update in-memory progress immediately
+		q.setProgress(taskID, stage, current, total)
+
+		now := time.Now()
+		stageChanged := stage != lastStage
+
+		// Update DB immediately on stage change, or throttled (once per second) for same stage
+		if stageChanged || now.Sub(lastUpdate) >= time.Second {
+			lastUpdate = now
+			lastStage = stage
+			if err := q.taskRepo.UpdateProgress(ctx, taskID, stage, current, total); err != nil {
+				log.Warn().Err(err).Str("task_id", taskID).Msg("Failed to update progress in DB")
+			}
+		}
+	}
+
+	result, err := queue.jobType.run(ctx, taskID, payload.Metadata, progress)
+	if err != nil {
+		code := generator.ErrorCode(err)
+		log.Error().Err(err).Str("task_id", taskID).Str("error_code", string(code)).Msg("Task failed")
+		metrics.TaskFailed(start, string(code))
+
+		// Record the failure even when the attempt timed out
+		failCtx := context.WithoutCancel(ctx)
+		retry := q.recordFailure(failCtx, dbTask.JobID, taskID, queue.config.MaxAttempts, code, err)
+		q.clearProgress(taskID)
+		if retry {
+			return err
+		}
+
+		// Backlite would run a permanent failure again, so the job is failed here and
+		// reported to backlite as done
+		if failErr := q.failJob(failCtx, dbTask.JobID, err.Error()); failErr != nil {
+			log.Error().Err(failErr).Str("task_id", taskID).Msg("Failed to fail job")
+			return err
+		}
+		return nil
+	}
+
+	// Re-fetch task to get latest progress values from DB
+	dbTask, err = q.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		q.clearProgress(taskID)
+		return err
+	}
+
+	// Update task with output - include final progress values from in-memory cache
+	finalProgress := q.GetProgress(taskID)
+	dbTask.Status = domain.TaskStatusCompleted
+	dbTask.OutputFilePath = result.OutputPath
+	dbTask.OutputFileSize = result.OutputSize
+	dbTask.ProgressStage = "Completed"
+	if finalProgress != nil {
+		dbTask.ProgressTotal = finalProgress.Total
+		dbTask.ProgressCurrent = finalProgress.Current
+	}
+	metrics.TaskCompleted(start, dbTask.ProgressTotal)
+	if err := q.taskRepo.Update(ctx, dbTask); err != nil {
+		q.clearProgress(taskID)
+		return err
+	}
+
+	q.clearProgress(taskID)
+	q.publish(ports.ProgressEvent{
+		TaskID:     taskID,
+		Status:     domain.TaskStatusCompleted,
+		Stage:      dbTask.ProgressStage,
+		Current:    dbTask.ProgressCurrent,
+		Total:      dbTask.ProgressTotal,
+		OutputSize: result.OutputSize,
+	})
+	q.NotifyTask(ctx, dbTask)
+	log.Info().Str("task_id", taskID).Str("output", result.OutputPath).Msg("Task completed")
+	return nil
+}
@@ -0,0 +1,192 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/generator"
+	"pdf_generator/pkg/queue"
+)
+
+type exportPayload struct {
+	Rows int `json:"rows"`
+}
+
+func TestQueue_RegisterJobType(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db, taskRepo, q := newReconcileQueue(t, "job_types", nil)
+	sqlDB, _ := db.DB()
+
+	// The first attempt fails with a transient error, the second succeeds
+	var attempts atomic.Int32
+	queue.RegisterJobType(q, queue.JobType[exportPayload]{
+		Type:        "export",
+		MaxAttempts: 2,
+		Backoff:     10 * time.Millisecond,
+		Handle: func(ctx context.Context, job queue.Job[exportPayload]) (queue.JobResult, error) {
+			if attempts.Add(1) == 1 {
+				return queue.JobResult{}, errors.New("connection reset")
+			}
+			job.Progress("Exporting rows", job.Payload.Rows, job.Payload.Rows)
+			return queue.JobResult{OutputPath: "/exports/" + job.TaskID + ".csv", OutputSize: 42}, nil
+		},
+	})
+	queue.RegisterJobType(q, queue.JobType[exportPayload]{
+		Type: "broken",
+		Handle: func(ctx context.Context, job queue.Job[exportPayload]) (queue.JobResult, error) {
+			return queue.JobResult{}, generator.ErrInvalidInput
+		},
+	})
+	var skippedRuns atomic.Int32
+	queue.RegisterJobType(q, queue.JobType[exportPayload]{
+		Type: "skipped",
+		Handle: func(ctx context.Context, job queue.Job[exportPayload]) (queue.JobResult, error) {
+			skippedRuns.Add(1)
+			return queue.JobResult{}, nil
+		},
+	})
+	q.RegisterConsumers()
+
+	// Jobs of tasks cancelled before they ran are dropped without running
+	skipped := &domain.Task{Type: "skipped"}
+	assert.NoError(t, q.Submit(ctx, skipped, exportPayload{}))
+	skipped.Status = domain.TaskStatusCancelled
+	assert.NoError(t, taskRepo.Update(ctx, skipped))
+
+	task := &domain.Task{Type: "export", Priority: domain.TaskPriorityUrgent}
+	assert.NoError(t, q.Submit(ctx, task, exportPayload{Rows: 7}))
+	broken := &domain.Task{Type: "broken"}
+	assert.NoError(t, q.Submit(ctx, broken, exportPayload{}))
+	pdf := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+
+	err := q.Submit(ctx, &domain.Task{Type: "unknown"}, exportPayload{})
+	assert.ErrorIs(t, err, queue.ErrUnknownTaskType)
+
+	var queues []string
+	rows, err := sqlDB.Query("SELECT queue FROM backlite_tasks ORDER BY queue")
+	assert.NoError(t, err)
+	for rows.Next() {
+		var name string
+		assert.NoError(t, rows.Scan(&name))
+		queues = append(queues, name)
+	}
+	rows.Close()
+	assert.Equal(t, []string{"broken", "export", "generate_pdf", "skipped"}, queues)
+
+	// Stop the PDF job from running, it has no data source
+	_, err = sqlDB.Exec("DELETE FROM backlite_tasks WHERE id = ?", pdf.JobID)
+	assert.NoError(t, err)
+	q.Start(ctx)
+
+	var got *domain.Task
+	assert.Eventually(t, func() bool {
+		got, err = taskRepo.GetByID(ctx, task.ID)
+		return err == nil && got.Status == domain.TaskStatusCompleted
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Equal(t, "/exports/"+task.ID+".csv", got.OutputFilePath)
+	assert.Equal(t, int64(42), got.OutputFileSize)
+	assert.Equal(t, 7, got.ProgressTotal)
+	assert.JSONEq(t, `{"rows":7}`, string(got.Payload))
+
+	// Permanent errors are not retried
+	assert.Eventually(t, func() bool {
+		got, err = taskRepo.GetByID(ctx, broken.ID)
+		return err == nil && got.Status == domain.TaskStatusFailed
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, domain.TaskErrorInvalidInput, got.ErrorCode)
+
+	assert.Eventually(t, func() bool {
+		var jobs int
+		return sqlDB.QueryRow("SELECT COUNT(*) FROM backlite_tasks WHERE queue = 'skipped'").Scan(&jobs) == nil && jobs == 0
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Zero(t, skippedRuns.Load())
+	got, err = taskRepo.GetByID(ctx, skipped.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusCancelled, got.Status)
+
+	// Tasks are listed by type
+	tasks, total, err := taskRepo.List(ctx, ports.TaskFilter{Type: "export"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, task.ID, tasks[0].ID)
+	_, total, err = taskRepo.List(ctx, ports.TaskFilter{Type: domain.TaskTypePDF})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+}
+
+func TestQueue_StandbyJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Remote mode: jobs other than PDF are run by the standby loop of Watch
+	_, taskRepo, q := newReconcileQueue(t, "standby_jobs", map[string]string{
+		domain.SettingWorkerMode:           string(domain.WorkerModeRemote),
+		domain.SettingTaskMaxAttempts:      "2",
+		domain.SettingTaskRetryBackoffSecs: "0",
+	})
+
+	// The job outlives its timeout
+	started := make(chan time.Time, 1)
+	queue.RegisterJobType(q, queue.JobType[exportPayload]{
+		Type:        "slow",
+		MaxAttempts: 1,
+		Timeout:     time.Second,
+		Handle: func(ctx context.Context, job queue.Job[exportPayload]) (queue.JobResult, error) {
+			started <- time.Now()
+			<-ctx.Done()
+			return queue.JobResult{}, ctx.Err()
+		},
+	})
+	var attempts atomic.Int32
+	queue.RegisterJobType(q, queue.JobType[exportPayload]{
+		Type: "flaky",
+		Handle: func(ctx context.Context, job queue.Job[exportPayload]) (queue.JobResult, error) {
+			attempts.Add(1)
+			return queue.JobResult{}, errors.New("connection reset")
+		},
+	})
+	q.RegisterConsumers()
+
+	slow := &domain.Task{Type: "slow"}
+	assert.NoError(t, q.Submit(ctx, slow, exportPayload{}))
+	q.Start(ctx)
+	go q.Watch(ctx, 20*time.Millisecond)
+
+	// The control loop keeps reporting while the job runs
+	var startedAt time.Time
+	select {
+	case startedAt = <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("slow job did not start")
+	}
+	assert.Eventually(t, func() bool {
+		c, err := q.Control(ctx)
+		return err == nil && c.ReportedAt != nil && c.ReportedAt.After(startedAt)
+	}, 500*time.Millisecond, 20*time.Millisecond)
+
+	var got *domain.Task
+	var err error
+	assert.Eventually(t, func() bool {
+		got, err = taskRepo.GetByID(ctx, slow.ID)
+		return err == nil && got.Status == domain.TaskStatusFailed
+	}, 3*time.Second, 20*time.Millisecond)
+	assert.Contains(t, got.ErrorMessage, "deadline exceeded")
+
+	// Retries follow the task_max_attempts setting
+	flaky := &domain.Task{Type: "flaky"}
+	assert.NoError(t, q.Submit(ctx, flaky, exportPayload{}))
+	assert.Eventually(t, func() bool {
+		got, err = taskRepo.GetByID(ctx, flaky.ID)
+		return err == nil && got.Status == domain.TaskStatusFailed
+	}, 3*time.Second, 20*time.Millisecond)
+	assert.Equal(t, int32(2), attempts.Load())
+}
@@ -0,0 +1,140 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mikestefanello/backlite"
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+)
+
+// standbyJobs limits how many notification jobs are run per standby pass
+const standbyJobs = 20
+
+// standbyQueue is a notification queue still consumed while this process stands by
+type standbyQueue struct {
+	config backlite.QueueConfig
+	run    func(ctx context.Context, payload []byte) error
+}
+
+// standbyQueues returns the notification queues and the queues of job types other
+// than PDF, with the retry policy a backlite client would get. PDF jobs are left to remote workers.
+func (q *Queue) standbyQueues(ctx context.Context) []standbyQueue {
+	queues := []standbyQueue{
+		{
+			config: WebhookTask{}.Config(),
+			run: func(ctx context.Context, payload []byte) error {
+				var t WebhookTask
+				if err := json.Unmarshal(payload, &t); err != nil {
+					return err
+				}
+				return q.handleWebhook(ctx, t)
+			},
+		},
+		{
+			config: EmailTask{}.Config(),
+			run: func(ctx context.Context, payload []byte) error {
+				var t EmailTask
+				if err := json.Unmarshal(payload, &t); err != nil {
+					return err
+				}
+				return q.handleEmail(ctx, t)
+			},
+		},
+	}
+
+	for _, queue := range q.jobQueues(q.retryPolicy(ctx)) {
+		if queue.jobType.taskType == domain.TaskTypePDF {
+			continue
+		}
+		queues = append(queues, standbyQueue{config: queue.config, run: queue.Process})
+	}
+	return queues
+}
+
+// startStandby runs a standby pass in the background unless the previous one is still
+// running, so slow deliveries do not hold up the control loop
+func (q *Queue) startStandby(ctx context.Context) {
+	if !q.standby.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer q.standby.Store(false)
+		q.runStandby(ctx)
+	}()
+}
+
+// runStandby runs due notification jobs while this process stands by for remote
+// workers. Its backlite client is stopped then, since the dispatcher would also claim
+// PDF jobs, so the jobs are claimed the same way leases are.
+func (q *Queue) runStandby(ctx context.Context) {
+	for _, queue := range q.standbyQueues(ctx) {
+		q.runStandbyQueue(ctx, queue)
+	}
+}
+
+func (q *Queue) runStandbyQueue(ctx context.Context, queue standbyQueue) {
+	now := time.Now()
+	rows, err := q.db.QueryContext(ctx, `SELECT id, task, attempts FROM backlite_tasks
+		WHERE queue = ? AND claimed_at IS NULL AND (wait_until IS NULL OR wait_until <= ?)
+		ORDER BY wait_until, id LIMIT ?`,
+		queue.config.Name, now.UnixMilli(), standbyJobs)
+	if err != nil {
+		log.Warn().Err(err).Str("queue", queue.config.Name).Msg("Failed to read standby jobs")
+		return
+	}
+	var jobs []leaseCandidate
+	for rows.Next() {
+		var job leaseCandidate
+		if err := rows.Scan(&job.id, &job.payload, &job.attempts); err != nil {
+			rows.Close()
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+
+	for _, job := range jobs {
+		if !q.runStandbyJob(ctx, queue, job, now) {
+			return
+		}
+	}
+}
+
+// runStandbyJob claims and runs one job within the timeout of its queue, and settles it the way
+// backlite does: failed jobs run again after the backoff until their attempts are used up, then
+// they are kept as failed when the queue retains them. It reports false when the job could not
+// be claimed because the database failed.
+func (q *Queue) runStandbyJob(ctx context.Context, queue standbyQueue, job leaseCandidate, now time.Time) bool {
+	res, err := q.db.ExecContext(ctx,
+		"UPDATE backlite_tasks SET claimed_at = ?, attempts = attempts + 1, last_executed_at = ? WHERE id = ? AND claimed_at IS NULL",
+		now.UnixMilli(), now.UnixMilli(), job.id)
+	if err != nil {
+		return false
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return true
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, queue.config.Timeout)
+	err = queue.run(runCtx, job.payload)
+	cancel()
+	switch {
+	case err == nil:
+		_, err = q.db.ExecContext(ctx, "DELETE FROM backlite_tasks WHERE id = ?", job.id)
+	case job.attempts+1 >= queue.config.MaxAttempts && queue.config.Retention != nil:
+		err = q.failJob(ctx, job.id, err.Error())
+	case job.attempts+1 >= queue.config.MaxAttempts:
+		_, err = q.db.ExecContext(ctx, "DELETE FROM backlite_tasks WHERE id = ?", job.id)
+	default:
+		_, err = q.db.ExecContext(ctx, "UPDATE backlite_tasks SET claimed_at = NULL, wait_until = ? WHERE id = ?",
+			time.Now().Add(queue.config.Backoff).UnixMilli(), job.id)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("job_id", job.id).Msg("Failed to update standby job")
+	}
+	return true
+}
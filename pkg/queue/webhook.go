@@ -0,0 +1,303 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikestefanello/backlite"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/pkg/utils"
+	"pdf_generator/pkg/version"
+)
+
+const (
+	// webhookQueueName is the backlite queue name of webhook deliveries
+	webhookQueueName = "webhook_delivery"
+
+	// maxDeliveryAttempts is how often an event is sent before the delivery is failed
+	maxDeliveryAttempts = 8
+
+	// deliveryBackoff is the wait before the second attempt, doubled for every further attempt
+	deliveryBackoff = 30 * time.Second
+
+	// deliveryTimeout bounds a single HTTP attempt
+	deliveryTimeout = 15 * time.Second
+
+	// responseBodyLimit is how much of the receiver response is kept in the delivery log
+	responseBodyLimit = 1024
+)
+
+// WebhookTask is the backlite job delivering one event to one webhook
+type WebhookTask struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+// Config returns the backlite task configuration. HTTP failures are retried by scheduling a
+// new job with exponential backoff; backlite retries only cover errors of the log itself.
+func (t WebhookTask) Config() backlite.QueueConfig {
+	return backlite.QueueConfig{
+		Name:        webhookQueueName,
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		Timeout:     time.Minute,
+	}
+}
+
+// WebhookPayload is the body posted to webhook URLs
+type WebhookPayload struct {
+	ID        string              `json:"id"` // Event ID, identical for all webhooks and replays
+	Event     domain.WebhookEvent `json:"event"`
+	CreatedAt time.Time           `json:"created_at"`
+	Task      *domain.Task        `json:"task"`
+	Output    *WebhookOutput      `json:"output,omitempty"`
+}
+
+// WebhookOutput describes the files of a completed task
+type WebhookOutput struct {
+	Files        []WebhookFile `json:"files"`
+	TotalSize    int64         `json:"total_size"`
+	DownloadPath string        `json:"download_path"`
+}
+
+// WebhookFile is a generated PDF
+type WebhookFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// NotifyTask queues the report email and webhook deliveries for a task that reached a final status
+func (q *Queue) NotifyTask(ctx context.Context, task *domain.Task) {
+	q.queueEmail(ctx, task)
+
+	if q.webhookRepo == nil {
+		return
+	}
+	event, ok := domain.WebhookEventForStatus(task.Status)
+	if !ok {
+		return
+	}
+
+	webhooks, err := q.webhookRepo.ListForTask(ctx, task)
+	if err != nil {
+		log.Error().Err(err).Str("task_id", task.ID).Msg("Failed to load webhooks")
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(newWebhookPayload(event, task))
+	if err != nil {
+		log.Error().Err(err).Str("task_id", task.ID).Msg("Failed to build webhook payload")
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribed(event) {
+			continue
+		}
+		delivery := &domain.WebhookDelivery{
+			WebhookID: webhook.ID,
+			TaskID:    task.ID,
+			Event:     event,
+			URL:       webhook.URL,
+			Payload:   string(payload),
+			Status:    domain.DeliveryStatusPending,
+		}
+		if err := q.webhookRepo.CreateDelivery(ctx, delivery); err != nil {
+			log.Error().Err(err).Str("webhook_id", webhook.ID).Msg("Failed to log webhook delivery")
+			continue
+		}
+		q.enqueueDelivery(delivery, time.Now())
+	}
+}
+
+// ReplayDelivery sends the payload of a logged delivery again as a new delivery
+func (q *Queue) ReplayDelivery(ctx context.Context, deliveryID string) (*domain.WebhookDelivery, error) {
+	original, err := q.webhookRepo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	webhook, err := q.webhookRepo.GetByID(ctx, original.WebhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &domain.WebhookDelivery{
+		WebhookID: webhook.ID,
+		TaskID:    original.TaskID,
+		Event:     original.Event,
+		URL:       webhook.URL,
+		Payload:   original.Payload,
+		Status:    domain.DeliveryStatusPending,
+		ReplayOf:  &original.ID,
+	}
+	if err := q.webhookRepo.CreateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	if err := q.enqueueDelivery(delivery, time.Now()); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// enqueueDelivery schedules a delivery attempt
+func (q *Queue) enqueueDelivery(delivery *domain.WebhookDelivery, at time.Time) error {
+	_, err := q.currentClient().Add(WebhookTask{DeliveryID: delivery.ID}).At(at).Save()
+	if err != nil {
+		log.Error().Err(err).Str("delivery_id", delivery.ID).Msg("Failed to enqueue webhook delivery")
+	}
+	return err
+}
+
+// handleWebhook performs one delivery attempt and schedules the next one on failure
+func (q *Queue) handleWebhook(ctx context.Context, t WebhookTask) error {
+	delivery, err := q.webhookRepo.GetDelivery(ctx, t.DeliveryID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if delivery.Status != domain.DeliveryStatusPending {
+		return nil
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.NextAttemptAt = nil
+
+	webhook, err := q.webhookRepo.GetByID(ctx, delivery.WebhookID)
+	if err != nil || !webhook.Active {
+		delivery.Status = domain.DeliveryStatusFailed
+		delivery.Error = "webhook was removed or disabled"
+		return q.webhookRepo.UpdateDelivery(ctx, delivery)
+	}
+
+	secret, err := utils.Decrypt(webhook.EncryptedSecret)
+	if err != nil {
+		delivery.Status = domain.DeliveryStatusFailed
+		delivery.Error = "failed to decrypt webhook secret"
+		return q.webhookRepo.UpdateDelivery(ctx, delivery)
+	}
+
+	code, body, sendErr := q.sendWebhook(ctx, delivery, secret)
+	delivery.ResponseCode = code
+	delivery.ResponseBody = body
+	delivery.Error = ""
+
+	retry := false
+	switch {
+	case sendErr == nil:
+		delivery.Status = domain.DeliveryStatusSucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= maxDeliveryAttempts:
+		delivery.Status = domain.DeliveryStatusFailed
+		delivery.Error = sendErr.Error()
+	default:
+		next := now.Add(webhookBackoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		delivery.Error = sendErr.Error()
+		retry = true
+	}
+
+	if err := q.webhookRepo.UpdateDelivery(ctx, delivery); err != nil {
+		return err
+	}
+	if retry {
+		log.Warn().Err(sendErr).Str("delivery_id", delivery.ID).Int("attempt", delivery.Attempts).Msg("Webhook delivery failed, retrying")
+		return q.enqueueDelivery(delivery, *delivery.NextAttemptAt)
+	}
+	return nil
+}
+
+// sendWebhook posts the signed payload and returns the response status and truncated body
+func (q *Queue) sendWebhook(ctx context.Context, delivery *domain.WebhookDelivery, secret string) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DataLane-Webhook/"+version.Version)
+	req.Header.Set("X-Webhook-Event", string(delivery.Event))
+	req.Header.Set("X-Webhook-Delivery", delivery.ID)
+	req.Header.Set("X-Signature", utils.GenerateHMAC(delivery.Payload, secret))
+
+	// Addresses are checked on connect, the host may resolve differently than when the webhook was created
+	client := q.webhookPolicy(ctx).Client()
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, responseBodyLimit))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(body), fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// webhookPolicy reads the hosts webhooks may reach although they are not public
+func (q *Queue) webhookPolicy(ctx context.Context) utils.AddressPolicy {
+	var policy utils.AddressPolicy
+	if setting, err := q.settingsRepo.Get(ctx, domain.SettingWebhookAllowedHosts); err == nil && setting != nil {
+		if policy, err = utils.ParseAddressPolicy(setting.Value); err != nil {
+			log.Warn().Err(err).Msg("Invalid webhook_allowed_hosts setting, only public addresses are allowed")
+		}
+	}
+	return policy
+}
+
+// webhookBackoff returns the wait after the given number of failed attempts
+func webhookBackoff(attempts int) time.Duration {
+	return deliveryBackoff << (attempts - 1)
+}
+
+// newWebhookPayload describes the task and, once completed, its output files
+func newWebhookPayload(event domain.WebhookEvent, task *domain.Task) WebhookPayload {
+	payload := WebhookPayload{
+		ID:        uuid.New().String(),
+		Event:     event,
+		CreatedAt: time.Now(),
+		Task:      task,
+	}
+	if task.Status != domain.TaskStatusCompleted || task.OutputFilePath == "" {
+		return payload
+	}
+
+	output := &WebhookOutput{
+		Files:        []WebhookFile{},
+		TotalSize:    task.OutputFileSize,
+		DownloadPath: "/api/tasks/" + task.ID + "/download",
+	}
+	for _, path := range strings.Split(task.OutputFilePath, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		file := WebhookFile{Name: filepath.Base(path)}
+		if info, err := os.Stat(outputPath(path)); err == nil {
+			file.Size = info.Size()
+		}
+		output.Files = append(output.Files, file)
+	}
+	payload.Output = output
+	return payload
+}
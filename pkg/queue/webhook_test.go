@@ -0,0 +1,120 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/adapters/repository"
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/queue"
+	"pdf_generator/pkg/utils"
+)
+
+func TestQueue_WebhookDelivery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Remote mode: deliveries are sent by the standby loop of Watch.
+	// The test receiver listens on loopback, which webhooks may only reach when allowed.
+	db, taskRepo, q := newReconcileQueue(t, "webhook", map[string]string{
+		domain.SettingWorkerMode:          string(domain.WorkerModeRemote),
+		domain.SettingWebhookAllowedHosts: "127.0.0.1",
+	})
+	sqlDB, _ := db.DB()
+	webhookRepo := repository.NewWebhookRepository(db)
+	q.SetWebhookRepository(webhookRepo)
+
+	// The receiver fails the first attempt
+	var mu sync.Mutex
+	var bodies []string
+	var verified []bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(body))
+		verified = append(verified, utils.VerifyHMAC(string(body), r.Header.Get("X-Signature"), "whsec_test") &&
+			r.Header.Get("X-Webhook-Event") == string(domain.WebhookEventTaskCompleted))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	task := enqueueTask(t, ctx, taskRepo, q, domain.TaskStatusQueued)
+	secret, _ := utils.Encrypt("whsec_test")
+	assert.NoError(t, webhookRepo.Create(ctx, &domain.Webhook{TaskID: &task.ID, URL: server.URL, EncryptedSecret: secret, Active: true}))
+	assert.NoError(t, webhookRepo.Create(ctx, &domain.Webhook{
+		URL: server.URL + "/failed-only", EncryptedSecret: secret, Active: true,
+		Events: []domain.WebhookEvent{domain.WebhookEventTaskFailed},
+	}))
+
+	_, err := q.Lease(ctx, "worker-a", "", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, q.CompleteLease(ctx, task.ID, "worker-a", "", "/out/report.pdf", 42))
+
+	// Only the subscribed webhook is notified
+	deliveries, total, err := webhookRepo.ListDeliveries(ctx, ports.WebhookFilter{TaskID: task.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	deliveryID := deliveries[0].ID
+
+	q.Start(ctx)
+	go q.Watch(ctx, 20*time.Millisecond)
+
+	// The failed attempt is scheduled again with a backoff
+	var delivery *domain.WebhookDelivery
+	assert.Eventually(t, func() bool {
+		delivery, err = webhookRepo.GetDelivery(ctx, deliveryID)
+		return err == nil && delivery.Attempts == 1
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Equal(t, domain.DeliveryStatusPending, delivery.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.ResponseCode)
+	if assert.NotNil(t, delivery.NextAttemptAt) {
+		assert.WithinDuration(t, time.Now().Add(30*time.Second), *delivery.NextAttemptAt, 5*time.Second)
+	}
+
+	_, err = sqlDB.Exec("UPDATE backlite_tasks SET wait_until = 0 WHERE queue = 'webhook_delivery'")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		delivery, err = webhookRepo.GetDelivery(ctx, deliveryID)
+		return err == nil && delivery.Status == domain.DeliveryStatusSucceeded
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Equal(t, "ok", delivery.ResponseBody)
+
+	// A replay sends the same signed payload again
+	replay, err := q.ReplayDelivery(ctx, deliveryID)
+	assert.NoError(t, err)
+	assert.Equal(t, deliveryID, *replay.ReplayOf)
+	assert.Eventually(t, func() bool {
+		delivery, err = webhookRepo.GetDelivery(ctx, replay.ID)
+		return err == nil && delivery.Status == domain.DeliveryStatusSucceeded
+	}, 2*time.Second, 20*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []bool{true, true, true}, verified)
+	assert.Equal(t, bodies[1], bodies[2])
+
+	var payload queue.WebhookPayload
+	assert.NoError(t, json.Unmarshal([]byte(bodies[1]), &payload))
+	assert.Equal(t, domain.WebhookEventTaskCompleted, payload.Event)
+	assert.Equal(t, task.ID, payload.Task.ID)
+	if assert.NotNil(t, payload.Output) {
+		assert.Equal(t, int64(42), payload.Output.TotalSize)
+		assert.Equal(t, "report.pdf", payload.Output.Files[0].Name)
+		assert.Equal(t, "/api/tasks/"+task.ID+"/download", payload.Output.DownloadPath)
+	}
+}
@@ -0,0 +1,177 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/api"
+	"pdf_generator/pkg/utils"
+)
+
+// requestTimeout bounds protocol calls other than uploads
+const requestTimeout = 30 * time.Second
+
+// Client speaks the remote worker protocol of the API. Requests are authenticated with
+// an API key, which also signs request bodies for the HMAC check.
+type Client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+// LeaseResponse is a leased job with the settings and gates needed to render it
+type LeaseResponse struct {
+	Lease    *ports.Lease      `json:"lease"`
+	Settings map[string]string `json:"settings"`
+	Gates    []domain.Gate     `json:"gates"`
+}
+
+// HeartbeatResponse lists the tasks whose lease was lost
+type HeartbeatResponse struct {
+	LeaseTTL float64  `json:"lease_ttl"`
+	Lost     []string `json:"lost"`
+}
+
+// NewClient creates a protocol client for the API at baseURL
+func NewClient(baseURL, apiKey string) *Client {
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "http://" + baseURL
+	}
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		// Uploads of large PDFs use the request context instead of a client timeout
+		http: &http.Client{},
+	}
+}
+
+// Heartbeat registers the worker and renews the leases of its current tasks
+func (c *Client) Heartbeat(ctx context.Context, worker *domain.Worker) (*HeartbeatResponse, error) {
+	var resp HeartbeatResponse
+	err := c.postJSON(ctx, "/api/worker/heartbeat", worker, &resp)
+	return &resp, err
+}
+
+// Lease asks for the next job. The lease is nil when nothing is ready
+func (c *Client) Lease(ctx context.Context, workerID string) (*LeaseResponse, error) {
+	var resp LeaseResponse
+	err := c.postJSON(ctx, "/api/worker/lease", map[string]string{"worker_id": workerID}, &resp)
+	return &resp, err
+}
+
+// Progress reports the progress of a leased task
+func (c *Client) Progress(ctx context.Context, taskID, workerID, stage string, current, total int) error {
+	return c.postJSON(ctx, "/api/worker/tasks/"+taskID+"/progress", map[string]any{
+		"worker_id": workerID,
+		"stage":     stage,
+		"current":   current,
+		"total":     total,
+	}, nil)
+}
+
+// Fail reports a failed attempt of a leased task and returns the new task status
+func (c *Client) Fail(ctx context.Context, taskID, workerID string, code domain.TaskErrorCode, errMsg string) (domain.TaskStatus, error) {
+	var resp struct {
+		Status domain.TaskStatus `json:"status"`
+	}
+	err := c.postJSON(ctx, "/api/worker/tasks/"+taskID+"/fail", map[string]string{
+		"worker_id":  workerID,
+		"error":      errMsg,
+		"error_code": string(code),
+	}, &resp)
+	return resp.Status, err
+}
+
+// Complete uploads the output files of a leased task
+func (c *Client) Complete(ctx context.Context, taskID, workerID string, paths []string) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("worker_id", workerID); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := addFile(form, path); err != nil {
+			return err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	return c.do(ctx, "/api/worker/tasks/"+taskID+"/complete", form.FormDataContentType(), body.Bytes(), nil)
+}
+
+func addFile(form *multipart.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	part, err := form.CreateFormFile("files", filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	return err
+}
+
+func (c *Client) postJSON(ctx context.Context, path string, payload, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	return c.do(ctx, path, "application/json", body, out)
+}
+
+// do sends a signed request and decodes the data of the standard API response into out
+func (c *Client) do(ctx context.Context, path, contentType string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-API-Key", c.apiKey)
+	req.Header.Set("X-Signature", utils.GenerateHMAC(string(body), c.apiKey))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("unexpected response (status %d): %w", resp.StatusCode, err)
+	}
+
+	switch {
+	case result.Code == api.CodeLeaseLost:
+		return ports.ErrLeaseLost
+	case result.Code != api.CodeSuccess:
+		return fmt.Errorf("api error %d: %s", result.Code, result.Message)
+	}
+
+	if out == nil || len(result.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(result.Data, out)
+}
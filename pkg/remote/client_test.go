@@ -0,0 +1,90 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/api"
+	"pdf_generator/pkg/utils"
+)
+
+func TestClient_SignsRequestsWithAPIKey(t *testing.T) {
+	var path, apiKey string
+	var verified bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		path = r.URL.Path
+		apiKey = r.Header.Get("X-API-Key")
+		verified = utils.VerifyHMAC(string(body), r.Header.Get("X-Signature"), apiKey)
+
+		json.NewEncoder(w).Encode(api.Response{Code: api.CodeSuccess, Data: map[string]any{
+			"lease":    map[string]any{"task_id": "task-1", "attempt": 1},
+			"settings": map[string]string{"page_size": "A4"},
+		}})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "secret-key")
+	resp, err := client.Lease(context.Background(), "worker-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/worker/lease", path)
+	assert.Equal(t, "secret-key", apiKey)
+	assert.True(t, verified)
+	assert.Equal(t, "task-1", resp.Lease.TaskID)
+
+	assert.Equal(t, "A4", resp.Settings["page_size"])
+}
+
+func TestClient_Errors(t *testing.T) {
+	code := api.CodeLeaseLost
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(api.Response{Code: code, Message: "lost"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "key")
+	err := client.Progress(context.Background(), "task-1", "worker-1", "Rendering", 1, 2)
+	assert.ErrorIs(t, err, ports.ErrLeaseLost)
+
+	code = api.CodeInternalError
+	_, err = client.Fail(context.Background(), "task-1", "worker-1", domain.TaskErrorInternal, "boom")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ports.ErrLeaseLost)
+}
+
+func TestClient_CompleteUploadsFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "report.pdf")
+	assert.NoError(t, os.WriteFile(file, []byte("%PDF-1.4"), 0644))
+
+	var workerID, name string
+	var content []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		workerID = r.FormValue("worker_id")
+		f, header, err := r.FormFile("files")
+		if assert.NoError(t, err) {
+			name = header.Filename
+			content, _ = io.ReadAll(f)
+		}
+		json.NewEncoder(w).Encode(api.Response{Code: api.CodeSuccess})
+	}))
+	defer server.Close()
+
+	err := NewClient(server.URL, "key").Complete(context.Background(), "task-1", "worker-1", []string{file})
+	assert.NoError(t, err)
+	assert.Equal(t, "worker-1", workerID)
+	assert.Equal(t, "report.pdf", name)
+	assert.Equal(t, "%PDF-1.4", string(content))
+}
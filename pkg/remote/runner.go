@@ -0,0 +1,281 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"pdf_generator/internal/core/domain"
+	"pdf_generator/internal/core/ports"
+	"pdf_generator/pkg/generator"
+	"pdf_generator/pkg/metrics"
+	"pdf_generator/pkg/utils"
+)
+
+const (
+	// HeartbeatInterval is how often the runner registers itself and renews its leases.
+	// It must stay well below domain.WorkerLeaseTTL
+	HeartbeatInterval = 10 * time.Second
+
+	// progressTimeout keeps a slow API from stalling PDF generation
+	progressTimeout = 5 * time.Second
+
+	// uploadAttempts is how often uploading the output of a task is tried
+	uploadAttempts = 3
+)
+
+// Config holds the options of a remote runner
+type Config struct {
+	Concurrency        int           // Jobs processed at the same time
+	PollInterval       time.Duration // Wait between lease requests when no job is ready
+	RootFolder         string        // Replaces the root folder of leased tasks, for archives mounted elsewhere
+	DataSourcePassword string        // Password of protected Access databases, secret settings are not leased
+}
+
+// Runner processes jobs leased from the API on a remote worker node
+type Runner struct {
+	client *Client
+	worker *domain.Worker
+	config Config
+
+	mu     sync.Mutex
+	active map[string]context.CancelFunc
+}
+
+// NewRunner creates a runner leasing jobs with client on behalf of worker
+func NewRunner(client *Client, worker *domain.Worker, config Config) *Runner {
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 3 * time.Second
+	}
+
+	worker.Mode = domain.WorkerModeRemote
+	worker.Concurrency = config.Concurrency
+	return &Runner{
+		client: client,
+		worker: worker,
+		config: config,
+		active: make(map[string]context.CancelFunc),
+	}
+}
+
+// Run leases and processes jobs until ctx is done. Tasks interrupted by shutdown are
+// not reported; their lease expires and the API hands them out again.
+func (r *Runner) Run(ctx context.Context) {
+	r.worker.State = domain.WorkerStateRunning
+	r.heartbeat(ctx)
+	log.Info().Str("worker_id", r.worker.ID).Int("concurrency", r.config.Concurrency).Msg("Remote worker registered")
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.loop(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			r.worker.State = domain.WorkerStateStopped
+			r.heartbeat(context.Background())
+			return
+		case <-ticker.C:
+			r.heartbeat(ctx)
+		}
+	}
+}
+
+// heartbeat registers the worker, renews leases and abandons tasks whose lease was lost
+func (r *Runner) heartbeat(ctx context.Context) {
+	r.worker.CurrentTasks = r.activeTasks()
+	r.worker.LastHeartbeat = time.Now()
+
+	resp, err := r.client.Heartbeat(ctx, r.worker)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to send worker heartbeat")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, taskID := range resp.Lost {
+		if cancel, ok := r.active[taskID]; ok {
+			log.Warn().Str("task_id", taskID).Msg("Task lease lost, abandoning task")
+			cancel()
+		}
+	}
+}
+
+// loop leases jobs one at a time until ctx is done
+func (r *Runner) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		resp, err := r.client.Lease(ctx, r.worker.ID)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				log.Warn().Err(err).Msg("Failed to lease task")
+			}
+		case resp.Lease != nil:
+			r.process(ctx, resp)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(r.config.PollInterval):
+		}
+	}
+}
+
+// process generates the PDFs of a leased job and reports the outcome
+func (r *Runner) process(ctx context.Context, resp *LeaseResponse) {
+	lease := resp.Lease
+	logger := log.With().Str("task_id", lease.TaskID).Int("attempt", lease.Attempt).Logger()
+	logger.Info().Msg("Processing leased PDF task")
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r.track(lease.TaskID, cancel)
+	defer r.untrack(lease.TaskID)
+
+	metadata := lease.Metadata
+	metadata.TaskID = lease.TaskID
+	if r.config.RootFolder != "" {
+		metadata.RootFolder = r.config.RootFolder
+	}
+
+	// Same throttling as local workers: report on stage change, otherwise once per second
+	var lastUpdate time.Time
+	var lastStage string
+	var transactions int
+	onProgress := func(stage string, current, total int) {
+		transactions = total
+		now := time.Now()
+		if stage == lastStage && now.Sub(lastUpdate) < time.Second {
+			return
+		}
+		lastUpdate, lastStage = now, stage
+
+		progressCtx, cancelProgress := context.WithTimeout(taskCtx, progressTimeout)
+		defer cancelProgress()
+		err := r.client.Progress(progressCtx, lease.TaskID, r.worker.ID, stage, current, total)
+		if errors.Is(err, ports.ErrLeaseLost) {
+			cancel()
+		} else if err != nil {
+			logger.Debug().Err(err).Msg("Failed to report progress")
+		}
+	}
+
+	start := time.Now()
+	// Dates of a range share the CPUs with the other jobs of this node, not of the API's worker
+	settings := make(map[string]string, len(resp.Settings)+1)
+	for key, value := range resp.Settings {
+		settings[key] = value
+	}
+	settings[domain.SettingQueueConcurrency] = strconv.Itoa(r.config.Concurrency)
+	if r.config.DataSourcePassword != "" {
+		// Settings hold the password encrypted
+		if encrypted, err := utils.Encrypt(r.config.DataSourcePassword); err == nil {
+			settings[domain.SettingDataSourcePassword] = encrypted
+		} else {
+			logger.Warn().Err(err).Msg("Failed to encrypt data source password")
+		}
+	}
+	snapshot := generator.NewSnapshot(settings, resp.Gates)
+
+	// Leases may move between nodes, so chunks are not resumed
+	output, _, err := generator.GenerateMultiDatePDF(taskCtx, metadata, snapshot, onProgress, nil)
+	paths := splitPaths(output)
+	defer removeFiles(output)
+
+	switch {
+	case ctx.Err() != nil:
+		logger.Info().Msg("Worker stopping, task left for another worker")
+		return
+	case taskCtx.Err() != nil:
+		logger.Warn().Msg("Task abandoned after its lease was lost")
+		return
+	case err != nil:
+		code := generator.ErrorCode(err)
+		logger.Error().Err(err).Str("error_code", string(code)).Msg("PDF generation failed")
+		metrics.TaskFailed(start, string(code))
+		status, failErr := r.client.Fail(ctx, lease.TaskID, r.worker.ID, code, err.Error())
+		if failErr != nil {
+			logger.Warn().Err(failErr).Msg("Failed to report task failure")
+			return
+		}
+		logger.Info().Str("status", string(status)).Msg("Task failure reported")
+		return
+	}
+
+	for attempt := 1; attempt <= uploadAttempts; attempt++ {
+		err = r.client.Complete(ctx, lease.TaskID, r.worker.ID, paths)
+		if err == nil || errors.Is(err, ports.ErrLeaseLost) || ctx.Err() != nil {
+			break
+		}
+		logger.Warn().Err(err).Int("attempt", attempt).Msg("Failed to upload output")
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("Output upload failed, task left for another worker")
+		return
+	}
+	metrics.TaskCompleted(start, transactions)
+	logger.Info().Int("files", len(paths)).Msg("PDF task completed and uploaded")
+}
+
+func (r *Runner) track(taskID string, cancel context.CancelFunc) {
+	r.mu.Lock()
+	r.active[taskID] = cancel
+	r.mu.Unlock()
+}
+
+func (r *Runner) untrack(taskID string) {
+	r.mu.Lock()
+	delete(r.active, taskID)
+	r.mu.Unlock()
+}
+
+func (r *Runner) activeTasks() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.active))
+	for id := range r.active {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// splitPaths splits the comma-separated output of multi-date tasks
+func splitPaths(output string) []string {
+	var paths []string
+	for _, p := range strings.Split(output, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// removeFiles deletes local outputs once they were uploaded or abandoned
+func removeFiles(output string) {
+	if err := generator.RemoveOutputs(output); err != nil {
+		log.Warn().Err(err).Str("output", output).Msg("Failed to remove local output")
+	}
+}
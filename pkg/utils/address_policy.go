@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrAddressNotAllowed is returned for destinations resolving to loopback, private or link-local addresses
+var ErrAddressNotAllowed = errors.New("address is not public")
+
+// AddressPolicy decides which hosts outgoing requests such as webhooks may reach. Public addresses are
+// always allowed, others only when listed.
+type AddressPolicy struct {
+	hosts []string     // Host names allowed whatever they resolve to
+	nets  []*net.IPNet // Addresses allowed although not public
+}
+
+// ParseAddressPolicy parses a comma or newline separated list of host names, IP addresses and CIDR ranges
+func ParseAddressPolicy(value string) (AddressPolicy, error) {
+	var policy AddressPolicy
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case strings.Contains(entry, "/"):
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return AddressPolicy{}, fmt.Errorf("invalid CIDR range %q", entry)
+			}
+			policy.nets = append(policy.nets, ipNet)
+		case net.ParseIP(entry) != nil:
+			ip := net.ParseIP(entry)
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			policy.nets = append(policy.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		default:
+			policy.hosts = append(policy.hosts, entry)
+		}
+	}
+	return policy, nil
+}
+
+// allowsHost checks if the host name is listed
+func (p AddressPolicy) allowsHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range p.hosts {
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsIP checks if the address is public or listed
+func (p AddressPolicy) allowsIP(ip net.IP) bool {
+	for _, ipNet := range p.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast())
+}
+
+// CheckURL resolves the host of the URL and checks that every address it resolves to is allowed
+func (p AddressPolicy) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if p.allowsHost(host) {
+		return nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !p.allowsIP(ip) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrAddressNotAllowed, host, ip)
+		}
+	}
+	return nil
+}
+
+// Client returns an HTTP client that checks the address of every connection it opens, including
+// those of redirects, so a host resolving to another address after CheckURL is still refused
+func (p AddressPolicy) Client() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	checked := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !p.allowsIP(ip) {
+				return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // The proxy address would be checked instead of the destination
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil && p.allowsHost(host) {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return checked.DialContext(ctx, network, address)
+	}
+	return &http.Client{Transport: transport}
+}
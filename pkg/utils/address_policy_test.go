@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAddressPolicy(t *testing.T) {
+	policy, err := ParseAddressPolicy("hooks.internal, 10.0.5.0/24\n192.168.1.7")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hooks.internal"}, policy.hosts)
+	assert.Len(t, policy.nets, 2)
+
+	_, err = ParseAddressPolicy("10.0.5.0/33")
+	assert.Error(t, err)
+}
+
+func TestAddressPolicy_CheckURL(t *testing.T) {
+	ctx := context.Background()
+	var strict AddressPolicy
+	for _, rawURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://10.1.2.3/hook",
+		"http://192.168.1.7/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		assert.ErrorIs(t, strict.CheckURL(ctx, rawURL), ErrAddressNotAllowed, rawURL)
+	}
+	assert.NoError(t, strict.CheckURL(ctx, "https://93.184.215.14/hook"))
+
+	// Listed addresses and host names may be reached
+	policy, err := ParseAddressPolicy("10.0.0.0/8, 192.168.1.7, hooks.internal")
+	assert.NoError(t, err)
+	assert.NoError(t, policy.CheckURL(ctx, "http://10.1.2.3/hook"))
+	assert.NoError(t, policy.CheckURL(ctx, "http://192.168.1.7/hook"))
+	assert.NoError(t, policy.CheckURL(ctx, "http://hooks.internal/hook"))
+	assert.ErrorIs(t, policy.CheckURL(ctx, "http://192.168.1.8/hook"), ErrAddressNotAllowed)
+}
+
+func TestAddressPolicy_Client(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// The address is checked when connecting
+	var strict AddressPolicy
+	_, err := strict.Client().Get(server.URL)
+	assert.ErrorIs(t, err, ErrAddressNotAllowed)
+
+	policy, err := ParseAddressPolicy("127.0.0.1")
+	assert.NoError(t, err)
+	resp, err := policy.Client().Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -45,6 +45,18 @@ func HashSHA256(data string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// WorkerSecret returns the secret shared by the API and worker processes to sign internal requests,
+// empty when neither WORKER_SECRET nor HMAC_SECRET is set
+func WorkerSecret() string {
+	if secret := os.Getenv("WORKER_SECRET"); secret != "" {
+		return secret
+	}
+	if secret := os.Getenv("HMAC_SECRET"); secret != "" {
+		return secret
+	}
+	return ""
+}
+
 // GenerateHMAC generates HMAC-SHA256 signature
 func GenerateHMAC(data, secret string) string {
 	h := hmac.New(sha256.New, []byte(secret))